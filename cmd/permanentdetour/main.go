@@ -0,0 +1,32 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+// Command permanentdetour is a tiny web service which redirects Voyager Web OPAC requests to Primo URLs.
+package main
+
+import "github.com/cu-library/permanentdetour/server"
+
+// Version information, which should be overwritten when building using ldflags.
+var (
+	version = "devel"
+	commit  = "unknown"
+	date    = "unknown"
+)
+
+// Institution defaults of -primo and -vid, which are empty unless set when building an institution's
+// release using ldflags, like -X main.defaultPrimo=ocul-qu -X main.defaultVID=01OCUL_QU:QU_DEFAULT.
+var (
+	defaultPrimo = ""
+	defaultVID   = ""
+)
+
+func main() {
+	server.Main(server.Build{
+		Version:      version,
+		Commit:       commit,
+		Date:         date,
+		DefaultPrimo: defaultPrimo,
+		DefaultVID:   defaultVID,
+	})
+}
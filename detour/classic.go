@@ -0,0 +1,29 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package detour
+
+import (
+	"net/url"
+	"strings"
+)
+
+// ClassicPath is the path of requests to the classic WebVoyage CGI, which the /vwebv/ catalogue replaced,
+// like /cgi-bin/Pwebrecon.cgi?BBID=651520.
+const ClassicPath string = "/cgi-bin/Pwebrecon.cgi"
+
+// ClassicQuery returns the query of the catalogue link which is equivalent to the query of a link to the classic
+// WebVoyage CGI, and reports whether it's a link to a record. Records are linked by their BBID, and searches by
+// Search_Arg and Search_Code, whose browse codes, like NAME_ and CALL_, end in an underscore.
+func ClassicQuery(q url.Values) (url.Values, bool) {
+	if q.Has("BBID") {
+		return url.Values{"bibId": {q.Get("BBID")}}, true
+	}
+	converted := url.Values{}
+	if q.Get("Search_Arg") != "" {
+		converted.Set("searchArg", q.Get("Search_Arg"))
+		converted.Set("searchCode", strings.TrimSuffix(q.Get("Search_Code"), "_"))
+	}
+	return converted, false
+}
@@ -0,0 +1,39 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package detour
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestClassicQuery(t *testing.T) {
+	var tests = []struct {
+		request  string
+		record   bool
+		expected string
+	}{
+		{"/cgi-bin/Pwebrecon.cgi?BBID=651520", true, "bibId=651520"},
+		{"/cgi-bin/Pwebrecon.cgi?v1=1&BBID=", true, "bibId="},
+		{"/cgi-bin/Pwebrecon.cgi?DB=local&Search_Arg=hamlet&Search_Code=TALL&CNT=50", false, "searchArg=hamlet&searchCode=TALL"},
+		{"/cgi-bin/Pwebrecon.cgi?DB=local&Search_Arg=shakespeare&Search_Code=NAME_&CNT=50", false, "searchArg=shakespeare&searchCode=NAME"},
+		{"/cgi-bin/Pwebrecon.cgi?DB=local&Search_Arg=PR2807&Search_Code=CALL_", false, "searchArg=PR2807&searchCode=CALL"},
+		{"/cgi-bin/Pwebrecon.cgi?DB=local&Search_Arg=hamlet", false, "searchArg=hamlet&searchCode="},
+		{"/cgi-bin/Pwebrecon.cgi?DB=local&PAGE=First", false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.request, func(t *testing.T) {
+			u, err := url.Parse(tt.request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			q, record := ClassicQuery(u.Query())
+			if record != tt.record || q.Encode() != tt.expected {
+				t.Fatalf("ClassicQuery(\"%v\") returned \"%v\", %v, not \"%v\", %v", tt.request, q.Encode(), record, tt.expected, tt.record)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+// Package detour translates links to a Voyager Web OPAC into links to Primo VE.
+//
+// The translations update a Primo URL, like https://ocul-qu.primo.exlibrisgroup.com/discovery/search,
+// with the path and query of the Primo page which best matches the Voyager page. Setting the vid
+// parameter is left to the caller, so the same translations can be used for any Primo view.
+package detour
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+const (
+	// PrimoDomain is the domain at which Primo instances are hosted.
+	PrimoDomain string = "primo.exlibrisgroup.com"
+
+	// RecordPrefix is the prefix of the path of requests to catalogues for the permalink of a record.
+	RecordPrefix string = "/vwebv/holdingsInfo"
+
+	// PatronInfoPrefix2 is the prefix of the path of requests to catalogues for the patron login form.
+	PatronInfoPrefix2 string = "/vwebv/login"
+
+	// PatronInfoPrefix is the prefix of the path of requests to catalogues for the patron's account.
+	PatronInfoPrefix string = "/vwebv/my"
+
+	// SearchPrefix is the prefix of the path of requests to catalogues for search results.
+	SearchPrefix string = "/vwebv/search"
+
+	// LoginPath is the path of the Primo login page, which patron requests are redirected to.
+	LoginPath string = "/discovery/login"
+
+	// DefaultSearchTab is the Primo tab of search redirects.
+	DefaultSearchTab string = "Everything"
+
+	// DefaultSearchScope is the Primo search scope of search redirects.
+	DefaultSearchScope string = "MyInst_and_CI"
+)
+
+// RecordRedirect updates redirectTo to the correct Primo record URL for the bibID requested in the query
+// of a link to a record, found with lookup. It returns the bibID and reports whether it was found in the map,
+// or returns an error if the bibID is invalid.
+func RecordRedirect(redirectTo *url.URL, q url.Values, lookup func(uint32) (uint64, bool)) (uint32, bool, error) {
+	bibID64, err := strconv.ParseUint(q.Get("bibId"), 10, 32)
+	if err != nil {
+		return 0, false, err
+	}
+	bibID := uint32(bibID64)
+	exlID, present := lookup(bibID)
+	if !present {
+		return bibID, false, nil
+	}
+	redirectTo.Path = "/discovery/fulldisplay"
+	SetParam(redirectTo, "docid", fmt.Sprintf("alma%v", exlID))
+	return bibID, true, nil
+}
+
+// SearchAuthorIndexPrefix string = "/vwebv/search?searchArg=XXX&searchCode=NAME"
+// SearchCallNumberIndexPrefix string = "/vwebv/search?searchArg=XXX&searchCode=CALL"
+// SearchTitleIndexPrefix string = "/vwebv/search?searchArg=XXX&searchCode=T"
+// SearchJournalIndexPrefix string = "/vwebv/search?searchArg=XXX&searchCode=JALL"
+
+// SearchRedirect updates redirectTo to an approximate Primo URL for the search in the query of a link to search results.
+// It returns the branch taken, the searchCode or the parameter searched, for the rule hit counters.
+func SearchRedirect(redirectTo *url.URL, q url.Values) string {
+	SetParam(redirectTo, "tab", DefaultSearchTab)
+	SetParam(redirectTo, "search_scope", DefaultSearchScope)
+
+	if q.Get("searchArg") != "" {
+		switch q.Get("searchCode") {
+		case "TKEY^":
+			SetParam(redirectTo, "query", fmt.Sprintf("title,contains,%v", q.Get("searchArg")))
+			return "TKEY^"
+		case "TALL":
+			SetParam(redirectTo, "query", fmt.Sprintf("title,contains,%v", q.Get("searchArg")))
+			return "TALL"
+		case "NAME":
+			redirectTo.Path = "/discovery/browse"
+			SetParam(redirectTo, "browseScope", "author")
+			SetParam(redirectTo, "browseQuery", q.Get("searchArg"))
+			return "NAME"
+		case "CALL":
+			redirectTo.Path = "/discovery/browse"
+			SetParam(redirectTo, "browseScope", "callnumber.0")
+			SetParam(redirectTo, "browseQuery", q.Get("searchArg"))
+			return "CALL"
+		case "JALL":
+			redirectTo.Path = "/discovery/jsearch"
+			SetParam(redirectTo, "tab", "jsearch_slot")
+			SetParam(redirectTo, "query", fmt.Sprintf("any,contains,%v", q.Get("searchArg")))
+			return "JALL"
+		default:
+			SetParam(redirectTo, "query", fmt.Sprintf("any,contains,%v", q.Get("searchArg")))
+			return "other"
+		}
+	} else if q.Get("SEARCH") != "" {
+		SetParam(redirectTo, "query", fmt.Sprintf("any,contains,%v", q.Get("SEARCH")))
+		return "SEARCH"
+	}
+	return "empty"
+}
+
+// SetParam is a helper function which sets a parameter in the query of a url.
+func SetParam(redirectTo *url.URL, param, value string) {
+	q := redirectTo.Query()
+	q.Set(param, value)
+	redirectTo.RawQuery = q.Encode()
+}
+
+// AddParam is a helper function which adds a parameter in the query of a url.
+func AddParam(redirectTo *url.URL, param, value string) {
+	q := redirectTo.Query()
+	q.Add(param, value)
+	redirectTo.RawQuery = q.Encode()
+}
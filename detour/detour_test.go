@@ -0,0 +1,78 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package detour
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestRecordRedirect(t *testing.T) {
+	lookup := func(bibID uint32) (uint64, bool) {
+		exlID, present := map[uint32]uint64{651520: 996515203405158}[bibID]
+		return exlID, present
+	}
+	var tests = []struct {
+		query    string
+		bibID    uint32
+		found    bool
+		invalid  bool
+		expected string
+	}{
+		{"bibId=651520", 651520, true, false, "https://ocul-qu.primo.exlibrisgroup.com/discovery/fulldisplay?docid=alma996515203405158"},
+		{"bibId=651521", 651521, false, false, "https://ocul-qu.primo.exlibrisgroup.com/discovery/search"},
+		{"bibId=invalid", 0, false, true, "https://ocul-qu.primo.exlibrisgroup.com/discovery/search"},
+		{"", 0, false, true, "https://ocul-qu.primo.exlibrisgroup.com/discovery/search"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			redirectTo := &url.URL{Scheme: "https", Host: "ocul-qu." + PrimoDomain, Path: "/discovery/search"}
+			bibID, found, err := RecordRedirect(redirectTo, q, lookup)
+			if bibID != tt.bibID || found != tt.found || (err != nil) != tt.invalid {
+				t.Fatalf("RecordRedirect(%q) returned %v, %v, %v, not %v, %v.", tt.query, bibID, found, err, tt.bibID, tt.found)
+			}
+			if redirectTo.String() != tt.expected {
+				t.Fatalf("RecordRedirect(%q) redirected to %v, not %v.", tt.query, redirectTo, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSearchRedirect(t *testing.T) {
+	var tests = []struct {
+		query    string
+		branch   string
+		expected string
+	}{
+		{"searchArg=origin+of+species&searchCode=TALL&searchType=1", "TALL",
+			"/discovery/search?query=title%2Ccontains%2Corigin+of+species&search_scope=MyInst_and_CI&tab=Everything"},
+		{"searchArg=darwin&searchCode=NAME", "NAME",
+			"/discovery/browse?browseQuery=darwin&browseScope=author&search_scope=MyInst_and_CI&tab=Everything"},
+		{"searchArg=nature&searchCode=JALL", "JALL",
+			"/discovery/jsearch?query=any%2Ccontains%2Cnature&search_scope=MyInst_and_CI&tab=jsearch_slot"},
+		{"searchArg=darwin&searchCode=GKEY%5E*", "other",
+			"/discovery/search?query=any%2Ccontains%2Cdarwin&search_scope=MyInst_and_CI&tab=Everything"},
+		{"SEARCH=darwin", "SEARCH",
+			"/discovery/search?query=any%2Ccontains%2Cdarwin&search_scope=MyInst_and_CI&tab=Everything"},
+		{"", "empty", "/discovery/search?search_scope=MyInst_and_CI&tab=Everything"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			redirectTo := &url.URL{Path: "/discovery/search"}
+			branch := SearchRedirect(redirectTo, q)
+			if branch != tt.branch || redirectTo.String() != tt.expected {
+				t.Fatalf("SearchRedirect(%q) returned %v and redirected to %v, not %v and %v.", tt.query, branch, redirectTo, tt.branch, tt.expected)
+			}
+		})
+	}
+}
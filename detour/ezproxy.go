@@ -0,0 +1,103 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package detour
+
+import (
+	"net"
+	"net/url"
+	"strings"
+)
+
+const (
+	// EZproxyLoginPath is the path of EZproxy starting point URLs, which wrap the target URL in a url or qurl parameter.
+	EZproxyLoginPath string = "/login"
+
+	// MaxProxyUnwrapDepth is the maximum number of nested proxy prefixes which are unwrapped.
+	MaxProxyUnwrapDepth int = 5
+)
+
+// UnwrapProxiedURL returns the path and query of the catalogue URL embedded in any EZproxy starting point URLs
+// in a request for u on host, and whether the request was wrapped. Only requests to one of the proxy hosts are
+// unwrapped, so a /login path on the catalogue's own host is translated as it is. Requests to a proxy-by-hostname
+// vhost already have the catalogue path, and need no unwrapping.
+func UnwrapProxiedURL(host string, u *url.URL, proxyHosts []string) (*url.URL, bool) {
+	if len(proxyHosts) == 0 || !IsProxyHost(host, proxyHosts) {
+		return u, false
+	}
+	unwrapped := u
+	for i := 0; i < MaxProxyUnwrapDepth; i++ {
+		embedded, ok := embeddedProxyURL(unwrapped)
+		if !ok {
+			break
+		}
+		unwrapped = embedded
+		// The embedded URL may itself be a starting point URL on one of the proxy hosts.
+		if unwrapped.Host != "" && !IsProxyHost(unwrapped.Host, proxyHosts) {
+			break
+		}
+	}
+	if unwrapped == u {
+		return u, false
+	}
+	return &url.URL{Path: unwrapped.Path, RawPath: unwrapped.RawPath, RawQuery: unwrapped.RawQuery}, true
+}
+
+// embeddedProxyURL parses the target URL from an EZproxy starting point URL.
+func embeddedProxyURL(u *url.URL) (*url.URL, bool) {
+	if strings.TrimSuffix(u.Path, "/") != EZproxyLoginPath {
+		return nil, false
+	}
+	q := u.Query()
+	target := q.Get("qurl")
+	if target == "" {
+		// The url parameter is conventionally the last in the query and unencoded,
+		// so everything after url= is the target, including any ampersands.
+		index := strings.Index(u.RawQuery, "url=")
+		for index > 0 && u.RawQuery[index-1] != '&' {
+			next := strings.Index(u.RawQuery[index+1:], "url=")
+			if next == -1 {
+				index = -1
+				break
+			}
+			index += next + 1
+		}
+		if index == -1 {
+			return nil, false
+		}
+		target = u.RawQuery[index+len("url="):]
+		// Some links encode the target anyway.
+		if !strings.Contains(target, "://") {
+			unescaped, err := url.QueryUnescape(target)
+			if err == nil {
+				target = unescaped
+			}
+		}
+	}
+	if target == "" {
+		return nil, false
+	}
+	embedded, err := url.Parse(target)
+	if err != nil {
+		return nil, false
+	}
+	return embedded, true
+}
+
+// IsProxyHost reports whether host, which may include a port, is one of the proxy hosts
+// or a proxy-by-hostname vhost below one of them.
+func IsProxyHost(host string, proxyHosts []string) bool {
+	hostname, _, err := net.SplitHostPort(host)
+	if err == nil {
+		host = hostname
+	}
+	host = strings.ToLower(host)
+	for _, proxyHost := range proxyHosts {
+		proxyHost = strings.ToLower(proxyHost)
+		if host == proxyHost || strings.HasSuffix(host, "."+proxyHost) {
+			return true
+		}
+	}
+	return false
+}
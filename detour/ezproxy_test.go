@@ -0,0 +1,65 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package detour
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestUnwrapProxiedURL(t *testing.T) {
+	proxyHosts := []string{"proxy.queensu.ca"}
+	var tests = []struct {
+		host     string
+		request  string
+		expected string
+	}{
+		{"catalogue.library.queensu.ca", "/vwebv/holdingsInfo?bibId=1", "/vwebv/holdingsInfo?bibId=1"},
+		{"catalogue.library.queensu.ca", "/login", "/login"},
+		// Starting point URLs are only unwrapped on the proxy hosts.
+		{"catalogue.library.queensu.ca", "/login?url=https://catalogue.library.queensu.ca/vwebv/holdingsInfo?bibId=1", "/login?url=https://catalogue.library.queensu.ca/vwebv/holdingsInfo?bibId=1"},
+		{"proxy.queensu.ca", "/login?url=https://catalogue.library.queensu.ca/vwebv/holdingsInfo?bibId=1", "/vwebv/holdingsInfo?bibId=1"},
+		{"proxy.queensu.ca", "/login?url=https://catalogue.library.queensu.ca/vwebv/search?searchArg=spiders&searchCode=NAME", "/vwebv/search?searchArg=spiders&searchCode=NAME"},
+		{"proxy.queensu.ca", "/login?url=https%3A%2F%2Fcatalogue.library.queensu.ca%2Fvwebv%2FholdingsInfo%3FbibId%3D1", "/vwebv/holdingsInfo?bibId=1"},
+		{"proxy.queensu.ca", "/login?qurl=https%3A%2F%2Fcatalogue.library.queensu.ca%2Fvwebv%2FholdingsInfo%3FbibId%3D1", "/vwebv/holdingsInfo?bibId=1"},
+		{"proxy.queensu.ca", "/login?url=https://proxy.queensu.ca/login?url=https://catalogue.library.queensu.ca/vwebv/my", "/vwebv/my"},
+		{"catalogue-library-queensu-ca.proxy.queensu.ca", "/vwebv/holdingsInfo?bibId=1", "/vwebv/holdingsInfo?bibId=1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.request, func(t *testing.T) {
+			u, err := url.Parse(tt.request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			unwrapped, _ := UnwrapProxiedURL(tt.host, u, proxyHosts)
+			if unwrapped.String() != tt.expected {
+				t.Fatalf("UnwrapProxiedURL(\"%v\", \"%v\") returned \"%v\", not \"%v\"", tt.host, tt.request, unwrapped, tt.expected)
+			}
+		})
+	}
+}
+
+func TestIsProxyHost(t *testing.T) {
+	proxyHosts := []string{"proxy.queensu.ca"}
+	var tests = []struct {
+		host  string
+		proxy bool
+	}{
+		{"proxy.queensu.ca", true},
+		{"PROXY.queensu.ca:443", true},
+		{"catalogue-library-queensu-ca.proxy.queensu.ca", true},
+		{"notproxy.queensu.ca", false},
+		{"catalogue.library.queensu.ca", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			if IsProxyHost(tt.host, proxyHosts) != tt.proxy {
+				t.Fatalf("IsProxyHost(\"%v\") returned %v, not %v", tt.host, !tt.proxy, tt.proxy)
+			}
+		})
+	}
+}
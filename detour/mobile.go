@@ -0,0 +1,43 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package detour
+
+import (
+	"net/url"
+	"strings"
+)
+
+// DesktopPrefix is the prefix of the path of requests to the desktop WebVoyage interface.
+const DesktopPrefix string = "/vwebv/"
+
+// MobilePrefixes are the prefixes of the path of requests to the mobile WebVoyage interface.
+var MobilePrefixes = []string{"/vwebv/m/", "/vwebv/mobile/", "/m/vwebv/"}
+
+// MobileSkinParams are the query parameters which select the mobile WebVoyage skin.
+var MobileSkinParams = []string{"sk", "skin"}
+
+// NormalizeMobileURL returns the path and query of u with mobile WebVoyage paths rewritten to their desktop
+// equivalents, and the mobile skin parameters removed, so the same rules can be used to translate them, and whether
+// u was for the mobile interface. If it wasn't, u is returned unchanged.
+func NormalizeMobileURL(u *url.URL) (*url.URL, bool) {
+	normalized := &url.URL{Path: u.Path, RawQuery: u.RawQuery}
+	for _, prefix := range MobilePrefixes {
+		if strings.HasPrefix(normalized.Path, prefix) {
+			normalized.Path = DesktopPrefix + normalized.Path[len(prefix):]
+			break
+		}
+	}
+	q := normalized.Query()
+	for _, param := range MobileSkinParams {
+		if strings.HasPrefix(strings.ToLower(q.Get(param)), "mobile") {
+			q.Del(param)
+			normalized.RawQuery = q.Encode()
+		}
+	}
+	if normalized.Path == u.Path && normalized.RawQuery == u.RawQuery {
+		return u, false
+	}
+	return normalized, true
+}
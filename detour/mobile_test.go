@@ -0,0 +1,39 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package detour
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestNormalizeMobileURL(t *testing.T) {
+	var tests = []struct {
+		request  string
+		expected string
+	}{
+		{"/vwebv/holdingsInfo?bibId=1", "/vwebv/holdingsInfo?bibId=1"},
+		{"/vwebv/m/holdingsInfo?bibId=1", "/vwebv/holdingsInfo?bibId=1"},
+		{"/vwebv/mobile/search?searchArg=spiders&searchCode=NAME", "/vwebv/search?searchArg=spiders&searchCode=NAME"},
+		{"/m/vwebv/my", "/vwebv/my"},
+		{"/vwebv/holdingsInfo?bibId=1&sk=mobile", "/vwebv/holdingsInfo?bibId=1"},
+		{"/vwebv/search?searchArg=spiders&sk=mobile_en_US", "/vwebv/search?searchArg=spiders"},
+		{"/vwebv/search?searchArg=spiders&sk=en_US", "/vwebv/search?searchArg=spiders&sk=en_US"},
+		{"/vwebv/map", "/vwebv/map"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.request, func(t *testing.T) {
+			u, err := url.Parse(tt.request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			normalized, _ := NormalizeMobileURL(u)
+			if normalized.String() != tt.expected {
+				t.Fatalf("NormalizeMobileURL(\"%v\") returned \"%v\", not \"%v\"", tt.request, normalized, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package detour
+
+import (
+	"net/url"
+	"strings"
+)
+
+// OpenURLVersion is the url_ver and ctx_ver value of OpenURL 1.0 (Z39.88-2004) context objects.
+const OpenURLVersion string = "Z39.88-2004"
+
+// IsOpenURL reports whether the query contains an OpenURL 1.0 context object.
+func IsOpenURL(q url.Values) bool {
+	if q.Get("url_ver") == OpenURLVersion || q.Get("ctx_ver") == OpenURLVersion {
+		return true
+	}
+	for key := range q {
+		if strings.HasPrefix(key, "rft.") || strings.HasPrefix(key, "rft_") {
+			return true
+		}
+	}
+	return false
+}
+
+// OpenURLRedirect updates redirectTo to the Primo OpenURL service endpoint, passing along the context object.
+func OpenURLRedirect(redirectTo *url.URL, q url.Values, vid string) {
+	redirectTo.Path = "/discovery/openurl"
+	for key, values := range q {
+		for _, value := range values {
+			AddParam(redirectTo, key, value)
+		}
+	}
+	// The institution code is the part of the vid before the colon.
+	SetParam(redirectTo, "institution", strings.SplitN(vid, ":", 2)[0])
+}
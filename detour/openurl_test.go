@@ -0,0 +1,54 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package detour
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestIsOpenURL(t *testing.T) {
+	var tests = []struct {
+		query   string
+		openURL bool
+	}{
+		{"", false},
+		{"searchArg=spiders&searchCode=GKEY^", false},
+		{"url_ver=Z39.88-2004", true},
+		{"ctx_ver=Z39.88-2004&rft_val_fmt=info:ofi/fmt:kev:mtx:journal", true},
+		{"url_ver=Z39.88-2003", false},
+		{"rft.issn=0028-0836", true},
+		{"rft_id=info:doi/10.1038/171737a0", true},
+		{"rfr_id=info:sid/example", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if IsOpenURL(q) != tt.openURL {
+				t.Fatalf("IsOpenURL(\"%v\") returned %v, not %v", tt.query, !tt.openURL, tt.openURL)
+			}
+		})
+	}
+}
+
+func TestOpenURLRedirect(t *testing.T) {
+	q, err := url.ParseQuery("url_ver=Z39.88-2004&rft.issn=0028-0836&rft.au=Watson&rft.au=Crick")
+	if err != nil {
+		t.Fatal(err)
+	}
+	redirectTo := &url.URL{}
+	OpenURLRedirect(redirectTo, q, "01OCUL_QU:QU_DEFAULT")
+	if redirectTo.Path != "/discovery/openurl" {
+		t.Fatalf("OpenURLRedirect set path to \"%v\", not \"/discovery/openurl\"", redirectTo.Path)
+	}
+	expected := "institution=01OCUL_QU&rft.au=Watson&rft.au=Crick&rft.issn=0028-0836&url_ver=Z39.88-2004"
+	if redirectTo.RawQuery != expected {
+		t.Fatalf("OpenURLRedirect set query to \"%v\", not \"%v\"", redirectTo.RawQuery, expected)
+	}
+}
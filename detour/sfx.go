@@ -0,0 +1,37 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package detour
+
+import (
+	"net/url"
+	"strings"
+)
+
+const (
+	// SFXPrefix is the prefix of the path of requests to SFX instances, like /sfxlcl41 or /sfx_local.
+	SFXPrefix string = "/sfx"
+
+	// SFXHostPrefix is the prefix of the host of SFX servers, like sfx.library.queensu.ca.
+	SFXHostPrefix string = "sfx."
+)
+
+// IsSFX reports whether a request for the host and path is for an SFX menu.
+func IsSFX(host, path string) bool {
+	return strings.HasPrefix(path, SFXPrefix) || strings.HasPrefix(strings.ToLower(host), SFXHostPrefix)
+}
+
+// SFXRedirect updates redirectTo to the Primo OpenURL service endpoint with the context object in the query of
+// an SFX request. Both OpenURL 0.1 and 1.0 context objects are understood by the Alma link resolver.
+func SFXRedirect(redirectTo *url.URL, q url.Values, vid string) {
+	openURL := url.Values{}
+	for key, values := range q {
+		// Parameters like sfx.response_type only control the SFX menu.
+		if strings.HasPrefix(key, "sfx.") {
+			continue
+		}
+		openURL[key] = values
+	}
+	OpenURLRedirect(redirectTo, openURL, vid)
+}
@@ -0,0 +1,47 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package detour
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestSFXRedirect(t *testing.T) {
+	var tests = []struct {
+		host     string
+		request  string
+		sfx      bool
+		expected string
+	}{
+		{"catalogue.library.queensu.ca", "/vwebv/search?searchArg=spiders", false, ""},
+		{"sfx.library.queensu.ca", "/sfxlcl41?sid=google&genre=article&issn=0028-0836&spage=737",
+			true, "genre=article&institution=01OCUL_QU&issn=0028-0836&sid=google&spage=737"},
+		{"SFX.library.queensu.ca", "/?url_ver=Z39.88-2004&rft.issn=0028-0836&sfx.ignore_date_threshold=1",
+			true, "institution=01OCUL_QU&rft.issn=0028-0836&url_ver=Z39.88-2004"},
+		{"catalogue.library.queensu.ca", "/sfx_local?issn=0028-0836&sfx.response_type=simplexml",
+			true, "institution=01OCUL_QU&issn=0028-0836"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.request, func(t *testing.T) {
+			u, err := url.Parse(tt.request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if IsSFX(tt.host, u.Path) != tt.sfx {
+				t.Fatalf("IsSFX(\"%v\", \"%v\") returned %v, not %v", tt.host, u.Path, !tt.sfx, tt.sfx)
+			}
+			if !tt.sfx {
+				return
+			}
+			redirectTo := &url.URL{}
+			SFXRedirect(redirectTo, u.Query(), "01OCUL_QU:QU_DEFAULT")
+			if redirectTo.Path != "/discovery/openurl" || redirectTo.RawQuery != tt.expected {
+				t.Fatalf("SFXRedirect(\"%v%v\") built \"%v\", not \"/discovery/openurl?%v\"", tt.host, tt.request, redirectTo, tt.expected)
+			}
+		})
+	}
+}
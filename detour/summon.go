@@ -0,0 +1,101 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package detour
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// SummonSearchPrefix is the prefix of the path of requests to Summon for search results.
+const SummonSearchPrefix string = "/search"
+
+// IsSummonSearch reports whether a request for the path is for Summon search results. The path is SummonSearchPrefix,
+// or starts with it followed by a slash, so paths like /searchable aren't matched.
+func IsSummonSearch(path string) bool {
+	return path == SummonSearchPrefix || strings.HasPrefix(path, SummonSearchPrefix+"/")
+}
+
+// summonContentTypes maps Summon ContentType facet values to Primo resource type (rtype) facet values.
+var summonContentTypes = map[string]string{
+	"Audio Recording":           "audios",
+	"Book":                      "books",
+	"Book / eBook":              "books",
+	"eBook":                     "books",
+	"Book Chapter":              "book_chapters",
+	"Book Review":               "reviews",
+	"Conference Proceeding":     "conference_proceedings",
+	"Data Set":                  "datasets",
+	"Dissertation":              "dissertations",
+	"Dissertation/Thesis":       "dissertations",
+	"Government Document":       "government_documents",
+	"Image":                     "images",
+	"Journal / eJournal":        "journals",
+	"Journal Article":           "articles",
+	"Magazine Article":          "magazinearticle",
+	"Map":                       "maps",
+	"Music Score":               "scores",
+	"Newspaper Article":         "newspaper_articles",
+	"Reference":                 "reference_entrys",
+	"Report":                    "reports",
+	"Text Resource":             "text_resources",
+	"Trade Publication Article": "articles",
+	"Video Recording":           "videos",
+	"Web Resource":              "websites",
+}
+
+// SummonRedirect updates redirectTo to an approximate Primo URL for the Summon search in the query.
+func SummonRedirect(redirectTo *url.URL, q url.Values) {
+	SetParam(redirectTo, "tab", DefaultSearchTab)
+	SetParam(redirectTo, "search_scope", DefaultSearchScope)
+
+	// Summon accepts the query as q, or s.q in links built by the Summon JavaScript client.
+	query := q.Get("q")
+	if query == "" {
+		query = q.Get("s.q")
+	}
+	if query != "" {
+		SetParam(redirectTo, "query", fmt.Sprintf("any,contains,%v", query))
+	}
+
+	// Facet value filters look like this: ContentType,Journal Article,f
+	// The optional third field is t when the filter is negated.
+	for _, param := range []string{"fvf", "fvf[]", "s.fvf", "s.fvf[]"} {
+		for _, filter := range q[param] {
+			facet, ok := summonFilterToPrimoFacet(filter)
+			if ok {
+				AddParam(redirectTo, "facet", facet)
+			}
+		}
+	}
+}
+
+// summonFilterToPrimoFacet converts a Summon facet value filter to a Primo facet parameter value.
+func summonFilterToPrimoFacet(filter string) (string, bool) {
+	splitFilter := strings.Split(filter, ",")
+	if len(splitFilter) < 2 {
+		return "", false
+	}
+	field, value := splitFilter[0], splitFilter[1]
+	mode := "include"
+	if len(splitFilter) > 2 && splitFilter[2] == "t" {
+		mode = "exclude"
+	}
+	switch field {
+	case "ContentType":
+		rtype, present := summonContentTypes[value]
+		if !present {
+			return "", false
+		}
+		return fmt.Sprintf("rtype,%v,%v", mode, rtype), true
+	case "IsFullText":
+		if value != "true" {
+			return "", false
+		}
+		return fmt.Sprintf("tlevel,%v,online_resources", mode), true
+	}
+	return "", false
+}
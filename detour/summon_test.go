@@ -0,0 +1,69 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package detour
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestSummonRedirect(t *testing.T) {
+	var tests = []struct {
+		request string
+		query   string
+		facets  []string
+	}{
+		{"/search", "", nil},
+		{"/search?q=spiders", "any,contains,spiders", nil},
+		{"/search?s.q=spiders", "any,contains,spiders", nil},
+		{"/search?q=spiders&fvf=ContentType,Book%20%2F%20eBook,f", "any,contains,spiders", []string{"rtype,include,books"}},
+		{"/search?q=spiders&fvf=ContentType,Newspaper%20Article,t", "any,contains,spiders", []string{"rtype,exclude,newspaper_articles"}},
+		{"/search?q=spiders&s.fvf[]=IsFullText,true,f&fvf=ContentType,Map,f", "any,contains,spiders", []string{"rtype,include,maps", "tlevel,include,online_resources"}},
+		{"/search?q=spiders&fvf=ContentType,Unknown,f&fvf=Language,English,f", "any,contains,spiders", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.request, func(t *testing.T) {
+			u, err := url.Parse(tt.request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			redirectTo := &url.URL{}
+			SummonRedirect(redirectTo, u.Query())
+			q := redirectTo.Query()
+			if q.Get("query") != tt.query {
+				t.Fatalf("SummonRedirect(\"%v\") set query to \"%v\", not \"%v\"", tt.request, q.Get("query"), tt.query)
+			}
+			if len(q["facet"]) != len(tt.facets) {
+				t.Fatalf("SummonRedirect(\"%v\") set facets %v, not %v", tt.request, q["facet"], tt.facets)
+			}
+			for i, facet := range tt.facets {
+				if q["facet"][i] != facet {
+					t.Fatalf("SummonRedirect(\"%v\") set facets %v, not %v", tt.request, q["facet"], tt.facets)
+				}
+			}
+		})
+	}
+}
+
+func TestIsSummonSearch(t *testing.T) {
+	var tests = []struct {
+		path     string
+		expected bool
+	}{
+		{"/search", true},
+		{"/search/", true},
+		{"/search/results", true},
+		{"/searchX", false},
+		{"/searchable", false},
+		{"/", false},
+		{"/vwebv/search", false},
+	}
+	for _, tt := range tests {
+		if IsSummonSearch(tt.path) != tt.expected {
+			t.Errorf("IsSummonSearch(\"%v\") returned %v, not %v", tt.path, !tt.expected, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+// Package detourclient is a client for the Permanent Detour lookup API.
+package detourclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	// LookupPath is the path of the lookup API.
+	LookupPath string = "/api/v1/lookup"
+
+	// DefaultMaxRetries is the default number of times a failed request is retried.
+	DefaultMaxRetries int = 3
+
+	// DefaultRetryWait is the default time to wait before the first retry. The wait doubles after each retry.
+	DefaultRetryWait time.Duration = 250 * time.Millisecond
+)
+
+// Result is the result of looking up a bibID.
+type Result struct {
+	BibID uint32 `json:"bibId"`
+	MMSID string `json:"mmsId,omitempty"`
+	Found bool   `json:"found"`
+	URL   string `json:"url,omitempty"`
+}
+
+// Client makes requests to the lookup API of a Permanent Detour server.
+type Client struct {
+	BaseURL    *url.URL      // The URL of the server, like http://localhost:8877.
+	HTTPClient *http.Client  // The HTTP client used to make requests.
+	MaxRetries int           // The number of times a failed request is retried.
+	RetryWait  time.Duration // The time to wait before the first retry.
+}
+
+// APIError is returned when the server responds with an unexpected status.
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("lookup API returned status %v: %v", e.StatusCode, e.Message)
+}
+
+// NewClient returns a Client for the server at baseURL, with the default retry settings.
+func NewClient(baseURL string) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse base URL %v, %w", baseURL, err)
+	}
+	return &Client{
+		BaseURL:    u,
+		HTTPClient: http.DefaultClient,
+		MaxRetries: DefaultMaxRetries,
+		RetryWait:  DefaultRetryWait,
+	}, nil
+}
+
+// Lookup resolves a single bibID. Unmapped bibIDs are not an error; the result's Found field is false.
+func (c *Client) Lookup(ctx context.Context, bibID uint32) (Result, error) {
+	u := c.lookupURL()
+	u.RawQuery = url.Values{"bibId": {strconv.FormatUint(uint64(bibID), 10)}}.Encode()
+	var result Result
+	err := c.do(ctx, http.MethodGet, u, nil, &result, http.StatusOK, http.StatusNotFound)
+	return result, err
+}
+
+// BatchLookup resolves many bibIDs at once. The results are in the same order as bibIDs.
+// The server limits the number of bibIDs in each request.
+func (c *Client) BatchLookup(ctx context.Context, bibIDs []uint32) ([]Result, error) {
+	body, err := json.Marshal(bibIDs)
+	if err != nil {
+		return nil, err
+	}
+	var results []Result
+	err = c.do(ctx, http.MethodPost, c.lookupURL(), body, &results, http.StatusOK)
+	return results, err
+}
+
+// lookupURL returns the URL of the lookup API.
+func (c *Client) lookupURL() *url.URL {
+	return c.BaseURL.ResolveReference(&url.URL{Path: LookupPath})
+}
+
+// do makes a request, retrying network errors and server errors, and decodes the JSON response into v.
+func (c *Client) do(ctx context.Context, method string, u *url.URL, body []byte, v interface{}, okStatuses ...int) error {
+	wait := c.RetryWait
+	var err error
+	for attempt := 0; attempt <= c.MaxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(wait):
+			}
+			wait *= 2
+		}
+		var retry bool
+		retry, err = c.attempt(ctx, method, u, body, v, okStatuses)
+		if !retry {
+			return err
+		}
+	}
+	return err
+}
+
+// attempt makes a single request, and reports whether a failed request should be retried.
+func (c *Client) attempt(ctx context.Context, method string, u *url.URL, body []byte, v interface{}, okStatuses []int) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		// Don't retry when the context is done.
+		return ctx.Err() == nil, err
+	}
+	defer resp.Body.Close()
+	for _, status := range okStatuses {
+		if resp.StatusCode == status {
+			return false, json.NewDecoder(resp.Body).Decode(v)
+		}
+	}
+	apiErr := &APIError{StatusCode: resp.StatusCode}
+	var errorBody struct {
+		Error string `json:"error"`
+	}
+	if json.NewDecoder(io.LimitReader(resp.Body, 4096)).Decode(&errorBody) == nil {
+		apiErr.Message = errorBody.Error
+	}
+	retry := resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusTooManyRequests
+	return retry, apiErr
+}
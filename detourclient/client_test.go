@@ -0,0 +1,113 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package detourclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newTestServer(t *testing.T, failures int) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Method {
+		case http.MethodGet:
+			if r.URL.Query().Get("bibId") == "651520" {
+				json.NewEncoder(w).Encode(Result{BibID: 651520, MMSID: "996515203405158", Found: true})
+				return
+			}
+			if r.URL.Query().Get("bibId") == "1" {
+				w.WriteHeader(http.StatusNotFound)
+				json.NewEncoder(w).Encode(Result{BibID: 1})
+				return
+			}
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "bad bibId"})
+		case http.MethodPost:
+			var bibIDs []uint32
+			json.NewDecoder(r.Body).Decode(&bibIDs)
+			results := []Result{}
+			for _, bibID := range bibIDs {
+				results = append(results, Result{BibID: bibID, Found: bibID == 651520})
+			}
+			json.NewEncoder(w).Encode(results)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestLookup(t *testing.T) {
+	c, err := NewClient(newTestServer(t, 0).URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := c.Lookup(context.Background(), 651520)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Found || result.MMSID != "996515203405158" {
+		t.Fatalf("Lookup(651520) returned %+v", result)
+	}
+	result, err = c.Lookup(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Found {
+		t.Fatalf("Lookup(1) returned %+v", result)
+	}
+	_, err = c.Lookup(context.Background(), 2)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest || apiErr.Message != "bad bibId" {
+		t.Fatalf("Lookup(2) returned %v, not an APIError", err)
+	}
+}
+
+func TestBatchLookup(t *testing.T) {
+	c, err := NewClient(newTestServer(t, 0).URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := c.BatchLookup(context.Background(), []uint32{1, 651520})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].Found || !results[1].Found {
+		t.Fatalf("BatchLookup([1, 651520]) returned %+v", results)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	c, err := NewClient(newTestServer(t, 2).URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.RetryWait = 0
+	_, err = c.Lookup(context.Background(), 651520)
+	if err != nil {
+		t.Fatalf("Lookup should have succeeded after retrying, %v", err)
+	}
+
+	c, err = NewClient(newTestServer(t, 5).URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.RetryWait = 0
+	_, err = c.Lookup(context.Background(), 651520)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("Lookup should have failed after exhausting retries, %v", err)
+	}
+}
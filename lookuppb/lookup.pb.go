@@ -0,0 +1,305 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: lookuppb/lookup.proto
+
+package lookuppb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type LookupRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	BibId         uint32                 `protobuf:"varint,1,opt,name=bib_id,json=bibId,proto3" json:"bib_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LookupRequest) Reset() {
+	*x = LookupRequest{}
+	mi := &file_lookuppb_lookup_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LookupRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LookupRequest) ProtoMessage() {}
+
+func (x *LookupRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_lookuppb_lookup_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LookupRequest.ProtoReflect.Descriptor instead.
+func (*LookupRequest) Descriptor() ([]byte, []int) {
+	return file_lookuppb_lookup_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *LookupRequest) GetBibId() uint32 {
+	if x != nil {
+		return x.BibId
+	}
+	return 0
+}
+
+type LookupResult struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	BibId uint32                 `protobuf:"varint,1,opt,name=bib_id,json=bibId,proto3" json:"bib_id,omitempty"`
+	// The MMS ID, or zero when the bibID isn't mapped.
+	MmsId uint64 `protobuf:"varint,2,opt,name=mms_id,json=mmsId,proto3" json:"mms_id,omitempty"`
+	Found bool   `protobuf:"varint,3,opt,name=found,proto3" json:"found,omitempty"`
+	// The Primo record URL, or empty when the bibID isn't mapped.
+	Url           string `protobuf:"bytes,4,opt,name=url,proto3" json:"url,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LookupResult) Reset() {
+	*x = LookupResult{}
+	mi := &file_lookuppb_lookup_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LookupResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LookupResult) ProtoMessage() {}
+
+func (x *LookupResult) ProtoReflect() protoreflect.Message {
+	mi := &file_lookuppb_lookup_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LookupResult.ProtoReflect.Descriptor instead.
+func (*LookupResult) Descriptor() ([]byte, []int) {
+	return file_lookuppb_lookup_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *LookupResult) GetBibId() uint32 {
+	if x != nil {
+		return x.BibId
+	}
+	return 0
+}
+
+func (x *LookupResult) GetMmsId() uint64 {
+	if x != nil {
+		return x.MmsId
+	}
+	return 0
+}
+
+func (x *LookupResult) GetFound() bool {
+	if x != nil {
+		return x.Found
+	}
+	return false
+}
+
+func (x *LookupResult) GetUrl() string {
+	if x != nil {
+		return x.Url
+	}
+	return ""
+}
+
+type BatchLookupRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	BibIds        []uint32               `protobuf:"varint,1,rep,packed,name=bib_ids,json=bibIds,proto3" json:"bib_ids,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BatchLookupRequest) Reset() {
+	*x = BatchLookupRequest{}
+	mi := &file_lookuppb_lookup_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BatchLookupRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchLookupRequest) ProtoMessage() {}
+
+func (x *BatchLookupRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_lookuppb_lookup_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchLookupRequest.ProtoReflect.Descriptor instead.
+func (*BatchLookupRequest) Descriptor() ([]byte, []int) {
+	return file_lookuppb_lookup_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *BatchLookupRequest) GetBibIds() []uint32 {
+	if x != nil {
+		return x.BibIds
+	}
+	return nil
+}
+
+type BatchLookupResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The results, in the same order as the requested bibIDs.
+	Results       []*LookupResult `protobuf:"bytes,1,rep,name=results,proto3" json:"results,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BatchLookupResponse) Reset() {
+	*x = BatchLookupResponse{}
+	mi := &file_lookuppb_lookup_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BatchLookupResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchLookupResponse) ProtoMessage() {}
+
+func (x *BatchLookupResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_lookuppb_lookup_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchLookupResponse.ProtoReflect.Descriptor instead.
+func (*BatchLookupResponse) Descriptor() ([]byte, []int) {
+	return file_lookuppb_lookup_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *BatchLookupResponse) GetResults() []*LookupResult {
+	if x != nil {
+		return x.Results
+	}
+	return nil
+}
+
+var File_lookuppb_lookup_proto protoreflect.FileDescriptor
+
+const file_lookuppb_lookup_proto_rawDesc = "" +
+	"\n" +
+	"\x15lookuppb/lookup.proto\x12\x12permanentdetour.v1\"&\n" +
+	"\rLookupRequest\x12\x15\n" +
+	"\x06bib_id\x18\x01 \x01(\rR\x05bibId\"d\n" +
+	"\fLookupResult\x12\x15\n" +
+	"\x06bib_id\x18\x01 \x01(\rR\x05bibId\x12\x15\n" +
+	"\x06mms_id\x18\x02 \x01(\x04R\x05mmsId\x12\x14\n" +
+	"\x05found\x18\x03 \x01(\bR\x05found\x12\x10\n" +
+	"\x03url\x18\x04 \x01(\tR\x03url\"-\n" +
+	"\x12BatchLookupRequest\x12\x17\n" +
+	"\abib_ids\x18\x01 \x03(\rR\x06bibIds\"Q\n" +
+	"\x13BatchLookupResponse\x12:\n" +
+	"\aresults\x18\x01 \x03(\v2 .permanentdetour.v1.LookupResultR\aresults2\xbe\x01\n" +
+	"\rLookupService\x12M\n" +
+	"\x06Lookup\x12!.permanentdetour.v1.LookupRequest\x1a .permanentdetour.v1.LookupResult\x12^\n" +
+	"\vBatchLookup\x12&.permanentdetour.v1.BatchLookupRequest\x1a'.permanentdetour.v1.BatchLookupResponseB0Z.github.com/cu-library/permanentdetour/lookuppbb\x06proto3"
+
+var (
+	file_lookuppb_lookup_proto_rawDescOnce sync.Once
+	file_lookuppb_lookup_proto_rawDescData []byte
+)
+
+func file_lookuppb_lookup_proto_rawDescGZIP() []byte {
+	file_lookuppb_lookup_proto_rawDescOnce.Do(func() {
+		file_lookuppb_lookup_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_lookuppb_lookup_proto_rawDesc), len(file_lookuppb_lookup_proto_rawDesc)))
+	})
+	return file_lookuppb_lookup_proto_rawDescData
+}
+
+var file_lookuppb_lookup_proto_msgTypes = make([]protoimpl.MessageInfo, 4)
+var file_lookuppb_lookup_proto_goTypes = []any{
+	(*LookupRequest)(nil),       // 0: permanentdetour.v1.LookupRequest
+	(*LookupResult)(nil),        // 1: permanentdetour.v1.LookupResult
+	(*BatchLookupRequest)(nil),  // 2: permanentdetour.v1.BatchLookupRequest
+	(*BatchLookupResponse)(nil), // 3: permanentdetour.v1.BatchLookupResponse
+}
+var file_lookuppb_lookup_proto_depIdxs = []int32{
+	1, // 0: permanentdetour.v1.BatchLookupResponse.results:type_name -> permanentdetour.v1.LookupResult
+	0, // 1: permanentdetour.v1.LookupService.Lookup:input_type -> permanentdetour.v1.LookupRequest
+	2, // 2: permanentdetour.v1.LookupService.BatchLookup:input_type -> permanentdetour.v1.BatchLookupRequest
+	1, // 3: permanentdetour.v1.LookupService.Lookup:output_type -> permanentdetour.v1.LookupResult
+	3, // 4: permanentdetour.v1.LookupService.BatchLookup:output_type -> permanentdetour.v1.BatchLookupResponse
+	3, // [3:5] is the sub-list for method output_type
+	1, // [1:3] is the sub-list for method input_type
+	1, // [1:1] is the sub-list for extension type_name
+	1, // [1:1] is the sub-list for extension extendee
+	0, // [0:1] is the sub-list for field type_name
+}
+
+func init() { file_lookuppb_lookup_proto_init() }
+func file_lookuppb_lookup_proto_init() {
+	if File_lookuppb_lookup_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_lookuppb_lookup_proto_rawDesc), len(file_lookuppb_lookup_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   4,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_lookuppb_lookup_proto_goTypes,
+		DependencyIndexes: file_lookuppb_lookup_proto_depIdxs,
+		MessageInfos:      file_lookuppb_lookup_proto_msgTypes,
+	}.Build()
+	File_lookuppb_lookup_proto = out.File
+	file_lookuppb_lookup_proto_goTypes = nil
+	file_lookuppb_lookup_proto_depIdxs = nil
+}
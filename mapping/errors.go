@@ -0,0 +1,44 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package mapping
+
+import (
+	"errors"
+	"fmt"
+)
+
+// The fields of a line of a mapping file which can be malformed.
+const (
+	FieldCount string = "fields" // The line has too few fields.
+	FieldBibID string = "bibID"
+	FieldMMSID string = "MMS ID"
+)
+
+// ErrDuplicateBibID is wrapped by the errors of LoadFile and ReadSnapshot for a bibID which was already mapped,
+// which say which bibID it was.
+var ErrDuplicateBibID = errors.New("Previously seen Bib ID")
+
+// MalformedLineError is the error for a line of a mapping file which couldn't be parsed.
+type MalformedLineError struct {
+	Path  string // The file, if the line was read by LoadFile.
+	Line  int    // The line number, or 0 if the line wasn't read from a file by LoadFile.
+	Text  string // The line.
+	Field string // The field which couldn't be parsed, FieldCount, FieldBibID, or FieldMMSID.
+	Err   error  // Why the field couldn't be parsed.
+}
+
+// Error describes why the line couldn't be parsed, and which line it was, if that's known.
+// The file isn't included, as callers usually name it already.
+func (e *MalformedLineError) Error() string {
+	if e.Line == 0 {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("Unable to process line %v '%v', %v.", e.Line, e.Text, e.Err)
+}
+
+// Unwrap returns why the field couldn't be parsed, like a *strconv.NumError.
+func (e *MalformedLineError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,107 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+// Package mapping reads and writes the files which map Voyager bibIDs to Alma MMS IDs: CSV files,
+// one mapping on each line like 996515203405158,a651520-01ocul_qu, and compiled snapshots.
+package mapping
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// LoadFile takes a file path, opens the file, and reads it line by line to add its mappings to m.
+// Mapping snapshots are also read. A bibID which is already in m is an error.
+func LoadFile(m map[uint32]uint64, mappingFilePath string) error {
+	// Get the absolute path of the file. Not strictly necessary, but creates clearer error messages.
+	absFilePath, err := filepath.Abs(mappingFilePath)
+	if err != nil {
+		return fmt.Errorf("Could not get absolute path of %v, %v.", mappingFilePath, err)
+	}
+
+	// Open the file for reading. Close the file automatically when done.
+	file, err := os.Open(absFilePath)
+	if err != nil {
+		return fmt.Errorf("Could not open %v for reading, %v.", absFilePath, err)
+	}
+	defer file.Close()
+
+	// Snapshots compiled from CSV files are read all at once.
+	reader := bufio.NewReader(file)
+	if IsSnapshot(reader) {
+		err = ReadSnapshot(reader, m)
+		if err != nil {
+			return fmt.Errorf("Could not read snapshot %v, %v.", absFilePath, err)
+		}
+		return nil
+	}
+
+	// Read the file line by line.
+	scanner := bufio.NewScanner(reader)
+	lnum := 0
+	for scanner.Scan() {
+		lnum += 1
+		bibID, exlID, err := ParseLine(scanner.Text())
+		var malformed *MalformedLineError
+		if errors.As(err, &malformed) {
+			malformed.Path, malformed.Line = absFilePath, lnum
+			return malformed
+		}
+		_, present := m[bibID]
+		if present {
+			return fmt.Errorf("%w %v was encountered on line %v of %v.", ErrDuplicateBibID, bibID, lnum, absFilePath)
+		}
+		m[bibID] = exlID
+	}
+	err = scanner.Err()
+	if err != nil {
+		return fmt.Errorf("Scanner error when processing %v, %v.", absFilePath, err)
+	}
+	return nil
+}
+
+// ParseLine takes a line of a mapping file, like 996515203405158,a651520-01ocul_qu, and finds the bibID and the exL ID.
+// The error for a malformed line is a *MalformedLineError.
+func ParseLine(line string) (bibID uint32, exlID uint64, _ error) {
+	malformed := func(field string, err error) error {
+		return &MalformedLineError{Text: line, Field: field, Err: err}
+	}
+	// Split the input line into fields on commas.
+	splitLine := strings.Split(line, ",")
+	if len(splitLine) < 2 {
+		return bibID, exlID, malformed(FieldCount, fmt.Errorf("Line has incorrect number of fields, 2 expected, %v found.", len(splitLine)))
+	}
+	// The bibIDs look like this: a1234-instid
+	// We need to strip off the first character and anything after the dash.
+	dashIndex := strings.Index(splitLine[1], "-")
+	if (dashIndex == 0) || (dashIndex == 1) {
+		return bibID, exlID, malformed(FieldBibID, errors.New("No bibID number was found before dash between bibID and institution id."))
+	}
+	bibIDString := "invalid"
+	// If the dash isn't found, use the whole bibID field except the first character.
+	if dashIndex == -1 {
+		bibIDString = splitLine[1]
+	} else {
+		bibIDString = splitLine[1][0:dashIndex]
+	}
+	// Exports which don't prefix the bibID with a letter are also accepted.
+	if bibIDString != "" && (bibIDString[0] < '0' || bibIDString[0] > '9') {
+		bibIDString = bibIDString[1:]
+	}
+	bibID64, err := strconv.ParseUint(bibIDString, 10, 32)
+	if err != nil {
+		return bibID, exlID, malformed(FieldBibID, err)
+	}
+	bibID = uint32(bibID64)
+	exlID, err = strconv.ParseUint(splitLine[0], 10, 64)
+	if err != nil {
+		return bibID, exlID, malformed(FieldMMSID, err)
+	}
+	return bibID, exlID, nil
+}
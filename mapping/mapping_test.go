@@ -0,0 +1,169 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package mapping
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// parseLineTests are lines of mapping files, and what ParseLine finds in them.
+var parseLineTests = []struct {
+	line  string
+	bibID uint32
+	exlID uint64
+	error bool
+}{
+	{"", 0, 0, true},
+	{"0,b0", 0, 0, false},
+	{"1,b1-", 1, 1, false},
+	{"1,b-", 0, 0, true},
+	{"1,-", 0, 0, true},
+	{"invalid,a0-", 0, 0, true},
+	{"0,invalid", 0, 0, true},
+	{"900000000000000001,b1000001-01suffix,", 1000001, 900000000000000001, false},
+	{"900000000000000001,b1000001-01suffix,,,,,", 1000001, 900000000000000001, false},
+	{"900000000000000001,b1000001-01suffix", 1000001, 900000000000000001, false},
+	{"18446744073709551615,b4294967295-01suffix,", 4294967295, 18446744073709551615, false},
+	{"18446744073709551616,b4294967296-01suffix,", 0, 0, true},
+	{"-1,a-1", 0, 0, true},
+}
+
+func TestParseLine(t *testing.T) {
+	for _, tt := range parseLineTests {
+		t.Run(tt.line, func(t *testing.T) {
+			bibID, exlID, err := ParseLine(tt.line)
+
+			if tt.error && err == nil {
+				t.Fatalf("ParseLine(\"%v\") should have returned an error, but it did not.\n", tt.line)
+			}
+			if !tt.error && err != nil {
+				t.Fatalf("ParseLine(\"%v\") should not have returned an error, but it did: %v.\n", tt.line, err)
+			}
+			if (bibID != tt.bibID) || (exlID != tt.exlID) {
+				t.Fatalf("ParseLine(\"%v\") returned %v, %v, not %v, %v", tt.line, bibID, exlID, tt.bibID, tt.exlID)
+			}
+		})
+	}
+}
+
+// FuzzParseLine checks ParseLine doesn't panic on any line, and that the mapping in a line it parses is
+// parsed the same from a line written in the export's own format.
+func FuzzParseLine(f *testing.F) {
+	for _, tt := range parseLineTests {
+		f.Add(tt.line)
+	}
+	f.Fuzz(func(t *testing.T, line string) {
+		bibID, exlID, err := ParseLine(line)
+		if err != nil {
+			return
+		}
+		canonical := fmt.Sprintf("%v,a%v-01ocul_qu", exlID, bibID)
+		bibID2, exlID2, err := ParseLine(canonical)
+		if err != nil || bibID2 != bibID || exlID2 != exlID {
+			t.Fatalf("ParseLine(%q) returned %v, %v, but ParseLine(%q) returned %v, %v, %v.", line, bibID, exlID, canonical, bibID2, exlID2, err)
+		}
+	})
+}
+
+func TestLoadFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "mappings.csv")
+	err := os.WriteFile(path, []byte("996515203405158,a651520-01ocul_qu\n996515213405158,a651521-01ocul_qu\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := map[uint32]uint64{}
+	err = LoadFile(m, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[uint32]uint64{651520: 996515203405158, 651521: 996515213405158}
+	if !maps.Equal(m, expected) {
+		t.Fatalf("LoadFile() loaded %v, not %v.", m, expected)
+	}
+	err = LoadFile(m, path)
+	if err == nil {
+		t.Fatal("A bibID which was already loaded wasn't an error.")
+	}
+	err = LoadFile(m, filepath.Join(dir, "missing.csv"))
+	if err == nil {
+		t.Fatal("A missing file was loaded without an error.")
+	}
+}
+
+// parseLineAllocBudget is the most allocations ParseLine may make for a line, for the slice of its fields.
+const parseLineAllocBudget float64 = 1
+
+func TestParseLineAllocations(t *testing.T) {
+	allocs := testing.AllocsPerRun(100, func() {
+		ParseLine("996515203405158,a651520-01ocul_qu")
+	})
+	if allocs > parseLineAllocBudget {
+		t.Fatalf("ParseLine made %v allocations, more than the budget of %v.", allocs, parseLineAllocBudget)
+	}
+}
+
+func BenchmarkParseLine(b *testing.B) {
+	b.ReportAllocs()
+	for b.Loop() {
+		ParseLine("996515203405158,a651520-01ocul_qu")
+	}
+}
+
+func BenchmarkLoadFile(b *testing.B) {
+	path := filepath.Join(b.TempDir(), "mappings.csv")
+	var sb strings.Builder
+	for i := range 100000 {
+		fmt.Fprintf(&sb, "99%v3405158,a%v-01ocul_qu\n", 100000+i, 100000+i)
+	}
+	err := os.WriteFile(path, []byte(sb.String()), 0644)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	for b.Loop() {
+		err := LoadFile(make(map[uint32]uint64, 100000), path)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestLoadFileErrors(t *testing.T) {
+	dir := t.TempDir()
+	var tests = []struct {
+		content string
+		line    int    // The line of the malformed line, or 0 for a duplicate.
+		field   string // The malformed field, or empty for a duplicate.
+	}{
+		{"996515203405158,a651520-01ocul_qu\nnot a mapping\n", 2, FieldCount},
+		{"996515203405158,a-01ocul_qu\n", 1, FieldBibID},
+		{"996515203405158,a651520-01ocul_qu\n99651520340515x,a651521-01ocul_qu\n", 2, FieldMMSID},
+		{"996515203405158,a651520-01ocul_qu\n996515213405158,a651520-01ocul_qu\n", 0, ""},
+	}
+	for i, tt := range tests {
+		path := filepath.Join(dir, fmt.Sprintf("mappings-%v.csv", i))
+		err := os.WriteFile(path, []byte(tt.content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = LoadFile(map[uint32]uint64{}, path)
+		var malformed *MalformedLineError
+		switch {
+		case tt.field == "" && !errors.Is(err, ErrDuplicateBibID):
+			t.Fatalf("LoadFile(%q) returned %v, not ErrDuplicateBibID.", tt.content, err)
+		case tt.field != "" && !errors.As(err, &malformed):
+			t.Fatalf("LoadFile(%q) returned %v, not a MalformedLineError.", tt.content, err)
+		case tt.field != "" && (malformed.Path != path || malformed.Line != tt.line || malformed.Field != tt.field):
+			t.Fatalf("LoadFile(%q) returned a malformed %v on line %v of %v, not %v on line %v of %v.", tt.content, malformed.Field, malformed.Line, malformed.Path, tt.field, tt.line, path)
+		}
+	}
+}
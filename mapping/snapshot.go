@@ -0,0 +1,88 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package mapping
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+)
+
+const (
+	// SnapshotMagic starts every mapping snapshot, so snapshots are recognized whatever their name.
+	SnapshotMagic string = "PDSNAP1\n"
+
+	// snapshotEntryLength is the length of a mapping in a snapshot, a bibID and an MMS ID.
+	snapshotEntryLength int = 4 + 8
+)
+
+// A mapping snapshot is a binary file of mappings, which loads much faster than CSV. It is made up of
+// SnapshotMagic, the number of mappings, the mappings in order of bibID, each a bibID and an MMS ID,
+// and the SHA-256 checksum of everything before it. Numbers are little endian.
+
+// IsSnapshot reports whether the reader is at the start of a mapping snapshot.
+func IsSnapshot(r *bufio.Reader) bool {
+	magic, err := r.Peek(len(SnapshotMagic))
+	return err == nil && string(magic) == SnapshotMagic
+}
+
+// WriteSnapshot writes the mappings to w as a snapshot.
+func WriteSnapshot(w io.Writer, m map[uint32]uint64) error {
+	h := sha256.New()
+	bw := bufio.NewWriter(io.MultiWriter(w, h))
+	bw.WriteString(SnapshotMagic)
+	entry := make([]byte, snapshotEntryLength)
+	binary.LittleEndian.PutUint64(entry, uint64(len(m)))
+	bw.Write(entry[:8])
+	for _, bibID := range slices.Sorted(maps.Keys(m)) {
+		binary.LittleEndian.PutUint32(entry, bibID)
+		binary.LittleEndian.PutUint64(entry[4:], m[bibID])
+		bw.Write(entry)
+	}
+	err := bw.Flush()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(h.Sum(nil))
+	return err
+}
+
+// ReadSnapshot adds the mappings in the snapshot read from r to m, after checking the snapshot is
+// complete and its checksum is correct. A bibID which is already in m is an error.
+func ReadSnapshot(r io.Reader, m map[uint32]uint64) error {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	header := len(SnapshotMagic) + 8
+	if len(content) < header+sha256.Size || string(content[:len(SnapshotMagic)]) != SnapshotMagic {
+		return errors.New("The snapshot is truncated")
+	}
+	body, checksum := content[:len(content)-sha256.Size], content[len(content)-sha256.Size:]
+	sum := sha256.Sum256(body)
+	if !bytes.Equal(sum[:], checksum) {
+		return errors.New("The snapshot's checksum doesn't match, it is corrupt or truncated")
+	}
+	count := binary.LittleEndian.Uint64(body[len(SnapshotMagic):header])
+	entries := body[header:]
+	if uint64(len(entries)) != count*uint64(snapshotEntryLength) {
+		return fmt.Errorf("The snapshot should have %v mappings, but has %v bytes of mappings", count, len(entries))
+	}
+	for i := 0; i < len(entries); i += snapshotEntryLength {
+		bibID := binary.LittleEndian.Uint32(entries[i:])
+		_, present := m[bibID]
+		if present {
+			return fmt.Errorf("%w %v was encountered.", ErrDuplicateBibID, bibID)
+		}
+		m[bibID] = binary.LittleEndian.Uint64(entries[i+4:])
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package mapping
+
+import (
+	"bytes"
+	"maps"
+	"testing"
+)
+
+func TestSnapshot(t *testing.T) {
+	m := map[uint32]uint64{651520: 996515203405158, 1: 991234503405158, 4294967295: 18446744073709551615}
+	var buf bytes.Buffer
+	err := WriteSnapshot(&buf, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshot := buf.Bytes()
+
+	loaded := map[uint32]uint64{}
+	err = ReadSnapshot(bytes.NewReader(snapshot), loaded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !maps.Equal(loaded, m) {
+		t.Fatalf("The snapshot had %v, not %v.", loaded, m)
+	}
+	err = ReadSnapshot(bytes.NewReader(snapshot), loaded)
+	if err == nil {
+		t.Fatal("A bibID which was already loaded wasn't an error.")
+	}
+
+	var tests = []struct {
+		name     string
+		snapshot []byte
+	}{
+		{"corrupt", append(append([]byte{}, snapshot[:20]...), append([]byte{snapshot[20] ^ 1}, snapshot[21:]...)...)},
+		{"truncated", snapshot[:len(snapshot)-1]},
+		{"empty", nil},
+	}
+	for _, tt := range tests {
+		err := ReadSnapshot(bytes.NewReader(tt.snapshot), map[uint32]uint64{})
+		if err == nil {
+			t.Errorf("The %v snapshot was read without an error.", tt.name)
+		}
+	}
+}
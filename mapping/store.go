@@ -0,0 +1,123 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package mapping
+
+import (
+	"context"
+	"iter"
+	"maps"
+	"sync/atomic"
+)
+
+// Store looks up the MMS IDs of bibIDs, wherever the mappings are kept.
+type Store interface {
+	// Lookup returns the MMS ID of the bibID, and reports whether the bibID is mapped.
+	Lookup(bibID uint32) (exlID uint64, found bool)
+	// Len returns the number of mappings.
+	Len() int
+	// Reload reads the mappings again from where they are kept. If they can't be read, the current mappings are kept.
+	Reload() error
+}
+
+// Lister is a Store whose mappings can be listed, for exports, sitemaps, and reverse lookups.
+// Stores in remote databases might not be.
+type Lister interface {
+	Store
+	// All returns the mappings of bibIDs to MMS IDs, in no particular order.
+	All() iter.Seq2[uint32, uint64]
+}
+
+// ContextStore is a Store whose lookups can block, like one in a remote database,
+// and which gives up on a lookup when its context is done.
+type ContextStore interface {
+	Store
+	// LookupContext returns the MMS ID of the bibID, and reports whether the bibID is mapped,
+	// or returns an error if the lookup couldn't finish, like ctx.Err() when ctx is done first.
+	LookupContext(ctx context.Context, bibID uint32) (exlID uint64, found bool, err error)
+}
+
+// LookupContext returns the MMS ID of the bibID in s, and reports whether the bibID is mapped.
+// If s is a ContextStore, the lookup gives up when ctx is done. Other stores don't block,
+// so ctx is only checked before the lookup. The error is ctx.Err(), or one from the ContextStore.
+func LookupContext(ctx context.Context, s Store, bibID uint32) (uint64, bool, error) {
+	if cs, ok := s.(ContextStore); ok {
+		return cs.LookupContext(ctx, bibID)
+	}
+	err := ctx.Err()
+	if err != nil {
+		return 0, false, err
+	}
+	exlID, found := s.Lookup(bibID)
+	return exlID, found, nil
+}
+
+// Map is a Store of mappings kept in memory, which can be reloaded from the mapping files they were read from.
+// It is safe for concurrent use.
+type Map struct {
+	paths []string
+	m     atomic.Pointer[map[uint32]uint64]
+}
+
+// NewMap returns a Map of the mappings in m, which were loaded from the mapping files at paths, if any.
+// m mustn't be modified afterwards.
+func NewMap(m map[uint32]uint64, paths ...string) *Map {
+	if m == nil {
+		m = map[uint32]uint64{}
+	}
+	s := &Map{paths: paths}
+	s.m.Store(&m)
+	return s
+}
+
+// LoadMap returns a Map of the mappings in the mapping files at paths.
+func LoadMap(paths ...string) (*Map, error) {
+	m, err := loadFiles(paths, 0)
+	if err != nil {
+		return nil, err
+	}
+	return NewMap(m, paths...), nil
+}
+
+// loadFiles returns the mappings in the files at paths, in a map with room for size mappings.
+func loadFiles(paths []string, size int) (map[uint32]uint64, error) {
+	m := make(map[uint32]uint64, size)
+	for _, path := range paths {
+		err := LoadFile(m, path)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// Lookup returns the MMS ID of the bibID, and reports whether the bibID is mapped.
+func (s *Map) Lookup(bibID uint32) (uint64, bool) {
+	exlID, found := (*s.m.Load())[bibID]
+	return exlID, found
+}
+
+// Len returns the number of mappings.
+func (s *Map) Len() int {
+	return len(*s.m.Load())
+}
+
+// All returns the mappings of bibIDs to MMS IDs, in no particular order.
+func (s *Map) All() iter.Seq2[uint32, uint64] {
+	return maps.All(*s.m.Load())
+}
+
+// Reload reads the mapping files again, and replaces the mappings once they have all been read.
+// A Map which wasn't loaded from files is left as it is.
+func (s *Map) Reload() error {
+	if len(s.paths) == 0 {
+		return nil
+	}
+	m, err := loadFiles(s.paths, s.Len())
+	if err != nil {
+		return err
+	}
+	s.m.Store(&m)
+	return nil
+}
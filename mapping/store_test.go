@@ -0,0 +1,153 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package mapping
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMap(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "mappings.csv")
+	err := os.WriteFile(path, []byte("996515203405158,a651520-01ocul_qu\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := LoadMap(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Map is used wherever a Store or a Lister is.
+	var l Lister = s
+	exlID, found := l.Lookup(651520)
+	if !found || exlID != 996515203405158 || l.Len() != 1 {
+		t.Fatalf("Lookup(651520) returned %v, %v, with %v mappings.", exlID, found, l.Len())
+	}
+	_, found = l.Lookup(651521)
+	if found {
+		t.Fatal("An unmapped bibID was found.")
+	}
+
+	// Reloading replaces the mappings with the files' new mappings.
+	err = os.WriteFile(path, []byte("996515203405159,a651520-01ocul_qu\n996515213405158,a651521-01ocul_qu\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[uint32]uint64{651520: 996515203405159, 651521: 996515213405158}
+	if !maps.Equal(maps.Collect(s.All()), expected) {
+		t.Fatalf("The reloaded mappings were %v, not %v.", maps.Collect(s.All()), expected)
+	}
+
+	// The mappings are kept when a file can't be read.
+	err = os.WriteFile(path, []byte("not a mapping\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Reload()
+	if err == nil {
+		t.Fatal("An invalid file was reloaded without an error.")
+	}
+	if s.Len() != 2 {
+		t.Fatalf("The Map had %v mappings after a failed reload, not 2.", s.Len())
+	}
+
+	// A Map which wasn't loaded from files keeps its mappings.
+	s = NewMap(map[uint32]uint64{1: 2})
+	if s.Reload() != nil || s.Len() != 1 {
+		t.Fatal("A Map without files changed on reload.")
+	}
+	if NewMap(nil).Len() != 0 {
+		t.Fatal("A Map of nil mappings wasn't empty.")
+	}
+}
+
+// blockingStore is a ContextStore whose lookups block until their context is done.
+type blockingStore struct {
+	*Map
+}
+
+// LookupContext waits for ctx to be done.
+func (s blockingStore) LookupContext(ctx context.Context, bibID uint32) (uint64, bool, error) {
+	<-ctx.Done()
+	return 0, false, ctx.Err()
+}
+
+func TestLookupContext(t *testing.T) {
+	m := NewMap(map[uint32]uint64{651520: 996515203405158})
+	exlID, found, err := LookupContext(context.Background(), m, 651520)
+	if err != nil || !found || exlID != 996515203405158 {
+		t.Fatalf("LookupContext(651520) returned %v, %v, %v.", exlID, found, err)
+	}
+
+	// A Store which doesn't block isn't looked up once the context is done.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, found, err = LookupContext(ctx, m, 651520)
+	if found || !errors.Is(err, context.Canceled) {
+		t.Fatalf("LookupContext with a canceled context returned %v, %v.", found, err)
+	}
+
+	// A ContextStore gives up when the deadline passes.
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, found, err = LookupContext(ctx, blockingStore{m}, 651520)
+	if found || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("LookupContext with a blocking store returned %v, %v.", found, err)
+	}
+}
+
+func TestLookupAllocations(t *testing.T) {
+	m := NewMap(map[uint32]uint64{651520: 996515203405158})
+	ctx := context.Background()
+	// Lookups are on the path of every record redirect, so mustn't allocate at all.
+	var tests = []struct {
+		name   string
+		lookup func()
+	}{
+		{"Lookup", func() { m.Lookup(651520) }},
+		{"LookupContext", func() { LookupContext(ctx, m, 651520) }},
+	}
+	for _, tt := range tests {
+		allocs := testing.AllocsPerRun(100, tt.lookup)
+		if allocs > 0 {
+			t.Fatalf("%v made %v allocations, not 0.", tt.name, allocs)
+		}
+	}
+}
+
+func BenchmarkLookup(b *testing.B) {
+	m := make(map[uint32]uint64, 1000000)
+	for i := range uint32(1000000) {
+		m[i] = 990000000003405158 + uint64(i)*10000
+	}
+	s := NewMap(m)
+	ctx := context.Background()
+	b.Run("Lookup", func(b *testing.B) {
+		b.ReportAllocs()
+		var bibID uint32
+		for b.Loop() {
+			s.Lookup(bibID % 2000000)
+			bibID += 7919
+		}
+	})
+	b.Run("LookupContext", func(b *testing.B) {
+		b.ReportAllocs()
+		var bibID uint32
+		for b.Loop() {
+			LookupContext(ctx, s, bibID%2000000)
+			bibID += 7919
+		}
+	})
+}
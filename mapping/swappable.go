@@ -0,0 +1,96 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package mapping
+
+import (
+	"context"
+	"iter"
+	"sync/atomic"
+	"time"
+)
+
+// SwappableStore is a Store whose mappings can be replaced by those of another Store while it's in use.
+// Each lookup is made in either the previous or the next Store, never in one which is partly built, as a Store
+// is only swapped in once it's complete. It is safe for concurrent use.
+type SwappableStore struct {
+	current atomic.Pointer[swappedStore]
+}
+
+// swappedStore is a Store which was swapped in, and when it was.
+type swappedStore struct {
+	Store
+	at time.Time
+}
+
+// NewSwappableStore returns a SwappableStore of the mappings in s.
+func NewSwappableStore(s Store) *SwappableStore {
+	ss := &SwappableStore{}
+	ss.Swap(s)
+	return ss
+}
+
+// Load returns the current Store.
+func (ss *SwappableStore) Load() Store {
+	return ss.current.Load().Store
+}
+
+// Swapped returns when the current Store was swapped in.
+func (ss *SwappableStore) Swapped() time.Time {
+	return ss.current.Load().at
+}
+
+// Swap replaces the current Store with s, and returns the previous Store, or nil if there wasn't one.
+// Lookups which have started finish in the previous Store.
+func (ss *SwappableStore) Swap(s Store) Store {
+	previous := ss.current.Swap(&swappedStore{Store: s, at: time.Now()})
+	if previous == nil {
+		return nil
+	}
+	return previous.Store
+}
+
+// Lookup returns the MMS ID of the bibID in the current Store, and reports whether the bibID is mapped.
+func (ss *SwappableStore) Lookup(bibID uint32) (uint64, bool) {
+	return ss.Load().Lookup(bibID)
+}
+
+// LookupContext returns the MMS ID of the bibID in the current Store, like the LookupContext function.
+func (ss *SwappableStore) LookupContext(ctx context.Context, bibID uint32) (uint64, bool, error) {
+	return LookupContext(ctx, ss.Load(), bibID)
+}
+
+// Len returns the number of mappings in the current Store.
+func (ss *SwappableStore) Len() int {
+	return ss.Load().Len()
+}
+
+// All returns the mappings in the current Store, in no particular order, or none if it isn't a Lister.
+func (ss *SwappableStore) All() iter.Seq2[uint32, uint64] {
+	l, ok := ss.Load().(Lister)
+	if !ok {
+		return func(yield func(uint32, uint64) bool) {}
+	}
+	return l.All()
+}
+
+// Reload reads the mappings again, and swaps them in once they have all been read. A Map is reloaded into a new Map,
+// which replaces it, so a Map which was handed out by Load isn't changed. Other stores reload themselves.
+// If the mappings can't be read, the current mappings are kept.
+func (ss *SwappableStore) Reload() error {
+	current := ss.Load()
+	m, ok := current.(*Map)
+	if !ok {
+		return current.Reload()
+	}
+	if len(m.paths) == 0 {
+		return nil
+	}
+	next, err := loadFiles(m.paths, m.Len())
+	if err != nil {
+		return err
+	}
+	ss.Swap(NewMap(next, m.paths...))
+	return nil
+}
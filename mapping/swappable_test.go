@@ -0,0 +1,144 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package mapping
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestSwappableStore(t *testing.T) {
+	first := NewMap(map[uint32]uint64{651520: 996515203405158})
+	ss := NewSwappableStore(first)
+	// SwappableStore is used wherever a Lister or a ContextStore is.
+	var _ Lister = ss
+	var _ ContextStore = ss
+	exlID, found := ss.Lookup(651520)
+	if !found || exlID != 996515203405158 || ss.Len() != 1 {
+		t.Fatalf("Lookup(651520) returned %v, %v, with %v mappings.", exlID, found, ss.Len())
+	}
+
+	swapped := ss.Swapped()
+	second := NewMap(map[uint32]uint64{651521: 996515213405158})
+	previous := ss.Swap(second)
+	if previous != first || ss.Load() != second {
+		t.Fatal("Swap didn't replace the first store with the second.")
+	}
+	if ss.Swapped().Before(swapped) {
+		t.Fatalf("The second store was swapped in at %v, before the first, at %v.", ss.Swapped(), swapped)
+	}
+	_, found = ss.Lookup(651520)
+	if found {
+		t.Fatal("A bibID of the previous store was found.")
+	}
+	if !maps.Equal(maps.Collect(ss.All()), map[uint32]uint64{651521: 996515213405158}) {
+		t.Fatalf("All returned %v.", maps.Collect(ss.All()))
+	}
+}
+
+func TestSwappableStoreReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mappings.csv")
+	err := os.WriteFile(path, []byte("996515203405158,a651520-01ocul_qu\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := LoadMap(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ss := NewSwappableStore(m)
+
+	// The reloaded mappings are swapped in as a new Map, so the Map which was loaded before isn't changed.
+	err = os.WriteFile(path, []byte("996515203405159,a651520-01ocul_qu\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ss.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	exlID, _ := ss.Lookup(651520)
+	if exlID != 996515203405159 {
+		t.Fatalf("Lookup(651520) returned %v after reloading, not 996515203405159.", exlID)
+	}
+	exlID, _ = m.Lookup(651520)
+	if exlID != 996515203405158 {
+		t.Fatalf("The previous Map's Lookup(651520) returned %v after reloading, not 996515203405158.", exlID)
+	}
+
+	// The mappings are kept when a file can't be read.
+	err = os.WriteFile(path, []byte("not a mapping\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ss.Reload()
+	if err == nil {
+		t.Fatal("An invalid file was reloaded without an error.")
+	}
+	exlID, _ = ss.Lookup(651520)
+	if exlID != 996515203405159 {
+		t.Fatalf("Lookup(651520) returned %v after a failed reload, not 996515203405159.", exlID)
+	}
+}
+
+// TestSwappableStoreConcurrent reloads the mappings while they're looked up, and checks that every lookup is made
+// in a complete store, with every mapping of the file.
+func TestSwappableStoreConcurrent(t *testing.T) {
+	const n = 1000
+	var content strings.Builder
+	for bibID := range n {
+		fmt.Fprintf(&content, "99%v3405158,a%v-01ocul_qu\n", bibID, bibID)
+	}
+	path := filepath.Join(t.TempDir(), "mappings.csv")
+	err := os.WriteFile(path, []byte(content.String()), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := LoadMap(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ss := NewSwappableStore(m)
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	errs := make(chan error, 4)
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				s := ss.Load()
+				_, found := s.Lookup(n - 1)
+				if s.Len() != n || !found {
+					errs <- fmt.Errorf("A store with %v mappings was looked up in, not %v", s.Len(), n)
+					return
+				}
+			}
+		}()
+	}
+	for range 20 {
+		err := ss.Reload()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(done)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+}
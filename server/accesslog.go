@@ -0,0 +1,260 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// combinedLogTimeFormat is the format of timestamps in the Apache combined log format.
+	combinedLogTimeFormat string = "02/Jan/2006:15:04:05 -0700"
+
+	// rotatedLogTimeFormat is the format of the timestamp appended to the names of rotated logs.
+	rotatedLogTimeFormat string = "20060102-150405"
+
+	// logRotationRetryInterval is how long writes continue to a log file which couldn't be rotated before
+	// rotating it is tried again.
+	logRotationRetryInterval time.Duration = time.Minute
+)
+
+// accessLogger is middleware which writes a line in the Apache combined log format for each request.
+type accessLogger struct {
+	next       http.Handler
+	mu         sync.Mutex
+	w          io.Writer
+	anonymizer *ipAnonymizer // Anonymizes the logged client addresses, or nil.
+	now        func() time.Time
+}
+
+// newAccessLogger returns middleware which logs requests to next in the combined log format to w,
+// with client addresses anonymized by anonymizer, if it isn't nil.
+func newAccessLogger(next http.Handler, w io.Writer, anonymizer *ipAnonymizer) *accessLogger {
+	return &accessLogger{next: next, w: w, anonymizer: anonymizer, now: time.Now}
+}
+
+// statusRecorder records the status and length of a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	n, err := s.ResponseWriter.Write(b)
+	s.bytes += n
+	return n, err
+}
+
+// Unwrap returns the underlying ResponseWriter, for http.ResponseController.
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// The accessLogger serves the request with the next handler, then logs it.
+func (a *accessLogger) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	received := a.now()
+	rec := &statusRecorder{ResponseWriter: w}
+	a.next.ServeHTTP(rec, r)
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	line := combinedLogLine(r, a.anonymizer, rec.status, rec.bytes, received)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	io.WriteString(a.w, line)
+}
+
+// combinedLogLine formats a request in the Apache combined log format,
+// %h %l %u %t "%r" %>s %b "%{Referer}i" "%{User-agent}i", with the client's address anonymized by anonymizer.
+func combinedLogLine(r *http.Request, anonymizer *ipAnonymizer, status, bytes int, received time.Time) string {
+	host := anonymizer.anonymize(clientIP(r))
+	user := "-"
+	if u, _, ok := r.BasicAuth(); ok && u != "" {
+		user = u
+	}
+	size := "-"
+	if bytes > 0 {
+		size = strconv.Itoa(bytes)
+	}
+	return fmt.Sprintf("%v - %v [%v] %v %v %v %v %v\n",
+		logField(host),
+		logField(user),
+		received.Format(combinedLogTimeFormat),
+		strconv.Quote(fmt.Sprintf("%v %v %v", r.Method, r.URL.RequestURI(), r.Proto)),
+		status,
+		size,
+		quoteLogField(r.Referer()),
+		quoteLogField(r.UserAgent()),
+	)
+}
+
+// logField returns an unquoted field, or "-" if it is empty.
+func logField(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return strings.Map(func(r rune) rune {
+		if r <= ' ' || r == '"' {
+			return '_'
+		}
+		return r
+	}, s)
+}
+
+// quoteLogField returns a quoted field, or "-" if it is empty.
+func quoteLogField(s string) string {
+	if s == "" {
+		return `"-"`
+	}
+	return strconv.Quote(s)
+}
+
+// logRotation is when log files are rotated.
+type logRotation struct {
+	maxSize int64         // Rotate when a write would grow the file past this size. Disabled when zero.
+	maxAge  time.Duration // Rotate when the file was opened this long ago. Disabled when zero.
+}
+
+// rotatingFile is a log file which is rotated when it reaches a maximum size, or age.
+// Rotated files are renamed with the time of rotation appended to their name.
+type rotatingFile struct {
+	path    string
+	maxSize int64         // Rotate when a write would grow the file past this size. Disabled when zero.
+	maxAge  time.Duration // Rotate when the file was opened this long ago. Disabled when zero.
+	now     func() time.Time
+
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	opened time.Time
+	failed time.Time // When the file last couldn't be rotated.
+}
+
+// newRotatingFile opens the log file at path for appending, creating it if necessary.
+func newRotatingFile(path string, maxSize int64, maxAge time.Duration) (*rotatingFile, error) {
+	f := &rotatingFile{
+		path:    path,
+		maxSize: maxSize,
+		maxAge:  maxAge,
+		now:     time.Now,
+	}
+	err := f.open()
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// open opens the log file, recording its current size.
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("Could not open log file %v, %w", f.path, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("Could not stat log file %v, %w", f.path, err)
+	}
+	f.file = file
+	f.size = info.Size()
+	f.opened = f.now()
+	return nil
+}
+
+// rotate closes the log file, renames it, and opens a new one. If the file can't be renamed, it's opened again,
+// so writes continue to it. The file is closed before it's renamed, as open files can't be renamed on Windows.
+// The file is nil if it couldn't be opened again.
+func (f *rotatingFile) rotate() error {
+	rotated, err := f.rotatedPath()
+	if err != nil {
+		return err
+	}
+	if f.file != nil {
+		err = f.file.Close()
+		f.file = nil
+		if err != nil {
+			err = fmt.Errorf("Could not close log file %v, %w", f.path, err)
+		} else {
+			err = os.Rename(f.path, rotated)
+			if err != nil {
+				err = fmt.Errorf("Could not rotate log file %v, %w", f.path, err)
+			}
+		}
+	}
+	return errors.Join(err, f.open())
+}
+
+// rotatedPath returns the name the log file is renamed to when it's rotated, which isn't the name of a log
+// rotated before, like in the same second.
+func (f *rotatingFile) rotatedPath() (string, error) {
+	stamp := f.now().Format(rotatedLogTimeFormat)
+	rotated := fmt.Sprintf("%v.%v", f.path, stamp)
+	for i := 1; ; i++ {
+		_, err := os.Stat(rotated)
+		if errors.Is(err, fs.ErrNotExist) {
+			return rotated, nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("Could not rotate log file %v, %w", f.path, err)
+		}
+		rotated = fmt.Sprintf("%v.%v.%v", f.path, stamp, i)
+	}
+}
+
+// Write writes b to the log file, rotating it first if necessary. If the file can't be rotated, the error is
+// logged, and writes continue to the file, or fail if it couldn't be opened again, until rotating it is tried
+// again after logRotationRetryInterval.
+func (f *rotatingFile) Write(b []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := f.now()
+	tooBig := f.maxSize > 0 && f.size > 0 && f.size+int64(len(b)) > f.maxSize
+	tooOld := f.maxAge > 0 && now.Sub(f.opened) >= f.maxAge
+	if (tooBig || tooOld || f.file == nil) && now.Sub(f.failed) >= logRotationRetryInterval {
+		err := f.rotate()
+		if err != nil {
+			f.failed = now
+			slog.Error("Could not rotate log file.", "path", f.path, "err", err)
+		}
+	}
+	if f.file == nil {
+		return 0, fmt.Errorf("Could not write to log file %v, it could not be opened", f.path)
+	}
+	n, err := f.file.Write(b)
+	f.size += int64(n)
+	return n, err
+}
+
+// Close closes the log file.
+func (f *rotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	return f.file.Close()
+}
@@ -0,0 +1,171 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCombinedLogLine(t *testing.T) {
+	received := time.Date(2019, time.October, 10, 13, 55, 36, 0, time.FixedZone("", -4*60*60))
+	var tests = []struct {
+		name      string
+		referer   string
+		userAgent string
+		status    int
+		bytes     int
+		expected  string
+	}{
+		{"full", "https://library.queensu.ca/", "Mozilla/5.0", 307, 120,
+			`192.0.2.1 - - [10/Oct/2019:13:55:36 -0400] "GET /vwebv/holdingsInfo?bibId=1 HTTP/1.1" 307 120 "https://library.queensu.ca/" "Mozilla/5.0"` + "\n"},
+		{"empty", "", "", 200, 0,
+			`192.0.2.1 - - [10/Oct/2019:13:55:36 -0400] "GET /vwebv/holdingsInfo?bibId=1 HTTP/1.1" 200 - "-" "-"` + "\n"},
+		{"quotes", "", `bad "agent"`, 200, 0,
+			`192.0.2.1 - - [10/Oct/2019:13:55:36 -0400] "GET /vwebv/holdingsInfo?bibId=1 HTTP/1.1" 200 - "-" "bad \"agent\""` + "\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/vwebv/holdingsInfo?bibId=1", nil)
+			r.RemoteAddr = "192.0.2.1:1234"
+			if tt.referer != "" {
+				r.Header.Set("Referer", tt.referer)
+			}
+			if tt.userAgent != "" {
+				r.Header.Set("User-Agent", tt.userAgent)
+			}
+			line := combinedLogLine(r, nil, tt.status, tt.bytes, received)
+			if line != tt.expected {
+				t.Fatalf("combinedLogLine() returned\n%v, not\n%v", line, tt.expected)
+			}
+		})
+	}
+}
+
+func TestAccessLogger(t *testing.T) {
+	var b strings.Builder
+	handler := newAccessLogger(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "https://example.com/", http.StatusTemporaryRedirect)
+	}), &b, nil)
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/vwebv/my", nil))
+	if !strings.Contains(b.String(), `"GET /vwebv/my HTTP/1.1" 307 `) {
+		t.Fatalf("The access log line %q does not contain the request and status.", b.String())
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "access.log")
+	now := time.Date(2019, time.October, 10, 13, 55, 36, 0, time.UTC)
+
+	f, err := newRotatingFile(path, 10, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	f.now = func() time.Time { return now }
+	f.opened = now
+
+	// The first write always fits, even if it is too large.
+	f.Write([]byte("0123456789"))
+	// This write would make the file too large.
+	f.Write([]byte("abc"))
+	rotated, err := os.ReadFile(path + ".20191010-135536")
+	if err != nil {
+		t.Fatalf("The log file was not rotated by size, %v.", err)
+	}
+	if string(rotated) != "0123456789" {
+		t.Fatalf("The rotated log file contains %q, not %q.", rotated, "0123456789")
+	}
+
+	// An hour later, the log file is rotated again.
+	now = now.Add(time.Hour)
+	f.Write([]byte("def"))
+	rotated, err = os.ReadFile(path + ".20191010-145536")
+	if err != nil {
+		t.Fatalf("The log file was not rotated by age, %v.", err)
+	}
+	if string(rotated) != "abc" {
+		t.Fatalf("The rotated log file contains %q, not %q.", rotated, "abc")
+	}
+	current, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(current) != "def" {
+		t.Fatalf("The log file contains %q, not %q.", current, "def")
+	}
+}
+
+func TestRotatingFileErrors(t *testing.T) {
+	now := time.Date(2019, time.October, 10, 13, 55, 36, 0, time.UTC)
+
+	// The names of rotated logs are too long, so they can't be checked, and writes continue to the log file.
+	path := filepath.Join(t.TempDir(), strings.Repeat("a", 245)+".log")
+	f, err := newRotatingFile(path, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	f.now = func() time.Time { return now }
+	f.Write([]byte("0123456789"))
+	_, err = f.Write([]byte("abc"))
+	if err != nil {
+		t.Fatalf("A write after a failed rotation returned %v.", err)
+	}
+	current, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(current) != "0123456789abc" {
+		t.Fatalf("The log file contains %q, not %q.", current, "0123456789abc")
+	}
+
+	// The log file's directory is removed, so it can't be renamed or opened again. Once the directory is back,
+	// the log file is rotated and opened again.
+	dir := filepath.Join(t.TempDir(), "logs")
+	err = os.Mkdir(dir, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path = filepath.Join(dir, "access.log")
+	f, err = newRotatingFile(path, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	f.now = func() time.Time { return now }
+	f.Write([]byte("0123456789"))
+	err = os.RemoveAll(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.Write([]byte("abc"))
+	if err == nil {
+		t.Fatal("A write after the log file couldn't be opened again returned no error.")
+	}
+	err = os.Mkdir(dir, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(logRotationRetryInterval)
+	_, err = f.Write([]byte("def"))
+	if err != nil {
+		t.Fatalf("A write after the log file's directory was restored returned %v.", err)
+	}
+	current, err = os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(current) != "def" {
+		t.Fatalf("The log file contains %q, not %q.", current, "def")
+	}
+}
@@ -0,0 +1,23 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// defaultACMECacheDir is the default directory in which ACME certificates are stored.
+const defaultACMECacheDir string = "acme-cache"
+
+// newACMEManager returns an autocert.Manager which obtains and renews certificates for the hosts
+// from Let's Encrypt, storing them in cacheDir.
+func newACMEManager(hosts []string, cacheDir, email string) *autocert.Manager {
+	return &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(hosts...),
+		Cache:      autocert.DirCache(cacheDir),
+		Email:      email,
+	}
+}
@@ -0,0 +1,45 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+)
+
+// listenFDsStart is the first file descriptor passed by systemd socket activation.
+const listenFDsStart int = 3
+
+// systemdListeners returns the listeners passed by systemd socket activation, described by the
+// LISTEN_PID and LISTEN_FDS environment variables. It returns no listeners when the process wasn't socket activated.
+func systemdListeners() ([]net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n < 1 {
+		return nil, nil
+	}
+	// Child processes shouldn't also think they were socket activated.
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	listeners := make([]net.Listener, 0, n)
+	for fd := listenFDsStart; fd < listenFDsStart+n; fd++ {
+		f := os.NewFile(uintptr(fd), fmt.Sprintf("LISTEN_FD_%v", fd))
+		l, err := net.FileListener(f)
+		// FileListener duplicates the file descriptor.
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("Could not use file descriptor %v from systemd as a listener, %w", fd, err)
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, nil
+}
@@ -0,0 +1,37 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"os"
+	"strconv"
+	"testing"
+)
+
+func TestSystemdListenersNotActivated(t *testing.T) {
+	var tests = []struct {
+		name string
+		pid  string
+		fds  string
+	}{
+		{"unset", "", ""},
+		{"other process", strconv.Itoa(os.Getpid() + 1), "1"},
+		{"no descriptors", strconv.Itoa(os.Getpid()), "0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("LISTEN_PID", tt.pid)
+			t.Setenv("LISTEN_FDS", tt.fds)
+			listeners, err := systemdListeners()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(listeners) != 0 {
+				t.Fatalf("systemdListeners() returned %v listeners, not 0.", len(listeners))
+			}
+		})
+	}
+}
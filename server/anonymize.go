@@ -0,0 +1,203 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The ways client addresses are anonymized in logs.
+const (
+	anonymizeTruncate string = "truncate"
+	anonymizeHash     string = "hash"
+)
+
+// anonymizeModes are the ways client addresses are anonymized in logs.
+var anonymizeModes = []string{anonymizeTruncate, anonymizeHash}
+
+const (
+	// anonymizeCommand is the subcommand which anonymizes the client addresses of access logs.
+	anonymizeCommand string = "anonymize"
+
+	// defaultAnonymizeSaltRotation is how often the salt of hashed client addresses is replaced.
+	defaultAnonymizeSaltRotation time.Duration = 24 * time.Hour
+
+	// anonymizedIPv4Bits and anonymizedIPv6Bits are the prefix lengths kept when addresses are truncated.
+	anonymizedIPv4Bits int = 24
+	anonymizedIPv6Bits int = 48
+
+	// anonymizedHashBytes is the number of bytes of the HMAC kept when addresses are hashed.
+	anonymizedHashBytes int = 8
+)
+
+// ipAnonymizer anonymizes client addresses before they are logged, by zeroing their low bits,
+// or replacing them with a keyed hash. The key, or salt, is random, never written anywhere,
+// and replaced each rotation, so the same client can only be followed through the logs until then.
+// A nil *ipAnonymizer doesn't change addresses.
+type ipAnonymizer struct {
+	mode     string
+	rotation time.Duration // Never rotated when 0.
+	now      func() time.Time
+
+	mu     sync.Mutex
+	salt   []byte
+	period time.Time // The start of the rotation the salt was made for.
+}
+
+// newIPAnonymizer returns an ipAnonymizer, or nil if mode is empty and addresses are logged as they are.
+func newIPAnonymizer(mode string, rotation time.Duration) (*ipAnonymizer, error) {
+	switch mode {
+	case "":
+		return nil, nil
+	case anonymizeTruncate, anonymizeHash:
+		return &ipAnonymizer{mode: mode, rotation: max(rotation, 0), now: time.Now}, nil
+	default:
+		return nil, fmt.Errorf("Unknown anonymization %q, expected %v", mode, strings.Join(anonymizeModes, " or "))
+	}
+}
+
+// anonymize returns the anonymized client address. Addresses which can't be parsed, which shouldn't happen,
+// are truncated to nothing, and logged as "-".
+func (a *ipAnonymizer) anonymize(client string) string {
+	if a == nil {
+		return client
+	}
+	addr, err := netip.ParseAddr(client)
+	if err != nil {
+		if a.mode == anonymizeHash && client != "" {
+			return a.hash(client)
+		}
+		return ""
+	}
+	addr = addr.Unmap().WithZone("")
+	if a.mode == anonymizeHash {
+		return a.hash(addr.String())
+	}
+	return truncateAddr(addr)
+}
+
+// truncateAddr returns the address with its low bits zeroed, keeping the network of IPv4 /24 and IPv6 /48 prefixes.
+func truncateAddr(addr netip.Addr) string {
+	bits := anonymizedIPv6Bits
+	if addr.Is4() {
+		bits = anonymizedIPv4Bits
+	}
+	prefix, _ := addr.Prefix(bits)
+	return prefix.Addr().String()
+}
+
+// hash returns the first bytes of the HMAC-SHA256 of client with the current salt, in hex.
+func (a *ipAnonymizer) hash(client string) string {
+	a.mu.Lock()
+	// Rotations start at multiples of the rotation since the zero time, so a daily salt is replaced at midnight UTC.
+	period := time.Time{}
+	if a.rotation > 0 {
+		period = a.now().UTC().Truncate(a.rotation)
+	}
+	if a.salt == nil || !period.Equal(a.period) {
+		a.salt = make([]byte, sha256.Size)
+		rand.Read(a.salt)
+		a.period = period
+	}
+	mac := hmac.New(sha256.New, a.salt)
+	a.mu.Unlock()
+	mac.Write([]byte(client))
+	return hex.EncodeToString(mac.Sum(nil)[:anonymizedHashBytes])
+}
+
+// runAnonymize anonymizes the client addresses of the access logs given in args, or standard input,
+// in the common or combined format, and writes them to the -o file or stdout. It returns the exit status,
+// 1 if a log couldn't be read or written, or 2 if the arguments are invalid.
+func runAnonymize(stdout, stderr io.Writer, args []string) int {
+	flags := flag.NewFlagSet(anonymizeCommand, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	mode := flags.String("mode", anonymizeTruncate, "How client addresses are anonymized, truncate or hash. Hashes are salted for this run only.")
+	output := flags.String("o", "", "The file to write the anonymized log to. Written to standard output when empty or -.")
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: permanentdetour %v [-mode truncate|hash] [-o anonymized.log] [access.log...]\n", anonymizeCommand)
+		flags.PrintDefaults()
+	}
+	err := flags.Parse(args)
+	if err != nil {
+		return 2
+	}
+	anonymizer, err := newIPAnonymizer(*mode, 0)
+	if err != nil || anonymizer == nil {
+		flags.Usage()
+		return 2
+	}
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"-"}
+	}
+
+	anonymizeAll := func(w io.Writer) error {
+		for _, path := range paths {
+			err := anonymizeLogFile(w, anonymizer, path)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if *output == "" || *output == "-" {
+		bw := bufio.NewWriter(stdout)
+		err = anonymizeAll(bw)
+		if err == nil {
+			err = bw.Flush()
+		}
+	} else {
+		err = writeMappingFile(*output, anonymizeAll)
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// anonymizeLogFile writes the access log at path, or standard input if path is -, to w,
+// with the client address at the start of each line anonymized.
+func anonymizeLogFile(w io.Writer, a *ipAnonymizer, path string) error {
+	r := io.Reader(os.Stdin)
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("Could not open access log %v, %w", path, err)
+		}
+		defer file.Close()
+		r = file
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		client, rest, found := strings.Cut(scanner.Text(), " ")
+		if found {
+			client = logField(a.anonymize(client))
+			rest = " " + rest
+		}
+		_, err := fmt.Fprintf(w, "%v%v\n", client, rest)
+		if err != nil {
+			return err
+		}
+	}
+	err := scanner.Err()
+	if err != nil {
+		return fmt.Errorf("Could not read access log %v, %w", path, err)
+	}
+	return nil
+}
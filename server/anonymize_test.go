@@ -0,0 +1,141 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIPAnonymizerTruncate(t *testing.T) {
+	a, err := newIPAnonymizer(anonymizeTruncate, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tests = []struct {
+		client   string
+		expected string
+	}{
+		{"192.0.2.123", "192.0.2.0"},
+		{"::ffff:192.0.2.123", "192.0.2.0"},
+		{"2001:db8:1:2:3:4:5:6", "2001:db8:1::"},
+		{"fe80::1%eth0", "fe80::"},
+		{"not an address", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		anonymized := a.anonymize(tt.client)
+		if anonymized != tt.expected {
+			t.Errorf("anonymize(%q) returned %q, not %q.", tt.client, anonymized, tt.expected)
+		}
+	}
+}
+
+func TestIPAnonymizerHash(t *testing.T) {
+	a, err := newIPAnonymizer(anonymizeHash, 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2019, time.October, 10, 13, 55, 36, 0, time.UTC)
+	a.now = func() time.Time { return now }
+
+	first := a.anonymize("192.0.2.1")
+	if len(first) != 2*anonymizedHashBytes || strings.Contains(first, "192") {
+		t.Fatalf("anonymize() returned %q, not a hash.", first)
+	}
+	if a.anonymize("::ffff:192.0.2.1") != first {
+		t.Fatal("The same client's addresses were hashed differently.")
+	}
+	if a.anonymize("192.0.2.2") == first {
+		t.Fatal("Different clients were hashed the same.")
+	}
+	// The salt is kept until midnight UTC.
+	now = time.Date(2019, time.October, 10, 23, 59, 59, 0, time.UTC)
+	if a.anonymize("192.0.2.1") != first {
+		t.Fatal("The salt was replaced before the rotation ended.")
+	}
+	now = time.Date(2019, time.October, 11, 0, 0, 0, 0, time.UTC)
+	if a.anonymize("192.0.2.1") == first {
+		t.Fatal("The salt wasn't replaced when the rotation ended.")
+	}
+}
+
+func TestNewIPAnonymizer(t *testing.T) {
+	a, err := newIPAnonymizer("", defaultAnonymizeSaltRotation)
+	if a != nil || err != nil {
+		t.Fatalf("newIPAnonymizer(\"\") returned %v, %v, not nil, nil.", a, err)
+	}
+	if a.anonymize("192.0.2.1") != "192.0.2.1" {
+		t.Fatal("A nil anonymizer changed the address.")
+	}
+	_, err = newIPAnonymizer("scramble", defaultAnonymizeSaltRotation)
+	if err == nil {
+		t.Fatal("An unknown anonymization was accepted.")
+	}
+}
+
+func TestAccessLoggerAnonymized(t *testing.T) {
+	a, err := newIPAnonymizer(anonymizeTruncate, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	handler := newAccessLogger(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), &b, a)
+	r := httptest.NewRequest("GET", "/vwebv/my", nil)
+	r.RemoteAddr = "192.0.2.123:1234"
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	if !strings.HasPrefix(b.String(), "192.0.2.0 - - [") {
+		t.Fatalf("The access log line %q doesn't start with the truncated address.", b.String())
+	}
+}
+
+func TestRunAnonymize(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "access.log")
+	err := os.WriteFile(input, []byte(
+		`192.0.2.123 - - [10/Oct/2019:13:55:36 -0400] "GET /vwebv/holdingsInfo?bibId=1 HTTP/1.1" 307 120 "-" "Mozilla/5.0"`+"\n"+
+			`2001:db8:1:2::5 - - [10/Oct/2019:13:55:37 -0400] "GET / HTTP/1.1" 307 - "-" "-"`+"\n"+
+			`unknown - - [10/Oct/2019:13:55:38 -0400] "GET / HTTP/1.1" 307 - "-" "-"`+"\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr strings.Builder
+	status := runAnonymize(&stdout, &stderr, []string{input})
+	if status != 0 {
+		t.Fatalf("runAnonymize() returned %v, not 0. Output:\n%v", status, stderr.String())
+	}
+	expected := `192.0.2.0 - - [10/Oct/2019:13:55:36 -0400] "GET /vwebv/holdingsInfo?bibId=1 HTTP/1.1" 307 120 "-" "Mozilla/5.0"` + "\n" +
+		`2001:db8:1:: - - [10/Oct/2019:13:55:37 -0400] "GET / HTTP/1.1" 307 - "-" "-"` + "\n" +
+		`- - - [10/Oct/2019:13:55:38 -0400] "GET / HTTP/1.1" 307 - "-" "-"` + "\n"
+	if stdout.String() != expected {
+		t.Fatalf("The anonymized log was\n%v\nnot\n%v", stdout.String(), expected)
+	}
+
+	output := filepath.Join(dir, "access.log.anon")
+	stdout.Reset()
+	status = runAnonymize(&stdout, &stderr, []string{"-mode", "hash", "-o", output, input})
+	if status != 0 {
+		t.Fatalf("runAnonymize() returned %v, not 0. Output:\n%v", status, stderr.String())
+	}
+	content, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if len(lines) != 3 || strings.Contains(string(content), "192.0.2") || !strings.HasSuffix(lines[0], `"GET /vwebv/holdingsInfo?bibId=1 HTTP/1.1" 307 120 "-" "Mozilla/5.0"`) {
+		t.Fatalf("The hashed log was\n%v", string(content))
+	}
+
+	status = runAnonymize(&stdout, &stderr, []string{"-mode", "scramble", input})
+	if status != 2 {
+		t.Fatalf("runAnonymize() with an unknown mode returned %v, not 2.", status)
+	}
+}
@@ -0,0 +1,176 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/cu-library/permanentdetour/detour"
+)
+
+const (
+	// lookupPath is the path of the JSON lookup API.
+	lookupPath string = "/api/v1/lookup"
+
+	// defaultBatchLimit is the default maximum number of bibIDs in a batch lookup.
+	defaultBatchLimit int = 1000
+
+	// batchBytesPerBibID is the allowance for each bibID when limiting the size of batch lookup request bodies.
+	batchBytesPerBibID int64 = 16
+)
+
+// lookupAPIResult is the result of looking up a bibID, as returned by the lookup API.
+// The MMS ID is a string, as it is too large to be safely represented as a JavaScript number.
+type lookupAPIResult struct {
+	BibID uint32 `json:"bibId"`
+	MMSID string `json:"mmsId,omitempty"`
+	Found bool   `json:"found"`
+	URL   string `json:"url,omitempty"`
+}
+
+// apiError is the body of error responses from the APIs.
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// lookup finds the Ex Libris ID and Primo record URL for a bibID.
+// It returns an error if the lookup couldn't finish, like when ctx's deadline passes first.
+func (d Detourer) lookup(ctx context.Context, bibID uint32) (lookupAPIResult, error) {
+	result := lookupAPIResult{BibID: bibID}
+	exlID, present, err := d.lookupID(ctx, bibID)
+	if err != nil {
+		return result, err
+	}
+	if present {
+		result.Found = true
+		result.MMSID = strconv.FormatUint(exlID, 10)
+		result.URL = d.recordURL(exlID).String()
+	}
+	return result, nil
+}
+
+// recordURL returns the Primo record URL for an Ex Libris ID.
+func (d Detourer) recordURL(exlID uint64) *url.URL {
+	recordURL := d.primoURL("/discovery/fulldisplay")
+	detour.SetParam(recordURL, "docid", fmt.Sprintf("alma%v", exlID))
+	detour.SetParam(recordURL, "vid", d.vid)
+	return recordURL
+}
+
+// serveLookup responds to lookup API requests, like /api/v1/lookup?bibId=651520.
+// POST requests are batch lookups.
+func (d Detourer) serveLookup(w http.ResponseWriter, r *http.Request) {
+	if !d.featureEnabled(featureLookupAPI) {
+		writeJSON(w, http.StatusNotFound, apiError{"Lookups are not enabled on this server."})
+		return
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+	case http.MethodPost:
+		d.serveBatchLookup(w, r)
+		return
+	default:
+		w.Header().Set("Allow", "GET, HEAD, POST")
+		writeJSON(w, http.StatusMethodNotAllowed, apiError{"Lookups must use GET, or POST for batch lookups."})
+		return
+	}
+	bibID64, err := strconv.ParseUint(r.URL.Query().Get("bibId"), 10, 32)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, apiError{fmt.Sprintf("The bibId parameter must be a bibID number, %v.", err)})
+		return
+	}
+	ctx, cancel := d.lookupContext(r.Context())
+	defer cancel()
+	result, err := d.lookup(ctx, uint32(bibID64))
+	if err != nil {
+		writeJSON(w, http.StatusServiceUnavailable, apiError{fmt.Sprintf("Could not look up the bibID, %v.", err)})
+		return
+	}
+	status := http.StatusOK
+	if !result.Found {
+		status = http.StatusNotFound
+	}
+	writeJSON(w, status, result)
+}
+
+// serveBatchLookup responds to batch lookup API requests. The body is a JSON array of bibIDs,
+// or when the content type is text/plain, a list of bibIDs with one on each line.
+func (d Detourer) serveBatchLookup(w http.ResponseWriter, r *http.Request) {
+	body := http.MaxBytesReader(w, r.Body, int64(d.batchLimit)*batchBytesPerBibID+batchBytesPerBibID)
+	var bibIDs []uint32
+	var err error
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "text/plain" {
+		bibIDs, err = readBibIDList(body)
+	} else {
+		err = json.NewDecoder(body).Decode(&bibIDs)
+	}
+	if errors.As(err, new(*http.MaxBytesError)) {
+		writeJSON(w, http.StatusRequestEntityTooLarge, apiError{fmt.Sprintf("At most %v bibIDs can be looked up at once.", d.batchLimit)})
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, apiError{fmt.Sprintf("Unable to read the list of bibIDs, %v.", err)})
+		return
+	}
+	if len(bibIDs) > d.batchLimit {
+		writeJSON(w, http.StatusRequestEntityTooLarge, apiError{fmt.Sprintf("At most %v bibIDs can be looked up at once.", d.batchLimit)})
+		return
+	}
+	// The whole batch shares the request's budget for lookups.
+	ctx, cancel := d.lookupContext(r.Context())
+	defer cancel()
+	results := make([]lookupAPIResult, 0, len(bibIDs))
+	for _, bibID := range bibIDs {
+		result, err := d.lookup(ctx, bibID)
+		if err != nil {
+			writeJSON(w, http.StatusServiceUnavailable, apiError{fmt.Sprintf("Could not look up bibID %v, %v.", bibID, err)})
+			return
+		}
+		results = append(results, result)
+	}
+	writeJSON(w, http.StatusOK, results)
+}
+
+// readBibIDList reads a list of bibIDs with one on each line. Blank lines are ignored.
+func readBibIDList(r io.Reader) ([]uint32, error) {
+	bibIDs := []uint32{}
+	scanner := bufio.NewScanner(r)
+	lnum := 0
+	for scanner.Scan() {
+		lnum += 1
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		bibID64, err := strconv.ParseUint(line, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("line %v, %v", lnum, err)
+		}
+		bibIDs = append(bibIDs, uint32(bibID64))
+	}
+	return bibIDs, scanner.Err()
+}
+
+// writeJSON is a helper function which writes v to the response as JSON.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		slog.Error("Error writing JSON response.", "err", err)
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cu-library/permanentdetour/mapping"
+)
+
+func TestServeLookup(t *testing.T) {
+	d := Detourer{
+		store: mapping.NewMap(map[uint32]uint64{651520: 996515203405158}),
+		primo: "ocul-qu.primo.exlibrisgroup.com",
+		vid:   "01OCUL_QU:QU_DEFAULT",
+	}
+	var tests = []struct {
+		request string
+		status  int
+		result  lookupAPIResult
+	}{
+		{"/api/v1/lookup?bibId=651520", http.StatusOK, lookupAPIResult{
+			BibID: 651520,
+			MMSID: "996515203405158",
+			Found: true,
+			URL:   "https://ocul-qu.primo.exlibrisgroup.com/discovery/fulldisplay?docid=alma996515203405158&vid=01OCUL_QU%3AQU_DEFAULT",
+		}},
+		{"/api/v1/lookup?bibId=1", http.StatusNotFound, lookupAPIResult{BibID: 1}},
+		{"/api/v1/lookup?bibId=invalid", http.StatusBadRequest, lookupAPIResult{}},
+		{"/api/v1/lookup", http.StatusBadRequest, lookupAPIResult{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.request, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			d.serveLookup(w, httptest.NewRequest("GET", tt.request, nil))
+			if w.Code != tt.status {
+				t.Fatalf("serveLookup(\"%v\") returned status %v, not %v", tt.request, w.Code, tt.status)
+			}
+			if tt.status == http.StatusBadRequest {
+				return
+			}
+			var result lookupAPIResult
+			err := json.NewDecoder(w.Body).Decode(&result)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result != tt.result {
+				t.Fatalf("serveLookup(\"%v\") returned %+v, not %+v", tt.request, result, tt.result)
+			}
+		})
+	}
+}
+
+func TestServeBatchLookup(t *testing.T) {
+	d := Detourer{
+		store:      mapping.NewMap(map[uint32]uint64{651520: 996515203405158}),
+		primo:      "ocul-qu.primo.exlibrisgroup.com",
+		vid:        "01OCUL_QU:QU_DEFAULT",
+		batchLimit: 3,
+	}
+	var tests = []struct {
+		contentType string
+		body        string
+		status      int
+		found       []bool
+	}{
+		{"application/json", "[651520, 1]", http.StatusOK, []bool{true, false}},
+		{"application/json", "[]", http.StatusOK, []bool{}},
+		{"text/plain; charset=utf-8", "651520\n\n1\n2\n", http.StatusOK, []bool{true, false, false}},
+		{"text/plain", "651520\ninvalid\n", http.StatusBadRequest, nil},
+		{"application/json", "{\"bibId\": 651520}", http.StatusBadRequest, nil},
+		{"application/json", "[1, 2, 3, 4]", http.StatusRequestEntityTooLarge, nil},
+		// Bodies too large for the batch limit aren't read to the end.
+		{"application/json", "[" + strings.Repeat("651520, ", 10) + "651520]", http.StatusRequestEntityTooLarge, nil},
+		{"text/plain", strings.Repeat("651520\n", 11), http.StatusRequestEntityTooLarge, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.body, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("POST", "/api/v1/lookup", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", tt.contentType)
+			d.serveLookup(w, r)
+			if w.Code != tt.status {
+				t.Fatalf("serveLookup(\"%v\") returned status %v, not %v", tt.body, w.Code, tt.status)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			var results []lookupAPIResult
+			err := json.NewDecoder(w.Body).Decode(&results)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(results) != len(tt.found) {
+				t.Fatalf("serveLookup(\"%v\") returned %v results, not %v", tt.body, len(results), len(tt.found))
+			}
+			for i, found := range tt.found {
+				if results[i].Found != found {
+					t.Fatalf("serveLookup(\"%v\") returned %+v, expected found to be %v", tt.body, results[i], found)
+				}
+			}
+		})
+	}
+}
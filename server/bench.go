@@ -0,0 +1,371 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"math/rand/v2"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/cu-library/permanentdetour/mapping"
+)
+
+const (
+	// benchCommand is the subcommand which benchmarks lookups in the mappings.
+	benchCommand string = "bench"
+
+	// benchMap is the backend which keeps the mappings in a Go map, as the server does.
+	benchMap string = "map"
+
+	// benchSorted is the backend which keeps the mappings in slices sorted by bibID, searched with a binary search.
+	benchSorted string = "sorted"
+
+	// benchSnapshot is the backend which loads the mappings into a Go map from a snapshot, for a faster startup.
+	benchSnapshot string = "snapshot"
+
+	// benchSQLite is the backend which looks up the mappings in a SQLite database on disk, which opens without
+	// loading them.
+	benchSQLite string = "sqlite"
+
+	// defaultBenchLookups is the default number of lookups timed.
+	defaultBenchLookups int = 1000000
+)
+
+// benchBackends are the backends the mappings can be benchmarked with.
+var benchBackends = []string{benchMap, benchSorted, benchSnapshot, benchSQLite}
+
+// lookupBackend looks up the MMS ID a bibID is mapped to.
+type lookupBackend interface {
+	lookup(bibID uint32) (uint64, bool, error)
+	mapped() ([]uint32, error) // The bibIDs which are mapped.
+}
+
+// mapBackend keeps the mappings in a map.
+type mapBackend map[uint32]uint64
+
+// lookup returns the MMS ID the bibID is mapped to.
+func (b mapBackend) lookup(bibID uint32) (uint64, bool, error) {
+	exlID, present := b[bibID]
+	return exlID, present, nil
+}
+
+// mapped returns the bibIDs which are mapped.
+func (b mapBackend) mapped() ([]uint32, error) {
+	return slices.Collect(maps.Keys(b)), nil
+}
+
+// sortedBackend keeps the mappings in slices sorted by bibID, which use less memory than a map.
+type sortedBackend struct {
+	bibIDs []uint32
+	exlIDs []uint64
+}
+
+// newSortedBackend returns a sortedBackend of the mappings in m.
+func newSortedBackend(m map[uint32]uint64) sortedBackend {
+	b := sortedBackend{bibIDs: slices.Sorted(maps.Keys(m)), exlIDs: make([]uint64, 0, len(m))}
+	for _, bibID := range b.bibIDs {
+		b.exlIDs = append(b.exlIDs, m[bibID])
+	}
+	return b
+}
+
+// lookup returns the MMS ID the bibID is mapped to.
+func (b sortedBackend) lookup(bibID uint32) (uint64, bool, error) {
+	i, found := slices.BinarySearch(b.bibIDs, bibID)
+	if !found {
+		return 0, false, nil
+	}
+	return b.exlIDs[i], true, nil
+}
+
+// mapped returns the bibIDs which are mapped.
+func (b sortedBackend) mapped() ([]uint32, error) {
+	return b.bibIDs, nil
+}
+
+// sqliteBackend looks up the mappings in a SQLite database. MMS IDs are stored as signed integers, as SQLite has
+// no unsigned integers.
+type sqliteBackend struct {
+	db     *sql.DB
+	lookUp *sql.Stmt
+}
+
+// writeSQLite writes the mappings to a new SQLite database at path.
+func writeSQLite(path string, m map[uint32]uint64) error {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	_, err = db.Exec("CREATE TABLE mappings (bib_id INTEGER PRIMARY KEY, mms_id INTEGER NOT NULL)")
+	if err != nil {
+		return err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	insert, err := tx.Prepare("INSERT INTO mappings (bib_id, mms_id) VALUES (?, ?)")
+	if err != nil {
+		return err
+	}
+	for bibID, exlID := range m {
+		_, err = insert.Exec(bibID, int64(exlID))
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// openSQLiteBackend opens the SQLite database at path read-only, and returns the backend and the number of mappings.
+func openSQLiteBackend(path string) (*sqliteBackend, int, error) {
+	db, err := sql.Open("sqlite", (&url.URL{Scheme: "file", Opaque: path, RawQuery: "mode=ro"}).String())
+	if err != nil {
+		return nil, 0, err
+	}
+	var mappings int
+	err = db.QueryRow("SELECT count(*) FROM mappings").Scan(&mappings)
+	if err != nil {
+		db.Close()
+		return nil, 0, err
+	}
+	lookUp, err := db.Prepare("SELECT mms_id FROM mappings WHERE bib_id = ?")
+	if err != nil {
+		db.Close()
+		return nil, 0, err
+	}
+	return &sqliteBackend{db: db, lookUp: lookUp}, mappings, nil
+}
+
+// lookup returns the MMS ID the bibID is mapped to.
+func (b *sqliteBackend) lookup(bibID uint32) (uint64, bool, error) {
+	var exlID int64
+	err := b.lookUp.QueryRow(bibID).Scan(&exlID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return uint64(exlID), true, nil
+}
+
+// mapped returns the bibIDs which are mapped.
+func (b *sqliteBackend) mapped() ([]uint32, error) {
+	rows, err := b.db.Query("SELECT bib_id FROM mappings")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var bibIDs []uint32
+	for rows.Next() {
+		var bibID uint32
+		err = rows.Scan(&bibID)
+		if err != nil {
+			return nil, err
+		}
+		bibIDs = append(bibIDs, bibID)
+	}
+	return bibIDs, rows.Err()
+}
+
+// Close closes the database.
+func (b *sqliteBackend) Close() error {
+	return b.db.Close()
+}
+
+// benchResult is the result of benchmarking a backend.
+type benchResult struct {
+	mappings int
+	load     time.Duration // The time taken to read the mapping files, snapshot, or database, and build the backend.
+	memory   uint64        // The bytes of heap used by the backend.
+	lookups  int
+	elapsed  time.Duration   // The time taken by all the lookups.
+	latency  []time.Duration // The time taken by each lookup, sorted.
+}
+
+// runBench loads the mapping files given in args into the -backend, times -lookups lookups of mapped bibIDs chosen
+// at random, and reports the lookups per second, latency, and memory used to w. It returns the exit status,
+// 1 if the mappings couldn't be loaded, or 2 if the arguments are invalid.
+func runBench(w io.Writer, args []string) int {
+	flags := flag.NewFlagSet(benchCommand, flag.ContinueOnError)
+	flags.SetOutput(w)
+	backend := flags.String("backend", benchMap, "The backend to keep the mappings in: "+strings.Join(benchBackends, " or ")+".")
+	lookups := flags.Int("lookups", defaultBenchLookups, "The number of lookups to time.")
+	flags.Usage = func() {
+		fmt.Fprintf(w, "Usage: permanentdetour %v [-backend %v] [-lookups n] file...\n", benchCommand, strings.Join(benchBackends, "|"))
+		flags.PrintDefaults()
+	}
+	err := flags.Parse(args)
+	if err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 || !slices.Contains(benchBackends, *backend) || *lookups < 1 {
+		flags.Usage()
+		return 2
+	}
+	result, err := bench(*backend, flags.Args(), *lookups)
+	if err != nil {
+		fmt.Fprintln(w, err)
+		return 1
+	}
+	result.write(w, *backend)
+	return 0
+}
+
+// bench loads the mapping files at paths into the backend, and times the lookups. For the snapshot and sqlite
+// backends, the mappings are first written to a snapshot or database in a temporary directory, and the load time is
+// the time taken to open it, as at startup.
+func bench(backend string, paths []string, lookups int) (benchResult, error) {
+	var result benchResult
+	if backend == benchSnapshot || backend == benchSQLite {
+		dir, err := os.MkdirTemp("", "permanentdetour-bench")
+		if err != nil {
+			return result, fmt.Errorf("Could not create a temporary directory, %w", err)
+		}
+		defer os.RemoveAll(dir)
+		stored, err := storeMappings(backend, dir, paths)
+		if err != nil {
+			return result, err
+		}
+		paths = []string{stored}
+	}
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	b, mappings, err := openBackend(backend, paths)
+	if err != nil {
+		return result, err
+	}
+	if c, ok := b.(io.Closer); ok {
+		defer c.Close()
+	}
+	result.mappings = mappings
+	result.load = time.Since(start)
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+	if after.HeapAlloc > before.HeapAlloc {
+		result.memory = after.HeapAlloc - before.HeapAlloc
+	}
+
+	// The bibIDs are chosen before the lookups are timed.
+	mapped, err := b.mapped()
+	if err != nil {
+		return result, err
+	}
+	bibIDs := make([]uint32, lookups)
+	for i := range bibIDs {
+		bibIDs[i] = mapped[rand.IntN(len(mapped))]
+	}
+	// Each lookup is timed, so the lookups per second and latency include the overhead of reading the clock.
+	result.lookups = lookups
+	result.latency = make([]time.Duration, lookups)
+	start = time.Now()
+	for i, bibID := range bibIDs {
+		lookupStart := time.Now()
+		_, found, err := b.lookup(bibID)
+		result.latency[i] = time.Since(lookupStart)
+		if err != nil {
+			return result, fmt.Errorf("Could not look up bib ID %v, %w", bibID, err)
+		}
+		if !found {
+			return result, fmt.Errorf("Bib ID %v was not found", bibID)
+		}
+	}
+	result.elapsed = time.Since(start)
+	slices.Sort(result.latency)
+	runtime.KeepAlive(b)
+	return result, nil
+}
+
+// loadMappings reads the mapping files at paths into a map. It returns an error if there are no mappings.
+func loadMappings(paths []string) (map[uint32]uint64, error) {
+	m := map[uint32]uint64{}
+	for _, path := range paths {
+		err := mapping.LoadFile(m, path)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(m) == 0 {
+		return nil, fmt.Errorf("No mappings were loaded from %v", strings.Join(paths, ", "))
+	}
+	return m, nil
+}
+
+// storeMappings writes the mappings in the files at paths to a snapshot or SQLite database in dir, for the backend,
+// and returns its path.
+func storeMappings(backend, dir string, paths []string) (string, error) {
+	m, err := loadMappings(paths)
+	if err != nil {
+		return "", err
+	}
+	if backend == benchSQLite {
+		path := filepath.Join(dir, "mappings.db")
+		err = writeSQLite(path, m)
+		if err != nil {
+			return "", fmt.Errorf("Could not write the mappings to SQLite database %v, %w", path, err)
+		}
+		return path, nil
+	}
+	path := filepath.Join(dir, "mappings.snapshot")
+	f, err := os.Create(path)
+	if err != nil {
+		return "", fmt.Errorf("Could not create snapshot %v, %w", path, err)
+	}
+	err = errors.Join(mapping.WriteSnapshot(f, m), f.Close())
+	if err != nil {
+		return "", fmt.Errorf("Could not write snapshot %v, %w", path, err)
+	}
+	return path, nil
+}
+
+// openBackend loads the mapping files at paths into the backend, and returns it and the number of mappings.
+// The path of the snapshot backend is a snapshot, and of the sqlite backend a database.
+func openBackend(backend string, paths []string) (lookupBackend, int, error) {
+	if backend == benchSQLite {
+		return openSQLiteBackend(paths[0])
+	}
+	m, err := loadMappings(paths)
+	if err != nil {
+		return nil, 0, err
+	}
+	if backend == benchSorted {
+		return newSortedBackend(m), len(m), nil
+	}
+	return mapBackend(m), len(m), nil
+}
+
+// percentile returns the latency which p percent of the lookups took at most.
+func (r benchResult) percentile(p float64) time.Duration {
+	return r.latency[int(float64(len(r.latency)-1)*p/100)]
+}
+
+// write writes the result to w.
+func (r benchResult) write(w io.Writer, backend string) {
+	fmt.Fprintf(w, "Backend:     %v\n", backend)
+	fmt.Fprintf(w, "Mappings:    %v\n", r.mappings)
+	fmt.Fprintf(w, "Load time:   %v\n", r.load.Round(time.Millisecond))
+	fmt.Fprintf(w, "Memory:      %.1f MB\n", float64(r.memory)/(1<<20))
+	fmt.Fprintf(w, "Lookups:     %v\n", r.lookups)
+	fmt.Fprintf(w, "Lookups/sec: %.0f\n", float64(r.lookups)/r.elapsed.Seconds())
+	fmt.Fprintf(w, "p50 latency: %v\n", r.percentile(50))
+	fmt.Fprintf(w, "p99 latency: %v\n", r.percentile(99))
+}
@@ -0,0 +1,84 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBackends(t *testing.T) {
+	m := map[uint32]uint64{651520: 996515203405158, 1: 991234503405158, 4294967295: 18446744073709551615}
+	path := filepath.Join(t.TempDir(), "mappings.db")
+	err := writeSQLite(path, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlite, mappings, err := openSQLiteBackend(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqlite.Close()
+	if mappings != len(m) {
+		t.Fatalf("The SQLite database had %v mappings, not %v.", mappings, len(m))
+	}
+
+	for name, b := range map[string]lookupBackend{benchSorted: newSortedBackend(m), benchSQLite: sqlite} {
+		for bibID, exlID := range m {
+			found, present, err := b.lookup(bibID)
+			if err != nil || !present || found != exlID {
+				t.Errorf("Bib ID %v was looked up in the %v backend as %v, %v, %v, not %v.", bibID, name, found, present, err, exlID)
+			}
+		}
+		_, present, err := b.lookup(2)
+		if err != nil || present {
+			t.Errorf("Bib ID 2 was found in the %v backend, %v, but isn't mapped.", name, err)
+		}
+		mapped, err := b.mapped()
+		if err != nil || len(mapped) != len(m) {
+			t.Errorf("The %v backend had %v mapped bibIDs, %v, not %v.", name, len(mapped), err, len(m))
+		}
+	}
+}
+
+func TestRunBench(t *testing.T) {
+	dir := t.TempDir()
+	mappings := filepath.Join(dir, "mappings.csv")
+	err := os.WriteFile(mappings, []byte("996515203405158,a651520-01ocul_qu\n996515213405158,a651521-01ocul_qu\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, backend := range benchBackends {
+		var out strings.Builder
+		status := runBench(&out, []string{"-backend", backend, "-lookups", "100", mappings})
+		if status != 0 {
+			t.Fatalf("runBench() with the %v backend returned %v, not 0. Output:\n%v", backend, status, out.String())
+		}
+		for _, prefix := range []string{"Backend:     " + backend + "\n", "Mappings:    2\n", "Lookups:     100\n", "p99 latency: "} {
+			if !strings.Contains(out.String(), prefix) {
+				t.Errorf("The %v result didn't have %q. Output:\n%v", backend, prefix, out.String())
+			}
+		}
+	}
+
+	var tests = []struct {
+		args     []string
+		expected int
+	}{
+		{[]string{"-backend", "bbolt", mappings}, 2},
+		{[]string{"-lookups", "0", mappings}, 2},
+		{[]string{}, 2},
+		{[]string{filepath.Join(dir, "missing.csv")}, 1},
+	}
+	for _, tt := range tests {
+		var out strings.Builder
+		status := runBench(&out, tt.args)
+		if status != tt.expected {
+			t.Errorf("runBench(%q) returned %v, not %v.", tt.args, status, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cacheControlMaxAge matches the max-age directive of a Cache-Control header.
+var cacheControlMaxAge = regexp.MustCompile(`(?i)(?:^|[,\s])max-age=(\d+)`)
+
+// parseCacheControlRules parses a semicolon separated list of rule=value pairs, like
+// "record=public, max-age=86400;patron=no-store", into a map of rule names to Cache-Control values.
+// The value for rules which aren't listed is stored under the empty string.
+func parseCacheControlRules(defaultValue, rules string) (map[string]string, error) {
+	m := map[string]string{}
+	if defaultValue != "" {
+		m[""] = defaultValue
+	}
+	for _, pair := range strings.Split(rules, ";") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		rule, value, found := strings.Cut(pair, "=")
+		rule, value = strings.TrimSpace(rule), strings.TrimSpace(value)
+		if !found || rule == "" || value == "" {
+			return nil, fmt.Errorf("Invalid Cache-Control rule %q, expected rule=value", pair)
+		}
+		m[rule] = value
+	}
+	return m, nil
+}
+
+// setCacheHeaders sets the Cache-Control header for the rule's redirects, and an equivalent Expires header
+// for HTTP/1.0 caches. Nothing is set if no value is configured for the rule.
+func setCacheHeaders(h http.Header, cacheControl map[string]string, rule string, now time.Time) {
+	value, present := cacheControl[rule]
+	if !present {
+		value, present = cacheControl[""]
+	}
+	if !present {
+		return
+	}
+	h.Set("Cache-Control", value)
+	lower := strings.ToLower(value)
+	if strings.Contains(lower, "no-store") || strings.Contains(lower, "no-cache") {
+		// A date in the past means already expired.
+		h.Set("Expires", time.Unix(0, 0).UTC().Format(http.TimeFormat))
+		return
+	}
+	match := cacheControlMaxAge.FindStringSubmatch(value)
+	if match != nil {
+		maxAge, err := strconv.ParseInt(match[1], 10, 64)
+		if err == nil {
+			h.Set("Expires", now.Add(time.Duration(maxAge)*time.Second).UTC().Format(http.TimeFormat))
+		}
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestSetCacheHeaders(t *testing.T) {
+	now := time.Date(2019, time.October, 10, 13, 55, 36, 0, time.UTC)
+	cacheControl, err := parseCacheControlRules("no-store", "record=public, max-age=86400; patron=private")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		rule         string
+		cacheControl string
+		expires      string
+	}{
+		{"record", "public, max-age=86400", "Fri, 11 Oct 2019 13:55:36 GMT"},
+		{"patron", "private", ""},
+		{"search", "no-store", "Thu, 01 Jan 1970 00:00:00 GMT"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rule, func(t *testing.T) {
+			h := http.Header{}
+			setCacheHeaders(h, cacheControl, tt.rule, now)
+			if h.Get("Cache-Control") != tt.cacheControl {
+				t.Fatalf("Cache-Control was %q, not %q.", h.Get("Cache-Control"), tt.cacheControl)
+			}
+			if h.Get("Expires") != tt.expires {
+				t.Fatalf("Expires was %q, not %q.", h.Get("Expires"), tt.expires)
+			}
+		})
+	}
+
+	h := http.Header{}
+	setCacheHeaders(h, nil, "record", now)
+	if len(h) != 0 {
+		t.Fatalf("Headers %v were set when no Cache-Control is configured.", h)
+	}
+
+	_, err = parseCacheControlRules("", "record")
+	if err == nil {
+		t.Fatal("parseCacheControlRules should have returned an error for a rule without a value, but it did not.")
+	}
+}
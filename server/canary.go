@@ -0,0 +1,74 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+)
+
+// canaryConfig is the canary in the configuration file, which routes a percentage of clients' redirects
+// to an alternate Primo view, like one being piloted, so it can be compared before a full cutover.
+type canaryConfig struct {
+	Percent   int    `json:"percent"`             // The percentage of clients whose redirects go to the canary, from 0 to 100.
+	VID       string `json:"vid,omitempty"`       // The canary's vid parameter for Primo.
+	Primo     string `json:"primo,omitempty"`     // The subdomain of the canary's Primo instance.
+	PrimoHost string `json:"primoHost,omitempty"` // The host of the canary's Primo instance, when it is behind a custom hostname.
+}
+
+// canary is a parsed canaryConfig. A nil *canary never chooses a request.
+type canary struct {
+	percent   uint32
+	vid       string
+	primo     string
+	primoHost string
+}
+
+// newCanary returns the canary for the configuration, or nil if its percentage is 0.
+func newCanary(c canaryConfig) (*canary, error) {
+	if c.Percent == 0 {
+		return nil, nil
+	}
+	if c.Percent < 0 || c.Percent > 100 {
+		return nil, fmt.Errorf("the canary percentage %v is not between 0 and 100", c.Percent)
+	}
+	if c.VID == "" && c.Primo == "" && c.PrimoHost == "" {
+		return nil, errors.New("the canary needs a vid, Primo subdomain, or Primo host")
+	}
+	if c.PrimoHost != "" {
+		_, _, err := parsePrimoHost(c.PrimoHost)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Primo host of the canary, %w", err)
+		}
+	}
+	return &canary{percent: uint32(c.Percent), vid: c.VID, primo: c.Primo, primoHost: c.PrimoHost}, nil
+}
+
+// chooses reports whether the request's redirect goes to the canary. Clients are chosen by a hash of
+// their address, so each client is consistently sent to the same view.
+func (c *canary) chooses(r *http.Request) bool {
+	if c == nil {
+		return false
+	}
+	h := fnv.New32a()
+	h.Write([]byte(clientIP(r)))
+	return h.Sum32()%100 < c.percent
+}
+
+// apply changes the Detourer to redirect to the canary's Primo instance and vid.
+func (c *canary) apply(d *Detourer) {
+	if c.primo != "" {
+		d.setPrimoSubdomain(c.primo)
+	}
+	if c.primoHost != "" {
+		// The host was checked by newCanary.
+		d.setPrimoHost(c.primoHost)
+	}
+	if c.vid != "" {
+		d.vid = c.vid
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cu-library/permanentdetour/mapping"
+)
+
+func TestNewCanary(t *testing.T) {
+	var tests = []struct {
+		config canaryConfig
+		err    bool
+	}{
+		{canaryConfig{}, false},
+		{canaryConfig{Percent: 10, VID: "01OCUL_QU:QU_NEW"}, false},
+		{canaryConfig{Percent: 100, PrimoHost: "search.library.queensu.ca"}, false},
+		{canaryConfig{Percent: 101, VID: "01OCUL_QU:QU_NEW"}, true},
+		{canaryConfig{Percent: -1, VID: "01OCUL_QU:QU_NEW"}, true},
+		{canaryConfig{Percent: 10}, true},
+		{canaryConfig{Percent: 10, PrimoHost: "search.library.queensu.ca/discovery"}, true},
+	}
+	for _, tt := range tests {
+		_, err := newCanary(tt.config)
+		if (err != nil) != tt.err {
+			t.Errorf("newCanary(%+v) returned %v.", tt.config, err)
+		}
+	}
+}
+
+func TestCanaryChooses(t *testing.T) {
+	c, err := newCanary(canaryConfig{Percent: 25, VID: "01OCUL_QU:QU_NEW"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	chosen := 0
+	for i := 0; i < 1000; i++ {
+		r := httptest.NewRequest("GET", "/vwebv/holdingsInfo?bibId=651520", nil)
+		r.RemoteAddr = fmt.Sprintf("10.0.%v.%v:1234", i/256, i%256)
+		first := c.chooses(r)
+		r.RemoteAddr = fmt.Sprintf("10.0.%v.%v:5678", i/256, i%256)
+		if c.chooses(r) != first {
+			t.Fatalf("%v was chosen inconsistently.", r.RemoteAddr)
+		}
+		if first {
+			chosen++
+		}
+	}
+	if chosen < 200 || chosen > 300 {
+		t.Fatalf("%v of 1000 clients were chosen, not about 250.", chosen)
+	}
+	var none *canary
+	if none.chooses(httptest.NewRequest("GET", "/", nil)) {
+		t.Fatal("A nil canary chose a request.")
+	}
+}
+
+func TestServeHTTPCanary(t *testing.T) {
+	c, err := newCanary(canaryConfig{Percent: 100, VID: "01OCUL_QU:QU_NEW", Primo: "ocul-qu-new"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := Detourer{
+		store:   mapping.NewMap(map[uint32]uint64{651520: 996515203405158}),
+		primo:   "ocul-qu.primo.exlibrisgroup.com",
+		vid:     "01OCUL_QU:QU_DEFAULT",
+		canary:  c,
+		metrics: NewMetrics(),
+	}
+	w := httptest.NewRecorder()
+	observed(d).ServeHTTP(w, httptest.NewRequest("GET", "/vwebv/holdingsInfo?bibId=651520", nil))
+	expected := "https://ocul-qu-new.primo.exlibrisgroup.com/discovery/fulldisplay?docid=alma996515203405158&vid=01OCUL_QU%3AQU_NEW"
+	if w.Header().Get("Location") != expected {
+		t.Fatalf("The redirect was to %v, not %v.", w.Header().Get("Location"), expected)
+	}
+	if w.Header().Get("Cache-Control") != "no-store" {
+		t.Fatalf("The Cache-Control header was %q, not no-store.", w.Header().Get("Cache-Control"))
+	}
+	if d.metrics.canary.Load() != 1 {
+		t.Fatalf("%v canary redirects were counted, not 1.", d.metrics.canary.Load())
+	}
+}
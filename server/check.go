@@ -0,0 +1,233 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/cu-library/permanentdetour/mapping"
+)
+
+const (
+	// checkCommand is the subcommand which validates the configuration and mapping files without serving.
+	checkCommand string = "check"
+
+	// checkFileProblemLimit is the maximum number of problems reported for each mapping file,
+	// so a file in the wrong format doesn't bury the rest of the report.
+	checkFileProblemLimit int = 100
+)
+
+// checkSettings are the settings validated by the check subcommand.
+type checkSettings struct {
+	primo             string
+	primoHost         string
+	vid               string
+	cacheControl      string
+	cacheControlRules string
+	canary            canaryConfig
+	configPath        string
+	mappingFiles      []string
+}
+
+// mappingLocation is the file and line on which a bibID was mapped.
+type mappingLocation struct {
+	file int // The index of the file in the list of mapping files.
+	line int // The line number, or 0 in a snapshot.
+}
+
+// format returns the location, like mappings.csv:17, given the list of mapping files.
+func (l mappingLocation) format(paths []string) string {
+	if l.line == 0 {
+		return paths[l.file]
+	}
+	return fmt.Sprintf("%v:%v", paths[l.file], l.line)
+}
+
+// runCheck validates the settings, the configuration file, and the mapping files, reporting every problem found to w.
+// It returns the exit status, 1 if any problem was found.
+func runCheck(w io.Writer, s checkSettings) int {
+	var problems []string
+	report := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	d := Detourer{vid: s.vid}
+	if s.primo != "" {
+		d.setPrimoSubdomain(s.primo)
+	}
+	if s.primoHost != "" {
+		err := d.setPrimoHost(s.primoHost)
+		if err != nil {
+			report("-primo-host: %v", err)
+		}
+	}
+	_, err := parseCacheControlRules(s.cacheControl, s.cacheControlRules)
+	if err != nil {
+		report("-cache-control-rules: %v", err)
+	}
+	_, err = newCanary(s.canary)
+	if err != nil {
+		report("-canary-percent: %v", err)
+	}
+
+	configured := d
+	if s.configPath != "" {
+		var configProblems []string
+		configured, configProblems = checkConfigFile(s.configPath, d)
+		problems = append(problems, configProblems...)
+	}
+	err = configured.checkPrimo()
+	if err != nil {
+		report("%v", err)
+	}
+
+	mappings, mappingProblems := checkMappingFiles(s.mappingFiles)
+	problems = append(problems, mappingProblems...)
+
+	for _, problem := range problems {
+		fmt.Fprintln(w, problem)
+	}
+	if len(problems) > 0 {
+		fmt.Fprintf(w, "%v problems found.\n", len(problems))
+		return 1
+	}
+	fmt.Fprintf(w, "No problems found. %v mappings in %v files.\n", mappings, len(s.mappingFiles))
+	return 0
+}
+
+// checkConfigFile returns d with the configuration file at path applied, and every problem with the file,
+// including those with the tenants' mapping files.
+func checkConfigFile(path string, d Detourer) (Detourer, []string) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return d, []string{fmt.Sprintf("%v: Could not read configuration file, %v", path, err)}
+	}
+	c, err := parseConfigFile(content)
+	if err != nil {
+		return d, []string{fmt.Sprintf("%v: %v", path, err)}
+	}
+	var problems []string
+	for _, err := range problemList(c.validate()) {
+		problems = append(problems, fmt.Sprintf("%v: %v", path, err))
+	}
+	configured, err := c.apply(d)
+	if err != nil {
+		configured = d
+	}
+	dir := filepath.Dir(path)
+	for _, tc := range c.Tenants {
+		paths := make([]string, 0, len(tc.Mappings))
+		for _, mappingPath := range tc.Mappings {
+			if !filepath.IsAbs(mappingPath) {
+				mappingPath = filepath.Join(dir, mappingPath)
+			}
+			paths = append(paths, mappingPath)
+		}
+		_, tenantProblems := checkMappingFiles(paths)
+		problems = append(problems, tenantProblems...)
+	}
+	return configured, problems
+}
+
+// problemList returns the errors joined in err, one for each problem.
+func problemList(err error) []error {
+	if err == nil {
+		return nil
+	}
+	var list []error
+	switch e := err.(type) {
+	case interface{ Unwrap() []error }:
+		for _, wrapped := range e.Unwrap() {
+			list = append(list, problemList(wrapped)...)
+		}
+	default:
+		list = append(list, err)
+	}
+	return list
+}
+
+// checkMappingFiles returns the number of mappings in the files, and every invalid or duplicate line.
+func checkMappingFiles(paths []string) (int, []string) {
+	seen := map[uint32]mappingLocation{}
+	var problems []string
+	for i := range paths {
+		problems = append(problems, checkMappingFile(seen, paths, i)...)
+	}
+	return len(seen), problems
+}
+
+// checkMappingFile adds the mappings in the file paths[index] to seen, and returns its problems, up to checkFileProblemLimit.
+func checkMappingFile(seen map[uint32]mappingLocation, paths []string, index int) []string {
+	path := paths[index]
+	file, err := os.Open(path)
+	if err != nil {
+		return []string{fmt.Sprintf("%v: Could not open mapping file, %v", path, err)}
+	}
+	defer file.Close()
+
+	var problems []string
+	omitted := 0
+	report := func(format string, args ...any) {
+		if len(problems) >= checkFileProblemLimit {
+			omitted++
+			return
+		}
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+	reader := bufio.NewReader(file)
+	if mapping.IsSnapshot(reader) {
+		checkSnapshot(seen, paths, index, reader, report)
+	} else {
+		scanner := bufio.NewScanner(reader)
+		lnum := 0
+		for scanner.Scan() {
+			lnum++
+			bibID, _, err := mapping.ParseLine(scanner.Text())
+			if err != nil {
+				report("%v:%v: Unable to process line '%v', %v", path, lnum, scanner.Text(), err)
+				continue
+			}
+			previous, present := seen[bibID]
+			if present {
+				report("%v:%v: Bib ID %v was previously seen at %v", path, lnum, bibID, previous.format(paths))
+				continue
+			}
+			seen[bibID] = mappingLocation{file: index, line: lnum}
+		}
+		err = scanner.Err()
+		if err != nil {
+			report("%v: Scanner error after line %v, %v", path, lnum, err)
+		}
+	}
+	if omitted > 0 {
+		problems = append(problems, fmt.Sprintf("%v: %v more problems were not listed", path, omitted))
+	}
+	return problems
+}
+
+// checkSnapshot adds the mappings in the snapshot paths[index], read from r, to seen, and reports its problems.
+func checkSnapshot(seen map[uint32]mappingLocation, paths []string, index int, r io.Reader, report func(format string, args ...any)) {
+	path := paths[index]
+	m := map[uint32]uint64{}
+	err := mapping.ReadSnapshot(r, m)
+	if err != nil {
+		report("%v: Could not read snapshot, %v", path, err)
+		return
+	}
+	for _, bibID := range slices.Sorted(maps.Keys(m)) {
+		previous, present := seen[bibID]
+		if present {
+			report("%v: Bib ID %v was previously seen at %v", path, bibID, previous.format(paths))
+			continue
+		}
+		seen[bibID] = mappingLocation{file: index}
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunCheck(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		err := os.WriteFile(path, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	valid := write("valid.csv", "996515203405158,a651520-01ocul_qu\n996515213405158,a651521-01ocul_qu\n")
+	invalid := write("invalid.csv", "996515223405158,a651522-01ocul_qu\nnot a mapping\n996515203405159,a651520-01ocul_qu\n")
+	write("law.csv", "bad,a1-01ocul_qu\n")
+	config := write("config.json", `{"fallback":"library.queensu.ca","routes":[{"prefix":"law/"}],"tenants":[{"name":"law","hosts":["law.example.edu"],"mappings":["law.csv"]}]}`)
+
+	var tests = []struct {
+		name     string
+		settings checkSettings
+		status   int
+		output   []string
+	}{
+		{
+			"valid",
+			checkSettings{primo: "ocul-qu", vid: "01OCUL_QU:QU_DEFAULT", mappingFiles: []string{valid}},
+			0,
+			[]string{"No problems found. 2 mappings in 1 files."},
+		},
+		{
+			"every problem",
+			checkSettings{vid: "01OCUL_QU:QU_DEFAULT", cacheControlRules: "record", configPath: config, mappingFiles: []string{valid, invalid}},
+			1,
+			[]string{
+				"-cache-control-rules: Invalid Cache-Control rule",
+				config + ": invalid fallback",
+				config + `: the route prefix "law/" must start with /`,
+				filepath.Join(dir, "law.csv") + ":1: Unable to process line 'bad,a1-01ocul_qu'",
+				"Set -primo",
+				invalid + ":2: Unable to process line 'not a mapping'",
+				invalid + ":3: Bib ID 651520 was previously seen at " + valid + ":1",
+				"7 problems found.",
+			},
+		},
+		{
+			"missing file",
+			checkSettings{primo: "ocul-qu", vid: "01OCUL_QU:QU_DEFAULT", mappingFiles: []string{filepath.Join(dir, "missing.csv")}},
+			1,
+			[]string{filepath.Join(dir, "missing.csv") + ": Could not open mapping file"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			status := runCheck(&out, tt.settings)
+			if status != tt.status {
+				t.Fatalf("runCheck() returned %v, not %v. Output:\n%v", status, tt.status, out.String())
+			}
+			lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+			for i, expected := range tt.output {
+				if i >= len(lines) || !strings.HasPrefix(lines[i], expected) {
+					t.Fatalf("Line %v of the output didn't start with %q. Output:\n%v", i+1, expected, out.String())
+				}
+			}
+		})
+	}
+}
+
+func TestCheckMappingFileLimit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "invalid.csv")
+	err := os.WriteFile(path, []byte(strings.Repeat("not a mapping\n", checkFileProblemLimit+5)), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, problems := checkMappingFiles([]string{path})
+	if len(problems) != checkFileProblemLimit+1 {
+		t.Fatalf("%v problems were reported, not %v.", len(problems), checkFileProblemLimit+1)
+	}
+	if !strings.HasSuffix(problems[checkFileProblemLimit], "5 more problems were not listed") {
+		t.Fatalf("The last problem was %q, not a count of those not listed.", problems[checkFileProblemLimit])
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/cu-library/permanentdetour/mapping"
+)
+
+// compileCommand is the subcommand which compiles mapping files into a snapshot.
+const compileCommand string = "compile"
+
+// runCompile compiles the mapping files given in args into the snapshot set by -o, and reports the result to stderr.
+// The snapshot is read back, so its checksum is verified before it is deployed. It returns the exit status,
+// 1 if the compile failed, or 2 if the arguments are invalid.
+func runCompile(stderr io.Writer, args []string) int {
+	flags := flag.NewFlagSet(compileCommand, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	output := flags.String("o", "", "The snapshot file to write. Required.")
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: permanentdetour %v -o mappings.snap file...\n", compileCommand)
+		flags.PrintDefaults()
+	}
+	err := flags.Parse(args)
+	if err != nil {
+		return 2
+	}
+	if *output == "" || flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	m := map[uint32]uint64{}
+	for _, path := range flags.Args() {
+		err := mapping.LoadFile(m, path)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+	}
+	err = writeMappingFile(*output, func(w io.Writer) error {
+		return mapping.WriteSnapshot(w, m)
+	})
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	compiled := map[uint32]uint64{}
+	err = mapping.LoadFile(compiled, *output)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	if len(compiled) != len(m) {
+		fmt.Fprintf(stderr, "The snapshot %v has %v mappings, not %v.\n", *output, len(compiled), len(m))
+		return 1
+	}
+	info, err := os.Stat(*output)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	fmt.Fprintf(stderr, "Compiled %v mappings from %v files into %v, %v bytes.\n", len(m), flags.NArg(), *output, info.Size())
+	return 0
+}
@@ -0,0 +1,75 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cu-library/permanentdetour/mapping"
+)
+
+func TestRunCompile(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "first.csv")
+	err := os.WriteFile(first, []byte("996515203405158,a651520-01ocul_qu\n996515213405158,a651521-01ocul_qu\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second := filepath.Join(dir, "second.csv")
+	err = os.WriteFile(second, []byte("996515223405158,a651522-01ocul_qu\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := filepath.Join(dir, "mappings.snap")
+	var stderr strings.Builder
+	status := runCompile(&stderr, []string{"-o", output, first, second})
+	if status != 0 {
+		t.Fatalf("runCompile() returned %v, not 0. Output:\n%v", status, stderr.String())
+	}
+	if !strings.HasPrefix(stderr.String(), "Compiled 3 mappings from 2 files into "+output) {
+		t.Fatalf("The report was %q.", stderr.String())
+	}
+
+	// The server loads the snapshot like a CSV file.
+	m := map[uint32]uint64{}
+	err = mapping.LoadFile(m, output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[uint32]uint64{651520: 996515203405158, 651521: 996515213405158, 651522: 996515223405158}
+	if !maps.Equal(m, expected) {
+		t.Fatalf("The snapshot had %v, not %v.", m, expected)
+	}
+
+	// Duplicates between the snapshot and other files are found by check.
+	mappings, problems := checkMappingFiles([]string{output, first})
+	if mappings != 3 || len(problems) != 2 || problems[0] != first+":1: Bib ID 651520 was previously seen at "+output {
+		t.Fatalf("check found %v mappings and the problems %q.", mappings, problems)
+	}
+
+	// A corrupt snapshot isn't loaded.
+	content, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content[len(mapping.SnapshotMagic)+8] ^= 1
+	err = os.WriteFile(output, content, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = mapping.LoadFile(map[uint32]uint64{}, output)
+	if err == nil {
+		t.Fatal("A corrupt snapshot was loaded.")
+	}
+
+	status = runCompile(&stderr, []string{first})
+	if status != 2 {
+		t.Fatalf("runCompile() without -o returned %v, not 2.", status)
+	}
+}
@@ -0,0 +1,447 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/cu-library/permanentdetour/mapping"
+)
+
+// reloadPath is the path of the admin endpoint which reloads the configuration file.
+const reloadPath string = "/admin/reload"
+
+// configFile is the JSON configuration file, which holds the translation settings which can be changed
+// at runtime. Settings in the file override the equivalent flags, and unset settings keep the flag values.
+type configFile struct {
+	Primo             string             `json:"primo,omitempty"`             // The subdomain of the target Primo instance.
+	PrimoHost         string             `json:"primoHost,omitempty"`         // The host of the target Primo instance, when it is behind a custom hostname.
+	VID               string             `json:"vid,omitempty"`               // The vid parameter for Primo.
+	Sandbox           bool               `json:"sandbox,omitempty"`           // Redirect to the Primo sandbox instead of production.
+	Fallback          string             `json:"fallback,omitempty"`          // The URL requests which match no rule are redirected to, instead of the Primo search form.
+	CacheControl      string             `json:"cacheControl,omitempty"`      // The Cache-Control header of redirects.
+	CacheControlRules map[string]string  `json:"cacheControlRules,omitempty"` // Cache-Control headers of redirects by rule.
+	RobotsTag         string             `json:"robotsTag,omitempty"`         // The X-Robots-Tag header of redirects.
+	NoisePaths        []string           `json:"noisePaths,omitempty"`        // Paths, in addition to the flags, which respond with a 404 status.
+	Rules             []prefixRuleConfig `json:"rules,omitempty"`             // Rules which redirect paths to fixed URLs, checked before the built-in rules.
+	Routes            []pathRouteConfig  `json:"routes,omitempty"`            // Path prefixes translated with their own vid, sharing the mappings.
+	Tenants           []tenantConfig     `json:"tenants,omitempty"`           // Hostnames served with their own Primo instance, vid, and mappings.
+	Canary            *canaryConfig      `json:"canary,omitempty"`            // A percentage of clients redirected to an alternate Primo view.
+	RedirectStatus    int                `json:"redirectStatus,omitempty"`    // The status of redirects, like 301.
+	Cutovers          []cutoverConfig    `json:"cutovers,omitempty"`          // Settings which change at a scheduled time.
+	Features          map[string]bool    `json:"features,omitempty"`          // Features turned off or on, by name.
+}
+
+// prefixRuleConfig is a rule in the configuration file which redirects requests for paths with the prefix to the target URL.
+type prefixRuleConfig struct {
+	Name   string `json:"name"`
+	Prefix string `json:"prefix"`
+	Target string `json:"target"`
+}
+
+// prefixRule is a parsed prefixRuleConfig.
+type prefixRule struct {
+	name   string
+	prefix string
+	target *url.URL
+}
+
+// builtInRules are the names of the rules built into the Detourer, its translators and maintenance mode, which
+// configured rules can't reuse.
+var builtInRules = append(translators.names(), "maintenance")
+
+// loadConfigFile reads and validates the configuration file at path. Unknown settings are errors, so typos are caught.
+func loadConfigFile(path string) (configFile, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return configFile{}, fmt.Errorf("Could not read configuration file %v, %w", path, err)
+	}
+	c, err := parseConfigFile(content)
+	if err != nil {
+		return c, fmt.Errorf("Could not parse configuration file %v, %w", path, err)
+	}
+	err = c.validate()
+	if err != nil {
+		return c, fmt.Errorf("Invalid configuration file %v, %w", path, err)
+	}
+	return c, nil
+}
+
+// parseConfigFile decodes the content of a configuration file. Syntax and type errors include the line number.
+func parseConfigFile(content []byte) (configFile, error) {
+	var c configFile
+	dec := json.NewDecoder(bytes.NewReader(content))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&c)
+	if err == nil {
+		return c, nil
+	}
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		return c, fmt.Errorf("line %v, %w", lineOfOffset(content, syntaxErr.Offset), err)
+	case errors.As(err, &typeErr):
+		return c, fmt.Errorf("line %v, %w", lineOfOffset(content, typeErr.Offset), err)
+	}
+	return c, err
+}
+
+// lineOfOffset returns the line number of the byte offset in content.
+func lineOfOffset(content []byte, offset int64) int {
+	offset = min(max(offset, 0), int64(len(content)))
+	return bytes.Count(content[:offset], []byte("\n")) + 1
+}
+
+// validate returns an error listing every invalid setting in the configuration file.
+func (c configFile) validate() error {
+	_, err := c.apply(Detourer{})
+	return errors.Join(err, validateTenants(c.Tenants), validateCutovers(c.Cutovers))
+}
+
+// apply returns a copy of d with the settings in the configuration file applied, or an error listing every invalid setting.
+func (c configFile) apply(d Detourer) (Detourer, error) {
+	var errs []error
+	if c.Primo != "" {
+		d.setPrimoSubdomain(c.Primo)
+	}
+	if c.PrimoHost != "" {
+		err := d.setPrimoHost(c.PrimoHost)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if c.VID != "" {
+		d.vid = c.VID
+	}
+	if c.Sandbox {
+		d.sandbox = true
+	}
+	if c.Fallback != "" {
+		fallback, err := parseRedirectTarget(c.Fallback)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid fallback, %w", err))
+		}
+		d.fallback = fallback
+	}
+	if c.CacheControl != "" || len(c.CacheControlRules) > 0 {
+		// The map is shared with the previous Detourer, which may still be serving requests.
+		d.cacheControl = maps.Clone(d.cacheControl)
+		if d.cacheControl == nil {
+			d.cacheControl = map[string]string{}
+		}
+		if c.CacheControl != "" {
+			d.cacheControl[""] = c.CacheControl
+		}
+		for _, rule := range slices.Sorted(maps.Keys(c.CacheControlRules)) {
+			value := c.CacheControlRules[rule]
+			if rule == "" || value == "" {
+				errs = append(errs, fmt.Errorf("invalid Cache-Control rule %q=%q", rule, value))
+				continue
+			}
+			d.cacheControl[rule] = value
+		}
+	}
+	if c.RobotsTag != "" {
+		d.robotsTag = c.RobotsTag
+	}
+	if len(c.NoisePaths) > 0 {
+		d.noisePaths = slices.Concat(d.noisePaths, c.NoisePaths)
+	}
+	if c.Canary != nil {
+		canary, err := newCanary(*c.Canary)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		d.canary = canary
+	}
+	if c.RedirectStatus != 0 {
+		err := checkRedirectStatus(c.RedirectStatus)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		d.status = c.RedirectStatus
+	}
+	if len(c.Features) > 0 {
+		err := d.setFeatures(c.Features)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	// Routes and rules replace those of d only when set, so cutovers which don't change them keep them.
+	if len(c.Routes) > 0 {
+		routes, err := parsePathRoutes(c.Routes)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		d.pathRoutes = routes
+	}
+	if len(c.Rules) > 0 {
+		d.prefixRules = nil
+	}
+	for i, rc := range c.Rules {
+		if rc.Name == "" || slices.Contains(builtInRules, rc.Name) {
+			errs = append(errs, fmt.Errorf("rule %v has no name, or the name of a built-in rule", i+1))
+			continue
+		}
+		if !strings.HasPrefix(rc.Prefix, "/") {
+			errs = append(errs, fmt.Errorf("the prefix of rule %v must start with /", rc.Name))
+			continue
+		}
+		target, err := parseRedirectTarget(rc.Target)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid target of rule %v, %w", rc.Name, err))
+			continue
+		}
+		d.prefixRules = append(d.prefixRules, prefixRule{name: rc.Name, prefix: rc.Prefix, target: target})
+	}
+	return d, errors.Join(errs...)
+}
+
+// parseRedirectTarget parses an absolute http or https URL to redirect to.
+func parseRedirectTarget(s string) (*url.URL, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("%q is not an absolute http or https URL", s)
+	}
+	return u, nil
+}
+
+// matchPrefixRule returns the first rule whose prefix matches the path, or nil.
+func matchPrefixRule(rules []prefixRule, path string) *prefixRule {
+	for i := range rules {
+		if strings.HasPrefix(path, rules[i].prefix) {
+			return &rules[i]
+		}
+	}
+	return nil
+}
+
+// liveDetourer serves requests with the current Detourers, which are replaced atomically when the
+// configuration file is reloaded. Requests being served finish with the Detourer they started with.
+type liveDetourer struct {
+	base       Detourer // The Detourer built from the flags, to which the configuration file is applied.
+	configPath string   // The configuration file, or empty if there isn't one.
+
+	rotation logRotation // When the tenants' access logs are rotated.
+
+	mu         sync.Mutex                // Serializes reloads.
+	loaded     map[string]tenantMappings // The tenants' mappings, by mapping files, so reloads don't reload unchanged files.
+	accessLogs map[string]*rotatingFile  // The tenants' access logs, by path, kept open across reloads.
+	cutoverAt  time.Time                 // When the cutovers' maintenance changes were last made, so each is made once.
+	timer      *time.Timer               // Reloads at the next cutover, or nil.
+	current    atomic.Pointer[router]
+}
+
+// newLiveDetourer returns a liveDetourer serving base with the configuration file at configPath applied, if it is set.
+// Tenants' access logs are rotated as set by rotation.
+func newLiveDetourer(base Detourer, configPath string, rotation logRotation) (*liveDetourer, error) {
+	l := &liveDetourer{base: base, configPath: configPath, rotation: rotation}
+	l.current.Store(&router{def: base})
+	if configPath != "" {
+		err := l.reloadAt(time.Now(), true)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// load returns the current Detourer for hosts which aren't a tenant's.
+func (l *liveDetourer) load() Detourer {
+	return l.current.Load().def
+}
+
+// forRequest returns the current Detourer for the request's host.
+func (l *liveDetourer) forRequest(r *http.Request) Detourer {
+	return l.current.Load().forRequest(r)
+}
+
+// reload reads the configuration file and replaces the current Detourer with one using it.
+// If the file is invalid, the current Detourer is kept.
+func (l *liveDetourer) reload() error {
+	return l.reloadAt(time.Now(), false)
+}
+
+// reloadAt reloads the configuration file with the cutovers which are due at now applied, and schedules
+// a reload at the next cutover. If cutover is set, the maintenance mode of cutovers which have become
+// due since the last cutover is also set, which isn't done on other reloads so the admin endpoint isn't overridden.
+func (l *liveDetourer) reloadAt(now time.Time, cutover bool) error {
+	if l.configPath == "" {
+		return errors.New("No configuration file is set")
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	c, err := loadConfigFile(l.configPath)
+	if err != nil {
+		return err
+	}
+	d, err := c.apply(l.base)
+	if err != nil {
+		return err
+	}
+	due, next := dueCutovers(c.Cutovers, now)
+	d, err = applyCutovers(d, due)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(l.configPath)
+	hosts, loaded, err := buildTenants(d, c.Tenants, dir, l.loaded)
+	if err != nil {
+		return err
+	}
+	accessLogs, err := openTenantAccessLogs(c.Tenants, hosts, dir, l.accessLogs, l.rotation)
+	if err != nil {
+		return err
+	}
+	// Mappings which are no longer used by a tenant are forgotten, so their memory can be freed.
+	l.loaded = loaded
+	l.current.Store(&router{def: d, hosts: hosts})
+	closeUnusedLogs(l.accessLogs, accessLogs)
+	l.accessLogs = accessLogs
+
+	if cutover {
+		enabled, set := cutoverMaintenance(due, l.cutoverAt)
+		if set && l.base.maintenance != nil {
+			l.base.maintenance.set(enabled)
+		}
+		l.cutoverAt = now
+	}
+	if l.timer != nil {
+		l.timer.Stop()
+		l.timer = nil
+	}
+	if !next.IsZero() {
+		l.timer = time.AfterFunc(next.Sub(now), l.cutOver)
+	}
+	return nil
+}
+
+// cutOver reloads the configuration file at a scheduled cutover.
+func (l *liveDetourer) cutOver() {
+	err := l.reloadAt(time.Now(), true)
+	if err != nil {
+		slog.Error("Could not cut over to the scheduled settings, the previous configuration is still in use.", "err", err)
+		return
+	}
+	d := l.load()
+	slog.Info("Cut over to the scheduled settings.", "config", l.configPath, "primo", d.primo, "vid", d.vid, "status", d.redirectStatus())
+}
+
+// close closes the tenants' access logs.
+func (l *liveDetourer) close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	closeUnusedLogs(l.accessLogs, nil)
+	l.accessLogs = nil
+	if l.timer != nil {
+		l.timer.Stop()
+		l.timer = nil
+	}
+}
+
+// reloadOnSIGHUP reloads the mapping files, and the configuration file, if there is one, whenever the process
+// receives a SIGHUP signal.
+func (l *liveDetourer) reloadOnSIGHUP() {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGHUP)
+	go func() {
+		for range sigs {
+			l.logMappingsReload(l.reloadMappings())
+			if l.configPath != "" {
+				l.logReload(l.reload())
+			}
+		}
+	}()
+}
+
+// logReload logs the result of a reload.
+func (l *liveDetourer) logReload(err error) {
+	if err != nil {
+		slog.Error("Could not reload configuration, the previous configuration is still in use.", "err", err)
+		return
+	}
+	d := l.load()
+	slog.Info("Reloaded configuration.", "config", l.configPath, "primo", d.primo, "vid", d.vid, "rules", len(d.prefixRules), "tenantHosts", len(l.current.Load().hosts))
+}
+
+// ServeHTTP serves the request with the current Detourer for its host.
+func (l *liveDetourer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d := l.forRequest(r)
+	d.logAccess(w, r, d.ServeHTTP)
+}
+
+// serveLookup serves a lookup API request with the current Detourer for its host.
+func (l *liveDetourer) serveLookup(w http.ResponseWriter, r *http.Request) {
+	d := l.forRequest(r)
+	d.logAccess(w, r, d.serveLookup)
+}
+
+// serveReverseLookup serves a reverse lookup API request with the current Detourer for its host.
+func (l *liveDetourer) serveReverseLookup(w http.ResponseWriter, r *http.Request) {
+	d := l.forRequest(r)
+	d.logAccess(w, r, d.serveReverseLookup)
+}
+
+// reloadError is the body of the response to a reload which failed. When a mapping file couldn't be loaded,
+// the problem is also described by its fields, so deployment tools can point at it.
+type reloadError struct {
+	Error     string `json:"error"`
+	File      string `json:"file,omitempty"`
+	Line      int    `json:"line,omitempty"`
+	Field     string `json:"field,omitempty"`     // The malformed field of the line.
+	Duplicate bool   `json:"duplicate,omitempty"` // A bibID is mapped more than once.
+}
+
+// newReloadError returns the body of the response to a reload which failed with err.
+func newReloadError(err error) reloadError {
+	re := reloadError{Error: err.Error(), Duplicate: errors.Is(err, mapping.ErrDuplicateBibID)}
+	var malformed *mapping.MalformedLineError
+	if errors.As(err, &malformed) {
+		re.File, re.Line, re.Field = malformed.Path, malformed.Line, malformed.Field
+	}
+	return re
+}
+
+// serveReload reloads the configuration file on POST requests.
+func (l *liveDetourer) serveReload(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeJSON(w, http.StatusMethodNotAllowed, apiError{Error: "Reloads must use POST."})
+		return
+	}
+	err := l.reload()
+	l.logReload(err)
+	if err != nil {
+		writeJSON(w, http.StatusUnprocessableEntity, newReloadError(err))
+		return
+	}
+	d := l.load()
+	writeJSON(w, http.StatusOK, struct {
+		Primo string `json:"primo"`
+		VID   string `json:"vid"`
+		Rules int    `json:"rules"`
+	}{d.primo, d.vid, len(d.prefixRules)})
+}
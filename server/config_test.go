@@ -0,0 +1,145 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cu-library/permanentdetour/mapping"
+)
+
+func TestLoadConfigFile(t *testing.T) {
+	var tests = []struct {
+		name    string
+		content string
+		err     string
+	}{
+		{"valid", `{"vid":"01OCUL_QU:QU_NEW","rules":[{"name":"guides","prefix":"/guides","target":"https://guides.library.queensu.ca/"}]}`, ""},
+		{"unknown setting", `{"vidd":"01OCUL_QU:QU_NEW"}`, "unknown field"},
+		{"built-in rule name", `{"rules":[{"name":"record","prefix":"/guides","target":"https://guides.library.queensu.ca/"}]}`, "built-in rule"},
+		{"relative prefix", `{"rules":[{"name":"guides","prefix":"guides","target":"https://guides.library.queensu.ca/"}]}`, "must start with /"},
+		{"relative target", `{"rules":[{"name":"guides","prefix":"/guides","target":"/guides"}]}`, "not an absolute"},
+		{"relative fallback", `{"fallback":"library.queensu.ca"}`, "invalid fallback"},
+		{"empty Cache-Control", `{"cacheControlRules":{"record":""}}`, "Cache-Control"},
+		{"syntax error line", "{\n\"vid\": \"01OCUL_QU:QU_NEW\",\n}", "line 3"},
+		{"type error line", "{\n\"sandbox\": \"yes\"\n}", "line 2"},
+		{"every problem", `{"fallback":"library.queensu.ca","rules":[{"name":"record","prefix":"/guides","target":"https://guides.library.queensu.ca/"}]}`, "is not an absolute http or https URL\nrule 1 has no name"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.json")
+			err := os.WriteFile(path, []byte(tt.content), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = loadConfigFile(path)
+			if tt.err == "" && err != nil {
+				t.Fatal(err)
+			}
+			if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Fatalf("loadConfigFile() returned %v, not an error containing %q.", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestLiveDetourerReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	write := func(content string) {
+		err := os.WriteFile(path, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(`{"vid":"01OCUL_QU:QU_NEW","fallback":"https://library.queensu.ca/","rules":[{"name":"guides","prefix":"/guides","target":"https://guides.library.queensu.ca/"}]}`)
+	base := Detourer{
+		store: mapping.NewMap(map[uint32]uint64{651520: 996515203405158}),
+		primo: "ocul-qu.primo.exlibrisgroup.com",
+		vid:   "01OCUL_QU:QU_DEFAULT",
+	}
+	l, err := newLiveDetourer(base, path, logRotation{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		url      string
+		location string
+	}{
+		{"/vwebv/holdingsInfo?bibId=651520", "https://ocul-qu.primo.exlibrisgroup.com/discovery/fulldisplay?docid=alma996515203405158&vid=01OCUL_QU%3AQU_NEW"},
+		{"/guides/history", "https://guides.library.queensu.ca/"},
+		{"/vwebv/enterCourseReserve.do?courseId=1", "https://library.queensu.ca/"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		l.ServeHTTP(w, httptest.NewRequest("GET", tt.url, nil))
+		if w.Header().Get("Location") != tt.location {
+			t.Fatalf("%v redirected to %v, not %v.", tt.url, w.Header().Get("Location"), tt.location)
+		}
+	}
+
+	// An invalid configuration is rejected, and the previous one kept.
+	write(`{"vid":`)
+	err = l.reload()
+	if err == nil {
+		t.Fatal("reload() didn't return an error for an invalid configuration file.")
+	}
+	if l.load().vid != "01OCUL_QU:QU_NEW" {
+		t.Fatalf("The vid was %v after a failed reload.", l.load().vid)
+	}
+
+	// Settings removed from the file return to the flag values.
+	write(`{}`)
+	r := httptest.NewRequest("POST", reloadPath, nil)
+	w := httptest.NewRecorder()
+	l.serveReload(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("The reload endpoint returned %v, not 200.", w.Code)
+	}
+	d := l.load()
+	if d.vid != base.vid || d.fallback != nil || len(d.prefixRules) != 0 {
+		t.Fatalf("After reloading an empty configuration, the vid was %v, the fallback %v, and there were %v rules.", d.vid, d.fallback, len(d.prefixRules))
+	}
+}
+
+func TestNewReloadError(t *testing.T) {
+	dir := t.TempDir()
+	malformed := filepath.Join(dir, "malformed.csv")
+	duplicated := filepath.Join(dir, "duplicated.csv")
+	err := os.WriteFile(malformed, []byte("996515203405158,a651520-01ocul_qu\n996515213405158,x-01ocul_qu\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(duplicated, []byte("996515203405158,a651520-01ocul_qu\n996515213405158,a651520-01ocul_qu\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		path     string
+		expected reloadError
+	}{
+		{malformed, reloadError{File: malformed, Line: 2, Field: mapping.FieldBibID}},
+		{duplicated, reloadError{Duplicate: true}},
+	}
+	for _, tt := range tests {
+		_, err := mapping.LoadMap(tt.path)
+		if err == nil {
+			t.Fatalf("LoadMap(%v) returned no error.", tt.path)
+		}
+		re := newReloadError(fmt.Errorf("Could not load the mappings of tenant law, %w", err))
+		tt.expected.Error = "Could not load the mappings of tenant law, " + err.Error()
+		if re != tt.expected {
+			t.Fatalf("The reload error for %v was %+v, not %+v.", tt.path, re, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultCORSMethods is the default comma separated list of methods allowed in cross-origin API requests.
+	defaultCORSMethods string = "GET,HEAD,POST"
+
+	// defaultCORSMaxAge is the default time browsers may cache the response to a preflight request.
+	defaultCORSMaxAge time.Duration = 10 * time.Minute
+
+	// corsAllowedHeaders are the request headers allowed in cross-origin API requests.
+	// Content-Type is needed to POST a batch lookup as JSON.
+	corsAllowedHeaders string = "Content-Type, X-Request-ID"
+)
+
+// corsPolicy describes which cross-origin requests browsers are allowed to make to the APIs.
+type corsPolicy struct {
+	origins []string // Allowed origins, like https://example.libguides.com, or * for any.
+	methods []string
+	maxAge  time.Duration
+}
+
+// allowsOrigin reports whether the policy allows requests from the origin.
+func (p corsPolicy) allowsOrigin(origin string) bool {
+	return slices.Contains(p.origins, "*") || slices.Contains(p.origins, origin)
+}
+
+// withCORS is middleware which sets the CORS headers on responses to requests from allowed origins,
+// and responds to preflight requests. Requests from other origins are served without CORS headers,
+// so browsers don't let the calling page read the response.
+func withCORS(next http.Handler, p corsPolicy) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Responses depend on the origin, so caches must keep them apart.
+		w.Header().Add("Vary", "Origin")
+		origin := r.Header.Get("Origin")
+		if origin == "" || !p.allowsOrigin(origin) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if slices.Contains(p.origins, "*") {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		} else {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+		}
+		w.Header().Set("Access-Control-Expose-Headers", "X-Request-ID")
+
+		// Preflight requests ask whether the real request is allowed.
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+			w.Header().Set("Access-Control-Allow-Methods", strings.Join(p.methods, ", "))
+			w.Header().Set("Access-Control-Allow-Headers", corsAllowedHeaders)
+			if p.maxAge > 0 {
+				w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(p.maxAge.Seconds())))
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
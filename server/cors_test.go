@@ -0,0 +1,68 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWithCORS(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	policy := corsPolicy{origins: []string{"https://library.libguides.com"}, methods: []string{"GET", "POST"}, maxAge: 10 * time.Minute}
+	anyOrigin := corsPolicy{origins: []string{"*"}, methods: []string{"GET"}}
+
+	var tests = []struct {
+		name          string
+		policy        corsPolicy
+		method        string
+		origin        string
+		requestMethod string
+		status        int
+		allowOrigin   string
+		allowMethods  string
+		maxAge        string
+	}{
+		{"same origin", policy, "GET", "", "", http.StatusOK, "", "", ""},
+		{"allowed", policy, "GET", "https://library.libguides.com", "", http.StatusOK, "https://library.libguides.com", "", ""},
+		{"not allowed", policy, "GET", "https://example.com", "", http.StatusOK, "", "", ""},
+		{"preflight", policy, "OPTIONS", "https://library.libguides.com", "POST", http.StatusNoContent, "https://library.libguides.com", "GET, POST", "600"},
+		{"preflight not allowed", policy, "OPTIONS", "https://example.com", "POST", http.StatusOK, "", "", ""},
+		{"any", anyOrigin, "GET", "https://example.com", "", http.StatusOK, "*", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, lookupPath, nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			if tt.requestMethod != "" {
+				r.Header.Set("Access-Control-Request-Method", tt.requestMethod)
+			}
+			w := httptest.NewRecorder()
+			withCORS(ok, tt.policy).ServeHTTP(w, r)
+			if w.Code != tt.status {
+				t.Fatalf("The status was %v, not %v.", w.Code, tt.status)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.allowOrigin {
+				t.Fatalf("Access-Control-Allow-Origin was %q, not %q.", got, tt.allowOrigin)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Methods"); got != tt.allowMethods {
+				t.Fatalf("Access-Control-Allow-Methods was %q, not %q.", got, tt.allowMethods)
+			}
+			if got := w.Header().Get("Access-Control-Max-Age"); got != tt.maxAge {
+				t.Fatalf("Access-Control-Max-Age was %q, not %q.", got, tt.maxAge)
+			}
+			if w.Header().Values("Vary")[0] != "Origin" {
+				t.Fatal("The response doesn't vary by Origin.")
+			}
+		})
+	}
+}
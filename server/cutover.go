@@ -0,0 +1,78 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// cutoverConfig is a scheduled change in the configuration file. From its time on, its settings override
+// those outside cutovers, so a go-live, like switching from 307 to 301 redirects, or from the maintenance
+// page to redirecting, happens on time without a redeploy.
+type cutoverConfig struct {
+	At          time.Time  `json:"at"`                    // When the cutover happens, like 2026-11-01T06:00:00-04:00.
+	Settings    configFile `json:"settings"`              // The settings which change. Tenants and cutovers can't be scheduled.
+	Maintenance *bool      `json:"maintenance,omitempty"` // Turns maintenance mode on or off at the time.
+}
+
+// validateCutovers checks each cutover has a time, and settings which are valid and can be scheduled.
+// The error lists every invalid cutover.
+func validateCutovers(cutovers []cutoverConfig) error {
+	var errs []error
+	for i, co := range cutovers {
+		if co.At.IsZero() {
+			errs = append(errs, fmt.Errorf("cutover %v has no time", i+1))
+			continue
+		}
+		if len(co.Settings.Tenants) > 0 || len(co.Settings.Cutovers) > 0 {
+			errs = append(errs, fmt.Errorf("the cutover at %v can't change tenants or cutovers", co.At.Format(time.RFC3339)))
+		}
+		_, err := co.Settings.apply(Detourer{})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid settings of the cutover at %v, %w", co.At.Format(time.RFC3339), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// dueCutovers returns the cutovers which are due at now, in time order, and the time of the next
+// cutover which isn't due yet, which is zero if there isn't one.
+func dueCutovers(cutovers []cutoverConfig, now time.Time) ([]cutoverConfig, time.Time) {
+	sorted := slices.Clone(cutovers)
+	slices.SortStableFunc(sorted, func(a, b cutoverConfig) int {
+		return a.At.Compare(b.At)
+	})
+	for i, co := range sorted {
+		if co.At.After(now) {
+			return sorted[:i], co.At
+		}
+	}
+	return sorted, time.Time{}
+}
+
+// applyCutovers returns a copy of d with the settings of the cutovers applied, in order.
+func applyCutovers(d Detourer, cutovers []cutoverConfig) (Detourer, error) {
+	for _, co := range cutovers {
+		var err error
+		d, err = co.Settings.apply(d)
+		if err != nil {
+			return d, fmt.Errorf("invalid settings of the cutover at %v, %w", co.At.Format(time.RFC3339), err)
+		}
+	}
+	return d, nil
+}
+
+// cutoverMaintenance returns the maintenance mode set by the last of the cutovers after the time since, if any set it.
+func cutoverMaintenance(cutovers []cutoverConfig, since time.Time) (enabled, set bool) {
+	for _, co := range cutovers {
+		if co.Maintenance != nil && co.At.After(since) {
+			enabled, set = *co.Maintenance, true
+		}
+	}
+	return enabled, set
+}
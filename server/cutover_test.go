@@ -0,0 +1,116 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cu-library/permanentdetour/mapping"
+)
+
+func TestDueCutovers(t *testing.T) {
+	now := time.Date(2026, 11, 1, 6, 0, 0, 0, time.UTC)
+	cutovers := []cutoverConfig{
+		{At: now.Add(time.Hour), Settings: configFile{VID: "later"}},
+		{At: now, Settings: configFile{VID: "now"}},
+		{At: now.Add(-time.Hour), Settings: configFile{VID: "earlier"}},
+		{At: now.Add(2 * time.Hour), Settings: configFile{VID: "latest"}},
+	}
+	due, next := dueCutovers(cutovers, now)
+	if len(due) != 2 || due[0].Settings.VID != "earlier" || due[1].Settings.VID != "now" {
+		t.Fatalf("dueCutovers() returned %v, not the earlier cutover and the one now.", due)
+	}
+	if !next.Equal(now.Add(time.Hour)) {
+		t.Fatalf("The next cutover was at %v, not %v.", next, now.Add(time.Hour))
+	}
+	_, next = dueCutovers(cutovers, now.Add(3*time.Hour))
+	if !next.IsZero() {
+		t.Fatalf("The next cutover was at %v, with none left.", next)
+	}
+}
+
+func TestValidateCutovers(t *testing.T) {
+	at := time.Date(2026, 11, 1, 6, 0, 0, 0, time.UTC)
+	var tests = []struct {
+		name     string
+		cutovers []cutoverConfig
+		err      string
+	}{
+		{"valid", []cutoverConfig{{At: at, Settings: configFile{RedirectStatus: 301}}}, ""},
+		{"no time", []cutoverConfig{{Settings: configFile{RedirectStatus: 301}}}, "has no time"},
+		{"invalid status", []cutoverConfig{{At: at, Settings: configFile{RedirectStatus: 200}}}, "not a redirect status"},
+		{"tenants", []cutoverConfig{{At: at, Settings: configFile{Tenants: []tenantConfig{{Name: "law"}}}}}, "can't change tenants"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateCutovers(tt.cutovers)
+			if tt.err == "" && err != nil {
+				t.Fatal(err)
+			}
+			if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Fatalf("validateCutovers() returned %v, not an error containing %q.", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestLiveDetourerCutover(t *testing.T) {
+	now := time.Now()
+	path := filepath.Join(t.TempDir(), "config.json")
+	err := os.WriteFile(path, []byte(fmt.Sprintf(`{"cutovers":[
+		{"at":%q,"settings":{"redirectStatus":301},"maintenance":false},
+		{"at":%q,"settings":{"vid":"01OCUL_QU:QU_NEW"}}
+	]}`, now.Add(-time.Hour).Format(time.RFC3339), now.Add(200*time.Millisecond).Format(time.RFC3339Nano))), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	maintenance, err := newMaintenance("", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	maintenance.set(true)
+	base := Detourer{
+		store:       mapping.NewMap(map[uint32]uint64{651520: 996515203405158}),
+		primo:       "ocul-qu.primo.exlibrisgroup.com",
+		vid:         "01OCUL_QU:QU_DEFAULT",
+		maintenance: maintenance,
+	}
+	l, err := newLiveDetourer(base, path, logRotation{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.close()
+
+	if maintenance.active() {
+		t.Fatal("Maintenance mode wasn't turned off by the cutover which was due.")
+	}
+	w := httptest.NewRecorder()
+	l.ServeHTTP(w, httptest.NewRequest("GET", "/vwebv/holdingsInfo?bibId=651520", nil))
+	if w.Code != 301 || !strings.HasSuffix(w.Header().Get("Location"), "QU_DEFAULT") {
+		t.Fatalf("Before the second cutover, the response was %v to %v.", w.Code, w.Header().Get("Location"))
+	}
+
+	// Maintenance changes made after a cutover aren't undone by later cutovers.
+	maintenance.set(true)
+	deadline := time.Now().Add(5 * time.Second)
+	for l.load().vid != "01OCUL_QU:QU_NEW" {
+		if time.Now().After(deadline) {
+			t.Fatal("The scheduled cutover didn't happen.")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if l.load().redirectStatus() != 301 {
+		t.Fatalf("After the second cutover, the status was %v, not 301.", l.load().redirectStatus())
+	}
+	if !maintenance.active() {
+		t.Fatal("The second cutover changed maintenance mode.")
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"cmp"
+	_ "embed"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/cu-library/permanentdetour/mapping"
+)
+
+const (
+	// dashboardPath is the path of the admin dashboard.
+	dashboardPath string = "/admin/"
+
+	// dashboardTopN is the number of paths and unmapped bibIDs listed on the dashboard.
+	dashboardTopN int = 10
+
+	// defaultPathLimit is the maximum number of distinct request paths counted for the dashboard.
+	defaultPathLimit int = 1000
+
+	// dashboardCSP is the Content-Security-Policy of the dashboard, which has inline styles but no scripts.
+	dashboardCSP string = "default-src 'none'; style-src 'unsafe-inline'; frame-ancestors 'none'; base-uri 'none'; form-action 'none'"
+)
+
+//go:embed web/dashboard.html
+var dashboardHTML string
+
+// dashboardTemplate renders the admin dashboard.
+var dashboardTemplate = template.Must(template.New("dashboard").Parse(dashboardHTML))
+
+// pathCounter counts requests by path, up to a limit of distinct paths, so a crawler can't exhaust memory.
+// A nil *pathCounter discards everything.
+type pathCounter struct {
+	limit int
+
+	mu     sync.Mutex
+	counts map[string]uint64
+	other  uint64 // Requests for paths which weren't counted because the limit was reached.
+}
+
+// newPathCounter returns an empty pathCounter which counts up to limit distinct paths.
+func newPathCounter(limit int) *pathCounter {
+	return &pathCounter{limit: limit, counts: map[string]uint64{}}
+}
+
+// record counts a request for the path.
+func (p *pathCounter) record(path string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, present := p.counts[path]
+	if !present && len(p.counts) >= p.limit {
+		p.other++
+		return
+	}
+	p.counts[path]++
+}
+
+// pathCount is the number of requests for a path.
+type pathCount struct {
+	Path  string
+	Count uint64
+}
+
+// top returns the n most requested paths, most requested first.
+func (p *pathCounter) top(n int) []pathCount {
+	p.mu.Lock()
+	paths := make([]pathCount, 0, len(p.counts))
+	for path, count := range p.counts {
+		paths = append(paths, pathCount{path, count})
+	}
+	p.mu.Unlock()
+	slices.SortFunc(paths, func(a, b pathCount) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(a.Path, b.Path))
+	})
+	return paths[:min(n, len(paths))]
+}
+
+// dashboardHandler serves an HTML summary of the service's activity, so staff can follow the cutover without Grafana.
+type dashboardHandler struct {
+	started      time.Time
+	metrics      *Metrics
+	unmapped     *unmappedTracker // The unmapped bibIDs, or nil if they aren't tracked.
+	paths        *pathCounter
+	mappings     *mapping.SwappableStore
+	mappingFiles []string
+}
+
+// ruleCount is the number of redirects built by a rule.
+type ruleCount struct {
+	Rule  string
+	Count uint64
+}
+
+// dashboardData is the data rendered by the dashboard template.
+type dashboardData struct {
+	Version      string
+	Uptime       time.Duration
+	Requests     uint64
+	Rules        []ruleCount
+	Unmapped     uint64
+	ParseErrors  uint64
+	RateLimited  uint64
+	Paths        []pathCount
+	TopUnmapped  []unmappedEntry
+	Tracking     bool
+	Mappings     int
+	MappingFiles []string
+	Loaded       time.Time
+}
+
+// data gathers the current counters for the dashboard.
+func (db *dashboardHandler) data(now time.Time) dashboardData {
+	data := dashboardData{
+		Version:      version,
+		Uptime:       now.Sub(db.started).Round(time.Second),
+		Requests:     db.metrics.requests.Load(),
+		Unmapped:     db.metrics.unmapped.Load(),
+		ParseErrors:  db.metrics.parseErrors.Load(),
+		RateLimited:  db.metrics.rateLimited.Load(),
+		Paths:        db.paths.top(dashboardTopN),
+		Tracking:     db.unmapped != nil,
+		Mappings:     db.mappings.Len(),
+		MappingFiles: db.mappingFiles,
+		Loaded:       db.mappings.Swapped(),
+	}
+	db.metrics.redirects.each(func(rule string, value uint64) {
+		data.Rules = append(data.Rules, ruleCount{rule, value})
+	})
+	if db.unmapped != nil {
+		unmapped := db.unmapped.report().Unmapped
+		data.TopUnmapped = unmapped[:min(dashboardTopN, len(unmapped))]
+	}
+	return data
+}
+
+// ServeHTTP renders the dashboard.
+func (db *dashboardHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != dashboardPath {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", dashboardCSP)
+	w.Header().Set("Cache-Control", "no-store")
+	err := dashboardTemplate.Execute(w, db.data(time.Now()))
+	if err != nil {
+		slog.Error("Error rendering dashboard.", "err", err)
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cu-library/permanentdetour/detour"
+	"github.com/cu-library/permanentdetour/mapping"
+)
+
+func TestPathCounter(t *testing.T) {
+	p := newPathCounter(2)
+	p.record(detour.RecordPrefix)
+	p.record(detour.SearchPrefix)
+	p.record(detour.SearchPrefix)
+	// The limit has been reached, so this path isn't counted.
+	p.record("/random")
+
+	expected := []pathCount{{detour.SearchPrefix, 2}, {detour.RecordPrefix, 1}}
+	if !reflect.DeepEqual(p.top(10), expected) {
+		t.Fatalf("top(10) returned %v, not %v.", p.top(10), expected)
+	}
+	if !reflect.DeepEqual(p.top(1), expected[:1]) {
+		t.Fatalf("top(1) returned %v, not %v.", p.top(1), expected[:1])
+	}
+	if p.other != 1 {
+		t.Fatalf("%v requests weren't counted, not 1.", p.other)
+	}
+}
+
+func TestDashboard(t *testing.T) {
+	m := NewMetrics()
+	m.observeRedirect("", "record", time.Millisecond)
+	u := newUnmappedTracker(defaultUnmappedLimit)
+	u.record(651520, "", time.Now())
+	p := newPathCounter(defaultPathLimit)
+	p.record(detour.RecordPrefix)
+	db := &dashboardHandler{
+		started:      time.Now().Add(-time.Hour),
+		metrics:      m,
+		unmapped:     u,
+		paths:        p,
+		mappings:     mapping.NewSwappableStore(mapping.NewMap(map[uint32]uint64{651520: 996515203405158})),
+		mappingFiles: []string{"mappings.csv"},
+	}
+
+	w := httptest.NewRecorder()
+	db.ServeHTTP(w, httptest.NewRequest("GET", dashboardPath, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("The dashboard returned %v, not 200.", w.Code)
+	}
+	if w.Header().Get("Content-Security-Policy") != dashboardCSP {
+		t.Fatalf("The dashboard's Content-Security-Policy was %q.", w.Header().Get("Content-Security-Policy"))
+	}
+	for _, expected := range []string{"up for 1h0m0s", "<td>record</td>", detour.RecordPrefix, "<td>651520</td>", "mappings.csv"} {
+		if !strings.Contains(w.Body.String(), expected) {
+			t.Fatalf("The dashboard doesn't contain %q.", expected)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	db.ServeHTTP(w, httptest.NewRequest("GET", dashboardPath+"missing", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("An unknown admin path returned %v, not 404.", w.Code)
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+const (
+	// debugHeader is the request header which asks for the translation to be described instead of redirected to.
+	debugHeader string = "X-Detour-Debug"
+
+	// debugParam is the query parameter which, set to debugParamValue, asks for the translation to be described.
+	debugParam string = "_detour"
+
+	// debugParamValue is the value of debugParam which enables debug mode.
+	debugParamValue string = "debug"
+)
+
+// translationDebug describes how a request was translated. In debug mode, it is returned instead of the redirect.
+type translationDebug struct {
+	Method string     `json:"method"`
+	Tenant string     `json:"tenant,omitempty"` // The name of the tenant which served the request.
+	URL    string     `json:"url"`              // The request URL which was translated, after unwrapping proxies and normalizing mobile requests.
+	Query  url.Values `json:"query"`            // The parameters of the request URL.
+	Rule   string     `json:"rule"`
+	Branch string     `json:"branch,omitempty"`
+	BibID  *uint32    `json:"bibId,omitempty"` // The bibID requested by a record link, if it was valid.
+	Found  *bool      `json:"found,omitempty"` // Whether the bibID was mapped.
+	MMSID  string     `json:"mmsId,omitempty"`
+	Error  string     `json:"error,omitempty"` // Why the bibID was invalid, or couldn't be looked up.
+	Target string     `json:"target"`
+	Status int        `json:"status"` // The status the redirect would have been sent with.
+}
+
+// newTranslationDebug describes the translation of a request with the method.
+func newTranslationDebug(method string, tr TranslationResult) translationDebug {
+	td := translationDebug{
+		Method: method,
+		Tenant: tr.Tenant,
+		URL:    tr.URL.String(),
+		Query:  tr.URL.Query(),
+		Rule:   tr.Rule,
+		Branch: tr.Branch,
+		Target: tr.Target.String(),
+		Status: tr.Status,
+	}
+	if tr.Err != nil {
+		td.Error = tr.Err.Error()
+	}
+	if !tr.hasBibID() {
+		return td
+	}
+	td.BibID = &tr.BibID
+	td.Found = &tr.Found
+	if tr.Found {
+		td.MMSID = strconv.FormatUint(tr.MMSID, 10)
+	}
+	return td
+}
+
+// debugRequest reports whether the request asks for debug mode, with the debugHeader or debugParam.
+// The parameter is removed from the returned request, so it isn't passed along when translating.
+func debugRequest(r *http.Request) (*http.Request, bool) {
+	debug := r.Header.Get(debugHeader) != ""
+	q := r.URL.Query()
+	if !q.Has(debugParam) {
+		return r, debug
+	}
+	debug = debug || q.Get(debugParam) == debugParamValue
+	q.Del(debugParam)
+	u := *r.URL
+	u.RawQuery = q.Encode()
+	return requestWithURL(r, &u), debug
+}
+
+// writeTranslationDebug responds with the description of the translation as JSON.
+func writeTranslationDebug(w http.ResponseWriter, r *http.Request, td translationDebug) {
+	slog.DebugContext(r.Context(), "Described translation.", "path", r.URL.Path, "rule", td.Rule, "target", td.Target)
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, td)
+}
@@ -0,0 +1,90 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cu-library/permanentdetour/mapping"
+)
+
+func TestDebugMode(t *testing.T) {
+	d := Detourer{
+		store:   mapping.NewMap(map[uint32]uint64{651520: 996515203405158}),
+		primo:   "ocul-qu.primo.exlibrisgroup.com",
+		vid:     "01OCUL_QU:QU_DEFAULT",
+		metrics: NewMetrics(),
+		rules:   newRuleHits(),
+	}
+
+	var tests = []struct {
+		name   string
+		url    string
+		header string
+		rule   string
+		branch string
+		mmsID  string
+		target string
+	}{
+		{"header", "/vwebv/holdingsInfo?bibId=651520", "1", "record", "mapped", "996515203405158",
+			"https://ocul-qu.primo.exlibrisgroup.com/discovery/fulldisplay?docid=alma996515203405158&vid=01OCUL_QU%3AQU_DEFAULT"},
+		{"parameter", "/vwebv/search?searchArg=smith&searchCode=NAME&_detour=debug", "", "search", "NAME", "",
+			"https://ocul-qu.primo.exlibrisgroup.com/discovery/browse?browseQuery=smith&browseScope=author&search_scope=MyInst_and_CI&tab=Everything&vid=01OCUL_QU%3AQU_DEFAULT"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", tt.url, nil)
+			if tt.header != "" {
+				r.Header.Set(debugHeader, tt.header)
+			}
+			w := httptest.NewRecorder()
+			d.ServeHTTP(w, r)
+			if w.Code != http.StatusOK {
+				t.Fatalf("Debug mode returned %v, not 200.", w.Code)
+			}
+			var td translationDebug
+			err := json.Unmarshal(w.Body.Bytes(), &td)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if td.Rule != tt.rule || td.Branch != tt.branch || td.MMSID != tt.mmsID || td.Target != tt.target {
+				t.Fatalf("Debug mode described %+v.", td)
+			}
+			if td.Query.Has(debugParam) {
+				t.Fatalf("The %v parameter wasn't removed before translating.", debugParam)
+			}
+		})
+	}
+
+	// Debug requests aren't counted.
+	if d.metrics.requests.Load() != 0 || len(d.rules.report()) != 0 {
+		t.Fatal("Debug requests were counted.")
+	}
+
+	// Other values of the parameter don't enable debug mode.
+	w := httptest.NewRecorder()
+	d.ServeHTTP(w, httptest.NewRequest("GET", "/?_detour=other", nil))
+	if w.Code != http.StatusTemporaryRedirect {
+		t.Fatalf("A request without debug mode returned %v, not 307.", w.Code)
+	}
+}
+
+func TestDebugModeInvalidBibID(t *testing.T) {
+	d := Detourer{primo: "ocul-qu.primo.exlibrisgroup.com", vid: "01OCUL_QU:QU_DEFAULT"}
+	w := httptest.NewRecorder()
+	d.ServeHTTP(w, httptest.NewRequest("GET", "/vwebv/holdingsInfo?bibId=abc&_detour=debug", nil))
+	var td translationDebug
+	err := json.Unmarshal(w.Body.Bytes(), &td)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if td.Branch != "invalid" || td.Error == "" || td.BibID != nil {
+		t.Fatalf("Debug mode described %+v.", td)
+	}
+}
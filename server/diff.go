@@ -0,0 +1,98 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+
+	"github.com/cu-library/permanentdetour/mapping"
+)
+
+// diffCommand is the subcommand which compares two mapping files, like deliveries from Ex Libris.
+const diffCommand string = "diff"
+
+// mappingDiff is the difference between two sets of mappings.
+type mappingDiff struct {
+	added     []uint32 // BibIDs mapped only in the new mappings.
+	removed   []uint32 // BibIDs mapped only in the old mappings.
+	changed   []uint32 // BibIDs mapped to different MMS IDs.
+	unchanged int
+}
+
+// diffMappings compares the old and new mappings. The bibIDs in the diff are in order.
+func diffMappings(previous, current map[uint32]uint64) mappingDiff {
+	var diff mappingDiff
+	for _, bibID := range slices.Sorted(maps.Keys(current)) {
+		exlID, present := previous[bibID]
+		switch {
+		case !present:
+			diff.added = append(diff.added, bibID)
+		case exlID != current[bibID]:
+			diff.changed = append(diff.changed, bibID)
+		default:
+			diff.unchanged++
+		}
+	}
+	for _, bibID := range slices.Sorted(maps.Keys(previous)) {
+		_, present := current[bibID]
+		if !present {
+			diff.removed = append(diff.removed, bibID)
+		}
+	}
+	return diff
+}
+
+// runDiff writes the mappings added, removed, and changed between the old and new mapping files to w,
+// in order of bibID, followed by a summary. Like diff, it returns the exit status 0 if the files map
+// the same bibIDs to the same MMS IDs, 1 if they differ, and 2 if a file couldn't be read.
+func runDiff(w io.Writer, args []string) int {
+	if len(args) != 2 {
+		fmt.Fprintf(w, "Usage: permanentdetour %v old.csv new.csv\n", diffCommand)
+		return 2
+	}
+	previous, current := map[uint32]uint64{}, map[uint32]uint64{}
+	err := mapping.LoadFile(previous, args[0])
+	if err != nil {
+		fmt.Fprintln(w, err)
+		return 2
+	}
+	err = mapping.LoadFile(current, args[1])
+	if err != nil {
+		fmt.Fprintln(w, err)
+		return 2
+	}
+
+	diff := diffMappings(previous, current)
+	// The lines are merged in order of bibID, so a bibID's changes are easy to find.
+	type line struct {
+		bibID uint32
+		text  string
+	}
+	lines := make([]line, 0, len(diff.added)+len(diff.removed)+len(diff.changed))
+	for _, bibID := range diff.added {
+		lines = append(lines, line{bibID, fmt.Sprintf("+ %v %v", bibID, current[bibID])})
+	}
+	for _, bibID := range diff.removed {
+		lines = append(lines, line{bibID, fmt.Sprintf("- %v %v", bibID, previous[bibID])})
+	}
+	for _, bibID := range diff.changed {
+		lines = append(lines, line{bibID, fmt.Sprintf("~ %v %v -> %v", bibID, previous[bibID], current[bibID])})
+	}
+	slices.SortStableFunc(lines, func(a, b line) int {
+		return cmp.Compare(a.bibID, b.bibID)
+	})
+	for _, l := range lines {
+		fmt.Fprintln(w, l.text)
+	}
+	fmt.Fprintf(w, "%v added, %v removed, %v changed, %v unchanged.\n", len(diff.added), len(diff.removed), len(diff.changed), diff.unchanged)
+	if len(lines) > 0 {
+		return 1
+	}
+	return 0
+}
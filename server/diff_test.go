@@ -0,0 +1,82 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunDiff(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		err := os.WriteFile(path, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	previous := write("old.csv", "996515203405158,a651520-01ocul_qu\n996515213405158,a651521-01ocul_qu\n996515223405158,a651522-01ocul_qu\n")
+	current := write("new.csv", "996515223405158,a651522-01ocul_qu\n996515203405159,a651520-01ocul_qu\n996515233405158,a651523-01ocul_qu\n")
+	invalid := write("invalid.csv", "not a mapping\n")
+
+	var tests = []struct {
+		name   string
+		args   []string
+		status int
+		output []string
+	}{
+		{
+			"changes",
+			[]string{previous, current},
+			1,
+			[]string{
+				"~ 651520 996515203405158 -> 996515203405159",
+				"- 651521 996515213405158",
+				"+ 651523 996515233405158",
+				"1 added, 1 removed, 1 changed, 1 unchanged.",
+			},
+		},
+		{
+			"same",
+			[]string{previous, previous},
+			0,
+			[]string{"0 added, 0 removed, 0 changed, 3 unchanged."},
+		},
+		{
+			"invalid",
+			[]string{previous, invalid},
+			2,
+			[]string{"Unable to process line 1 'not a mapping'"},
+		},
+		{
+			"usage",
+			[]string{previous},
+			2,
+			[]string{"Usage: permanentdetour diff old.csv new.csv"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			status := runDiff(&out, tt.args)
+			if status != tt.status {
+				t.Fatalf("runDiff() returned %v, not %v. Output:\n%v", status, tt.status, out.String())
+			}
+			lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+			if len(lines) != len(tt.output) {
+				t.Fatalf("The output had %v lines, not %v. Output:\n%v", len(lines), len(tt.output), out.String())
+			}
+			for i, expected := range tt.output {
+				if !strings.HasPrefix(lines[i], expected) {
+					t.Fatalf("Line %v of the output didn't start with %q. Output:\n%v", i+1, expected, out.String())
+				}
+			}
+		})
+	}
+}
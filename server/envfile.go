@@ -0,0 +1,163 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// defaultEnvFile is the name of the env file read from the executable's directory when -env-file isn't set.
+const defaultEnvFile string = ".env"
+
+// envVar is a variable assignment from an env file.
+type envVar struct {
+	name  string
+	value string
+}
+
+// envFilePath returns the path of the env file to read, and whether it must exist.
+// The path set by the flag or its environment variable must exist. The default,
+// defaultEnvFile next to the executable, is read only if present.
+func envFilePath(set string) (string, bool) {
+	if set == "" {
+		set = os.Getenv(envPrefix + "ENV_FILE")
+	}
+	if set != "" {
+		return set, true
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return "", false
+	}
+	return filepath.Join(filepath.Dir(exe), defaultEnvFile), false
+}
+
+// loadEnvFile sets the PERMANENTDETOUR_ variables in the env file at path which aren't already
+// in the environment, so the environment takes precedence. Other variables are ignored.
+// It returns the names of the variables which were set. A missing file is only an error if required.
+func loadEnvFile(path string, required bool) ([]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) && !required {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Could not open env file %v, %w", path, err)
+	}
+	defer file.Close()
+	vars, err := parseEnvFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read env file %v, %w", path, err)
+	}
+	set := []string{}
+	for _, v := range vars {
+		if !strings.HasPrefix(v.name, envPrefix) {
+			continue
+		}
+		_, present := os.LookupEnv(v.name)
+		if present {
+			continue
+		}
+		err := os.Setenv(v.name, v.value)
+		if err != nil {
+			return nil, fmt.Errorf("Could not set %v from env file %v, %w", v.name, path, err)
+		}
+		set = append(set, v.name)
+	}
+	return set, nil
+}
+
+// parseEnvFile parses NAME=value lines. Blank lines and lines starting with # are skipped,
+// and a leading export is allowed. Values may be single quoted, taken literally, or double
+// quoted, with Go escapes. Unquoted values end at a # preceded by a space.
+func parseEnvFile(r io.Reader) ([]envVar, error) {
+	vars := []envVar{}
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
+		name, value, found := strings.Cut(line, "=")
+		name = strings.TrimSpace(name)
+		if !found || name == "" || strings.ContainsAny(name, " \t") {
+			return nil, fmt.Errorf("Line %v is not NAME=value", lineNumber)
+		}
+		value, err := parseEnvValue(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("Invalid value for %v on line %v, %w", name, lineNumber, err)
+		}
+		vars = append(vars, envVar{name, value})
+	}
+	err := scanner.Err()
+	if err != nil {
+		return nil, err
+	}
+	return vars, nil
+}
+
+// parseEnvValue unquotes a value from an env file and removes any trailing comment.
+func parseEnvValue(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, `"`):
+		end := closingQuote(value)
+		if end < 0 {
+			return "", errors.New("unterminated double quote")
+		}
+		if !isComment(value[end+1:]) {
+			return "", errors.New("unexpected text after the closing quote")
+		}
+		return strconv.Unquote(value[:end+1])
+	case strings.HasPrefix(value, "'"):
+		end := strings.IndexByte(value[1:], '\'')
+		if end < 0 {
+			return "", errors.New("unterminated single quote")
+		}
+		if !isComment(value[end+2:]) {
+			return "", errors.New("unexpected text after the closing quote")
+		}
+		return value[1 : end+1], nil
+	}
+	if strings.HasPrefix(value, "#") {
+		return "", nil
+	}
+	comment := strings.Index(value, " #")
+	if comment >= 0 {
+		value = value[:comment]
+	}
+	return strings.TrimSpace(value), nil
+}
+
+// closingQuote returns the index of the double quote which closes the value, skipping escaped quotes, or -1.
+func closingQuote(value string) int {
+	for i := 1; i < len(value); i++ {
+		switch value[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+// isComment reports whether the text after a quoted value is empty or a comment.
+func isComment(rest string) bool {
+	rest = strings.TrimSpace(rest)
+	return rest == "" || strings.HasPrefix(rest, "#")
+}
@@ -0,0 +1,103 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseEnvFile(t *testing.T) {
+	input := `# Deployment settings
+PERMANENTDETOUR_PRIMO=ocul-qu
+export PERMANENTDETOUR_VID = 01OCUL_QU:QU_DEFAULT
+PERMANENTDETOUR_ADDRESS=:8080 # The public port
+PERMANENTDETOUR_CSP="default-src 'none'; frame-ancestors 'none'"
+PERMANENTDETOUR_NOTE='a # literal\n'
+PERMANENTDETOUR_ESCAPED="line\none \"quoted\""
+PERMANENTDETOUR_EMPTY=
+PERMANENTDETOUR_HASH=a#b
+`
+	vars, err := parseEnvFile(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []envVar{
+		{"PERMANENTDETOUR_PRIMO", "ocul-qu"},
+		{"PERMANENTDETOUR_VID", "01OCUL_QU:QU_DEFAULT"},
+		{"PERMANENTDETOUR_ADDRESS", ":8080"},
+		{"PERMANENTDETOUR_CSP", "default-src 'none'; frame-ancestors 'none'"},
+		{"PERMANENTDETOUR_NOTE", `a # literal\n`},
+		{"PERMANENTDETOUR_ESCAPED", "line\none \"quoted\""},
+		{"PERMANENTDETOUR_EMPTY", ""},
+		{"PERMANENTDETOUR_HASH", "a#b"},
+	}
+	if !slices.Equal(vars, expected) {
+		t.Fatalf("parseEnvFile() returned %v, not %v.", vars, expected)
+	}
+}
+
+func TestParseEnvFileInvalid(t *testing.T) {
+	tests := []string{
+		"PERMANENTDETOUR_PRIMO",
+		"=ocul-qu",
+		"PERMANENTDETOUR PRIMO=ocul-qu",
+		`PERMANENTDETOUR_CSP="default-src 'none'`,
+		"PERMANENTDETOUR_CSP='default-src",
+		`PERMANENTDETOUR_CSP="default-src" 'none'`,
+	}
+	for _, test := range tests {
+		_, err := parseEnvFile(strings.NewReader(test))
+		if err == nil {
+			t.Errorf("parseEnvFile() didn't return an error for %q.", test)
+		}
+	}
+}
+
+func TestLoadEnvFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env")
+	err := os.WriteFile(path, []byte("PERMANENTDETOUR_PRIMO=ocul-qu\nPERMANENTDETOUR_VID=01OCUL_QU:QU_DEFAULT\nOTHER_SETTING=ignored\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PERMANENTDETOUR_PRIMO", "from-environment")
+	t.Setenv("PERMANENTDETOUR_VID", "")
+	os.Unsetenv("PERMANENTDETOUR_VID")
+	t.Setenv("OTHER_SETTING", "")
+	os.Unsetenv("OTHER_SETTING")
+
+	set, err := loadEnvFile(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(set, []string{"PERMANENTDETOUR_VID"}) {
+		t.Fatalf("loadEnvFile() set %v, not [PERMANENTDETOUR_VID].", set)
+	}
+	if os.Getenv("PERMANENTDETOUR_PRIMO") != "from-environment" {
+		t.Fatalf("The env file replaced a variable in the environment with %v.", os.Getenv("PERMANENTDETOUR_PRIMO"))
+	}
+	if os.Getenv("PERMANENTDETOUR_VID") != "01OCUL_QU:QU_DEFAULT" {
+		t.Fatalf("PERMANENTDETOUR_VID was %v, not 01OCUL_QU:QU_DEFAULT.", os.Getenv("PERMANENTDETOUR_VID"))
+	}
+	_, present := os.LookupEnv("OTHER_SETTING")
+	if present {
+		t.Fatal("A variable without the PERMANENTDETOUR_ prefix was set.")
+	}
+}
+
+func TestLoadEnvFileMissing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env")
+	_, err := loadEnvFile(path, false)
+	if err != nil {
+		t.Fatalf("A missing default env file returned an error, %v.", err)
+	}
+	_, err = loadEnvFile(path, true)
+	if err == nil {
+		t.Fatal("A missing env file set with -env-file didn't return an error.")
+	}
+}
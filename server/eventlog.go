@@ -0,0 +1,245 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"sync/atomic"
+	"time"
+
+	// The pure Go SQLite driver, so the command still builds without cgo.
+	_ "modernc.org/sqlite"
+)
+
+const (
+	// defaultEventsBatchSize is the default maximum number of events written to the event log at once.
+	defaultEventsBatchSize int = 500
+
+	// defaultEventsFlushInterval is the default longest time events wait before they're written to the event log.
+	defaultEventsFlushInterval time.Duration = 5 * time.Second
+
+	// eventsQueueBatches is the number of batches of events which can be waiting to be written before new events are
+	// dropped, so a slow disk doesn't slow down redirects.
+	eventsQueueBatches int = 8
+
+	// eventTimeLayout is the layout of the times in the event log, in UTC. It's the layout of SQLite's date and time
+	// functions, so times can be compared to theirs, and sorts in time order.
+	eventTimeLayout string = "2006-01-02 15:04:05.000"
+)
+
+// eventsSchema creates the table of the event log, if it isn't there.
+const eventsSchema string = `
+CREATE TABLE IF NOT EXISTS events (
+	id INTEGER PRIMARY KEY,
+	time TEXT NOT NULL,
+	tenant TEXT NOT NULL,
+	rule TEXT NOT NULL,
+	branch TEXT NOT NULL,
+	bib_id INTEGER,
+	mapped INTEGER,
+	target TEXT NOT NULL,
+	status INTEGER NOT NULL,
+	referrer TEXT NOT NULL,
+	client TEXT NOT NULL,
+	user_agent TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS events_time ON events (time);
+`
+
+// redirectEvent is a request, as it's recorded in the event log. Its rule is empty unless it was translated.
+type redirectEvent struct {
+	time      time.Time
+	tenant    string
+	rule      string
+	branch    string
+	bibID     sql.NullInt64 // Null unless a record link had a valid bibID.
+	mapped    sql.NullBool  // Whether the bibID was mapped, or null unless it was valid.
+	target    string
+	status    int
+	referrer  string
+	client    string // The client's address, truncated like -anonymize-ips truncate.
+	userAgent string
+}
+
+// eventLog records requests in a SQLite database, for a queryable record of the sunset period.
+// Events are written in batches by a single goroutine, and events recorded while the queue is full are dropped.
+// A nil *eventLog discards everything.
+type eventLog struct {
+	db            *sql.DB
+	batchSize     int
+	flushInterval time.Duration
+
+	events  chan redirectEvent
+	dropped atomic.Uint64 // Events dropped because the queue was full, since the last batch was written.
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// openEventLog opens the SQLite database at path, creating it if needed, and starts writing the events recorded
+// to it in batches of up to batchSize, at least every flushInterval.
+func openEventLog(path string, batchSize int, flushInterval time.Duration) (*eventLog, error) {
+	if batchSize < 1 || flushInterval <= 0 {
+		return nil, fmt.Errorf("Could not open event log %v, the batch size and flush interval must be positive", path)
+	}
+	db, err := sql.Open("sqlite", eventLogDSN(path, false))
+	if err != nil {
+		return nil, fmt.Errorf("Could not open event log %v, %w", path, err)
+	}
+	db.SetMaxOpenConns(1)
+	_, err = db.Exec(eventsSchema)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("Could not create the tables of event log %v, %w", path, err)
+	}
+	l := &eventLog{
+		db:            db,
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		events:        make(chan redirectEvent, batchSize*eventsQueueBatches),
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+	go l.run()
+	return l, nil
+}
+
+// eventLogDSN returns the data source name of the event log at path, opened read-only or for writing.
+// Write-ahead logging lets the database be queried while events are written.
+func eventLogDSN(path string, readOnly bool) string {
+	query := "_pragma=busy_timeout(5000)"
+	if readOnly {
+		query = "mode=ro&" + query
+	} else {
+		query += "&_pragma=journal_mode(WAL)"
+	}
+	return (&url.URL{Scheme: "file", Opaque: path, RawQuery: query}).String()
+}
+
+// record queues the request and its translation for the event log. It doesn't wait for the event to be written.
+// Requests which weren't translated have an empty result, and are recorded without a rule or target.
+func (l *eventLog) record(r *http.Request, result TranslationResult, status int, t time.Time) {
+	if l == nil {
+		return
+	}
+	e := redirectEvent{
+		time:      t,
+		tenant:    result.Tenant,
+		rule:      result.Rule,
+		branch:    result.Branch,
+		status:    status,
+		referrer:  r.Referer(),
+		client:    truncateIP(clientIP(r)),
+		userAgent: r.UserAgent(),
+	}
+	if result.Target != nil {
+		e.target = result.Target.String()
+	}
+	if result.hasBibID() {
+		e.bibID = sql.NullInt64{Int64: int64(result.BibID), Valid: true}
+		e.mapped = sql.NullBool{Bool: result.Found, Valid: true}
+	}
+	select {
+	case l.events <- e:
+	default:
+		l.dropped.Add(1)
+	}
+}
+
+// truncateIP returns the client address with its low bits zeroed, or empty if it can't be parsed.
+func truncateIP(client string) string {
+	addr, err := netip.ParseAddr(client)
+	if err != nil {
+		return ""
+	}
+	return truncateAddr(addr.Unmap().WithZone(""))
+}
+
+// run writes the queued events in batches, until the log is closed.
+func (l *eventLog) run() {
+	defer close(l.done)
+	ticker := time.NewTicker(l.flushInterval)
+	defer ticker.Stop()
+	batch := make([]redirectEvent, 0, l.batchSize)
+	for {
+		select {
+		case e := <-l.events:
+			batch = append(batch, e)
+			if len(batch) < l.batchSize {
+				continue
+			}
+		case <-ticker.C:
+		case <-l.stop:
+			// Write the events which were queued before the log was closed.
+			for len(l.events) > 0 {
+				batch = append(batch, <-l.events)
+				if len(batch) >= l.batchSize {
+					batch = l.flush(batch)
+				}
+			}
+			l.flush(batch)
+			return
+		}
+		batch = l.flush(batch)
+	}
+}
+
+// flush writes the batch of events to the database in one transaction, and returns the batch emptied.
+// A batch which can't be written is logged and discarded, so a full disk doesn't grow the queue without limit.
+func (l *eventLog) flush(batch []redirectEvent) []redirectEvent {
+	if dropped := l.dropped.Swap(0); dropped > 0 {
+		slog.Warn("Dropped redirect events, the event log's queue was full.", "dropped", dropped)
+	}
+	if len(batch) == 0 {
+		return batch
+	}
+	err := l.write(batch)
+	if err != nil {
+		slog.Error("Could not write redirect events.", "events", len(batch), "err", err)
+	}
+	return batch[:0]
+}
+
+// write inserts the events into the database in one transaction.
+func (l *eventLog) write(batch []redirectEvent) error {
+	ctx := context.Background()
+	tx, err := l.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.PrepareContext(ctx, `INSERT INTO events
+		(time, tenant, rule, branch, bib_id, mapped, target, status, referrer, client, user_agent)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, e := range batch {
+		_, err = stmt.ExecContext(ctx,
+			e.time.UTC().Format(eventTimeLayout), e.tenant, e.rule, e.branch, e.bibID, e.mapped,
+			e.target, e.status, e.referrer, e.client, e.userAgent,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// close writes the queued events and closes the database. Events recorded after it's closed aren't written.
+func (l *eventLog) close() error {
+	if l == nil {
+		return nil
+	}
+	close(l.stop)
+	<-l.done
+	return l.db.Close()
+}
@@ -0,0 +1,115 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cu-library/permanentdetour/mapping"
+)
+
+func TestEventLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.db")
+	events, err := openEventLog(path, 2, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := NewDetourer(mapping.NewMap(map[uint32]uint64{651520: 996515203405158}),
+		WithPrimo("ocul-qu"),
+		WithVID("01OCUL_QU:QU_DEFAULT"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := Chain(observed(d), recordEvents(events))
+
+	for _, target := range []string{"/vwebv/holdingsInfo?bibId=651520", "/vwebv/holdingsInfo?bibId=1", "/vwebv/holdingsInfo?bibId=x", "/"} {
+		r := httptest.NewRequest("GET", target, nil)
+		r.RemoteAddr = "192.0.2.123:1234"
+		r.Header.Set("Referer", "https://guides.library.queensu.ca/hamlet")
+		r.Header.Set("User-Agent", "Mozilla/5.0")
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	// Requests which aren't redirected are recorded too, without a rule unless they were translated.
+	for _, r := range []*http.Request{
+		httptest.NewRequest("GET", "/vwebv/holdingsInfo?bibId=651520&"+debugParam+"="+debugParamValue, nil),
+		httptest.NewRequest("POST", "/vwebv/holdingsInfo?bibId=651520", nil),
+		httptest.NewRequest("GET", "/favicon.ico", nil),
+	} {
+		r.RemoteAddr = "192.0.2.123:1234"
+		r.Header.Set("Referer", "https://guides.library.queensu.ca/hamlet")
+		r.Header.Set("User-Agent", "Mozilla/5.0")
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	// The events which are still queued are written when the log is closed.
+	err = events.close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	rows, err := db.Query("SELECT time, rule, branch, bib_id, mapped, target, status, referrer, client, user_agent FROM events ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	type event struct {
+		rule   string
+		branch string
+		bibID  sql.NullInt64
+		mapped sql.NullBool
+		target string
+		status int
+	}
+	var expected = []event{
+		{"record", "mapped", sql.NullInt64{Int64: 651520, Valid: true}, sql.NullBool{Bool: true, Valid: true}, "https://ocul-qu.primo.exlibrisgroup.com/discovery/fulldisplay?docid=alma996515203405158&vid=01OCUL_QU%3AQU_DEFAULT", defaultRedirectStatus},
+		{"record", "unmapped", sql.NullInt64{Int64: 1, Valid: true}, sql.NullBool{Valid: true}, "https://ocul-qu.primo.exlibrisgroup.com/discovery/search?vid=01OCUL_QU%3AQU_DEFAULT", defaultRedirectStatus},
+		{"record", "invalid", sql.NullInt64{}, sql.NullBool{}, "https://ocul-qu.primo.exlibrisgroup.com/discovery/search?vid=01OCUL_QU%3AQU_DEFAULT", defaultRedirectStatus},
+		{"default", "", sql.NullInt64{}, sql.NullBool{}, "https://ocul-qu.primo.exlibrisgroup.com/discovery/search?vid=01OCUL_QU%3AQU_DEFAULT", defaultRedirectStatus},
+		{"record", "mapped", sql.NullInt64{Int64: 651520, Valid: true}, sql.NullBool{Bool: true, Valid: true}, "https://ocul-qu.primo.exlibrisgroup.com/discovery/fulldisplay?docid=alma996515203405158&vid=01OCUL_QU%3AQU_DEFAULT", http.StatusOK},
+		{"", "", sql.NullInt64{}, sql.NullBool{}, "", http.StatusMethodNotAllowed},
+		{"", "", sql.NullInt64{}, sql.NullBool{}, "", http.StatusNotFound},
+	}
+	var i int
+	for rows.Next() {
+		var e event
+		var at, referrer, client, userAgent string
+		err = rows.Scan(&at, &e.rule, &e.branch, &e.bibID, &e.mapped, &e.target, &e.status, &referrer, &client, &userAgent)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i >= len(expected) {
+			t.Fatalf("Event %v, %+v, was recorded, but only %v requests were made.", i, e, len(expected))
+		}
+		if e != expected[i] {
+			t.Errorf("Event %v was %+v, not %+v.", i, e, expected[i])
+		}
+		_, err = time.Parse(eventTimeLayout, at)
+		if err != nil {
+			t.Errorf("Event %v was recorded at %q, %v.", i, at, err)
+		}
+		// The client's address is truncated.
+		if referrer != "https://guides.library.queensu.ca/hamlet" || client != "192.0.2.0" || userAgent != "Mozilla/5.0" {
+			t.Errorf("Event %v had the referrer %q, client %q, and user agent %q.", i, referrer, client, userAgent)
+		}
+		i++
+	}
+	if rows.Err() != nil {
+		t.Fatal(rows.Err())
+	}
+	if i != len(expected) {
+		t.Fatalf("%v events were recorded, not %v.", i, len(expected))
+	}
+}
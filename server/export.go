@@ -0,0 +1,156 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/cu-library/permanentdetour/detour"
+)
+
+const (
+	// exportCommand is the subcommand which exports the record redirects for other servers, instead of serving.
+	exportCommand string = "export"
+
+	// exportNginx is an nginx map of request URIs to Primo permalinks, to include in a map block.
+	exportNginx string = "nginx"
+
+	// exportRewriteMap is an Apache RewriteMap text file of bibIDs to Primo permalinks.
+	exportRewriteMap string = "rewritemap"
+
+	// exportCloudflare is Cloudflare Bulk Redirect list CSV files, of source URLs, target URLs, and statuses.
+	exportCloudflare string = "cloudflare"
+
+	// defaultExportChunkSize is the default maximum number of redirects in each Cloudflare list file,
+	// the number of Bulk Redirects of the smallest plans.
+	defaultExportChunkSize int = 10000
+)
+
+// exportFormats are the formats the record redirects can be exported in.
+var exportFormats = []string{exportNginx, exportRewriteMap, exportCloudflare}
+
+// cloudflareRedirectStatuses are the statuses Cloudflare Bulk Redirects can be sent with.
+var cloudflareRedirectStatuses = []int{http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect}
+
+// exportSettings are the settings of the export subcommand.
+type exportSettings struct {
+	format    string
+	output    string // The file to write to, or stdout when empty.
+	host      string // The legacy catalogue host of source URLs, for Cloudflare.
+	chunkSize int    // The maximum number of redirects in each Cloudflare list file.
+}
+
+// runExport writes the record redirects of the mapped bibIDs, in the format, to the output file, or to stdout if
+// output is empty. Problems are reported to stderr. It returns the exit status, 1 if the export failed,
+// or 2 if the export settings are invalid.
+func runExport(stdout, stderr io.Writer, s translateSettings, e exportSettings) int {
+	if !slices.Contains(exportFormats, e.format) {
+		fmt.Fprintf(stderr, "Usage: permanentdetour %v -format %v [flag...] [file...]\n", exportCommand, strings.Join(exportFormats, "|"))
+		return 2
+	}
+	if e.format == exportCloudflare && (e.host == "" || e.output == "" || e.chunkSize < 1) {
+		fmt.Fprintf(stderr, "The %v format needs -export-host, -output, and an -export-chunk-size of at least 1.\n", exportCloudflare)
+		return 2
+	}
+	rt, err := newTranslationRouter(s)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	d := rt.def
+	switch {
+	case e.format == exportCloudflare:
+		var files []string
+		files, err = writeCloudflareExport(d, e)
+		if err == nil {
+			fmt.Fprintf(stderr, "Exported %v redirects to %v files: %v\n", d.store.Len(), len(files), strings.Join(files, ", "))
+		}
+	case e.output == "" || e.output == "-":
+		err = writeExport(stdout, d, e.format)
+	default:
+		err = writeMappingFile(e.output, func(w io.Writer) error {
+			return writeExport(w, d, e.format)
+		})
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// writeExport writes the record redirect of each bibID mapped by d to w, in the format, in order of bibID.
+func writeExport(w io.Writer, d Detourer, format string) error {
+	bibIDs, err := d.sortedBibIDs()
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "# %v record redirects to %v, exported by permanentdetour %v.\n", len(bibIDs), d.primo, version)
+	for _, bibID := range bibIDs {
+		exlID, _ := d.store.Lookup(bibID)
+		target := d.recordURL(exlID).String()
+		switch format {
+		case exportNginx:
+			// Both are quoted, as the request URI has a ? and the target may have a ;.
+			_, err = fmt.Fprintf(bw, "%v %v;\n", strconv.Quote(detour.RecordPrefix+"?bibId="+strconv.FormatUint(uint64(bibID), 10)), strconv.Quote(target))
+		case exportRewriteMap:
+			_, err = fmt.Fprintf(bw, "%v %v\n", bibID, target)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// writeCloudflareExport writes the record redirects of the bibIDs mapped by d as Cloudflare Bulk Redirect list CSV
+// files, in order of bibID, with at most e.chunkSize in each. When more than one file is needed, they are named
+// like the output with a number, like redirects-1.csv and redirects-2.csv. It returns the names of the files.
+func writeCloudflareExport(d Detourer, e exportSettings) ([]string, error) {
+	status := d.redirectStatus()
+	if !slices.Contains(cloudflareRedirectStatuses, status) {
+		return nil, fmt.Errorf("Cloudflare Bulk Redirects can't be sent with the status %v, expected one of %v", status, cloudflareRedirectStatuses)
+	}
+	bibIDs, err := d.sortedBibIDs()
+	if err != nil {
+		return nil, err
+	}
+	chunks := slices.Collect(slices.Chunk(bibIDs, e.chunkSize))
+	var files []string
+	for i, chunk := range chunks {
+		path := e.output
+		if len(chunks) > 1 {
+			ext := filepath.Ext(path)
+			path = fmt.Sprintf("%v-%v%v", strings.TrimSuffix(path, ext), i+1, ext)
+		}
+		err := writeMappingFile(path, func(w io.Writer) error {
+			out := csv.NewWriter(w)
+			for _, bibID := range chunk {
+				source := e.host + detour.RecordPrefix + "?bibId=" + strconv.FormatUint(uint64(bibID), 10)
+				exlID, _ := d.store.Lookup(bibID)
+				err := out.Write([]string{source, d.recordURL(exlID).String(), strconv.Itoa(status)})
+				if err != nil {
+					return err
+				}
+			}
+			out.Flush()
+			return out.Error()
+		})
+		if err != nil {
+			return files, err
+		}
+		files = append(files, path)
+	}
+	return files, nil
+}
@@ -0,0 +1,129 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunExport(t *testing.T) {
+	dir := t.TempDir()
+	mappings := filepath.Join(dir, "mappings.csv")
+	err := os.WriteFile(mappings, []byte("996515213405158,a651521-01ocul_qu\n996515203405158,a651520-01ocul_qu\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings := translateSettings{primo: "ocul-qu", vid: "01OCUL_QU:QU_DEFAULT", mappingFiles: []string{mappings}}
+
+	var tests = []struct {
+		format   string
+		expected []string
+	}{
+		{
+			exportNginx,
+			[]string{
+				`"/vwebv/holdingsInfo?bibId=651520" "https://ocul-qu.primo.exlibrisgroup.com/discovery/fulldisplay?docid=alma996515203405158&vid=01OCUL_QU%3AQU_DEFAULT";`,
+				`"/vwebv/holdingsInfo?bibId=651521" "https://ocul-qu.primo.exlibrisgroup.com/discovery/fulldisplay?docid=alma996515213405158&vid=01OCUL_QU%3AQU_DEFAULT";`,
+			},
+		},
+		{
+			exportRewriteMap,
+			[]string{
+				"651520 https://ocul-qu.primo.exlibrisgroup.com/discovery/fulldisplay?docid=alma996515203405158&vid=01OCUL_QU%3AQU_DEFAULT",
+				"651521 https://ocul-qu.primo.exlibrisgroup.com/discovery/fulldisplay?docid=alma996515213405158&vid=01OCUL_QU%3AQU_DEFAULT",
+			},
+		},
+	}
+	for _, tt := range tests {
+		var stdout, stderr strings.Builder
+		status := runExport(&stdout, &stderr, settings, exportSettings{format: tt.format})
+		if status != 0 {
+			t.Fatalf("runExport() of %v returned %v, not 0. Output:\n%v", tt.format, status, stderr.String())
+		}
+		lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+		if !strings.HasPrefix(lines[0], "# 2 record redirects to ocul-qu.primo.exlibrisgroup.com") {
+			t.Fatalf("The %v export didn't start with a comment. Output:\n%v", tt.format, stdout.String())
+		}
+		if strings.Join(lines[1:], "\n") != strings.Join(tt.expected, "\n") {
+			t.Fatalf("The %v export was\n%v\nnot\n%v", tt.format, strings.Join(lines[1:], "\n"), strings.Join(tt.expected, "\n"))
+		}
+	}
+
+	output := filepath.Join(dir, "detour.map")
+	var stdout, stderr strings.Builder
+	status := runExport(&stdout, &stderr, settings, exportSettings{format: exportRewriteMap, output: output})
+	if status != 0 {
+		t.Fatalf("runExport() to a file returned %v, not 0. Output:\n%v", status, stderr.String())
+	}
+	content, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(string(content), "651521 https://ocul-qu.primo.exlibrisgroup.com/discovery/fulldisplay?docid=alma996515213405158&vid=01OCUL_QU%3AQU_DEFAULT\n") {
+		t.Fatalf("The exported file was\n%v", string(content))
+	}
+
+	status = runExport(&stdout, &stderr, settings, exportSettings{format: "apache"})
+	if status != 2 {
+		t.Fatalf("runExport() of an unknown format returned %v, not 2.", status)
+	}
+}
+
+func TestRunExportCloudflare(t *testing.T) {
+	dir := t.TempDir()
+	mappings := filepath.Join(dir, "mappings.csv")
+	err := os.WriteFile(mappings, []byte("996515213405158,a651521-01ocul_qu\n996515203405158,a651520-01ocul_qu\n996515223405158,a651522-01ocul_qu\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings := translateSettings{primo: "ocul-qu", vid: "01OCUL_QU:QU_DEFAULT", mappingFiles: []string{mappings}}
+	e := exportSettings{format: exportCloudflare, output: filepath.Join(dir, "redirects.csv"), host: "catalogue.library.queensu.ca", chunkSize: 2}
+
+	var stdout, stderr strings.Builder
+	status := runExport(&stdout, &stderr, settings, e)
+	if status != 0 {
+		t.Fatalf("runExport() returned %v, not 0. Output:\n%v", status, stderr.String())
+	}
+	var tests = []struct {
+		file     string
+		expected string
+	}{
+		{
+			"redirects-1.csv",
+			"catalogue.library.queensu.ca/vwebv/holdingsInfo?bibId=651520,https://ocul-qu.primo.exlibrisgroup.com/discovery/fulldisplay?docid=alma996515203405158&vid=01OCUL_QU%3AQU_DEFAULT,307\n" +
+				"catalogue.library.queensu.ca/vwebv/holdingsInfo?bibId=651521,https://ocul-qu.primo.exlibrisgroup.com/discovery/fulldisplay?docid=alma996515213405158&vid=01OCUL_QU%3AQU_DEFAULT,307\n",
+		},
+		{
+			"redirects-2.csv",
+			"catalogue.library.queensu.ca/vwebv/holdingsInfo?bibId=651522,https://ocul-qu.primo.exlibrisgroup.com/discovery/fulldisplay?docid=alma996515223405158&vid=01OCUL_QU%3AQU_DEFAULT,307\n",
+		},
+	}
+	for _, tt := range tests {
+		content, err := os.ReadFile(filepath.Join(dir, tt.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(content) != tt.expected {
+			t.Errorf("%v was\n%v\nnot\n%v", tt.file, string(content), tt.expected)
+		}
+	}
+
+	// Cloudflare can't send a 303.
+	settings.redirectStatus = http.StatusSeeOther
+	status = runExport(&stdout, &stderr, settings, e)
+	if status != 1 {
+		t.Fatalf("runExport() with a 303 status returned %v, not 1.", status)
+	}
+
+	e.host = ""
+	status = runExport(&stdout, &stderr, settings, e)
+	if status != 2 {
+		t.Fatalf("runExport() without a host returned %v, not 2.", status)
+	}
+}
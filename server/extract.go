@@ -0,0 +1,259 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	// extractMappingCommand is the subcommand which extracts a mapping file from an Alma export of bibliographic records.
+	extractMappingCommand string = "extract-mapping"
+
+	// defaultExtractColumn is the default column of the system numbers in CSV exports, as it's named by Alma.
+	defaultExtractColumn string = "Network Number"
+
+	// extractMMSIDColumn is the column of the MMS IDs in CSV exports, matched ignoring case.
+	extractMMSIDColumn string = "MMS Id"
+)
+
+// marcRecord is the part of a MARCXML record read for the mapping, in any namespace.
+type marcRecord struct {
+	ControlFields []struct {
+		Tag   string `xml:"tag,attr"`
+		Value string `xml:",chardata"`
+	} `xml:"controlfield"`
+	DataFields []struct {
+		Tag       string `xml:"tag,attr"`
+		Subfields []struct {
+			Code  string `xml:"code,attr"`
+			Value string `xml:",chardata"`
+		} `xml:"subfield"`
+	} `xml:"datafield"`
+}
+
+// mmsID returns the record's MMS ID, in the 001 field.
+func (r marcRecord) mmsID() string {
+	for _, f := range r.ControlFields {
+		if f.Tag == "001" {
+			return strings.TrimSpace(f.Value)
+		}
+	}
+	return ""
+}
+
+// systemNumbers returns the record's system numbers, in the 035 $a subfields.
+func (r marcRecord) systemNumbers() []string {
+	var numbers []string
+	for _, f := range r.DataFields {
+		if f.Tag != "035" {
+			continue
+		}
+		for _, sf := range f.Subfields {
+			if sf.Code == "a" {
+				numbers = append(numbers, strings.TrimSpace(sf.Value))
+			}
+		}
+	}
+	return numbers
+}
+
+// extractResult is the mappings extracted from Alma exports.
+type extractResult struct {
+	prefix     string // The prefix of the system numbers which are Voyager bibIDs, like (CaOKQ).
+	mappings   map[uint32]mergedMapping
+	records    int
+	unnumbered int // The records without a Voyager bibID.
+	identical  int // Duplicate mappings of bibIDs to the same MMS ID, which were dropped.
+}
+
+// runExtractMapping extracts the mappings of Voyager bibIDs to MMS IDs from the Alma exports given in args,
+// and writes them as a mapping file to the -o file or stdout, and a summary to stderr. It returns the exit status,
+// 1 if the extract failed, or 2 if the arguments are invalid.
+func runExtractMapping(stdout, stderr io.Writer, args []string) int {
+	flags := flag.NewFlagSet(extractMappingCommand, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	output := flags.String("o", "", "The mapping file to write. Written to standard output when empty or -.")
+	prefix := flags.String("prefix", "", "The prefix of the 035 $a system numbers which are Voyager bibIDs, like (CaOKQ). Required.")
+	column := flags.String("column", defaultExtractColumn, "The column of the 035 $a system numbers in CSV exports.")
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: permanentdetour %v -prefix (CaOKQ) [-column name] [-o mappings.csv] export.xml|export.csv...\n", extractMappingCommand)
+		flags.PrintDefaults()
+	}
+	err := flags.Parse(args)
+	if err != nil {
+		return 2
+	}
+	if *prefix == "" || flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	result := extractResult{prefix: *prefix, mappings: map[uint32]mergedMapping{}}
+	for i, path := range flags.Args() {
+		err := result.extractFile(flags.Args(), i, *column)
+		if err != nil {
+			fmt.Fprintf(stderr, "Could not extract mappings from %v, %v\n", path, err)
+			return 1
+		}
+	}
+	if len(result.mappings) == 0 {
+		fmt.Fprintf(stderr, "No system numbers starting with %v were found in %v records.\n", *prefix, result.records)
+		return 1
+	}
+	if *output == "" || *output == "-" {
+		err = writeMappings(stdout, result.mappings)
+	} else {
+		err = writeMappingFile(*output, func(w io.Writer) error {
+			return writeMappings(w, result.mappings)
+		})
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	fmt.Fprintf(stderr, "Extracted %v mappings from %v records in %v files. %v records had no Voyager bibID, and %v identical duplicates were dropped.\n",
+		len(result.mappings), result.records, flags.NArg(), result.unnumbered, result.identical)
+	return 0
+}
+
+// extractFile extracts the mappings in the export paths[index], which is MARCXML if it starts with <, and CSV otherwise.
+func (e *extractResult) extractFile(paths []string, index int, column string) error {
+	file, err := os.Open(paths[index])
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	reader := bufio.NewReader(file)
+	start, _ := reader.Peek(64)
+	if bytes.HasPrefix(bytes.TrimLeft(bytes.TrimPrefix(start, []byte("\xef\xbb\xbf")), " \t\r\n"), []byte("<")) {
+		return e.extractMARCXML(paths, index, reader)
+	}
+	return e.extractCSV(paths, index, reader, column)
+}
+
+// extractMARCXML extracts the mappings in the MARCXML records read from r.
+func (e *extractResult) extractMARCXML(paths []string, index int, r io.Reader) error {
+	decoder := xml.NewDecoder(r)
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "record" {
+			continue
+		}
+		var record marcRecord
+		err = decoder.DecodeElement(&record, &start)
+		if err != nil {
+			return err
+		}
+		e.records++
+		err = e.add(paths, index, e.records, record.mmsID(), record.systemNumbers())
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// extractCSV extracts the mappings in the CSV read from r, whose header names the MMS ID and system number columns.
+// A cell can have more than one system number, separated by semicolons.
+func (e *extractResult) extractCSV(paths []string, index int, r io.Reader, column string) error {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return fmt.Errorf("Could not read the header, %w", err)
+	}
+	for i := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(header[i], "\ufeff")))
+	}
+	mmsIDIndex := slices.Index(header, strings.ToLower(extractMMSIDColumn))
+	numbersIndex := slices.Index(header, strings.ToLower(column))
+	if mmsIDIndex == -1 || numbersIndex == -1 {
+		return fmt.Errorf("The header doesn't have the columns %q and %q", extractMMSIDColumn, column)
+	}
+	for {
+		row, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		e.records++
+		if mmsIDIndex >= len(row) || numbersIndex >= len(row) {
+			return fmt.Errorf("Row %v has %v columns, not %v", e.records, len(row), len(header))
+		}
+		err = e.add(paths, index, e.records, strings.TrimSpace(row[mmsIDIndex]), strings.Split(row[numbersIndex], ";"))
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// add adds the mappings of the record's Voyager bibIDs, the system numbers with the prefix, to the MMS ID.
+// A bibID mapped to a different MMS ID by an earlier record is an error.
+func (e *extractResult) add(paths []string, index int, record int, mmsID string, numbers []string) error {
+	found := false
+	for _, number := range numbers {
+		number = strings.TrimSpace(number)
+		if !strings.HasPrefix(number, e.prefix) {
+			continue
+		}
+		bibID, err := parseVoyagerNumber(strings.TrimSpace(strings.TrimPrefix(number, e.prefix)))
+		if err != nil {
+			return fmt.Errorf("Record %v has the invalid Voyager bibID %q, %w", record, number, err)
+		}
+		exlID, err := strconv.ParseUint(mmsID, 10, 64)
+		if err != nil {
+			return fmt.Errorf("Record %v has the invalid MMS ID %q, %w", record, mmsID, err)
+		}
+		found = true
+		current := mergedMapping{exlID: exlID, location: mappingLocation{file: index, line: record}}
+		previous, present := e.mappings[bibID]
+		switch {
+		case !present:
+			e.mappings[bibID] = current
+		case previous.exlID == exlID:
+			e.identical++
+		default:
+			return fmt.Errorf("Bib ID %v in record %v is mapped to %v, but to %v in record %v of %v",
+				bibID, record, exlID, previous.exlID, previous.location.line, paths[previous.location.file])
+		}
+	}
+	if !found {
+		e.unnumbered++
+	}
+	return nil
+}
+
+// parseVoyagerNumber returns the bibID of a Voyager system number, like 651520, a651520, or a651520-01ocul_qu.
+func parseVoyagerNumber(number string) (uint32, error) {
+	number, _, _ = strings.Cut(number, "-")
+	if number != "" && (number[0] < '0' || number[0] > '9') {
+		number = number[1:]
+	}
+	bibID, err := strconv.ParseUint(number, 10, 32)
+	if err != nil {
+		return 0, err
+	}
+	return uint32(bibID), nil
+}
@@ -0,0 +1,175 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cu-library/permanentdetour/mapping"
+)
+
+func TestRunExtractMapping(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		err := os.WriteFile(path, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	marcxml := write("export.xml", `<?xml version="1.0" encoding="UTF-8"?>
+<collection xmlns="http://www.loc.gov/MARC21/slim">
+<record>
+  <leader>00000nam a2200000 a 4500</leader>
+  <controlfield tag="001">996515203405158</controlfield>
+  <datafield tag="035" ind1=" " ind2=" "><subfield code="a">(OCoLC)12345</subfield></datafield>
+  <datafield tag="035" ind1=" " ind2=" "><subfield code="a">(CaOKQ)a651520-01ocul_qu</subfield></datafield>
+</record>
+<record>
+  <controlfield tag="001">996515213405158</controlfield>
+  <datafield tag="035" ind1=" " ind2=" "><subfield code="a">(CaOKQ)651521</subfield></datafield>
+  <datafield tag="245" ind1="1" ind2="0"><subfield code="a">(CaOKQ)651529</subfield></datafield>
+</record>
+<record>
+  <controlfield tag="001">996515293405158</controlfield>
+</record>
+</collection>
+`)
+	csv := write("export.csv", "\ufeffMMS Id,Title,Network Number\n996515223405158,\"Species, origin of\",(OCoLC)123; (CaOKQ)a651522\n996515203405158,Duplicate,(CaOKQ)a651520-01ocul_qu\n")
+	column := write("column.csv", "mms id,035 $a\n996515223405158,(CaOKQ)651522\n")
+	conflict := write("conflict.csv", "MMS Id,Network Number\n996515203405159,(CaOKQ)a651520\n")
+	invalid := write("invalid.xml", `<collection><record><controlfield tag="001">996515203405158</controlfield><datafield tag="035"><subfield code="a">(CaOKQ)a65x</subfield></datafield></record></collection>`)
+	header := write("header.csv", "MMS Id,Title\n996515203405158,Species\n")
+
+	var tests = []struct {
+		name   string
+		args   []string
+		status int
+		stdout string
+		stderr string
+	}{
+		{
+			"marcxml",
+			[]string{"-prefix", "(CaOKQ)", marcxml},
+			0,
+			"996515203405158,a651520\n996515213405158,a651521\n",
+			"Extracted 2 mappings from 3 records in 1 files. 1 records had no Voyager bibID, and 0 identical duplicates were dropped.",
+		},
+		{
+			"marcxml and csv",
+			[]string{"-prefix", "(CaOKQ)", "-o", "-", marcxml, csv},
+			0,
+			"996515203405158,a651520\n996515213405158,a651521\n996515223405158,a651522\n",
+			"Extracted 3 mappings from 5 records in 2 files. 1 records had no Voyager bibID, and 1 identical duplicates were dropped.",
+		},
+		{
+			"column",
+			[]string{"-prefix", "(CaOKQ)", "-column", "035 $a", column},
+			0,
+			"996515223405158,a651522\n",
+			"Extracted 1 mappings",
+		},
+		{
+			"conflict",
+			[]string{"-prefix", "(CaOKQ)", marcxml, conflict},
+			1,
+			"",
+			"Could not extract mappings from " + conflict + ", Bib ID 651520 in record 4 is mapped to 996515203405159, but to 996515203405158 in record 1 of " + marcxml,
+		},
+		{
+			"invalid",
+			[]string{"-prefix", "(CaOKQ)", invalid},
+			1,
+			"",
+			`Could not extract mappings from ` + invalid + `, Record 1 has the invalid Voyager bibID "(CaOKQ)a65x"`,
+		},
+		{
+			"missing column",
+			[]string{"-prefix", "(CaOKQ)", header},
+			1,
+			"",
+			`Could not extract mappings from ` + header + `, The header doesn't have the columns "MMS Id" and "Network Number"`,
+		},
+		{
+			"no mappings",
+			[]string{"-prefix", "(CaOKQ-TEST)", marcxml},
+			1,
+			"",
+			"No system numbers starting with (CaOKQ-TEST) were found in 3 records.",
+		},
+		{
+			"no prefix",
+			[]string{marcxml},
+			2,
+			"",
+			"Usage: permanentdetour extract-mapping",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr strings.Builder
+			status := runExtractMapping(&stdout, &stderr, tt.args)
+			if status != tt.status {
+				t.Fatalf("runExtractMapping() returned %v, not %v. Output:\n%v", status, tt.status, stderr.String())
+			}
+			if stdout.String() != tt.stdout {
+				t.Fatalf("The extracted mappings were\n%v\nnot\n%v", stdout.String(), tt.stdout)
+			}
+			if !strings.HasPrefix(stderr.String(), tt.stderr) {
+				t.Fatalf("The report didn't start with %q. Output:\n%v", tt.stderr, stderr.String())
+			}
+		})
+	}
+}
+
+func TestRunExtractMappingOutputFile(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "export.csv")
+	err := os.WriteFile(input, []byte("MMS Id,Network Number\n996515213405158,(CaOKQ)a651521\n996515203405158,(CaOKQ)a651520\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := filepath.Join(dir, "mappings.csv")
+	var stdout, stderr strings.Builder
+	status := runExtractMapping(&stdout, &stderr, []string{"-prefix", "(CaOKQ)", "-o", output, input})
+	if status != 0 {
+		t.Fatalf("runExtractMapping() returned %v, not 0. Output:\n%v", status, stderr.String())
+	}
+	// The extracted file can be loaded.
+	m := map[uint32]uint64{}
+	err = mapping.LoadFile(m, output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m) != 2 || m[651520] != 996515203405158 {
+		t.Fatalf("The mappings loaded from the extracted file were %v.", m)
+	}
+}
+
+func TestParseVoyagerNumber(t *testing.T) {
+	var tests = []struct {
+		number   string
+		expected uint32
+		valid    bool
+	}{
+		{"651520", 651520, true},
+		{"a651520", 651520, true},
+		{"a651520-01ocul_qu", 651520, true},
+		{"", 0, false},
+		{"a", 0, false},
+		{"a65x", 0, false},
+		{"a99999999999", 0, false},
+	}
+	for _, tt := range tests {
+		bibID, err := parseVoyagerNumber(tt.number)
+		if (err == nil) != tt.valid || bibID != tt.expected {
+			t.Errorf("parseVoyagerNumber(%q) returned %v, %v, not %v.", tt.number, bibID, err, tt.expected)
+		}
+	}
+}
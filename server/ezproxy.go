@@ -0,0 +1,21 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"net/http"
+
+	"github.com/cu-library/permanentdetour/detour"
+)
+
+// unwrapProxiedRequest returns a copy of the request with the catalogue URL embedded in any
+// EZproxy starting point URLs as its URL. If the request isn't wrapped, it is returned unchanged.
+func unwrapProxiedRequest(r *http.Request, proxyHosts []string) *http.Request {
+	u, unwrapped := detour.UnwrapProxiedURL(r.Host, r.URL, proxyHosts)
+	if !unwrapped {
+		return r
+	}
+	return requestWithURL(r, u)
+}
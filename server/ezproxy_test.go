@@ -0,0 +1,33 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestUnwrapProxiedRequest(t *testing.T) {
+	proxyHosts := []string{"proxy.queensu.ca"}
+	var tests = []struct {
+		host     string
+		request  string
+		expected string
+	}{
+		{"proxy.queensu.ca", "/login?url=https://catalogue.library.queensu.ca/vwebv/holdingsInfo?bibId=1", "/vwebv/holdingsInfo?bibId=1"},
+		{"catalogue.library.queensu.ca", "/login?url=https://catalogue.library.queensu.ca/vwebv/holdingsInfo?bibId=1", "/login?url=https://catalogue.library.queensu.ca/vwebv/holdingsInfo?bibId=1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			r := httptest.NewRequest("GET", tt.request, nil)
+			r.Host = tt.host
+			unwrapped := unwrapProxiedRequest(r, proxyHosts)
+			if unwrapped.URL.String() != tt.expected {
+				t.Fatalf("unwrapProxiedRequest(\"%v\") returned \"%v\", not \"%v\"", tt.request, unwrapped.URL, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// The features which can be turned off or on in the features section of the configuration file.
+const (
+	// featureSFX translates requests for SFX menus.
+	featureSFX string = "sfx"
+
+	// featureOpenURL passes OpenURL context objects along to the link resolver, whatever the path.
+	featureOpenURL string = "openurl"
+
+	// featureClassic translates links to the classic WebVoyage CGI.
+	featureClassic string = "classic"
+
+	// featureSearch translates catalogue searches.
+	featureSearch string = "search"
+
+	// featurePatron redirects patron login and account requests to the Primo login.
+	featurePatron string = "patron"
+
+	// featureSummon translates Summon searches.
+	featureSummon string = "summon"
+
+	// featureMaintenancePage holds requests at the notice page while maintenance mode is enabled.
+	featureMaintenancePage string = "maintenancePage"
+
+	// featureLookupAPI serves the lookup, batch lookup, and reverse lookup APIs, over HTTP and gRPC.
+	featureLookupAPI string = "lookupApi"
+)
+
+// featureNames are the names of the features which can be turned off or on. Every feature is on by default.
+var featureNames = []string{featureSFX, featureOpenURL, featureClassic, featureSearch, featurePatron, featureSummon, featureMaintenancePage, featureLookupAPI}
+
+// setFeatures turns the features off or on, keeping the setting of features which aren't listed.
+// The error lists every unknown feature.
+func (d *Detourer) setFeatures(features map[string]bool) error {
+	var unknown []string
+	// The map is shared with the previous Detourer, which may still be serving requests.
+	d.features = maps.Clone(d.features)
+	if d.features == nil {
+		d.features = map[string]bool{}
+	}
+	for _, name := range slices.Sorted(maps.Keys(features)) {
+		if !slices.Contains(featureNames, name) {
+			unknown = append(unknown, name)
+			continue
+		}
+		d.features[name] = features[name]
+	}
+	if len(unknown) > 0 {
+		return fmt.Errorf("unknown features %q, the features are %q", unknown, featureNames)
+	}
+	return nil
+}
+
+// featureEnabled reports whether the feature is on. Features which weren't set are on.
+func (d Detourer) featureEnabled(name string) bool {
+	enabled, set := d.features[name]
+	return enabled || !set
+}
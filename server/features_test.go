@@ -0,0 +1,89 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cu-library/permanentdetour/mapping"
+)
+
+func TestSetFeatures(t *testing.T) {
+	d := Detourer{}
+	err := d.setFeatures(map[string]bool{featureSFX: false, "cgi": true})
+	if err == nil {
+		t.Fatal("An unknown feature wasn't an error.")
+	}
+	if d.featureEnabled(featureSFX) {
+		t.Fatal("The sfx feature was on after it was turned off.")
+	}
+	if !d.featureEnabled(featureSummon) {
+		t.Fatal("The summon feature was off, though it wasn't set.")
+	}
+	previous := d
+	err = d.setFeatures(map[string]bool{featureSFX: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !d.featureEnabled(featureSFX) {
+		t.Fatal("The sfx feature was off after it was turned on.")
+	}
+	if previous.featureEnabled(featureSFX) {
+		t.Fatal("Turning a feature on changed the previous detourer.")
+	}
+}
+
+func TestServeHTTPFeatures(t *testing.T) {
+	var tests = []struct {
+		features map[string]bool
+		url      string
+		expected string
+	}{
+		{nil, "/vwebv/search?searchArg=tolkien&searchCode=GKEY%5E*", "https://ocul-qu.primo.exlibrisgroup.com/discovery/search?query=any%2Ccontains%2Ctolkien&search_scope=MyInst_and_CI&tab=Everything&vid=01OCUL_QU%3AQU_DEFAULT"},
+		{map[string]bool{featureSearch: false}, "/vwebv/search?searchArg=tolkien&searchCode=GKEY%5E*", "https://ocul-qu.primo.exlibrisgroup.com/discovery/search?vid=01OCUL_QU%3AQU_DEFAULT"},
+		{map[string]bool{featureClassic: false}, "/cgi-bin/Pwebrecon.cgi?BBID=651520", "https://ocul-qu.primo.exlibrisgroup.com/discovery/search?vid=01OCUL_QU%3AQU_DEFAULT"},
+		{map[string]bool{featurePatron: false}, "/vwebv/my", "https://ocul-qu.primo.exlibrisgroup.com/discovery/search?vid=01OCUL_QU%3AQU_DEFAULT"},
+		{map[string]bool{featureSummon: false, featurePatron: true}, "/vwebv/login", "https://ocul-qu.primo.exlibrisgroup.com/discovery/login?vid=01OCUL_QU%3AQU_DEFAULT"},
+	}
+	for _, tt := range tests {
+		d := Detourer{primo: "ocul-qu.primo.exlibrisgroup.com", vid: "01OCUL_QU:QU_DEFAULT"}
+		err := d.setFeatures(tt.features)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		d.ServeHTTP(w, httptest.NewRequest("GET", tt.url, nil))
+		if w.Header().Get("Location") != tt.expected {
+			t.Errorf("With features %v, %v was redirected to %v, not %v.", tt.features, tt.url, w.Header().Get("Location"), tt.expected)
+		}
+	}
+}
+
+func TestFeaturesMaintenancePageAndLookups(t *testing.T) {
+	d := Detourer{
+		store:       mapping.NewMap(map[uint32]uint64{651520: 996515203405158}),
+		primo:       "ocul-qu.primo.exlibrisgroup.com",
+		vid:         "01OCUL_QU:QU_DEFAULT",
+		batchLimit:  10,
+		maintenance: &maintenance{},
+	}
+	d.maintenance.set(true)
+	err := d.setFeatures(map[string]bool{featureMaintenancePage: false, featureLookupAPI: false})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	d.ServeHTTP(w, httptest.NewRequest("GET", "/vwebv/holdingsInfo?bibId=651520", nil))
+	if w.Code != defaultRedirectStatus {
+		t.Fatalf("With the maintenance page off, the status was %v, not %v.", w.Code, defaultRedirectStatus)
+	}
+	w = httptest.NewRecorder()
+	d.serveLookup(w, httptest.NewRequest("GET", "/api/v1/lookup?bibId=651520", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("With the lookup API off, the lookup status was %v, not %v.", w.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,366 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Config is the configuration of the server, and of the subcommands which share its flags. LoadConfig resolves it
+// from the command line, the env file, the environment, and secret files. Tests can fill it in themselves,
+// and pass it to Run.
+type Config struct {
+	Command      string   // The check, translate, export, sitemap, verify, replay, smoke, or report subcommand, or empty to serve.
+	Arg          string   // The URL translated by the translate subcommand, or the access log replayed by the replay subcommand.
+	MappingFiles []string // The mapping files listed in -mappings, then those given as arguments.
+
+	// The settings of the flags, named like them. Lists are comma separated, like the flags.
+	Version               bool
+	Address               string
+	AdminAddress          string
+	SecretsDir            string
+	EnvFile               string
+	Format                string
+	Output                string
+	Target                string
+	ReplayHost            string
+	Sample                int
+	ReportDate            string
+	SMTPAddress           string
+	SMTPFrom              string
+	SMTPTo                string
+	SMTPUsername          string
+	SMTPPassword          string
+	SitemapURL            string
+	ExportHost            string
+	ExportChunkSize       int
+	Batch                 string
+	Mappings              string
+	ConfigPath            string
+	Primo                 string
+	VID                   string
+	PrimoHost             string
+	Sandbox               bool
+	CanaryPercent         int
+	CanaryVID             string
+	CanaryPrimo           string
+	CanaryPrimoHost       string
+	PrimoCheckInterval    time.Duration
+	PrimoCheckTimeout     time.Duration
+	ProxyHosts            string
+	BatchLimit            int
+	LookupTimeout         time.Duration
+	CORSOrigins           string
+	CORSMethods           string
+	CORSMaxAge            time.Duration
+	Reverse               bool
+	GRPCAddress           string
+	SRUPath               string
+	TLSCert               string
+	TLSKey                string
+	ACMEHosts             string
+	ACMECacheDir          string
+	ACMEEmail             string
+	ACMEHTTPAddress       string
+	ReadHeaderTimeout     time.Duration
+	ReadTimeout           time.Duration
+	WriteTimeout          time.Duration
+	IdleTimeout           time.Duration
+	ShutdownTimeout       time.Duration
+	H2C                   bool
+	Metrics               bool
+	UnmappedLimit         int
+	UnmappedFile          string
+	UnmappedSaveInterval  time.Duration
+	EventsDB              string
+	EventsBatchSize       int
+	EventsFlushInterval   time.Duration
+	Maintenance           bool
+	MaintenanceTemplate   string
+	MaintenanceRetryAfter time.Duration
+	Pprof                 bool
+	PprofToken            string
+	StatsDAddress         string
+	StatsDPrefix          string
+	DogStatsD             bool
+	LogFormat             string
+	Setuid                string
+	Setgid                string
+	AllowRoot             bool
+	Service               string
+	PIDFile               string
+	LogLevel              string
+	ProxyProtocol         bool
+	TrustedProxies        string
+	RedirectStatus        int
+	Methods               string
+	CacheControl          string
+	CacheControlRules     string
+	NoisePaths            string
+	RobotsTxt             string
+	RobotsTag             string
+	HSTS                  string
+	ReferrerPolicy        string
+	CSP                   string
+	AllowCIDR             string
+	DenyCIDR              string
+	RateLimit             float64
+	RateLimitBurst        int
+	RateLimitExempt       string
+	LogSuppress           string
+	LogDedupInterval      time.Duration
+	AccessLog             string
+	AccessLogMaxSize      int
+	AccessLogMaxAge       time.Duration
+	AnonymizeIPs          string
+	AnonymizeSaltRotation time.Duration
+	OTLPEndpoint          string
+	SRUTarget             string
+
+	envPath     string        // The env file which was read, or empty.
+	envSet      []string      // The variables which were set from the env file.
+	secretsRead []string      // The secret flags which were read from files.
+	flags       *flag.FlagSet // The flags which were parsed, or nil if the Config wasn't loaded by LoadConfig.
+}
+
+// LoadConfig returns the configuration set by args, the command line arguments after the program name, and, for each
+// flag which isn't set by them, its PERMANENTDETOUR_ environment variable, read after the env file, or its secret file.
+// The Build's defaults are the defaults of -primo and -vid. Help is written to standard error, and returned as flag.ErrHelp.
+func LoadConfig(b Build, args []string) (Config, error) {
+	var c Config
+	fs := flag.NewFlagSet("permanentdetour", flag.ContinueOnError)
+	fs.Usage = func() { usage(fs) }
+
+	// Define the command line flags.
+	fs.BoolVar(&c.Version, "version", false, "Print the version, commit, and build date, and exit.")
+	fs.StringVar(&c.Address, "address", defaultAddress, "Comma separated list of addresses to bind on.")
+	fs.StringVar(&c.AdminAddress, "admin-address", "", "Address to bind on for the dashboard, health, version, and metrics endpoints, like an internal port. When set, they're only served on this address.")
+	fs.StringVar(&c.SecretsDir, "secrets-dir", "", "Directory of files holding secrets, named like their flags, like pprof-token, such as mounted secrets. Secrets can also be read from the file named by a _FILE environment variable, like PERMANENTDETOUR_PPROF_TOKEN_FILE.")
+	fs.StringVar(&c.EnvFile, "env-file", "", "Path of a file of PERMANENTDETOUR_ environment variables, read before the environment. Variables already in the environment take precedence. Defaults to "+defaultEnvFile+" next to the executable, if present.")
+	fs.StringVar(&c.Format, "format", "", "With the export subcommand, the format to export the record redirects in: nginx, rewritemap, or cloudflare.")
+	fs.StringVar(&c.Output, "output", "", "With the export subcommand, the file to write to. Standard output when empty. Cloudflare lists which are split are numbered, like redirects-1.csv. With the sitemap subcommand, the directory to write to. With the report subcommand, the file to write the summary to.")
+	fs.StringVar(&c.Target, "target", "", "With the smoke subcommand, the URL of the running instance to check, like http://localhost:8877.")
+	fs.StringVar(&c.ReplayHost, "replay-host", "", "With the replay subcommand, the host the logged requests are replayed to, which chooses the tenant.")
+	fs.IntVar(&c.Sample, "sample", defaultVerifySample, "With the verify subcommand, the number of mappings chosen at random to verify.")
+	fs.StringVar(&c.ReportDate, "report-date", "", "With the report subcommand, the day to summarize, like 2019-10-11, in the local time zone. Yesterday when empty.")
+	fs.StringVar(&c.SMTPAddress, "smtp-address", "", "With the report subcommand, the host and port of the SMTP server to email the summary through, like smtp.example.com:587. Not emailed when empty.")
+	fs.StringVar(&c.SMTPFrom, "smtp-from", "", "With the report subcommand, the address the summary is emailed from.")
+	fs.StringVar(&c.SMTPTo, "smtp-to", "", "With the report subcommand, comma separated list of addresses to email the summary to.")
+	fs.StringVar(&c.SMTPUsername, "smtp-username", "", "With the report subcommand, the username to authenticate to the SMTP server with. Not authenticated when empty.")
+	fs.StringVar(&c.SMTPPassword, "smtp-password", "", "With the report subcommand, the password to authenticate to the SMTP server with. Only sent over TLS.")
+	fs.StringVar(&c.SitemapURL, "sitemap-url", "", "With the sitemap subcommand, the URL the sitemaps are published at, like https://library.example.com/sitemaps/.")
+	fs.StringVar(&c.ExportHost, "export-host", "", "With the export subcommand, the legacy catalogue host of the source URLs of Cloudflare lists, like catalogue.library.queensu.ca.")
+	fs.IntVar(&c.ExportChunkSize, "export-chunk-size", defaultExportChunkSize, "With the export subcommand, the maximum number of redirects in each Cloudflare list file.")
+	fs.StringVar(&c.Batch, "batch", "", "With the translate subcommand, a file of legacy URLs to translate, one on each line, or - for standard input. The translations are written as CSV.")
+	fs.StringVar(&c.Mappings, "mappings", "", "Comma separated list of mapping files, which are loaded before those given as arguments. Files can also be separated like PATH, by : or, on Windows, ;.")
+	fs.StringVar(&c.ConfigPath, "config", "", "Path to a JSON configuration file of translation settings, which override the flags. Reloaded on SIGHUP, and on POST to /admin/reload on the -admin-address.")
+	fs.StringVar(&c.Primo, "primo", b.DefaultPrimo, "The subdomain of the target Primo instance, ?????.primo.exlibrisgroup.com. Required, unless -primo-host is set.")
+	fs.StringVar(&c.VID, "vid", b.DefaultVID, "VID parameter for Primo. Required.")
+	fs.StringVar(&c.PrimoHost, "primo-host", "", "The host of the target Primo instance, like search.library.example.edu, or a scheme and host, like http://search.library.example.edu, when Primo is behind a custom hostname. Overrides -primo.")
+	fs.BoolVar(&c.Sandbox, "sandbox", false, "Redirect to the Primo sandbox, the -psb subdomain, instead of production. Requests can choose with the X-Detour-Primo header.")
+	fs.IntVar(&c.CanaryPercent, "canary-percent", 0, "The percentage of clients whose redirects go to the canary Primo view, chosen by a hash of their address. Disabled when 0.")
+	fs.StringVar(&c.CanaryVID, "canary-vid", "", "The vid of the canary Primo view, like 01OCUL_QU:QU_NEW.")
+	fs.StringVar(&c.CanaryPrimo, "canary-primo", "", "The subdomain of the canary's Primo instance, if it isn't -primo.")
+	fs.StringVar(&c.CanaryPrimoHost, "canary-primo-host", "", "The host of the canary's Primo instance, when it is behind a custom hostname.")
+	fs.DurationVar(&c.PrimoCheckInterval, "primo-check-interval", 0, "Check that the Primo search page for the vid is reachable this often, reporting it in /readyz and the metrics. Disabled when 0.")
+	fs.DurationVar(&c.PrimoCheckTimeout, "primo-check-timeout", defaultPrimoCheckTimeout, "The time allowed for each Primo reachability check.")
+	fs.StringVar(&c.ProxyHosts, "proxy-hosts", "", "Comma separated list of EZproxy hosts. Starting point URLs are unwrapped before translation.")
+	fs.IntVar(&c.BatchLimit, "batch-limit", defaultBatchLimit, "The maximum number of bibIDs in a batch lookup API request.")
+	fs.DurationVar(&c.LookupTimeout, "lookup-timeout", defaultLookupTimeout, "The longest a request waits for its mapping lookups, before a record link is redirected to the search form instead. No limit when 0.")
+	fs.StringVar(&c.CORSOrigins, "cors-origins", "", "Comma separated list of origins allowed to call the lookup APIs from browsers, like https://example.libguides.com, or * for any. Disabled when empty.")
+	fs.StringVar(&c.CORSMethods, "cors-methods", defaultCORSMethods, "Comma separated list of methods allowed in cross-origin lookup API requests.")
+	fs.DurationVar(&c.CORSMaxAge, "cors-max-age", defaultCORSMaxAge, "How long browsers may cache the response to a cross-origin preflight request.")
+	fs.BoolVar(&c.Reverse, "reverse", false, "Build a reverse index of MMS IDs to bibIDs for the reverse lookup API. Uses more memory.")
+	fs.StringVar(&c.GRPCAddress, "grpc-address", "", "Address to bind the gRPC lookup service on. Disabled when empty.")
+	fs.StringVar(&c.SRUPath, "sru", "", "Path on which to proxy SRU searchRetrieve requests to Alma, like /voyager. Disabled when empty.")
+	fs.StringVar(&c.TLSCert, "tls-cert", "", "Path to a TLS certificate. HTTPS is served when this and -tls-key are set. Reloaded on SIGHUP.")
+	fs.StringVar(&c.TLSKey, "tls-key", "", "Path to the TLS certificate's private key.")
+	fs.StringVar(&c.ACMEHosts, "acme", "", "Comma separated list of hostnames for which to obtain certificates from Let's Encrypt. HTTPS is served when set.")
+	fs.StringVar(&c.ACMECacheDir, "acme-cache", defaultACMECacheDir, "Directory in which to store certificates from Let's Encrypt.")
+	fs.StringVar(&c.ACMEEmail, "acme-email", "", "Contact email address for the Let's Encrypt account. Optional.")
+	fs.StringVar(&c.ACMEHTTPAddress, "acme-http-address", "", "Address to bind on for HTTP requests when using -acme, like :80. Serves HTTP-01 challenges. Disabled when empty.")
+	fs.DurationVar(&c.ReadHeaderTimeout, "read-header-timeout", defaultReadHeaderTimeout, "The time allowed to read request headers.")
+	fs.DurationVar(&c.ReadTimeout, "read-timeout", defaultReadTimeout, "The time allowed to read an entire request, including the body.")
+	fs.DurationVar(&c.WriteTimeout, "write-timeout", defaultWriteTimeout, "The time allowed to write a response.")
+	fs.DurationVar(&c.IdleTimeout, "idle-timeout", defaultIdleTimeout, "The time to keep idle keep-alive connections open.")
+	fs.DurationVar(&c.ShutdownTimeout, "shutdown-timeout", defaultShutdownTimeout, "The time allowed for open connections to finish when shutting down, before they are closed.")
+	fs.BoolVar(&c.H2C, "h2c", false, "Accept HTTP/2 without TLS (h2c with prior knowledge), for proxies which speak h2c to backends.")
+	fs.BoolVar(&c.Metrics, "metrics", true, "Serve Prometheus metrics on /metrics.")
+	fs.IntVar(&c.UnmappedLimit, "unmapped-limit", defaultUnmappedLimit, "The maximum number of unmapped bibIDs to track, served on /admin/unmapped on the -admin-address. Disabled when 0.")
+	fs.StringVar(&c.UnmappedFile, "unmapped-file", "", "Path of a CSV file in which to save the tracked unmapped bibIDs, loaded at startup. Disabled when empty.")
+	fs.DurationVar(&c.UnmappedSaveInterval, "unmapped-save-interval", defaultUnmappedSaveInterval, "The time between saves of the unmapped bibIDs to -unmapped-file.")
+	fs.StringVar(&c.EventsDB, "events-db", "", "Path of a SQLite database in which to record every request, created if needed. Disabled when empty.")
+	fs.IntVar(&c.EventsBatchSize, "events-batch-size", defaultEventsBatchSize, "The maximum number of requests written to -events-db at once.")
+	fs.DurationVar(&c.EventsFlushInterval, "events-flush-interval", defaultEventsFlushInterval, "The longest time requests wait before they're written to -events-db.")
+	fs.BoolVar(&c.Maintenance, "maintenance", false, "Start in maintenance mode, serving a notice page instead of redirecting. Toggled on /admin/maintenance on the -admin-address.")
+	fs.StringVar(&c.MaintenanceTemplate, "maintenance-template", "", "Path to an HTML template for the maintenance page. {{.Target}} is the URL requests would be redirected to. A built-in page is used when empty.")
+	fs.DurationVar(&c.MaintenanceRetryAfter, "maintenance-retry-after", defaultMaintenanceRetryAfter, "The Retry-After header of responses during maintenance.")
+	fs.BoolVar(&c.Pprof, "pprof", false, "Serve the net/http/pprof profiling endpoints on /debug/pprof/. Requires -admin-address or -pprof-token.")
+	fs.StringVar(&c.PprofToken, "pprof-token", "", "A bearer token required to access the profiling endpoints.")
+	fs.StringVar(&c.StatsDAddress, "statsd-address", "", "Address of a StatsD server to send metrics to over UDP, like localhost:8125. Disabled when empty.")
+	fs.StringVar(&c.StatsDPrefix, "statsd-prefix", defaultStatsDPrefix, "The prefix of the names of metrics sent to StatsD.")
+	fs.BoolVar(&c.DogStatsD, "dogstatsd", false, "Send the rule as a DogStatsD tag, instead of in the StatsD metric name.")
+	fs.StringVar(&c.LogFormat, "log-format", "text", "The format of log messages, text or json.")
+	fs.StringVar(&c.Setuid, "setuid", "", "User name or ID to switch to after binding listeners, so privileged ports can be bound without running as root.")
+	fs.StringVar(&c.Setgid, "setgid", "", "Group name or ID to switch to after binding listeners. Defaults to the -setuid user's primary group.")
+	fs.BoolVar(&c.AllowRoot, "allow-root", false, "Allow serving as root. Without it, the server refuses to serve as root unless -setuid is set.")
+	fs.StringVar(&c.Service, "service", "", "Install or uninstall the Windows service, started with the other flags and files given. One of install or uninstall.")
+	fs.StringVar(&c.PIDFile, "pidfile", "", "Path of a file to write the process ID to. Removed on clean shutdown. Disabled when empty.")
+	fs.StringVar(&c.LogLevel, "log-level", "info", "The minimum level of log messages, debug, info, warn, or error.")
+	fs.BoolVar(&c.ProxyProtocol, "proxy-protocol", false, "Require a PROXY protocol v1 or v2 header on each connection, which conveys the client's address.")
+	fs.StringVar(&c.TrustedProxies, "trusted-proxies", "", "Comma separated list of CIDR prefixes of proxies trusted to set X-Forwarded-For and X-Forwarded-Proto.")
+	fs.IntVar(&c.RedirectStatus, "redirect-status", defaultRedirectStatus, "The status of redirects, like 301 once the legacy URLs will never be reused, or 302.")
+	fs.StringVar(&c.Methods, "methods", strings.Join(defaultMethods, ","), "Comma separated list of request methods which are translated. Others receive a 405 status.")
+	fs.StringVar(&c.CacheControl, "cache-control", "", "The Cache-Control header of redirects, like no-store or max-age=86400. Not set when empty.")
+	fs.StringVar(&c.CacheControlRules, "cache-control-rules", "", "Semicolon separated list of rule=value Cache-Control headers for redirects by rule, like record=max-age=86400;patron=no-store.")
+	fs.StringVar(&c.NoisePaths, "noise-paths", "", "Comma separated list of paths, in addition to the built-in list, which respond with a 404 status instead of a redirect. Paths ending in * are prefixes.")
+	fs.StringVar(&c.RobotsTxt, "robots-txt", "", "Path to a robots.txt file to serve. By default, crawlers are allowed to follow redirects.")
+	fs.StringVar(&c.RobotsTag, "x-robots-tag", "", "The X-Robots-Tag header of redirects, like noindex. Not set when empty.")
+	fs.StringVar(&c.HSTS, "hsts", defaultHSTS, "The Strict-Transport-Security header sent over HTTPS. Disabled when empty.")
+	fs.StringVar(&c.ReferrerPolicy, "referrer-policy", defaultReferrerPolicy, "The Referrer-Policy header. Disabled when empty.")
+	fs.StringVar(&c.CSP, "csp", defaultCSP, "The Content-Security-Policy header sent with HTML responses. Disabled when empty.")
+	fs.StringVar(&c.AllowCIDR, "allow-cidr", "", "Comma separated list of CIDR prefixes of clients which are allowed. All clients are allowed when empty.")
+	fs.StringVar(&c.DenyCIDR, "deny-cidr", "", "Comma separated list of CIDR prefixes of clients which are refused, even if allowed.")
+	fs.Float64Var(&c.RateLimit, "rate-limit", 0, "The number of requests per second allowed from each client. Disabled when 0.")
+	fs.IntVar(&c.RateLimitBurst, "rate-limit-burst", defaultRateLimitBurst, "The number of requests each client can make at once.")
+	fs.StringVar(&c.RateLimitExempt, "rate-limit-exempt", "", "Comma separated list of CIDR prefixes of clients which aren't rate limited.")
+	fs.StringVar(&c.LogSuppress, "log-suppress", "", "Comma separated list of categories of per-request log messages which aren't logged: "+strings.Join(logCategories, ", ")+".")
+	fs.DurationVar(&c.LogDedupInterval, "log-dedup-interval", 0, "Log invalid and not found messages for the same bibID at most once per interval. Disabled when 0.")
+	fs.StringVar(&c.AccessLog, "access-log", "", "Path of a file to write an access log to, in the Apache combined format. Disabled when empty.")
+	fs.IntVar(&c.AccessLogMaxSize, "access-log-max-size", 100, "Rotate the access log when it reaches this many megabytes. Disabled when 0.")
+	fs.DurationVar(&c.AccessLogMaxAge, "access-log-max-age", 24*time.Hour, "Rotate the access log when it is this old. Disabled when 0.")
+	fs.StringVar(&c.AnonymizeIPs, "anonymize-ips", "", "Anonymize client addresses in the access logs and log messages, truncate to zero their low bits, or hash to replace them with a salted hash. Disabled when empty.")
+	fs.DurationVar(&c.AnonymizeSaltRotation, "anonymize-salt-rotation", defaultAnonymizeSaltRotation, "Replace the salt of hashed client addresses this often. Never replaced when 0.")
+	fs.StringVar(&c.OTLPEndpoint, "otlp-endpoint", "", "OTLP/HTTP endpoint to export traces to, like http://localhost:4318. Disabled when empty.")
+	fs.StringVar(&c.SRUTarget, "sru-target", "", "The Alma SRU endpoint. Defaults to https://<primo>.alma.exlibrisgroup.com/view/sru/<institution from vid>.")
+
+	// The check, translate, export, sitemap, verify, replay, and smoke subcommands use the same flags and mappings,
+	// and the report subcommand the same event log, instead of serving.
+	if len(args) > 0 && slices.Contains([]string{checkCommand, translateCommand, exportCommand, sitemapCommand, verifyCommand, replayCommand, smokeCommand, reportCommand}, args[0]) {
+		c.Command, args = args[0], args[1:]
+	}
+
+	// Process the flags.
+	err := fs.Parse(args)
+	if err != nil {
+		return c, err
+	}
+	c.flags = fs
+
+	// Variables from the env file fill in the environment before it's read.
+	var envRequired bool
+	c.envPath, envRequired = envFilePath(c.EnvFile)
+	c.envSet, err = loadEnvFile(c.envPath, envRequired)
+	if err != nil {
+		return c, fmt.Errorf("Could not read the env file, %w", err)
+	}
+
+	// If any flags have not been set, see if there are
+	// environment variables that set them.
+	err = overrideUnsetFlagsFromEnvironmentVariables(fs)
+	if err != nil {
+		return c, fmt.Errorf("Could not read configuration from the environment, %w", err)
+	}
+
+	// Secrets unset by the flags and environment are read from files, which other processes can't see.
+	c.secretsRead, err = readSecretFiles(fs, c.SecretsDir)
+	if err != nil {
+		return c, fmt.Errorf("Could not read secrets, %w", err)
+	}
+
+	// Mapping files can be listed with -mappings, so they can be set by the environment, as well as given as arguments.
+	// The translate subcommand's first argument is the URL to translate, unless the URLs are read from a -batch file,
+	// and the replay subcommand's first argument is the access log.
+	positional := fs.Args()
+	if (c.Command == translateCommand && c.Batch == "" || c.Command == replayCommand) && len(positional) > 0 {
+		c.Arg, positional = positional[0], positional[1:]
+	}
+	c.MappingFiles = append(splitMappingList(c.Mappings), positional...)
+	return c, nil
+}
+
+// usage writes the usage of the command, and the flags in fs, to standard error.
+func usage(fs *flag.FlagSet) {
+	fmt.Fprintf(os.Stderr, "Permanent Detour: A tiny web service which redirects Voyager Web OPAC requests to Primo URLs.\n")
+	fmt.Fprintf(os.Stderr, "Version %v\n", version)
+	fmt.Fprintf(os.Stderr, "Usage: permanentdetour [flag...] [file...]\n")
+	fmt.Fprintf(os.Stderr, "       permanentdetour %v [flag...] [file...]\n", checkCommand)
+	fmt.Fprintf(os.Stderr, "       permanentdetour %v [flag...] url [file...]\n", translateCommand)
+	fmt.Fprintf(os.Stderr, "       permanentdetour %v -batch urls.txt [flag...] [file...]\n", translateCommand)
+	fmt.Fprintf(os.Stderr, "       permanentdetour %v -format nginx|rewritemap|cloudflare [-output file] [flag...] [file...]\n", exportCommand)
+	fmt.Fprintf(os.Stderr, "       permanentdetour %v -output dir -sitemap-url url [flag...] [file...]\n", sitemapCommand)
+	fmt.Fprintf(os.Stderr, "       permanentdetour %v [-sample n] [flag...] [file...]\n", verifyCommand)
+	fmt.Fprintf(os.Stderr, "       permanentdetour %v [-replay-host host] [flag...] access.log [file...]\n", replayCommand)
+	fmt.Fprintf(os.Stderr, "       permanentdetour %v -target url [flag...] [file...]\n", smokeCommand)
+	fmt.Fprintf(os.Stderr, "       permanentdetour %v -events-db events.db [-report-date yyyy-mm-dd] [-output summary.txt] [flag...]\n", reportCommand)
+	fmt.Fprintf(os.Stderr, "       permanentdetour %v file...\n", validateCommand)
+	fmt.Fprintf(os.Stderr, "       permanentdetour %v old.csv new.csv\n", diffCommand)
+	fmt.Fprintf(os.Stderr, "       permanentdetour %v [-o combined.csv] [-duplicates error|first|last] file...\n", mergeCommand)
+	fmt.Fprintf(os.Stderr, "       permanentdetour %v -o mappings.snap file...\n", compileCommand)
+	fmt.Fprintf(os.Stderr, "       permanentdetour %v file...\n", statsCommand)
+	fmt.Fprintf(os.Stderr, "       permanentdetour %v [-backend map|sorted|snapshot|sqlite] [-lookups n] file...\n", benchCommand)
+	fmt.Fprintf(os.Stderr, "       permanentdetour %v -target url [-o misses.csv]\n", missesCommand)
+	fmt.Fprintf(os.Stderr, "       permanentdetour %v -prefix prefix [-column name] [-o mappings.csv] export...\n", extractMappingCommand)
+	fmt.Fprintf(os.Stderr, "       permanentdetour %v [-mode truncate|hash] [-o anonymized.log] [access.log...]\n", anonymizeCommand)
+	fs.PrintDefaults()
+	fmt.Fprintln(os.Stderr, "  Environment variables read when flag is unset:")
+
+	fs.VisitAll(func(f *flag.Flag) {
+		fmt.Fprintf(os.Stderr, "  %v\n", environmentVariableName(f))
+	})
+}
+
+// If any flags are not set, use environment variables to set them.
+func overrideUnsetFlagsFromEnvironmentVariables(fs *flag.FlagSet) error {
+
+	// A map of pointers to unset flags.
+	listOfUnsetFlags := make(map[*flag.Flag]bool)
+
+	// flag.Visit calls a function on "only those flags that have been set."
+	// flag.VisitAll calls a function on "all flags, even those not set."
+	// No way to ask for "only unset flags". So, we add all, then
+	// delete the set flags.
+
+	// First, visit all the flags, and add them to our map.
+	fs.VisitAll(func(f *flag.Flag) { listOfUnsetFlags[f] = true })
+
+	// Then delete the set flags.
+	fs.Visit(func(f *flag.Flag) { delete(listOfUnsetFlags, f) })
+
+	// Loop through our list of unset flags.
+	// We don't care about the values in our map, only the keys.
+	for k := range listOfUnsetFlags {
+
+		// Build the corresponding environment variable name for each flag.
+		environmentVariableName := environmentVariableName(k)
+
+		// Look for the environment variable name.
+		// If found, set the flag to that value.
+		// If there's a problem setting the flag value,
+		// there's a serious problem we can't recover from.
+		environmentVariableValue := os.Getenv(environmentVariableName)
+		if environmentVariableValue != "" {
+			err := k.Value.Set(environmentVariableValue)
+			if err != nil {
+				return fmt.Errorf("Unable to set configuration option %v from environment variable %v, "+
+					"which has a value of \"%v\", %w",
+					k.Name, environmentVariableName, environmentVariableValue, err)
+			}
+		}
+	}
+	return nil
+}
+
+// environmentVariableName returns the name of the environment variable which can set a flag.
+// Dashes in the flag name are replaced with underscores, so the name can be used in shells.
+func environmentVariableName(f *flag.Flag) string {
+	uppercaseName := strings.ToUpper(strings.Replace(f.Name, "-", "_", -1))
+	return fmt.Sprintf("%v%v", envPrefix, uppercaseName)
+}
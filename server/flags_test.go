@@ -0,0 +1,59 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadConfig(t *testing.T) {
+	t.Setenv("PERMANENTDETOUR_VID", "01OCUL_QU:QU_DEFAULT")
+	t.Setenv("PERMANENTDETOUR_PRIMO", "ocul-qu")
+	t.Setenv("PERMANENTDETOUR_MAPPINGS", "a.csv,b.csv")
+	b := Build{DefaultPrimo: "default-primo", DefaultVID: "default-vid"}
+
+	c, err := LoadConfig(b, []string{translateCommand, "-primo", "ocul-qu-psb", "-lookup-timeout", "2s", "https://example.com/vwebv/holdingsInfo?bibId=1", "c.csv"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Command != translateCommand || c.Arg != "https://example.com/vwebv/holdingsInfo?bibId=1" {
+		t.Fatalf("LoadConfig() returned the command %q and argument %q.", c.Command, c.Arg)
+	}
+	// The flag takes precedence over the environment, which takes precedence over the Build's defaults.
+	if c.Primo != "ocul-qu-psb" || c.VID != "01OCUL_QU:QU_DEFAULT" || c.LookupTimeout != 2*time.Second {
+		t.Fatalf("LoadConfig() returned -primo %v, -vid %v, and -lookup-timeout %v.", c.Primo, c.VID, c.LookupTimeout)
+	}
+	if !slices.Equal(c.MappingFiles, []string{"a.csv", "b.csv", "c.csv"}) {
+		t.Fatalf("LoadConfig() returned the mapping files %v, not a.csv, b.csv, c.csv.", c.MappingFiles)
+	}
+	if c.Address != defaultAddress || c.RedirectStatus != defaultRedirectStatus {
+		t.Fatalf("LoadConfig() returned -address %v and -redirect-status %v, not the defaults.", c.Address, c.RedirectStatus)
+	}
+}
+
+func TestLoadConfigDefaults(t *testing.T) {
+	c, err := LoadConfig(Build{DefaultPrimo: "ocul-qu", DefaultVID: "01OCUL_QU:QU_DEFAULT"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Command != "" || c.Primo != "ocul-qu" || c.VID != "01OCUL_QU:QU_DEFAULT" {
+		t.Fatalf("LoadConfig() returned the command %q, -primo %v, and -vid %v.", c.Command, c.Primo, c.VID)
+	}
+}
+
+func TestLoadConfigInvalidEnvironment(t *testing.T) {
+	t.Setenv("PERMANENTDETOUR_REDIRECT_STATUS", "moved")
+	_, err := LoadConfig(Build{}, nil)
+	if err == nil {
+		t.Fatal("LoadConfig() with an invalid environment variable returned no error.")
+	}
+	// The error says which variable was invalid, and why.
+	if !strings.Contains(err.Error(), "PERMANENTDETOUR_REDIRECT_STATUS") || !strings.Contains(err.Error(), "parse error") {
+		t.Fatalf("LoadConfig() returned %q.", err)
+	}
+}
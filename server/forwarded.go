@@ -0,0 +1,118 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// forwardedKey is the context key under which the client's forwarded address and scheme are stored.
+type forwardedKey struct{}
+
+// forwarded is the client address and scheme, as reported by a trusted proxy.
+type forwarded struct {
+	clientIP string
+	scheme   string
+}
+
+// parsePrefixes parses a list of CIDR prefixes or single addresses, like a list of trusted proxies.
+func parsePrefixes(list []string) ([]netip.Prefix, error) {
+	prefixes := []netip.Prefix{}
+	for _, item := range list {
+		if !strings.Contains(item, "/") {
+			addr, err := netip.ParseAddr(item)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid address or CIDR prefix %v, %w", item, err)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(item)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid address or CIDR prefix %v, %w", item, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// inPrefixes reports whether the address is in one of the prefixes.
+func inPrefixes(ip string, prefixes []netip.Prefix) bool {
+	addr, err := netip.ParseAddr(strings.TrimSpace(ip))
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// withTrustedProxies is middleware which, when the peer is a trusted proxy, records the client address from
+// X-Forwarded-For and the scheme from X-Forwarded-Proto in the request's context.
+// The client is the rightmost address in X-Forwarded-For which isn't itself a trusted proxy.
+func withTrustedProxies(next http.Handler, trusted []netip.Prefix) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !inPrefixes(remoteIP(r), trusted) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		f := forwarded{}
+		hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if hop == "" {
+				continue
+			}
+			f.clientIP = hop
+			if !inPrefixes(hop, trusted) {
+				break
+			}
+		}
+		proto := strings.ToLower(strings.TrimSpace(strings.Split(r.Header.Get("X-Forwarded-Proto"), ",")[0]))
+		if proto == "http" || proto == "https" {
+			f.scheme = proto
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), forwardedKey{}, f)))
+	})
+}
+
+// remoteIP returns the address of the request's peer, without the port.
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// clientIP returns the address of the client, as reported by a trusted proxy, or the request's peer.
+func clientIP(r *http.Request) string {
+	f, _ := r.Context().Value(forwardedKey{}).(forwarded)
+	if f.clientIP != "" {
+		return f.clientIP
+	}
+	return remoteIP(r)
+}
+
+// requestScheme returns the scheme the client used, as reported by a trusted proxy, or the scheme of the request.
+func requestScheme(r *http.Request) string {
+	f, _ := r.Context().Value(forwardedKey{}).(forwarded)
+	if f.scheme != "" {
+		return f.scheme
+	}
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
@@ -0,0 +1,77 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWithTrustedProxies(t *testing.T) {
+	trusted, err := parsePrefixes([]string{"10.0.0.0/8", "192.0.2.10"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		name           string
+		remoteAddr     string
+		forwardedFor   []string
+		forwardedProto string
+		tls            bool
+		client         string
+		scheme         string
+	}{
+		{"direct", "198.51.100.1:1234", nil, "", false, "198.51.100.1", "http"},
+		{"direct over TLS", "198.51.100.1:1234", nil, "", true, "198.51.100.1", "https"},
+		{"untrusted peer", "198.51.100.1:1234", []string{"203.0.113.7"}, "https", false, "198.51.100.1", "http"},
+		{"trusted peer", "10.0.0.5:1234", []string{"203.0.113.7"}, "https", false, "203.0.113.7", "https"},
+		{"trusted single address", "192.0.2.10:1234", []string{"203.0.113.7"}, "", false, "203.0.113.7", "http"},
+		{"spoofed hop", "10.0.0.5:1234", []string{"6.6.6.6, 203.0.113.7"}, "", false, "203.0.113.7", "http"},
+		{"trusted hops", "10.0.0.5:1234", []string{"203.0.113.7, 10.1.1.1", "10.2.2.2"}, "", false, "203.0.113.7", "http"},
+		{"no header", "10.0.0.5:1234", nil, "", false, "10.0.0.5", "http"},
+		{"bad proto", "10.0.0.5:1234", nil, "gopher", false, "10.0.0.5", "http"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var client, scheme string
+			handler := withTrustedProxies(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				client, scheme = clientIP(r), requestScheme(r)
+			}), trusted)
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, value := range tt.forwardedFor {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+			if tt.forwardedProto != "" {
+				r.Header.Set("X-Forwarded-Proto", tt.forwardedProto)
+			}
+			if tt.tls {
+				r.TLS = &tls.ConnectionState{}
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), r)
+			if client != tt.client {
+				t.Fatalf("The client address was %v, not %v.", client, tt.client)
+			}
+			if scheme != tt.scheme {
+				t.Fatalf("The scheme was %v, not %v.", scheme, tt.scheme)
+			}
+		})
+	}
+}
+
+func TestParsePrefixes(t *testing.T) {
+	_, err := parsePrefixes([]string{"10.0.0.0/8", "::1", "fd00::/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = parsePrefixes([]string{"load-balancer"})
+	if err == nil {
+		t.Fatal("parseTrustedProxies should have returned an error for a hostname, but it did not.")
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"context"
+
+	"github.com/cu-library/permanentdetour/lookuppb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// lookupServer implements the gRPC lookup service, backed by the Detourer's mappings.
+type lookupServer struct {
+	lookuppb.UnimplementedLookupServiceServer
+	d    Detourer
+	live *liveDetourer // When set, its current Detourer is used instead of d, so reloaded settings apply.
+}
+
+// errLookupsDisabled is returned while the lookup API feature is off.
+var errLookupsDisabled = status.Error(codes.Unimplemented, "Lookups are not enabled on this server.")
+
+// detourer returns the Detourer to serve with.
+func (s lookupServer) detourer() Detourer {
+	if s.live != nil {
+		return s.live.load()
+	}
+	return s.d
+}
+
+// Lookup resolves a single bibID.
+func (s lookupServer) Lookup(ctx context.Context, req *lookuppb.LookupRequest) (*lookuppb.LookupResult, error) {
+	d := s.detourer()
+	if !d.featureEnabled(featureLookupAPI) {
+		return nil, errLookupsDisabled
+	}
+	ctx, cancel := d.lookupContext(ctx)
+	defer cancel()
+	return lookupResult(ctx, d, req.GetBibId())
+}
+
+// BatchLookup resolves many bibIDs at once.
+func (s lookupServer) BatchLookup(ctx context.Context, req *lookuppb.BatchLookupRequest) (*lookuppb.BatchLookupResponse, error) {
+	d := s.detourer()
+	if !d.featureEnabled(featureLookupAPI) {
+		return nil, errLookupsDisabled
+	}
+	if len(req.GetBibIds()) > d.batchLimit {
+		return nil, status.Errorf(codes.InvalidArgument, "At most %v bibIDs can be looked up at once.", d.batchLimit)
+	}
+	resp := &lookuppb.BatchLookupResponse{
+		Results: make([]*lookuppb.LookupResult, 0, len(req.GetBibIds())),
+	}
+	// The whole batch shares the request's budget for lookups.
+	ctx, cancel := d.lookupContext(ctx)
+	defer cancel()
+	for _, bibID := range req.GetBibIds() {
+		result, err := lookupResult(ctx, d, bibID)
+		if err != nil {
+			return nil, err
+		}
+		resp.Results = append(resp.Results, result)
+	}
+	return resp, nil
+}
+
+// lookupResult finds the Ex Libris ID and Primo record URL for a bibID.
+// A lookup which couldn't finish returns an error with the status of ctx's error, like DeadlineExceeded.
+func lookupResult(ctx context.Context, d Detourer, bibID uint32) (*lookuppb.LookupResult, error) {
+	result := &lookuppb.LookupResult{BibId: bibID}
+	exlID, present, err := d.lookupID(ctx, bibID)
+	if err != nil {
+		return nil, status.FromContextError(err).Err()
+	}
+	if present {
+		result.MmsId = exlID
+		result.Found = true
+		result.Url = d.recordURL(exlID).String()
+	}
+	return result, nil
+}
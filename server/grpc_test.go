@@ -0,0 +1,47 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cu-library/permanentdetour/lookuppb"
+	"github.com/cu-library/permanentdetour/mapping"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestLookupServer(t *testing.T) {
+	s := lookupServer{d: Detourer{
+		store:      mapping.NewMap(map[uint32]uint64{651520: 996515203405158}),
+		primo:      "ocul-qu.primo.exlibrisgroup.com",
+		vid:        "01OCUL_QU:QU_DEFAULT",
+		batchLimit: 2,
+	}}
+	ctx := context.Background()
+
+	result, err := s.Lookup(ctx, &lookuppb.LookupRequest{BibId: 651520})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.GetFound() || result.GetMmsId() != 996515203405158 ||
+		result.GetUrl() != "https://ocul-qu.primo.exlibrisgroup.com/discovery/fulldisplay?docid=alma996515203405158&vid=01OCUL_QU%3AQU_DEFAULT" {
+		t.Fatalf("Lookup(651520) returned %v", result)
+	}
+
+	resp, err := s.BatchLookup(ctx, &lookuppb.BatchLookupRequest{BibIds: []uint32{1, 651520}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.GetResults()) != 2 || resp.GetResults()[0].GetFound() || !resp.GetResults()[1].GetFound() {
+		t.Fatalf("BatchLookup([1, 651520]) returned %v", resp)
+	}
+
+	_, err = s.BatchLookup(ctx, &lookuppb.BatchLookupRequest{BibIds: []uint32{1, 2, 3}})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("BatchLookup over the batch limit returned %v, not an InvalidArgument error", err)
+	}
+}
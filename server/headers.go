@@ -0,0 +1,80 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"net/http"
+	"strings"
+)
+
+const (
+	// defaultHSTS is the default Strict-Transport-Security header, one year.
+	defaultHSTS string = "max-age=31536000"
+
+	// defaultReferrerPolicy is the default Referrer-Policy header.
+	defaultReferrerPolicy string = "strict-origin-when-cross-origin"
+
+	// defaultCSP is the default Content-Security-Policy header for HTML responses.
+	// The HTML the service serves has no scripts, styles, or images.
+	defaultCSP string = "default-src 'none'; frame-ancestors 'none'; base-uri 'none'; form-action 'none'"
+)
+
+// securityHeaders are the security headers set on responses. Empty headers aren't set.
+type securityHeaders struct {
+	hsts           string // Set on responses to HTTPS requests.
+	referrerPolicy string
+	csp            string // Set on HTML responses.
+}
+
+// withSecurityHeaders is middleware which sets the security headers on responses.
+func withSecurityHeaders(next http.Handler, h securityHeaders) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Browsers ignore HSTS over HTTP.
+		if h.hsts != "" && requestScheme(r) == "https" {
+			w.Header().Set("Strict-Transport-Security", h.hsts)
+		}
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		if h.referrerPolicy != "" {
+			w.Header().Set("Referrer-Policy", h.referrerPolicy)
+		}
+		if h.csp != "" {
+			w = &cspWriter{ResponseWriter: w, csp: h.csp}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// cspWriter sets the Content-Security-Policy header when the response is HTML, unless the handler set its own.
+// The content type is only known once the handler writes the header.
+type cspWriter struct {
+	http.ResponseWriter
+	csp         string
+	wroteHeader bool
+}
+
+func (c *cspWriter) WriteHeader(status int) {
+	if !c.wroteHeader {
+		c.wroteHeader = true
+		if strings.HasPrefix(c.Header().Get("Content-Type"), "text/html") && c.Header().Get("Content-Security-Policy") == "" {
+			c.Header().Set("Content-Security-Policy", c.csp)
+		}
+	}
+	c.ResponseWriter.WriteHeader(status)
+}
+
+func (c *cspWriter) Write(b []byte) (int, error) {
+	if !c.wroteHeader {
+		if c.Header().Get("Content-Type") == "" {
+			c.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		c.WriteHeader(http.StatusOK)
+	}
+	return c.ResponseWriter.Write(b)
+}
+
+// Unwrap returns the underlying ResponseWriter, for http.ResponseController.
+func (c *cspWriter) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
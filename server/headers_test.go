@@ -0,0 +1,65 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWithSecurityHeaders(t *testing.T) {
+	h := securityHeaders{hsts: defaultHSTS, referrerPolicy: defaultReferrerPolicy, csp: defaultCSP}
+	html := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "https://example.com/", http.StatusTemporaryRedirect)
+	})
+	text := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "OK")
+	})
+	styled := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Content-Security-Policy", dashboardCSP)
+		io.WriteString(w, "<p>OK</p>")
+	})
+
+	var tests = []struct {
+		name    string
+		handler http.Handler
+		tls     bool
+		hsts    string
+		csp     string
+	}{
+		{"HTML over HTTP", html, false, "", defaultCSP},
+		{"HTML over HTTPS", html, true, defaultHSTS, defaultCSP},
+		{"text over HTTPS", text, true, defaultHSTS, ""},
+		{"HTML with its own policy", styled, false, "", dashboardCSP},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			if tt.tls {
+				r.TLS = &tls.ConnectionState{}
+			}
+			w := httptest.NewRecorder()
+			withSecurityHeaders(tt.handler, h).ServeHTTP(w, r)
+			header := w.Result().Header
+			if header.Get("Strict-Transport-Security") != tt.hsts {
+				t.Fatalf("Strict-Transport-Security was %q, not %q.", header.Get("Strict-Transport-Security"), tt.hsts)
+			}
+			if header.Get("Content-Security-Policy") != tt.csp {
+				t.Fatalf("Content-Security-Policy was %q, not %q.", header.Get("Content-Security-Policy"), tt.csp)
+			}
+			if header.Get("X-Content-Type-Options") != "nosniff" {
+				t.Fatalf("X-Content-Type-Options was %q, not \"nosniff\".", header.Get("X-Content-Type-Options"))
+			}
+			if header.Get("Referrer-Policy") != defaultReferrerPolicy {
+				t.Fatalf("Referrer-Policy was %q, not %q.", header.Get("Referrer-Policy"), defaultReferrerPolicy)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// healthzPath is the path of the liveness endpoint.
+	healthzPath string = "/healthz"
+
+	// readyzPath is the path of the readiness endpoint.
+	readyzPath string = "/readyz"
+)
+
+// health tracks whether the service is ready to serve redirects, using a set of named readiness checks.
+type health struct {
+	mu     sync.RWMutex
+	checks map[string]func() error
+}
+
+// newHealth returns a health with no readiness checks.
+func newHealth() *health {
+	return &health{checks: map[string]func() error{}}
+}
+
+// setCheck adds or replaces a readiness check. The service is ready when all checks return nil.
+func (h *health) setCheck(name string, check func() error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.checks[name] = check
+}
+
+// flagCheck returns a readiness check which passes while the flag is set, and otherwise fails with message.
+func flagCheck(flag *atomic.Bool, message string) func() error {
+	return func() error {
+		if !flag.Load() {
+			return errors.New(message)
+		}
+		return nil
+	}
+}
+
+// serveHealthz responds to liveness probes. If the process can respond, it is alive.
+func (h *health) serveHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	fmt.Fprintln(w, "ok")
+}
+
+// serveReadyz responds to readiness probes, with the result of each readiness check.
+func (h *health) serveReadyz(w http.ResponseWriter, r *http.Request) {
+	h.mu.RLock()
+	names := make([]string, 0, len(h.checks))
+	for name := range h.checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	status := http.StatusOK
+	for _, name := range names {
+		err := h.checks[name]()
+		if err != nil {
+			status = http.StatusServiceUnavailable
+			fmt.Fprintf(&b, "%v: %v\n", name, err)
+		} else {
+			fmt.Fprintf(&b, "%v: ok\n", name)
+		}
+	}
+	h.mu.RUnlock()
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	fmt.Fprint(w, b.String())
+}
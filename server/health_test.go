@@ -0,0 +1,46 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestReadyz(t *testing.T) {
+	h := newHealth()
+	var loaded, serving atomic.Bool
+	h.setCheck("mappings", flagCheck(&loaded, "mappings are not loaded"))
+	h.setCheck("listener", flagCheck(&serving, "not serving"))
+
+	var tests = []struct {
+		loaded  bool
+		serving bool
+		status  int
+		body    string
+	}{
+		{false, false, http.StatusServiceUnavailable, "listener: not serving\nmappings: mappings are not loaded\n"},
+		{true, false, http.StatusServiceUnavailable, "listener: not serving\nmappings: ok\n"},
+		{true, true, http.StatusOK, "listener: ok\nmappings: ok\n"},
+	}
+
+	for _, tt := range tests {
+		loaded.Store(tt.loaded)
+		serving.Store(tt.serving)
+		w := httptest.NewRecorder()
+		h.serveReadyz(w, httptest.NewRequest("GET", "/readyz", nil))
+		if w.Code != tt.status || w.Body.String() != tt.body {
+			t.Fatalf("serveReadyz returned %v %q, not %v %q", w.Code, w.Body.String(), tt.status, tt.body)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	h.serveHealthz(w, httptest.NewRequest("GET", "/healthz", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("serveHealthz returned %v, not %v", w.Code, http.StatusOK)
+	}
+}
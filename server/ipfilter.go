@@ -0,0 +1,23 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"net/http"
+	"net/netip"
+)
+
+// withIPFilter is middleware which refuses requests from clients in the denied prefixes, and,
+// if any allowed prefixes are given, from clients outside of them. Denied prefixes take precedence.
+func withIPFilter(next http.Handler, allow, deny []netip.Prefix) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client := clientIP(r)
+		if inPrefixes(client, deny) || (len(allow) > 0 && !inPrefixes(client, allow)) {
+			http.Error(w, "Forbidden.", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
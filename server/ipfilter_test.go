@@ -0,0 +1,53 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWithIPFilter(t *testing.T) {
+	campus, err := parsePrefixes([]string{"130.15.0.0/16", "2607:f8b0::/32"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	crawlers, err := parsePrefixes([]string{"130.15.66.0/24", "198.51.100.7"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		name       string
+		allow      bool
+		remoteAddr string
+		status     int
+	}{
+		{"no allow list", false, "203.0.113.7:1234", http.StatusOK},
+		{"denied without allow list", false, "198.51.100.7:1234", http.StatusForbidden},
+		{"allowed", true, "130.15.1.1:1234", http.StatusOK},
+		{"allowed IPv6", true, "[2607:f8b0::1]:1234", http.StatusOK},
+		{"not allowed", true, "203.0.113.7:1234", http.StatusForbidden},
+		{"allowed but denied", true, "130.15.66.6:1234", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allow := campus
+			if !tt.allow {
+				allow = nil
+			}
+			handler := withIPFilter(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), allow, crawlers)
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tt.status {
+				t.Fatalf("A request from %v had status %v, not %v.", tt.remoteAddr, w.Code, tt.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,27 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"fmt"
+	"net"
+)
+
+// listenAll binds a TCP listener on each address. If any address can't be bound,
+// the listeners which were already bound are closed.
+func listenAll(addrs []string) ([]net.Listener, error) {
+	listeners := make([]net.Listener, 0, len(addrs))
+	for _, addr := range addrs {
+		l, err := net.Listen("tcp", addr)
+		if err != nil {
+			for _, bound := range listeners {
+				bound.Close()
+			}
+			return nil, fmt.Errorf("Could not listen on %v, %w", addr, err)
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, nil
+}
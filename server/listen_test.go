@@ -0,0 +1,55 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"net"
+	"testing"
+)
+
+func TestListenAll(t *testing.T) {
+	listeners, err := listenAll([]string{"127.0.0.1:0", "127.0.0.1:0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		for _, l := range listeners {
+			l.Close()
+		}
+	}()
+	if len(listeners) != 2 {
+		t.Fatalf("listenAll() returned %v listeners, not 2.", len(listeners))
+	}
+	if listeners[0].Addr().String() == listeners[1].Addr().String() {
+		t.Fatalf("Both listeners are bound on %v.", listeners[0].Addr())
+	}
+}
+
+func TestListenAllClosesOnError(t *testing.T) {
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer taken.Close()
+
+	// Reserve a free address, then release it, so listenAll binds it before failing.
+	free, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	freeAddr := free.Addr().String()
+	free.Close()
+
+	_, err = listenAll([]string{freeAddr, taken.Addr().String()})
+	if err == nil {
+		t.Fatal("listenAll() didn't return an error for an address in use.")
+	}
+	// The first address should have been released.
+	l, err := net.Listen("tcp", freeAddr)
+	if err != nil {
+		t.Fatalf("%v wasn't released, %v", freeAddr, err)
+	}
+	l.Close()
+}
@@ -0,0 +1,57 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestNewLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := newLogger(&buf, "json", "warn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Info("quiet")
+	logger.Warn("loud", "bibID", 651520)
+	var record map[string]interface{}
+	err = json.Unmarshal(buf.Bytes(), &record)
+	if err != nil {
+		t.Fatalf("The logger wrote %q, not a single JSON record, %v", buf.String(), err)
+	}
+	if record["msg"] != "loud" || record["bibID"] != float64(651520) {
+		t.Fatalf("The logger wrote %v", record)
+	}
+
+	_, err = newLogger(&buf, "xml", "info")
+	if err == nil {
+		t.Fatal("newLogger should have returned an error for an unknown format, but it did not.")
+	}
+	_, err = newLogger(&buf, "text", "loud")
+	if err == nil {
+		t.Fatal("newLogger should have returned an error for an unknown level, but it did not.")
+	}
+}
+
+func TestLoggerRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := newLogger(&buf, "json", "info")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.WithValue(context.Background(), requestIDKey{}, "abc-123")
+	logger.With("rule", "record").InfoContext(ctx, "Redirected.")
+	var record map[string]interface{}
+	err = json.Unmarshal(buf.Bytes(), &record)
+	if err != nil {
+		t.Fatalf("The logger wrote %q, not a single JSON record, %v", buf.String(), err)
+	}
+	if record["requestID"] != "abc-123" || record["rule"] != "record" {
+		t.Fatalf("The logger wrote %v", record)
+	}
+}
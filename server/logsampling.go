@@ -0,0 +1,107 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The categories of per-request log messages, which can be suppressed.
+const (
+	logRedirected  string = "redirected"
+	logNotFound    string = "not-found"
+	logInvalid     string = "invalid"
+	logMaintenance string = "maintenance"
+	logLookupError string = "lookup-error"
+)
+
+// logCategories are the categories of per-request log messages.
+var logCategories = []string{logRedirected, logNotFound, logInvalid, logMaintenance, logLookupError}
+
+// logSampleKeyLimit is the maximum number of distinct keys remembered by a logSampler,
+// so a crawler requesting random bibIDs can't exhaust memory.
+const logSampleKeyLimit int = 100000
+
+// logSampler decides which per-request log messages are written. Messages in suppressed categories
+// are never written, and messages for the same key are written at most once per interval.
+// A nil *logSampler writes everything.
+type logSampler struct {
+	suppressed []string
+	interval   time.Duration // Disabled when 0.
+
+	mu   sync.Mutex
+	seen map[string]*sampledKey
+}
+
+// sampledKey records when a message for a key was last written, and how many were skipped since.
+type sampledKey struct {
+	last    time.Time
+	skipped uint64
+}
+
+// newLogSampler returns a logSampler, or nil if it would write everything.
+func newLogSampler(suppressed []string, interval time.Duration) (*logSampler, error) {
+	for _, category := range suppressed {
+		if !slices.Contains(logCategories, category) {
+			return nil, fmt.Errorf("Unknown log category %q, expected %v", category, strings.Join(logCategories, ", "))
+		}
+	}
+	if len(suppressed) == 0 && interval <= 0 {
+		return nil, nil
+	}
+	return &logSampler{suppressed: suppressed, interval: interval, seen: map[string]*sampledKey{}}, nil
+}
+
+// enabled reports whether messages in the category are written.
+func (s *logSampler) enabled(category string) bool {
+	return s == nil || !slices.Contains(s.suppressed, category)
+}
+
+// allow reports whether a message in the category for the key should be written at time t.
+// When it should, it also returns the number of messages for the key which were skipped since the last one.
+func (s *logSampler) allow(category, key string, t time.Time) (bool, uint64) {
+	if !s.enabled(category) {
+		return false, 0
+	}
+	if s == nil || s.interval <= 0 {
+		return true, 0
+	}
+	key = category + " " + key
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sk, present := s.seen[key]
+	if present && t.Sub(sk.last) < s.interval {
+		sk.skipped++
+		return false, 0
+	}
+	if !present {
+		if len(s.seen) >= logSampleKeyLimit {
+			s.prune(t)
+		}
+		if len(s.seen) >= logSampleKeyLimit {
+			// Every key was logged within the interval, so this one can't be tracked.
+			return true, 0
+		}
+		sk = &sampledKey{}
+		s.seen[key] = sk
+	}
+	skipped := sk.skipped
+	sk.last, sk.skipped = t, 0
+	return true, skipped
+}
+
+// prune forgets the keys which weren't logged within the interval before t.
+// Messages skipped for them since are lost.
+func (s *logSampler) prune(t time.Time) {
+	for key, sk := range s.seen {
+		if t.Sub(sk.last) >= s.interval {
+			delete(s.seen, key)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLogSamplerAllow(t *testing.T) {
+	s, err := newLogSampler([]string{logRedirected}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2019, 10, 10, 13, 0, 0, 0, time.UTC)
+
+	var tests = []struct {
+		category string
+		key      string
+		after    time.Duration
+		ok       bool
+		skipped  uint64
+	}{
+		{logRedirected, "", 0, false, 0},
+		{logNotFound, "651520", 0, true, 0},
+		{logNotFound, "651520", 10 * time.Second, false, 0},
+		{logNotFound, "651520", 20 * time.Second, false, 0},
+		{logNotFound, "651521", 20 * time.Second, true, 0},
+		{logInvalid, "651520", 20 * time.Second, true, 0},
+		{logNotFound, "651520", time.Minute, true, 2},
+		{logNotFound, "651520", 2 * time.Minute, true, 0},
+	}
+
+	for _, tt := range tests {
+		ok, skipped := s.allow(tt.category, tt.key, start.Add(tt.after))
+		if ok != tt.ok || skipped != tt.skipped {
+			t.Fatalf("allow(%v, %v) after %v was %v with %v skipped, not %v with %v skipped.",
+				tt.category, tt.key, tt.after, ok, skipped, tt.ok, tt.skipped)
+		}
+	}
+}
+
+func TestNewLogSampler(t *testing.T) {
+	s, err := newLogSampler(nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != nil {
+		t.Fatal("newLogSampler() returned a sampler which writes everything, not nil.")
+	}
+	ok, _ := s.allow(logNotFound, "651520", time.Now())
+	if !ok {
+		t.Fatal("A nil sampler didn't allow a message.")
+	}
+	_, err = newLogSampler([]string{"everything"}, 0)
+	if err == nil {
+		t.Fatal("newLogSampler() didn't return an error for an unknown category.")
+	}
+}
@@ -0,0 +1,1013 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+// Package server is the permanentdetour command: it serves redirects from Voyager Web OPAC links to Primo,
+// the lookup APIs, and the admin endpoints, and runs the subcommands. The translations themselves are
+// in package detour, and the mapping files are read with package mapping.
+//
+// Main and Build let an institution build its own command with its defaults built in. Config, LoadConfig, and Run
+// let a program or a test configure the server itself. NewDetourer and its options build a Detourer, which a server
+// can embed to serve the redirects, and whose Translate returns the TranslationResult of a request. Chain and the
+// Middleware it wraps the Detourer in, with Metrics for those which count, are the server's own. Nothing else is
+// meant to be used by other programs.
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/cu-library/permanentdetour/lookuppb"
+	"github.com/cu-library/permanentdetour/mapping"
+	"google.golang.org/grpc"
+)
+
+const (
+	// envPrefix is the prefix for the environment variables.
+	envPrefix string = "PERMANENTDETOUR_"
+
+	// defaultAddress is the default address to serve from.
+	defaultAddress string = ":8877"
+
+	// maxMappingFileLength is the maximum number of lines in a mapping file.
+	maxMappingFileLength uint64 = 1000000
+
+	// defaultReadHeaderTimeout is the default time allowed to read request headers.
+	defaultReadHeaderTimeout time.Duration = 10 * time.Second
+
+	// defaultReadTimeout is the default time allowed to read an entire request.
+	defaultReadTimeout time.Duration = 30 * time.Second
+
+	// defaultWriteTimeout is the default time allowed to write a response.
+	defaultWriteTimeout time.Duration = 30 * time.Second
+
+	// defaultIdleTimeout is the default time to keep an idle connection open.
+	defaultIdleTimeout time.Duration = 2 * time.Minute
+
+	// defaultRedirectStatus is the default status of redirects.
+	defaultRedirectStatus int = http.StatusTemporaryRedirect
+
+	// defaultLookupTimeout is the default longest a request waits for its mapping lookups.
+	// Lookups in memory take nanoseconds, so it only matters for stores which can block.
+	defaultLookupTimeout time.Duration = time.Second
+)
+
+// redirectStatuses are the statuses redirects can be sent with.
+var redirectStatuses = []int{http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther, http.StatusTemporaryRedirect, http.StatusPermanentRedirect}
+
+// defaultMethods are the request methods which are translated by default.
+var defaultMethods = []string{http.MethodGet, http.MethodHead}
+
+// Version information, set by Main from the Build, or the build information embedded by the Go toolchain.
+var (
+	version  = "devel"
+	commit   = "unknown"
+	date     = "unknown"
+	modified = false // Whether the binary was built from a checkout with uncommitted changes.
+)
+
+// Build is the version of the binary and the institution's defaults, which the command sets when building using ldflags.
+type Build struct {
+	Version      string
+	Commit       string
+	Date         string
+	DefaultPrimo string // The default of -primo, or empty.
+	DefaultVID   string // The default of -vid, or empty.
+}
+
+// Detourer is a struct which stores the data needed to perform redirects.
+type Detourer struct {
+	store         mapping.Store       // The mappings of BibIDs to ExL IDs.
+	primo         string              // The domain name (host) for the target Primo instance.
+	primoScheme   string              // The scheme of Primo URLs. https when empty.
+	exLibrisHost  string              // The Ex Libris host behind a custom primo host, for the sandbox, or empty.
+	vid           string              // The vid parameter to use when building Primo URLs.
+	proxyHosts    []string            // The EZproxy hosts whose starting point URLs are unwrapped before translation.
+	batchLimit    int                 // The maximum number of bibIDs in a batch lookup.
+	reverseMap    map[uint64][]uint32 // The map of ExL IDs to BibIDs, nil unless reverse lookups are enabled.
+	metrics       *Metrics            // The request metrics, or nil if they aren't collected.
+	methods       []string            // The request methods which are translated. defaultMethods when empty.
+	cacheControl  map[string]string   // The Cache-Control header of redirects by rule, with the default under "".
+	robotsTag     string              // The X-Robots-Tag header of redirects, or empty.
+	noisePaths    []string            // Paths which aren't translated. defaultNoisePaths when empty.
+	unmapped      *unmappedTracker    // The requested bibIDs which aren't mapped, or nil if they aren't tracked.
+	paths         *pathCounter        // Requests by path for the dashboard, or nil if they aren't counted.
+	rules         *ruleHits           // Redirects by rule and branch, or nil if they aren't counted.
+	maintenance   *maintenance        // Holds requests at a notice page while enabled, or nil.
+	logs          *logSampler         // Decides which per-request messages are logged, or nil to log everything.
+	anonymizer    *ipAnonymizer       // Anonymizes the client addresses which are logged, or nil.
+	fallback      *url.URL            // The URL requests which match no rule are redirected to, or nil for the Primo search form.
+	prefixRules   []prefixRule        // Configured rules which redirect paths to fixed URLs, checked before the built-in rules.
+	pathRoutes    []pathRoute         // Path prefixes translated with their own vid, longest first.
+	sandbox       bool                // Redirect to the Primo sandbox instead of production, unless a request asks otherwise.
+	tenant        string              // The name of the tenant served, which tags its logs and metrics, or empty.
+	accessLog     io.Writer           // The tenant's own access log, or nil.
+	canary        *canary             // Redirects a percentage of clients to an alternate Primo view, or nil.
+	status        int                 // The status of redirects. defaultRedirectStatus when 0.
+	lookupTimeout time.Duration       // The longest a request waits for mapping lookups. No limit when 0.
+	features      map[string]bool     // Features turned off or on by the configuration file. Features which aren't set are on.
+}
+
+// The Detourer serves HTTP redirects based on the request. It leaves what it did in the request's context, where
+// the middleware returned by redirectObservers trace, log, and count it.
+func (d Detourer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Requests with other methods than those which follow links, and requests for noise, aren't translated.
+	switch d.refusal(r) {
+	case http.StatusMethodNotAllowed:
+		w.Header().Set("Allow", strings.Join(d.allowedMethods(), ", "))
+		http.Error(w, "Method not allowed.", http.StatusMethodNotAllowed)
+		return
+	case http.StatusNotFound:
+		http.NotFound(w, r)
+		return
+	}
+
+	// In debug mode, the translation is described instead of redirected to, and isn't counted.
+	r, debug := debugRequest(r)
+	if debug {
+		d.metrics, d.unmapped, d.rules, d.paths = nil, nil, nil, nil
+	}
+
+	result := d.Translate(r)
+
+	if debug {
+		writeTranslationDebug(w, r, newTranslationDebug(r.Method, result))
+		reportOutcome(r, redirectOutcome{d: d, result: result, debug: true})
+		return
+	}
+
+	// During maintenance, hold requests at the notice page instead of redirecting them into an outage.
+	if d.maintenance.active() && d.featureEnabled(featureMaintenancePage) {
+		d.maintenance.servePage(w, result.Target.String())
+		reportOutcome(r, redirectOutcome{d: d, result: result, held: true, status: http.StatusServiceUnavailable})
+		return
+	}
+
+	if result.chosen || d.canary != nil {
+		// Caches mustn't serve a redirect to one environment or view in response to a request for the other.
+		w.Header().Set("Cache-Control", "no-store")
+	} else {
+		setCacheHeaders(w.Header(), d.cacheControl, result.Rule, time.Now())
+	}
+	// Ask search engines to drop the legacy URLs.
+	if d.robotsTag != "" {
+		w.Header().Set("X-Robots-Tag", d.robotsTag)
+	}
+
+	// Send the redirect to the client.
+	http.Redirect(w, r, result.Target.String(), result.Status)
+	reportOutcome(r, redirectOutcome{d: d, result: result, status: result.Status})
+}
+
+// redirectStatus returns the status of redirects.
+func (d Detourer) redirectStatus() int {
+	if d.status == 0 {
+		return defaultRedirectStatus
+	}
+	return d.status
+}
+
+// checkRedirectStatus returns an error if redirects can't be sent with the status.
+func checkRedirectStatus(status int) error {
+	if !slices.Contains(redirectStatuses, status) {
+		return fmt.Errorf("%v is not a redirect status, expected one of %v", status, redirectStatuses)
+	}
+	return nil
+}
+
+// logger returns the logger of per-request messages, which tags them with the tenant, if there is one.
+func (d Detourer) logger() *slog.Logger {
+	if d.tenant == "" {
+		return slog.Default()
+	}
+	return slog.Default().With("tenant", d.tenant)
+}
+
+// lookupContext returns ctx with the deadline of the request's mapping lookups, if there is a lookup timeout.
+func (d Detourer) lookupContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if d.lookupTimeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, d.lookupTimeout)
+}
+
+// lookupID finds the Ex Libris ID for a bibID in the mapping, recording how long the lookup took.
+// It returns an error if the lookup couldn't finish, like when ctx's deadline passes first.
+func (d Detourer) lookupID(ctx context.Context, bibID uint32) (uint64, bool, error) {
+	if d.store == nil {
+		return 0, false, nil
+	}
+	start := time.Now()
+	exlID, present, err := mapping.LookupContext(ctx, d.store, bibID)
+	d.metrics.observeLookup(time.Since(start))
+	if err != nil {
+		d.metrics.observeLookupError()
+	}
+	return exlID, present, err
+}
+
+// sortedBibIDs returns the mapped bibIDs in order, or an error if the mapping store can't list them.
+func (d Detourer) sortedBibIDs() ([]uint32, error) {
+	if d.store == nil {
+		return nil, nil
+	}
+	l, ok := d.store.(mapping.Lister)
+	if !ok {
+		return nil, errors.New("The mapping store can't list its mappings")
+	}
+	bibIDs := make([]uint32, 0, l.Len())
+	for bibID := range l.All() {
+		bibIDs = append(bibIDs, bibID)
+	}
+	slices.Sort(bibIDs)
+	return bibIDs, nil
+}
+
+// Main serves redirects, or runs the subcommand, with the arguments in os.Args, and exits when it is done.
+func Main(b Build) {
+	version, commit, date, modified = resolveBuild(b, readBuildInfo())
+
+	// The validate, diff, merge, compile, stats, and bench subcommands only read the mapping files they are given,
+	// extract-mapping only reads Alma exports, anonymize only reads access logs, and the misses subcommand
+	// only talks to a running instance, so they don't use the flags.
+	args := os.Args[1:]
+	if len(args) > 0 {
+		switch args[0] {
+		case validateCommand:
+			os.Exit(runValidate(os.Stdout, args[1:]))
+		case diffCommand:
+			os.Exit(runDiff(os.Stdout, args[1:]))
+		case mergeCommand:
+			os.Exit(runMerge(os.Stdout, os.Stderr, args[1:]))
+		case compileCommand:
+			os.Exit(runCompile(os.Stderr, args[1:]))
+		case statsCommand:
+			os.Exit(runStats(os.Stdout, args[1:]))
+		case benchCommand:
+			os.Exit(runBench(os.Stdout, args[1:]))
+		case missesCommand:
+			os.Exit(runMisses(os.Stdout, os.Stderr, args[1:]))
+		case extractMappingCommand:
+			os.Exit(runExtractMapping(os.Stdout, os.Stderr, args[1:]))
+		case anonymizeCommand:
+			os.Exit(runAnonymize(os.Stdout, os.Stderr, args[1:]))
+		}
+	}
+
+	// The server and the other subcommands are configured by the flags, the environment, and secret files.
+	c, err := LoadConfig(b, args)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		fatal("Invalid configuration.", "err", err)
+	}
+	Run(c)
+}
+
+// Run serves redirects, or runs the subcommand, with the configuration, and exits when it is done.
+func Run(c Config) {
+	started := time.Now()
+
+	if c.Version {
+		writeVersion(os.Stdout)
+		os.Exit(0)
+	}
+
+	// Set up logging as configured.
+	logger, err := newLogger(os.Stderr, c.LogFormat, c.LogLevel)
+	if err != nil {
+		fatal("Could not set up logging.", "err", err)
+	}
+	slog.SetDefault(logger)
+	if len(c.envSet) > 0 {
+		slog.Info("Read variables from the env file.", "path", c.envPath, "variables", c.envSet)
+	}
+	if len(c.secretsRead) > 0 {
+		slog.Info("Read secrets from files.", "flags", c.secretsRead)
+	}
+
+	if c.Command == checkCommand {
+		os.Exit(runCheck(os.Stdout, checkSettings{
+			primo:             c.Primo,
+			primoHost:         c.PrimoHost,
+			vid:               c.VID,
+			cacheControl:      c.CacheControl,
+			cacheControlRules: c.CacheControlRules,
+			canary:            canaryConfig{Percent: c.CanaryPercent, VID: c.CanaryVID, Primo: c.CanaryPrimo, PrimoHost: c.CanaryPrimoHost},
+			configPath:        c.ConfigPath,
+			mappingFiles:      c.MappingFiles,
+		}))
+	}
+	if c.Command == reportCommand {
+		os.Exit(runReport(os.Stdout, reportSettings{
+			eventsDB: c.EventsDB,
+			date:     c.ReportDate,
+			output:   c.Output,
+			smtp: smtpSettings{
+				address:  c.SMTPAddress,
+				from:     c.SMTPFrom,
+				to:       splitList(c.SMTPTo),
+				username: c.SMTPUsername,
+				password: c.SMTPPassword,
+			},
+		}, time.Now()))
+	}
+	if slices.Contains([]string{translateCommand, exportCommand, sitemapCommand, verifyCommand, replayCommand, smokeCommand}, c.Command) {
+		settings := translateSettings{
+			primo:          c.Primo,
+			primoHost:      c.PrimoHost,
+			vid:            c.VID,
+			sandbox:        c.Sandbox,
+			proxyHosts:     splitList(c.ProxyHosts),
+			noisePaths:     splitList(c.NoisePaths),
+			redirectStatus: c.RedirectStatus,
+			configPath:     c.ConfigPath,
+			mappingFiles:   c.MappingFiles,
+		}
+		if c.Command == exportCommand {
+			os.Exit(runExport(os.Stdout, os.Stderr, settings, exportSettings{format: c.Format, output: c.Output, host: c.ExportHost, chunkSize: c.ExportChunkSize}))
+		}
+		if c.Command == smokeCommand {
+			os.Exit(runSmoke(os.Stdout, settings, c.Target))
+		}
+		if c.Command == replayCommand {
+			os.Exit(runReplay(os.Stdout, settings, c.ReplayHost, c.Arg))
+		}
+		if c.Command == verifyCommand {
+			os.Exit(runVerify(os.Stdout, settings, c.Sample, c.SRUTarget, c.PrimoCheckTimeout))
+		}
+		if c.Command == sitemapCommand {
+			os.Exit(runSitemap(os.Stderr, settings, c.Output, c.SitemapURL))
+		}
+		if c.Batch != "" {
+			os.Exit(runTranslateBatch(os.Stdout, settings, c.Batch))
+		}
+		os.Exit(runTranslate(os.Stdout, settings, c.Arg))
+	}
+
+	// Optionally manage the Windows service, instead of serving.
+	switch c.Service {
+	case "":
+	case "install":
+		if c.flags == nil {
+			fatal("Could not install service, the configuration wasn't loaded from flags.")
+		}
+		args, err := serviceArgs(c.flags)
+		if err != nil {
+			fatal("Could not install service.", "err", err)
+		}
+		err = installService(args)
+		if err != nil {
+			fatal("Could not install service.", "err", err)
+		}
+		return
+	case "uninstall":
+		err = uninstallService()
+		if err != nil {
+			fatal("Could not uninstall service.", "err", err)
+		}
+		return
+	default:
+		fatal("Unknown -service action, expected install or uninstall.", "service", c.Service)
+	}
+
+	// Shut down on SIGINT or SIGTERM, and upgrade on SIGUSR2 where supported.
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, append([]os.Signal{syscall.SIGINT, syscall.SIGTERM}, upgradeSignals...)...)
+	// Under the Windows service control manager, stop requests are delivered as SIGTERM.
+	// Start the service early, as the service control manager expects a prompt response.
+	stopService := func() {}
+	if isWindowsService() {
+		stopService = runService(sigs)
+	}
+
+	// Listeners passed from a previous process on upgrade are used instead of binding new ones.
+	up, err := newUpgrader()
+	if err != nil {
+		fatal("Could not use listeners from the previous process.", "err", err)
+	}
+
+	// The Detourer has all the data needed to build redirects.
+	// The mappings are loaded below, once the server is otherwise ready.
+	opts := []Option{
+		WithVID(c.VID),
+		WithSandbox(c.Sandbox),
+		WithProxyHosts(splitList(c.ProxyHosts)...),
+		WithBatchLimit(c.BatchLimit),
+		WithLookupTimeout(c.LookupTimeout),
+		WithMethods(splitList(c.Methods)...),
+		WithRobotsTag(c.RobotsTag),
+		WithNoisePaths(splitList(c.NoisePaths)...),
+		WithRedirectStatus(c.RedirectStatus),
+	}
+	if c.Primo != "" {
+		opts = append(opts, WithPrimo(c.Primo))
+	}
+	if c.PrimoHost != "" {
+		opts = append(opts, WithPrimoHost(c.PrimoHost))
+	}
+	d, err := NewDetourer(nil, opts...)
+	if err != nil {
+		fatal("Invalid settings.", "err", err)
+	}
+	d.metrics = NewMetrics()
+	d.rules = newRuleHits()
+	d.cacheControl, err = parseCacheControlRules(c.CacheControl, c.CacheControlRules)
+	if err != nil {
+		fatal("Could not parse Cache-Control rules.", "err", err)
+	}
+	d.canary, err = newCanary(canaryConfig{Percent: c.CanaryPercent, VID: c.CanaryVID, Primo: c.CanaryPrimo, PrimoHost: c.CanaryPrimoHost})
+	if err != nil {
+		fatal("Could not set up the canary.", "err", err)
+	}
+
+	// Optionally send metrics to StatsD.
+	if c.StatsDAddress != "" {
+		d.metrics.statsd, err = newStatsDClient(c.StatsDAddress, c.StatsDPrefix, c.DogStatsD)
+		if err != nil {
+			fatal("Could not set up StatsD.", "err", err)
+		}
+		slog.Info("Sending metrics to StatsD.", "address", c.StatsDAddress)
+	}
+
+	// Optionally export traces.
+	if c.OTLPEndpoint != "" {
+		shutdownTracing, err := setupTracing(context.Background(), c.OTLPEndpoint)
+		if err != nil {
+			fatal("Could not set up tracing.", "err", err)
+		}
+		defer func() {
+			err := shutdownTracing(context.Background())
+			if err != nil {
+				slog.Error("Error flushing traces.", "err", err)
+			}
+		}()
+		slog.Info("Exporting traces.", "endpoint", c.OTLPEndpoint)
+	}
+
+	// The service is ready once the mappings are loaded and the server is listening.
+	health := newHealth()
+	var mappingsLoaded, serving atomic.Bool
+	health.setCheck("mappings", flagCheck(&mappingsLoaded, "mappings are not loaded"))
+	health.setCheck("listener", flagCheck(&serving, "server is not listening"))
+
+	// There is no default Primo instance, so it must be configured by the flags or the configuration file.
+	// Check before loading the mappings, so a missing setting is reported right away.
+	configured := d
+	if c.ConfigPath != "" {
+		file, err := loadConfigFile(c.ConfigPath)
+		if err != nil {
+			fatal("Could not load configuration file.", "err", err)
+		}
+		configured, err = file.apply(d)
+		if err != nil {
+			fatal("Could not load configuration file.", "err", err)
+		}
+	}
+	err = configured.checkPrimo()
+	if err != nil {
+		fatal("The Primo instance is not configured.", "err", err)
+	}
+
+	// Optionally check that Primo is reachable, so a typo in the subdomain or vid is noticed.
+	stopCheckingPrimo := make(chan struct{})
+	defer close(stopCheckingPrimo)
+	if c.PrimoCheckInterval > 0 {
+		primoCheck := newUpstreamCheck(configured.primoURL("/discovery/search"), configured.vid, c.PrimoCheckTimeout, d.metrics)
+		health.setCheck("primo", primoCheck.ready)
+		go primoCheck.checkEvery(c.PrimoCheckInterval, stopCheckingPrimo)
+		slog.Info("Checking Primo is reachable.", "url", primoCheck.url, "interval", c.PrimoCheckInterval)
+	}
+
+	// Measure how much the heap grows while loading, to report the memory used by the mappings.
+	var memory memoryUsage
+	heapBefore := heapAlloc()
+
+	// Map of BibIDs to ExL IDs
+	// The initial size is an estimate based on the number of arguments.
+	size := uint64(len(c.MappingFiles)) * maxMappingFileLength
+	idMap := make(map[uint32]uint64, size)
+
+	// Process each file in the arguments list.
+	for _, mappingFilePath := range c.MappingFiles {
+		// Add the mappings from this file to the idMap.
+		err := mapping.LoadFile(idMap, mappingFilePath)
+		if errors.Is(err, mapping.ErrDuplicateBibID) {
+			fatal("Could not load mappings, as a bibID is mapped more than once. List the duplicates with the validate subcommand, and combine the files with the merge subcommand.", "err", err)
+		}
+		if err != nil {
+			fatal("Could not load mappings.", "err", err)
+		}
+	}
+	// The mappings are swapped for new ones when they're reloaded.
+	mappings := mapping.NewSwappableStore(mapping.NewMap(idMap, c.MappingFiles...))
+	d.store = mappings
+
+	memory.MappingsEstimatedBytes = estimateMapBytes(d.store.Len())
+	memory.MappingsMeasuredBytes = heapGrowth(heapBefore)
+	slog.Info("VGer BibID to Ex Libris ID mappings processed.",
+		"mappings", d.store.Len(),
+		"estimatedBytes", memory.MappingsEstimatedBytes,
+		"measuredBytes", memory.MappingsMeasuredBytes,
+	)
+	d.metrics.setMappings(d.store.Len())
+	mappingsLoaded.Store(true)
+
+	// Optionally track requests for unmapped bibIDs, so missing mappings can be found.
+	stopSavingUnmapped := make(chan struct{})
+	if c.UnmappedLimit > 0 {
+		d.unmapped = newUnmappedTracker(c.UnmappedLimit)
+		if c.UnmappedFile != "" {
+			err = d.unmapped.load(c.UnmappedFile)
+			if err != nil {
+				fatal("Could not load unmapped bibIDs.", "err", err)
+			}
+			go d.unmapped.saveEvery(c.UnmappedFile, c.UnmappedSaveInterval, stopSavingUnmapped)
+		}
+	}
+
+	if c.Reverse {
+		heapBefore := heapAlloc()
+		d.reverseMap = buildReverseMap(d.store.(mapping.Lister))
+		memory.ReverseMeasuredBytes = heapGrowth(heapBefore)
+		slog.Info("Reverse index built.", "exlIDs", len(d.reverseMap), "measuredBytes", memory.ReverseMeasuredBytes)
+	}
+
+	// Per-request log messages can be suppressed by category, and repeated messages for a bibID sampled.
+	d.logs, err = newLogSampler(splitList(c.LogSuppress), c.LogDedupInterval)
+	if err != nil {
+		fatal("Could not set up log sampling.", "err", err)
+	}
+
+	// Client addresses can be anonymized before they are written to the logs.
+	d.anonymizer, err = newIPAnonymizer(c.AnonymizeIPs, c.AnonymizeSaltRotation)
+	if err != nil {
+		fatal("Could not set up client address anonymization.", "err", err)
+	}
+
+	// Optionally record every request in a SQLite database, for a queryable record of the sunset period.
+	var events *eventLog
+	if c.EventsDB != "" {
+		events, err = openEventLog(c.EventsDB, c.EventsBatchSize, c.EventsFlushInterval)
+		if err != nil {
+			fatal("Could not open the event log.", "err", err)
+		}
+	}
+
+	// Maintenance mode can be toggled on the admin address, or set at startup.
+	d.maintenance, err = newMaintenance(c.MaintenanceTemplate, c.MaintenanceRetryAfter)
+	if err != nil {
+		fatal("Could not set up maintenance mode.", "err", err)
+	}
+	d.maintenance.set(c.Maintenance)
+
+	// The dashboard is only served on the admin address, as it shows what patrons are requesting.
+	var dashboard *dashboardHandler
+	if c.AdminAddress != "" {
+		d.paths = newPathCounter(defaultPathLimit)
+		dashboard = &dashboardHandler{
+			started:      started,
+			metrics:      d.metrics,
+			unmapped:     d.unmapped,
+			paths:        d.paths,
+			mappings:     mappings,
+			mappingFiles: c.MappingFiles,
+		}
+	}
+
+	// The translation settings in the configuration file are applied over the flags, and can be reloaded.
+	live, err := newLiveDetourer(d, c.ConfigPath, logRotation{maxSize: int64(c.AccessLogMaxSize) * 1024 * 1024, maxAge: c.AccessLogMaxAge})
+	if err != nil {
+		fatal("Could not load configuration file.", "err", err)
+	}
+	defer live.close()
+	if c.ConfigPath != "" {
+		current := live.load()
+		slog.Info("Loaded configuration.", "config", c.ConfigPath, "primo", current.primo, "vid", current.vid, "rules", len(current.prefixRules), "tenantHosts", len(live.current.Load().hosts))
+	}
+	live.reloadOnSIGHUP()
+
+	// Use an explicit request multiplexer.
+	mux := http.NewServeMux()
+	mux.Handle("/", Chain(live, redirectObservers()...))
+	// The health, version, and metrics endpoints are optionally served on a separate admin address.
+	adminMux := mux
+	if c.AdminAddress != "" {
+		adminMux = http.NewServeMux()
+	}
+	adminMux.HandleFunc(healthzPath, health.serveHealthz)
+	adminMux.HandleFunc(readyzPath, health.serveReadyz)
+	adminMux.HandleFunc(versionPath, serveVersion)
+	robots, err := loadRobotsTxt(c.RobotsTxt)
+	if err != nil {
+		fatal("Could not load robots.txt.", "err", err)
+	}
+	mux.Handle(robotsPath, robotsHandler(robots))
+	// Browsers on other origins, like LibGuides widgets, can call the APIs when their origin is allowed.
+	var lookupHandler, reverseLookupHandler http.Handler = http.HandlerFunc(live.serveLookup), http.HandlerFunc(live.serveReverseLookup)
+	if c.CORSOrigins != "" {
+		policy := corsPolicy{
+			origins: splitList(c.CORSOrigins),
+			methods: splitList(strings.ToUpper(c.CORSMethods)),
+			maxAge:  c.CORSMaxAge,
+		}
+		lookupHandler = withCORS(lookupHandler, policy)
+		reverseLookupHandler = withCORS(reverseLookupHandler, policy)
+	}
+	mux.Handle(lookupPath, lookupHandler)
+	mux.Handle(reverseLookupPath, reverseLookupHandler)
+	if c.Metrics {
+		adminMux.Handle(metricsPath, d.metrics)
+	}
+	// Like the dashboard, the admin pages, and the endpoints which show what patrons are requesting, are only served
+	// on the admin address.
+	if dashboard != nil {
+		adminMux.Handle(dashboardPath, dashboard)
+		adminMux.HandleFunc(testPagePath, live.serveTestPage)
+		adminMux.HandleFunc(maintenancePath, d.maintenance.serveAdmin)
+		adminMux.HandleFunc(mappingsReloadPath, live.serveMappingsReload)
+		if c.ConfigPath != "" {
+			adminMux.HandleFunc(reloadPath, live.serveReload)
+		}
+		adminMux.HandleFunc(rulesPath, d.rules.serveRules)
+		adminMux.Handle(statusPath, statusHandler{started: started, metrics: d.metrics, memory: memory})
+		if d.unmapped != nil {
+			adminMux.HandleFunc(unmappedPath, d.unmapped.serveUnmapped)
+			adminMux.HandleFunc(unmappedReportPath, d.unmapped.serveUnmappedReport)
+		}
+	}
+	// Profiles expose internals, so are only served on the admin address or behind a token.
+	if c.Pprof {
+		if c.AdminAddress == "" && c.PprofToken == "" {
+			fatal("-pprof requires -admin-address or -pprof-token.")
+		}
+		adminMux.Handle(pprofPath, pprofHandler(c.PprofToken))
+	}
+
+	// Optionally proxy SRU requests to Alma.
+	if c.SRUPath != "" {
+		if c.SRUTarget == "" && (c.Primo == "" || c.VID == "") {
+			fatal("-sru requires -sru-target, unless -primo and -vid are set.")
+		}
+		target := almaSRUURL(c.Primo, c.VID)
+		if c.SRUTarget != "" {
+			target, err = url.Parse(c.SRUTarget)
+			if err != nil {
+				fatal("Could not parse SRU target.", "target", c.SRUTarget, "err", err)
+			}
+		}
+		mux.Handle(c.SRUPath, newSRUShim(target, d.store))
+		slog.Info("Proxying SRU requests.", "path", c.SRUPath, "target", target.String())
+	}
+
+	// The middleware are chained in the order documented on Chain, and are nil when they're turned off.
+	var rateLimiter, clientFilter, accessLogger, trustedProxiesFilter Middleware
+	// Optionally shed clients making too many requests, before they're translated and counted.
+	if c.RateLimit > 0 {
+		exempt, err := parsePrefixes(splitList(c.RateLimitExempt))
+		if err != nil {
+			fatal("Could not parse rate limit exemptions.", "err", err)
+		}
+		rateLimiter = RateLimit(c.RateLimit, c.RateLimitBurst, exempt, d.metrics)
+	}
+	// Optionally refuse clients by address, before rate limiting.
+	if c.AllowCIDR != "" || c.DenyCIDR != "" {
+		allow, err := parsePrefixes(splitList(c.AllowCIDR))
+		if err != nil {
+			fatal("Could not parse allowed CIDR prefixes.", "err", err)
+		}
+		deny, err := parsePrefixes(splitList(c.DenyCIDR))
+		if err != nil {
+			fatal("Could not parse denied CIDR prefixes.", "err", err)
+		}
+		clientFilter = IPFilter(allow, deny)
+	}
+	// Optionally log each request in the combined log format, separately from the diagnostic log.
+	if c.AccessLog != "" {
+		accessLogFile, err := newRotatingFile(c.AccessLog, int64(c.AccessLogMaxSize)*1024*1024, c.AccessLogMaxAge)
+		if err != nil {
+			fatal("Could not open access log.", "err", err)
+		}
+		defer accessLogFile.Close()
+		accessLogger = accessLog(accessLogFile, d.anonymizer)
+		slog.Info("Writing access log.", "path", c.AccessLog)
+	}
+	// Optionally trust load balancers to report the client's address and scheme.
+	if c.TrustedProxies != "" {
+		trusted, err := parsePrefixes(splitList(c.TrustedProxies))
+		if err != nil {
+			fatal("Could not parse trusted proxies.", "err", err)
+		}
+		trustedProxiesFilter = TrustedProxies(trusted)
+	}
+	handler := Chain(withSecurityHeaders(mux, securityHeaders{
+		hsts:           c.HSTS,
+		referrerPolicy: c.ReferrerPolicy,
+		csp:            c.CSP,
+	}),
+		countRequests(d.metrics),
+		trustedProxiesFilter,
+		accessLogger,
+		recordEvents(events),
+		clientFilter,
+		rateLimiter,
+		RequestID(),
+		Recovery(d.metrics),
+	)
+
+	// Count connections, to report how many are drained when shutting down.
+	conns := &connCounter{}
+	server := http.Server{
+		Handler:   handler,
+		Protocols: new(http.Protocols),
+		// Don't let slow clients hold connections open indefinitely.
+		ReadHeaderTimeout: c.ReadHeaderTimeout,
+		ReadTimeout:       c.ReadTimeout,
+		WriteTimeout:      c.WriteTimeout,
+		IdleTimeout:       c.IdleTimeout,
+		ConnState:         conns.track,
+	}
+
+	// HTTP/2 is used over TLS when clients support it, and optionally over cleartext.
+	server.Protocols.SetHTTP1(true)
+	server.Protocols.SetHTTP2(true)
+	server.Protocols.SetUnencryptedHTTP2(c.H2C)
+
+	// Optionally serve HTTPS.
+	if (c.TLSCert == "") != (c.TLSKey == "") {
+		fatal("Both -tls-cert and -tls-key must be set to serve HTTPS.")
+	}
+	if c.TLSCert != "" && c.ACMEHosts != "" {
+		fatal("Only one of -tls-cert and -acme can be set.")
+	}
+	if c.TLSCert != "" {
+		certs, err := newCertReloader(c.TLSCert, c.TLSKey)
+		if err != nil {
+			fatal("Could not set up TLS.", "err", err)
+		}
+		certs.reloadOnSIGHUP()
+		server.TLSConfig = &tls.Config{GetCertificate: certs.getCertificate}
+	}
+	if c.ACMEHosts != "" {
+		m := newACMEManager(splitList(c.ACMEHosts), c.ACMECacheDir, c.ACMEEmail)
+		server.TLSConfig = m.TLSConfig()
+		// Requests over HTTP are still translated, other than HTTP-01 challenges.
+		if c.ACMEHTTPAddress != "" {
+			acmeListener, err := up.listen("acme-http", c.ACMEHTTPAddress)
+			if err != nil {
+				fatal("Could not listen for ACME challenges.", "address", c.ACMEHTTPAddress, "err", err)
+			}
+			go func() {
+				slog.Info("Starting HTTP server for ACME challenges.", "address", c.ACMEHTTPAddress)
+				acmeServer := &http.Server{
+					Handler:           m.HTTPHandler(handler),
+					ReadHeaderTimeout: server.ReadHeaderTimeout,
+					ReadTimeout:       server.ReadTimeout,
+					WriteTimeout:      server.WriteTimeout,
+					IdleTimeout:       server.IdleTimeout,
+				}
+				err := acmeServer.Serve(acmeListener)
+				if err != nil {
+					fatal("Fatal ACME HTTP server error.", "err", err)
+				}
+			}()
+		}
+	}
+
+	// Optionally serve the gRPC lookup service alongside HTTP.
+	grpcServer := grpc.NewServer()
+	lookuppb.RegisterLookupServiceServer(grpcServer, lookupServer{live: live})
+	if c.GRPCAddress != "" {
+		grpcListener, err := up.listen("grpc", c.GRPCAddress)
+		if err != nil {
+			fatal("Could not listen for gRPC.", "address", c.GRPCAddress, "err", err)
+		}
+		go func() {
+			slog.Info("Starting gRPC server.", "address", c.GRPCAddress)
+			err := grpcServer.Serve(grpcListener)
+			if err != nil {
+				fatal("Fatal gRPC server error.", "err", err)
+			}
+		}()
+	}
+
+	// Optionally serve the admin endpoints on their own address, without the redirect middleware.
+	adminConns := &connCounter{}
+	adminServer := http.Server{
+		Handler:           Chain(adminMux, countRequests(d.metrics), Recovery(d.metrics)),
+		ReadHeaderTimeout: server.ReadHeaderTimeout,
+		ReadTimeout:       server.ReadTimeout,
+		WriteTimeout:      server.WriteTimeout,
+		IdleTimeout:       server.IdleTimeout,
+		ConnState:         adminConns.track,
+	}
+	if c.AdminAddress != "" {
+		adminListener, err := up.listen("admin", c.AdminAddress)
+		if err != nil {
+			fatal("Could not listen for admin requests.", "address", c.AdminAddress, "err", err)
+		}
+		go func() {
+			slog.Info("Starting admin server.", "address", c.AdminAddress)
+			err := adminServer.Serve(adminListener)
+			if err != http.ErrServerClosed {
+				fatal("Fatal admin server error.", "err", err)
+			}
+		}()
+	}
+
+	shutdown := make(chan struct{})
+	go func() {
+		// Wait to receive a message on the channel.
+		// On SIGUSR2, hand the listeners to a new process, and shut down once it is ready.
+		for sig := range sigs {
+			if !slices.Contains(upgradeSignals, sig) {
+				break
+			}
+			slog.Info("Upgrading.")
+			err := up.upgrade()
+			if err != nil {
+				slog.Error("Could not upgrade, continuing to serve.", "err", err)
+				continue
+			}
+			slog.Info("The new process is ready, shutting down.")
+			break
+		}
+		// Fail readiness probes while shutting down.
+		serving.Store(false)
+		ctx, cancel := context.WithTimeout(context.Background(), c.ShutdownTimeout)
+		defer cancel()
+		stopGRPCServer(ctx, grpcServer)
+		err := shutdownServer(ctx, &server, conns)
+		if err != nil {
+			slog.Error("Error shutting down server.", "err", err)
+		}
+		if c.AdminAddress != "" {
+			err = shutdownServer(ctx, &adminServer, adminConns)
+			if err != nil {
+				slog.Error("Error shutting down admin server.", "err", err)
+			}
+		}
+		close(shutdown)
+	}()
+
+	// Bind the listeners before serving, so readiness reflects bound listeners.
+	// Under systemd socket activation or after an upgrade, the listeners are inherited instead, so restarts don't drop connections.
+	listeners := up.take("http")
+	if len(listeners) > 0 {
+		slog.Info("Using listeners from the previous process.", "listeners", len(listeners))
+	} else {
+		listeners, err = systemdListeners()
+		if err != nil {
+			fatal("Could not use socket activation.", "err", err)
+		}
+		if len(listeners) > 0 {
+			slog.Info("Using listeners from systemd.", "listeners", len(listeners))
+		} else {
+			listeners, err = listenAll(splitList(c.Address))
+			if err != nil {
+				fatal("Could not listen.", "err", err)
+			}
+		}
+		up.add("http", listeners...)
+	}
+
+	// Drop root privileges now that the listeners are bound, then optionally record the process ID for init scripts
+	// and log rotation hooks. It is written once the listeners are bound, so a failed upgrade doesn't replace the
+	// previous process's ID.
+	if c.Setgid != "" && c.Setuid == "" {
+		fatal("-setgid can only be used with -setuid.")
+	}
+	err = dropPrivilegesAndWritePIDFile(c.Setuid, c.Setgid, c.PIDFile)
+	if err != nil {
+		fatal("Could not drop privileges or write PID file.", "err", err)
+	}
+	if os.Geteuid() == 0 && !c.AllowRoot {
+		fatal("Refusing to serve as root. Set -setuid to switch users after binding, or -allow-root.")
+	}
+
+	serving.Store(true)
+	// The same server serves requests from every listener.
+	// Serving can set up a TLSConfig for HTTP/2, so check whether to serve HTTPS first.
+	useTLS := server.TLSConfig != nil
+	serveErrs := make(chan error, len(listeners))
+	for _, listener := range listeners {
+		if c.ProxyProtocol {
+			listener = proxyListener{listener}
+		}
+		go func() {
+			if useTLS {
+				slog.Info("Starting HTTPS server.", "address", listener.Addr().String())
+				serveErrs <- server.ServeTLS(listener, "", "")
+			} else {
+				slog.Info("Starting server.", "address", listener.Addr().String())
+				serveErrs <- server.Serve(listener)
+			}
+		}()
+	}
+	// Let the previous process, if any, shut down.
+	err = up.ready()
+	if err != nil {
+		slog.Error("Could not tell the previous process this one is ready.", "err", err)
+	}
+	for range listeners {
+		err := <-serveErrs
+		if err != http.ErrServerClosed {
+			fatal("Fatal server error.", "err", err)
+		}
+	}
+	<-shutdown
+
+	if d.unmapped != nil && c.UnmappedFile != "" {
+		close(stopSavingUnmapped)
+		err = d.unmapped.save(c.UnmappedFile)
+		if err != nil {
+			slog.Error("Could not save unmapped bibIDs.", "err", err)
+		}
+	}
+
+	err = events.close()
+	if err != nil {
+		slog.Error("Could not close the event log.", "err", err)
+	}
+
+	if c.PIDFile != "" {
+		err = removePIDFile(c.PIDFile)
+		if err != nil {
+			slog.Error("Could not remove PID file.", "err", err)
+		}
+	}
+
+	slog.Info("Server stopped.")
+	stopService()
+}
+
+// dropPrivilegesAndWritePIDFile switches to the user and group, if a user is set, and then writes the process ID to
+// the PID file, if one is set. The file is written as the user, so the process can remove it on shutdown, and the new
+// process after an upgrade, which starts as the user, can replace it.
+func dropPrivilegesAndWritePIDFile(userName, groupName, pidFile string) error {
+	if userName != "" {
+		uid, gid, err := lookupIDs(userName, groupName)
+		if err != nil {
+			return fmt.Errorf("Could not find the user to switch to, %w", err)
+		}
+		err = dropPrivileges(uid, gid)
+		if err != nil {
+			return fmt.Errorf("Could not drop privileges, %w", err)
+		}
+		slog.Info("Dropped privileges.", "uid", uid, "gid", gid)
+	}
+	if pidFile != "" {
+		return writePIDFile(pidFile)
+	}
+	return nil
+}
+
+// splitMappingList splits a list of mapping files separated by commas, or by the OS's path list separator.
+func splitMappingList(list string) []string {
+	paths := []string{}
+	for _, item := range splitList(list) {
+		for _, path := range filepath.SplitList(item) {
+			path = strings.TrimSpace(path)
+			if path != "" {
+				paths = append(paths, path)
+			}
+		}
+	}
+	return paths
+}
+
+// splitList is a helper function which splits a comma separated list, ignoring empty items.
+func splitList(list string) []string {
+	items := []string{}
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// requestWithURL is a helper function which returns a shallow copy of the request with a different URL.
+func requestWithURL(r *http.Request, u *url.URL) *http.Request {
+	r2 := new(http.Request)
+	*r2 = *r
+	r2.URL = u
+	return r2
+}
@@ -0,0 +1,330 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/cu-library/permanentdetour/mapping"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestServeHTTPMethods(t *testing.T) {
+	d := Detourer{
+		store: mapping.NewMap(map[uint32]uint64{651520: 996515203405158}),
+		primo: "ocul-qu.primo.exlibrisgroup.com",
+		vid:   "01OCUL_QU:QU_DEFAULT",
+	}
+	server := httptest.NewServer(observed(d))
+	defer server.Close()
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	location := "https://ocul-qu.primo.exlibrisgroup.com/discovery/fulldisplay?docid=alma996515203405158&vid=01OCUL_QU%3AQU_DEFAULT"
+
+	var tests = []struct {
+		method   string
+		status   int
+		location string
+		body     bool
+	}{
+		{http.MethodGet, http.StatusTemporaryRedirect, location, true},
+		{http.MethodHead, http.StatusTemporaryRedirect, location, false},
+		{http.MethodPost, http.StatusMethodNotAllowed, "", true},
+		{http.MethodDelete, http.StatusMethodNotAllowed, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, server.URL+"/vwebv/holdingsInfo?bibId=651520", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.status {
+				t.Fatalf("A %v request had status %v, not %v.", tt.method, resp.StatusCode, tt.status)
+			}
+			if resp.Header.Get("Location") != tt.location {
+				t.Fatalf("A %v request had Location %q, not %q.", tt.method, resp.Header.Get("Location"), tt.location)
+			}
+			if (len(body) > 0) != tt.body {
+				t.Fatalf("A %v request had body %q.", tt.method, body)
+			}
+			if tt.status == http.StatusMethodNotAllowed && resp.Header.Get("Allow") != "GET, HEAD" {
+				t.Fatalf("A %v request had Allow %q, not \"GET, HEAD\".", tt.method, resp.Header.Get("Allow"))
+			}
+		})
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	d, err := NewDetourer(mapping.NewMap(map[uint32]uint64{651520: 996515203405158}),
+		WithPrimo("ocul-qu"),
+		WithVID("01OCUL_QU:QU_DEFAULT"),
+		WithRedirectStatus(http.StatusMovedPermanently),
+		WithRobotsTag("noindex"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.metrics = NewMetrics()
+	d.logs, _ = newLogSampler(logCategories, 0)
+	d.cacheControl, err = parseCacheControlRules("public, max-age=3600", "patron=no-store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(observed(d))
+	defer server.Close()
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	primo := "https://ocul-qu.primo.exlibrisgroup.com"
+	vid := "vid=01OCUL_QU%3AQU_DEFAULT"
+	search := "&search_scope=MyInst_and_CI&tab=Everything&" + vid
+
+	var tests = []struct {
+		target       string
+		rule         string
+		location     string
+		cacheControl string
+	}{
+		{"/vwebv/holdingsInfo?bibId=651520", "record", primo + "/discovery/fulldisplay?docid=alma996515203405158&" + vid, "public, max-age=3600"},
+		{"/vwebv/holdingsInfo?bibId=651521", "record", primo + "/discovery/search?" + vid, "public, max-age=3600"},
+		{"/vwebv/holdingsInfo?bibId=-1", "record", primo + "/discovery/search?" + vid, "public, max-age=3600"},
+		{"/vwebv/holdingsInfo", "record", primo + "/discovery/search?" + vid, "public, max-age=3600"},
+		{"/vwebv/search?searchArg=dune&searchCode=TKEY%5E", "search", primo + "/discovery/search?query=title%2Ccontains%2Cdune" + search, "public, max-age=3600"},
+		{"/vwebv/search?searchArg=dune&searchCode=TALL", "search", primo + "/discovery/search?query=title%2Ccontains%2Cdune" + search, "public, max-age=3600"},
+		{"/vwebv/search?searchArg=Herbert&searchCode=NAME", "search", primo + "/discovery/browse?browseQuery=Herbert&browseScope=author" + search, "public, max-age=3600"},
+		{"/vwebv/search?searchArg=PS3558&searchCode=CALL", "search", primo + "/discovery/browse?browseQuery=PS3558&browseScope=callnumber.0" + search, "public, max-age=3600"},
+		{"/vwebv/search?searchArg=science&searchCode=JALL", "search", primo + "/discovery/jsearch?query=any%2Ccontains%2Cscience&search_scope=MyInst_and_CI&tab=jsearch_slot&" + vid, "public, max-age=3600"},
+		{"/vwebv/search?searchArg=dune&searchCode=GKEY%5E*", "search", primo + "/discovery/search?query=any%2Ccontains%2Cdune" + search, "public, max-age=3600"},
+		{"/vwebv/search?SEARCH=dune", "search", primo + "/discovery/search?query=any%2Ccontains%2Cdune" + search, "public, max-age=3600"},
+		{"/vwebv/search", "search", primo + "/discovery/search?search_scope=MyInst_and_CI&tab=Everything&" + vid, "public, max-age=3600"},
+		{"/cgi-bin/Pwebrecon.cgi?BBID=651520", "classic", primo + "/discovery/fulldisplay?docid=alma996515203405158&" + vid, "public, max-age=3600"},
+		{"/cgi-bin/Pwebrecon.cgi?BBID=651521", "classic", primo + "/discovery/search?" + vid, "public, max-age=3600"},
+		{"/cgi-bin/Pwebrecon.cgi?DB=local&Search_Arg=Herbert&Search_Code=NAME_&CNT=50", "classic", primo + "/discovery/browse?browseQuery=Herbert&browseScope=author" + search, "public, max-age=3600"},
+		{"/vwebv/myAccount", "patron", primo + "/discovery/login?" + vid, "no-store"},
+		{"/vwebv/login", "patron", primo + "/discovery/login?" + vid, "no-store"},
+		{"/", "default", primo + "/discovery/search?" + vid, "public, max-age=3600"},
+		{"/vwebv/enterCourseReserve.do?courseId=1", "default", primo + "/discovery/search?" + vid, "public, max-age=3600"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			resp, err := client.Get(server.URL + tt.target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusMovedPermanently {
+				t.Fatalf("The request had status %v, not %v.", resp.StatusCode, http.StatusMovedPermanently)
+			}
+			if resp.Header.Get("Location") != tt.location {
+				t.Fatalf("The request had Location %q, not %q.", resp.Header.Get("Location"), tt.location)
+			}
+			if resp.Header.Get("Cache-Control") != tt.cacheControl {
+				t.Fatalf("The request had Cache-Control %q, not %q.", resp.Header.Get("Cache-Control"), tt.cacheControl)
+			}
+			if resp.Header.Get("Expires") == "" {
+				t.Fatal("The request had no Expires header.")
+			}
+			if resp.Header.Get("X-Robots-Tag") != "noindex" {
+				t.Fatalf("The request had X-Robots-Tag %q, not noindex.", resp.Header.Get("X-Robots-Tag"))
+			}
+		})
+	}
+
+	// Every request is counted under the rule which built its redirect.
+	counts := map[string]uint64{}
+	for _, tt := range tests {
+		counts[tt.rule]++
+	}
+	d.metrics.redirects.each(func(rule string, value uint64) {
+		if counts[rule] != value {
+			t.Errorf("%v redirects were counted for the %v rule, not %v.", value, rule, counts[rule])
+		}
+		delete(counts, rule)
+	})
+	if len(counts) > 0 {
+		t.Errorf("No redirects were counted for the rules %v.", counts)
+	}
+	if d.metrics.unmapped.Load() != 2 || d.metrics.parseErrors.Load() != 2 {
+		t.Errorf("%v unmapped and %v invalid bibIDs were counted, not 2 and 2.", d.metrics.unmapped.Load(), d.metrics.parseErrors.Load())
+	}
+}
+
+func TestSplitMappingList(t *testing.T) {
+	var tests = []struct {
+		list     string
+		expected []string
+	}{
+		{"", []string{}},
+		{"qu.csv", []string{"qu.csv"}},
+		{"qu.csv, law.csv,", []string{"qu.csv", "law.csv"}},
+		{"qu.csv" + string(filepath.ListSeparator) + "law.csv", []string{"qu.csv", "law.csv"}},
+	}
+	for _, tt := range tests {
+		paths := splitMappingList(tt.list)
+		if !slices.Equal(paths, tt.expected) {
+			t.Errorf("splitMappingList(%q) was %v, not %v.", tt.list, paths, tt.expected)
+		}
+	}
+}
+
+// blockingStore is a mapping.ContextStore whose lookups block until their context is done, like a store
+// in a remote database which has gone away.
+type blockingStore struct {
+	*mapping.Map
+}
+
+// LookupContext waits for ctx to be done.
+func (s blockingStore) LookupContext(ctx context.Context, bibID uint32) (uint64, bool, error) {
+	<-ctx.Done()
+	return 0, false, ctx.Err()
+}
+
+func TestLookupTimeout(t *testing.T) {
+	metrics := NewMetrics()
+	d, err := NewDetourer(blockingStore{mapping.NewMap(map[uint32]uint64{651520: 996515203405158})},
+		WithPrimo("ocul-qu"),
+		WithVID("01OCUL_QU:QU_DEFAULT"),
+		WithLookupTimeout(10*time.Millisecond),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.metrics = metrics
+
+	// The record link is redirected to the search form, as the record couldn't be looked up in time.
+	w := httptest.NewRecorder()
+	d.ServeHTTP(w, httptest.NewRequest("GET", "/vwebv/holdingsInfo?bibId=651520", nil))
+	expected := "https://ocul-qu.primo.exlibrisgroup.com/discovery/search?vid=01OCUL_QU%3AQU_DEFAULT"
+	if w.Code != defaultRedirectStatus || w.Header().Get("Location") != expected {
+		t.Fatalf("A request whose lookup timed out responded with %v %v, not %v %v.", w.Code, w.Header().Get("Location"), defaultRedirectStatus, expected)
+	}
+	if metrics.lookupErrs.Load() != 1 {
+		t.Fatalf("%v lookup errors were counted, not 1.", metrics.lookupErrs.Load())
+	}
+
+	// The lookup API reports the lookup failed, instead of that the bibID isn't mapped.
+	w = httptest.NewRecorder()
+	d.serveLookup(w, httptest.NewRequest("GET", "/api/v1/lookup?bibId=651520", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("A lookup API request whose lookup timed out responded with %v, not %v.", w.Code, http.StatusServiceUnavailable)
+	}
+}
+
+// serveHTTPAllocBudgets are the most allocations ServeHTTP, with the middleware which trace, log, and count its
+// redirects, may make for a request, by the rule which translates it, including the few made by the
+// httptest.ResponseRecorder. Most are for parsing the query and building the
+// redirect URL. The lookup itself makes none.
+//
+// The budgets were measured by TestServeHTTPAllocations, with Go 1.27 and tracing off, at 61, 84, and 36
+// allocations, and leave a few more for changes in the standard library between Go versions.
+var serveHTTPAllocBudgets = []struct {
+	rule   string
+	target string
+	budget float64
+}{
+	{"record", "/vwebv/holdingsInfo?bibId=651520", 64},
+	{"search", "/vwebv/search?searchArg=dune&searchCode=TALL", 90},
+	{"default", "/", 40},
+}
+
+// observed returns h with the middleware which trace, log, and count its redirects, as the server chains them.
+func observed(h http.Handler) http.Handler {
+	return Chain(h, redirectObservers()...)
+}
+
+// newBenchmarkDetourer returns a Detourer which translates without logging, as the server does, with metrics.
+func newBenchmarkDetourer(tb testing.TB) Detourer {
+	d, err := NewDetourer(mapping.NewMap(map[uint32]uint64{651520: 996515203405158}),
+		WithPrimo("ocul-qu"),
+		WithVID("01OCUL_QU:QU_DEFAULT"),
+	)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	d.metrics = NewMetrics()
+	d.rules = newRuleHits()
+	d.logs, _ = newLogSampler(logCategories, 0)
+	return d
+}
+
+// withoutTracing replaces the tracer with a no-op one for the test, so tracing set up by other tests doesn't
+// change its allocations.
+func withoutTracing(tb testing.TB) {
+	previous := tracer
+	tracer = noop.NewTracerProvider().Tracer(tracerName)
+	tb.Cleanup(func() {
+		tracer = previous
+	})
+}
+
+func TestServeHTTPAllocations(t *testing.T) {
+	if raceEnabled {
+		t.Skip("The race detector makes allocations of its own.")
+	}
+	withoutTracing(t)
+	d := newBenchmarkDetourer(t)
+	ctx := context.Background()
+	allocs := testing.AllocsPerRun(100, func() {
+		d.lookupID(ctx, 651520)
+	})
+	if allocs > 0 {
+		t.Errorf("Looking up a bibID made %v allocations, not 0.", allocs)
+	}
+	h := observed(d)
+	for _, tt := range serveHTTPAllocBudgets {
+		r := httptest.NewRequest("GET", tt.target, nil)
+		allocs := testing.AllocsPerRun(100, func() {
+			h.ServeHTTP(httptest.NewRecorder(), r)
+		})
+		if allocs > tt.budget {
+			t.Errorf("Serving %v made %v allocations, more than the %v rule's budget of %v.", tt.target, allocs, tt.rule, tt.budget)
+		}
+	}
+}
+
+func BenchmarkServeHTTP(b *testing.B) {
+	withoutTracing(b)
+	h := observed(newBenchmarkDetourer(b))
+	for _, tt := range serveHTTPAllocBudgets {
+		b.Run(tt.rule, func(b *testing.B) {
+			r := httptest.NewRequest("GET", tt.target, nil)
+			b.ReportAllocs()
+			for b.Loop() {
+				h.ServeHTTP(httptest.NewRecorder(), r)
+			}
+		})
+	}
+}
+
+func BenchmarkLookupID(b *testing.B) {
+	d := newBenchmarkDetourer(b)
+	ctx := context.Background()
+	b.ReportAllocs()
+	for b.Loop() {
+		d.lookupID(ctx, 651520)
+	}
+}
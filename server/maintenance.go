@@ -0,0 +1,112 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	_ "embed"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// maintenancePath is the path of the admin endpoint which reports and toggles maintenance mode.
+	maintenancePath string = "/admin/maintenance"
+
+	// defaultMaintenanceRetryAfter is the default time clients are asked to wait before retrying during maintenance.
+	defaultMaintenanceRetryAfter time.Duration = 10 * time.Minute
+
+	// maintenanceCSP is the Content-Security-Policy of the maintenance page, which can have inline styles and images.
+	maintenanceCSP string = "default-src 'none'; style-src 'unsafe-inline'; img-src https: data:; frame-ancestors 'none'; base-uri 'none'; form-action 'none'"
+)
+
+//go:embed web/maintenance.html
+var defaultMaintenanceHTML string
+
+// maintenance holds requests at a notice page instead of redirecting them, while Primo is unavailable.
+// A nil *maintenance is never enabled.
+type maintenance struct {
+	enabled    atomic.Bool
+	page       *template.Template
+	retryAfter time.Duration
+}
+
+// maintenancePage is the data rendered by the maintenance page template.
+type maintenancePage struct {
+	Target string // The URL the request would have been redirected to.
+}
+
+// newMaintenance returns a maintenance, which is disabled, rendering the template at path, or the default page when path is empty.
+func newMaintenance(path string, retryAfter time.Duration) (*maintenance, error) {
+	html := defaultMaintenanceHTML
+	if path != "" {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("Could not read maintenance template %v, %w", path, err)
+		}
+		html = string(content)
+	}
+	page, err := template.New("maintenance").Parse(html)
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse maintenance template, %w", err)
+	}
+	return &maintenance{page: page, retryAfter: retryAfter}, nil
+}
+
+// active reports whether maintenance mode is enabled.
+func (m *maintenance) active() bool {
+	return m != nil && m.enabled.Load()
+}
+
+// set enables or disables maintenance mode.
+func (m *maintenance) set(enabled bool) {
+	previous := m.enabled.Swap(enabled)
+	if previous != enabled {
+		slog.Info("Maintenance mode changed.", "enabled", enabled)
+	}
+}
+
+// servePage responds with the maintenance page and a 503 status.
+func (m *maintenance) servePage(w http.ResponseWriter, target string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", maintenanceCSP)
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Retry-After", strconv.Itoa(int(m.retryAfter.Seconds())))
+	w.WriteHeader(http.StatusServiceUnavailable)
+	err := m.page.Execute(w, maintenancePage{Target: target})
+	if err != nil {
+		slog.Error("Error rendering maintenance page.", "err", err)
+	}
+}
+
+// maintenanceState is the body of the maintenance endpoint.
+type maintenanceState struct {
+	Enabled bool `json:"enabled"`
+}
+
+// serveAdmin reports whether maintenance mode is enabled. POST requests with an enabled form value of true or false change it.
+func (m *maintenance) serveAdmin(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+	case http.MethodPost:
+		enabled, err := strconv.ParseBool(r.FormValue("enabled"))
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, apiError{Error: "The enabled value must be true or false."})
+			return
+		}
+		m.set(enabled)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, POST")
+		writeJSON(w, http.StatusMethodNotAllowed, apiError{Error: "Method not allowed."})
+		return
+	}
+	writeJSON(w, http.StatusOK, maintenanceState{Enabled: m.active()})
+}
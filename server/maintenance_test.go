@@ -0,0 +1,112 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cu-library/permanentdetour/mapping"
+)
+
+func TestMaintenanceMode(t *testing.T) {
+	m, err := newMaintenance("", 5*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := Detourer{
+		store:       mapping.NewMap(map[uint32]uint64{651520: 996515203405158}),
+		primo:       "ocul-qu.primo.exlibrisgroup.com",
+		vid:         "01OCUL_QU:QU_DEFAULT",
+		maintenance: m,
+	}
+
+	w := httptest.NewRecorder()
+	d.ServeHTTP(w, httptest.NewRequest("GET", "/vwebv/holdingsInfo?bibId=651520", nil))
+	if w.Code != http.StatusTemporaryRedirect {
+		t.Fatalf("Before maintenance, the response status was %v, not 307.", w.Code)
+	}
+
+	m.set(true)
+	w = httptest.NewRecorder()
+	d.ServeHTTP(w, httptest.NewRequest("GET", "/vwebv/holdingsInfo?bibId=651520", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("During maintenance, the response status was %v, not 503.", w.Code)
+	}
+	if w.Header().Get("Retry-After") != "300" {
+		t.Fatalf("Retry-After was %v, not 300.", w.Header().Get("Retry-After"))
+	}
+	if w.Header().Get("Location") != "" {
+		t.Fatal("A Location header was set during maintenance.")
+	}
+	if !strings.Contains(w.Body.String(), "docid=alma996515203405158") {
+		t.Fatal("The maintenance page didn't link to the target.")
+	}
+}
+
+func TestMaintenanceTemplate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "maintenance.html")
+	err := os.WriteFile(path, []byte(`<p>Back soon: {{.Target}}</p>`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := newMaintenance(path, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	m.servePage(w, "https://example.com/?a=<b>")
+	if w.Body.String() != "<p>Back soon: https://example.com/?a=&lt;b&gt;</p>" {
+		t.Fatalf("The maintenance page was %q.", w.Body.String())
+	}
+
+	err = os.WriteFile(path, []byte(`{{.Target`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = newMaintenance(path, time.Minute)
+	if err == nil {
+		t.Fatal("newMaintenance() didn't return an error for an invalid template.")
+	}
+}
+
+func TestMaintenanceAdmin(t *testing.T) {
+	m, err := newMaintenance("", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		method string
+		form   string
+		code   int
+		active bool
+	}{
+		{"GET", "", http.StatusOK, false},
+		{"POST", "enabled=true", http.StatusOK, true},
+		{"POST", "enabled=maybe", http.StatusBadRequest, true},
+		{"DELETE", "", http.StatusMethodNotAllowed, true},
+		{"POST", "enabled=false", http.StatusOK, false},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, maintenancePath, strings.NewReader(tt.form))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		m.serveAdmin(w, r)
+		if w.Code != tt.code {
+			t.Fatalf("%v %v returned %v, not %v.", tt.method, url.QueryEscape(tt.form), w.Code, tt.code)
+		}
+		if m.active() != tt.active {
+			t.Fatalf("After %v %v, maintenance mode was %v, not %v.", tt.method, tt.form, m.active(), tt.active)
+		}
+	}
+}
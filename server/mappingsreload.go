@@ -0,0 +1,101 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/cu-library/permanentdetour/mapping"
+)
+
+// mappingsReloadPath is the path of the admin endpoint which reloads the mapping files.
+const mappingsReloadPath string = "/admin/mappings/reload"
+
+// reloadMappings reads the mapping files of the server and its tenants again, and swaps each store's new mappings in
+// once they have all been read, so requests are translated with either the previous or the new mappings, never some
+// of each. Reverse indexes are rebuilt from the new mappings. A store whose files can't be read keeps its mappings,
+// and the errors of all such stores are returned.
+func (l *liveDetourer) reloadMappings() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var stores []*mapping.SwappableStore
+	if ss, ok := l.base.store.(*mapping.SwappableStore); ok {
+		stores = append(stores, ss)
+	}
+	for _, m := range l.loaded {
+		stores = append(stores, m.store)
+	}
+	var errs []error
+	for _, ss := range stores {
+		err := ss.Reload()
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	l.base.metrics.setMappings(l.base.store.Len())
+
+	// The reverse indexes are rebuilt for the stores' new mappings, and the current Detourers are replaced with
+	// copies using them, as the indexes aren't part of the stores.
+	if l.base.reverseMap == nil {
+		return errors.Join(errs...)
+	}
+	reverse := map[mapping.Store]map[uint64][]uint32{}
+	for _, ss := range stores {
+		reverse[ss] = buildReverseMap(ss)
+	}
+	if rm, ok := reverse[l.base.store]; ok {
+		l.base.reverseMap = rm
+	}
+	for key, m := range l.loaded {
+		m.reverseMap = reverse[m.store]
+		l.loaded[key] = m
+	}
+	rt := l.current.Load()
+	next := &router{def: rt.def.withReverseMap(reverse), hosts: make(map[string]*Detourer, len(rt.hosts))}
+	for host, t := range rt.hosts {
+		copied := t.withReverseMap(reverse)
+		next.hosts[host] = &copied
+	}
+	l.current.Store(next)
+	return errors.Join(errs...)
+}
+
+// withReverseMap returns a copy of d using the reverse index of its store in reverse, if there is one.
+func (d Detourer) withReverseMap(reverse map[mapping.Store]map[uint64][]uint32) Detourer {
+	if rm, ok := reverse[d.store]; ok {
+		d.reverseMap = rm
+	}
+	return d
+}
+
+// logMappingsReload logs the result of reloading the mappings.
+func (l *liveDetourer) logMappingsReload(err error) {
+	if err != nil {
+		slog.Error("Could not reload mappings, the previous mappings are still in use.", "err", err)
+		return
+	}
+	slog.Info("Reloaded mappings.", "mappings", l.base.store.Len(), "tenantMappings", len(l.loaded))
+}
+
+// serveMappingsReload reloads the mapping files on POST requests.
+func (l *liveDetourer) serveMappingsReload(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeJSON(w, http.StatusMethodNotAllowed, apiError{Error: "Reloads must use POST."})
+		return
+	}
+	err := l.reloadMappings()
+	l.logMappingsReload(err)
+	if err != nil {
+		writeJSON(w, http.StatusUnprocessableEntity, newReloadError(err))
+		return
+	}
+	writeJSON(w, http.StatusOK, struct {
+		Mappings int `json:"mappings"`
+	}{l.base.store.Len()})
+}
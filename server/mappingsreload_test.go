@@ -0,0 +1,90 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/cu-library/permanentdetour/mapping"
+)
+
+func TestServeMappingsReload(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		err := os.WriteFile(path, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	mappingsPath := write("mappings.csv", "996515203405158,a651520-01ocul_qu\n")
+	write("law.csv", "991234503405158,a12345-01ocul_qu\n")
+	config := write("config.json", `{"tenants":[{"name":"law","hosts":["lawcat.queensu.ca"],"vid":"01OCUL_QL:QL_DEFAULT","mappings":["law.csv"]}]}`)
+
+	m, err := mapping.LoadMap(mappingsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := mapping.NewSwappableStore(m)
+	base := Detourer{
+		store:      store,
+		primo:      "ocul-qu.primo.exlibrisgroup.com",
+		vid:        "01OCUL_QU:QU_DEFAULT",
+		reverseMap: buildReverseMap(store),
+		metrics:    NewMetrics(),
+	}
+	l, err := newLiveDetourer(base, config, logRotation{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.close()
+
+	reload := func(method string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		l.serveMappingsReload(w, httptest.NewRequest(method, mappingsReloadPath, nil))
+		return w
+	}
+	if w := reload("GET"); w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("A GET request responded with %v, not %v.", w.Code, http.StatusMethodNotAllowed)
+	}
+
+	// The new mappings of the server and the tenant are used, with their reverse indexes.
+	write("mappings.csv", "996515203405159,a651520-01ocul_qu\n996515213405158,a651521-01ocul_qu\n")
+	write("law.csv", "991234503405159,a12345-01ocul_qu\n")
+	w := reload("POST")
+	if w.Code != http.StatusOK || w.Body.String() != "{\"mappings\":2}\n" {
+		t.Fatalf("The reload responded with %v %q.", w.Code, w.Body.String())
+	}
+	def := l.load()
+	exlID, _, _ := def.lookupID(t.Context(), 651520)
+	if exlID != 996515203405159 || !slices.Equal(def.reverseMap[996515203405159], []uint32{651520}) {
+		t.Fatalf("After reloading, bibID 651520 was mapped to %v, with the reverse index %v.", exlID, def.reverseMap)
+	}
+	law := l.current.Load().hosts["lawcat.queensu.ca"]
+	exlID, _, _ = law.lookupID(t.Context(), 12345)
+	if exlID != 991234503405159 || !slices.Equal(law.reverseMap[991234503405159], []uint32{12345}) {
+		t.Fatalf("After reloading, the tenant's bibID 12345 was mapped to %v, with the reverse index %v.", exlID, law.reverseMap)
+	}
+	if base.metrics.mappings.Load() != 2 {
+		t.Fatalf("The mappings metric was %v after reloading, not 2.", base.metrics.mappings.Load())
+	}
+
+	// A file which can't be read is reported, and its mappings are kept.
+	write("mappings.csv", "not a mapping\n")
+	w = reload("POST")
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("The reload of an invalid file responded with %v, not %v.", w.Code, http.StatusUnprocessableEntity)
+	}
+	exlID, _, _ = l.load().lookupID(t.Context(), 651520)
+	if exlID != 996515203405159 {
+		t.Fatalf("After a failed reload, bibID 651520 was mapped to %v, not 996515203405159.", exlID)
+	}
+}
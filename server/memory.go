@@ -0,0 +1,68 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"math"
+	"math/bits"
+	"runtime"
+)
+
+const (
+	// mapSlotBytes is the size of a slot in a map[uint32]uint64: the key, padding to align the value, and the value.
+	mapSlotBytes uint64 = 4 + 4 + 8
+
+	// mapControlBytes is the control byte kept for each slot.
+	mapControlBytes uint64 = 1
+
+	// mapLoadFactor is the fraction of slots which are filled before a map grows.
+	mapLoadFactor float64 = 7.0 / 8.0
+)
+
+// memoryUsage reports the memory used by the mapping store, in bytes.
+type memoryUsage struct {
+	MappingsEstimatedBytes uint64 `json:"mappingsEstimatedBytes"`         // Estimated from the number of mappings.
+	MappingsMeasuredBytes  uint64 `json:"mappingsMeasuredBytes"`          // The growth of the heap while loading the mappings.
+	ReverseMeasuredBytes   uint64 `json:"reverseMeasuredBytes,omitempty"` // The growth of the heap while building the reverse index.
+	HeapAllocBytes         uint64 `json:"heapAllocBytes"`                 // The heap currently allocated, including the store.
+	SysBytes               uint64 `json:"sysBytes"`                       // The memory obtained from the operating system.
+}
+
+// estimateMapBytes estimates the memory used by a map[uint32]uint64 with the number of entries,
+// ignoring the small fixed overhead of the map itself. Maps allocate slots in powers of two.
+func estimateMapBytes(entries int) uint64 {
+	if entries == 0 {
+		return 0
+	}
+	needed := uint64(math.Ceil(float64(entries) / mapLoadFactor))
+	slots := uint64(1) << bits.Len64(needed-1)
+	return slots * (mapSlotBytes + mapControlBytes)
+}
+
+// heapAlloc returns the bytes allocated on the heap, after collecting garbage so the figure is of live objects.
+func heapAlloc() uint64 {
+	runtime.GC()
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return m.HeapAlloc
+}
+
+// heapGrowth returns how much the heap has grown since before, or zero if it has shrunk.
+func heapGrowth(before uint64) uint64 {
+	after := heapAlloc()
+	if after < before {
+		return 0
+	}
+	return after - before
+}
+
+// current returns the usage with the current heap and system memory.
+func (u memoryUsage) current() memoryUsage {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	u.HeapAllocBytes = m.HeapAlloc
+	u.SysBytes = m.Sys
+	return u
+}
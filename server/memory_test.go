@@ -0,0 +1,44 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"testing"
+)
+
+func TestEstimateMapBytes(t *testing.T) {
+	var tests = []struct {
+		entries  int
+		expected uint64
+	}{
+		{0, 0},
+		{7, 8 * 17},
+		{8, 16 * 17},
+		{1000000, 2097152 * 17},
+	}
+	for _, tt := range tests {
+		estimate := estimateMapBytes(tt.entries)
+		if estimate != tt.expected {
+			t.Fatalf("estimateMapBytes(%v) returned %v, not %v.", tt.entries, estimate, tt.expected)
+		}
+	}
+}
+
+func TestHeapGrowth(t *testing.T) {
+	before := heapAlloc()
+	m := make(map[uint32]uint64, 100000)
+	for i := range uint32(100000) {
+		m[i] = uint64(i)
+	}
+	growth := heapGrowth(before)
+	// The measurement should be in the neighbourhood of the estimate.
+	estimate := estimateMapBytes(len(m))
+	if growth < estimate/2 || growth > estimate*2 {
+		t.Fatalf("The heap grew by %v bytes for a map estimated at %v bytes.", growth, estimate)
+	}
+	if len(m) != 100000 {
+		t.Fatal("The map was collected early.")
+	}
+}
@@ -0,0 +1,192 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/cu-library/permanentdetour/mapping"
+)
+
+const (
+	// mergeCommand is the subcommand which combines mapping files into one.
+	mergeCommand string = "merge"
+
+	// duplicateError, duplicateFirst, and duplicateLast are the policies for a bibID mapped to different
+	// MMS IDs by the merged files. Either the merge fails, or the first or last mapping is kept.
+	duplicateError string = "error"
+	duplicateFirst string = "first"
+	duplicateLast  string = "last"
+)
+
+// duplicatePolicies are the policies for bibIDs mapped to different MMS IDs.
+var duplicatePolicies = []string{duplicateError, duplicateFirst, duplicateLast}
+
+// mergedMapping is a mapping kept by a merge, and where it was found.
+type mergedMapping struct {
+	exlID    uint64
+	location mappingLocation
+}
+
+// mergeResult is the mappings merged from mapping files.
+type mergeResult struct {
+	mappings  map[uint32]mergedMapping
+	lines     int
+	identical int      // Duplicate mappings of bibIDs to the same MMS ID, which were dropped.
+	conflicts []string // The bibIDs mapped to different MMS IDs, and which mapping was kept.
+}
+
+// mergeMappingFiles merges the mappings in the files at paths. Lines which map a bibID to the same MMS ID
+// as an earlier line are dropped, and bibIDs mapped to different MMS IDs are handled by the policy.
+// Invalid lines are errors.
+func mergeMappingFiles(paths []string, policy string) (mergeResult, error) {
+	result := mergeResult{mappings: map[uint32]mergedMapping{}}
+	if !slices.Contains(duplicatePolicies, policy) {
+		return result, fmt.Errorf("Unknown duplicate policy %q, expected one of %v", policy, duplicatePolicies)
+	}
+	for i, path := range paths {
+		err := result.mergeFile(paths, i, policy)
+		if err != nil {
+			return result, fmt.Errorf("Could not merge %v, %w", path, err)
+		}
+	}
+	return result, nil
+}
+
+// mergeFile merges the mappings in the file paths[index].
+func (m *mergeResult) mergeFile(paths []string, index int, policy string) error {
+	path := paths[index]
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	lnum := 0
+	for scanner.Scan() {
+		lnum++
+		m.lines++
+		bibID, exlID, err := mapping.ParseLine(scanner.Text())
+		var malformed *mapping.MalformedLineError
+		if errors.As(err, &malformed) {
+			malformed.Path, malformed.Line = path, lnum
+			return malformed
+		}
+		current := mergedMapping{exlID: exlID, location: mappingLocation{file: index, line: lnum}}
+		previous, present := m.mappings[bibID]
+		switch {
+		case !present:
+			m.mappings[bibID] = current
+		case previous.exlID == exlID:
+			m.identical++
+		case policy == duplicateError:
+			return fmt.Errorf("Bib ID %v on line %v is mapped to %v, but to %v at %v:%v", bibID, lnum, exlID, previous.exlID, paths[previous.location.file], previous.location.line)
+		default:
+			kept := previous
+			if policy == duplicateLast {
+				kept = current
+				m.mappings[bibID] = current
+			}
+			m.conflicts = append(m.conflicts, fmt.Sprintf("%v:%v: Bib ID %v is mapped to %v, but to %v at %v:%v, keeping %v",
+				path, lnum, bibID, exlID, previous.exlID, paths[previous.location.file], previous.location.line, kept.exlID))
+		}
+	}
+	return scanner.Err()
+}
+
+// writeMappings writes the mappings to w in order of bibID, one on each line, like 996515203405158,a651520.
+func writeMappings(w io.Writer, mappings map[uint32]mergedMapping) error {
+	bw := bufio.NewWriter(w)
+	for _, bibID := range slices.Sorted(maps.Keys(mappings)) {
+		_, err := fmt.Fprintf(bw, "%v,a%v\n", mappings[bibID].exlID, bibID)
+		if err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// writeMappingFile replaces the file at path with the mappings written by write, like a merged CSV file
+// or a snapshot. The file is only replaced once it has been written completely.
+func writeMappingFile(path string, write func(io.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("Could not create mapping file %v, %w", path, err)
+	}
+	defer os.Remove(tmp.Name())
+	// Mapping files are read by the server, which may run as another user.
+	err = tmp.Chmod(0644)
+	if err != nil {
+		tmp.Close()
+		return fmt.Errorf("Could not write mapping file %v, %w", path, err)
+	}
+	err = write(tmp)
+	if err != nil {
+		tmp.Close()
+		return fmt.Errorf("Could not write mapping file %v, %w", path, err)
+	}
+	err = tmp.Close()
+	if err != nil {
+		return fmt.Errorf("Could not write mapping file %v, %w", path, err)
+	}
+	err = os.Rename(tmp.Name(), path)
+	if err != nil {
+		return fmt.Errorf("Could not write mapping file %v, %w", path, err)
+	}
+	return nil
+}
+
+// runMerge merges the mapping files given in args into one, written to the -o file or stdout, and reports
+// the conflicts resolved and a summary to stderr. It returns the exit status, 1 if the merge failed,
+// or 2 if the arguments are invalid.
+func runMerge(stdout, stderr io.Writer, args []string) int {
+	flags := flag.NewFlagSet(mergeCommand, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	output := flags.String("o", "", "The file to write the merged mappings to. Written to standard output when empty or -.")
+	policy := flags.String("duplicates", duplicateError, "What to do with a bibID mapped to different MMS IDs: error, or keep the first or last mapping.")
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: permanentdetour %v [-o combined.csv] [-duplicates error|first|last] file...\n", mergeCommand)
+		flags.PrintDefaults()
+	}
+	err := flags.Parse(args)
+	if err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	result, err := mergeMappingFiles(flags.Args(), *policy)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	for _, conflict := range result.conflicts {
+		fmt.Fprintln(stderr, conflict)
+	}
+	if *output == "" || *output == "-" {
+		err = writeMappings(stdout, result.mappings)
+	} else {
+		err = writeMappingFile(*output, func(w io.Writer) error {
+			return writeMappings(w, result.mappings)
+		})
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	fmt.Fprintf(stderr, "Merged %v mappings from %v lines in %v files. %v identical duplicates were dropped, and %v conflicting duplicates resolved.\n",
+		len(result.mappings), result.lines, flags.NArg(), result.identical, len(result.conflicts))
+	return 0
+}
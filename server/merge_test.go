@@ -0,0 +1,132 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cu-library/permanentdetour/mapping"
+)
+
+func TestRunMerge(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		err := os.WriteFile(path, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	first := write("first.csv", "996515213405158,a651521-01ocul_qu\r\n996515203405158,a651520-01ocul_qu,extra\r\n")
+	second := write("second.csv", "996515203405158,651520\n996515223405158,a651522-01ocul_qu\n996515213405159,a651521-01ocul_qu\n")
+	invalid := write("invalid.csv", "not a mapping\n")
+
+	var tests = []struct {
+		name   string
+		args   []string
+		status int
+		stdout string
+		stderr []string
+	}{
+		{
+			"first",
+			[]string{"-duplicates", "first", first, second},
+			0,
+			"996515203405158,a651520\n996515213405158,a651521\n996515223405158,a651522\n",
+			[]string{
+				second + ":3: Bib ID 651521 is mapped to 996515213405159, but to 996515213405158 at " + first + ":1, keeping 996515213405158",
+				"Merged 3 mappings from 5 lines in 2 files. 1 identical duplicates were dropped, and 1 conflicting duplicates resolved.",
+			},
+		},
+		{
+			"last",
+			[]string{"-duplicates=last", "-o", "-", first, second},
+			0,
+			"996515203405158,a651520\n996515213405159,a651521\n996515223405158,a651522\n",
+			[]string{
+				second + ":3: Bib ID 651521 is mapped to 996515213405159, but to 996515213405158 at " + first + ":1, keeping 996515213405159",
+				"Merged 3 mappings",
+			},
+		},
+		{
+			"error",
+			[]string{first, second},
+			1,
+			"",
+			[]string{"Could not merge " + second + ", Bib ID 651521 on line 3 is mapped to 996515213405159, but to 996515213405158 at " + first + ":1"},
+		},
+		{
+			"invalid",
+			[]string{first, invalid},
+			1,
+			"",
+			[]string{"Could not merge " + invalid + ", Unable to process line 1 'not a mapping'"},
+		},
+		{
+			"unknown policy",
+			[]string{"-duplicates", "newest", first},
+			1,
+			"",
+			[]string{`Unknown duplicate policy "newest"`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr strings.Builder
+			status := runMerge(&stdout, &stderr, tt.args)
+			if status != tt.status {
+				t.Fatalf("runMerge() returned %v, not %v. Output:\n%v", status, tt.status, stderr.String())
+			}
+			if stdout.String() != tt.stdout {
+				t.Fatalf("The merged mappings were\n%v\nnot\n%v", stdout.String(), tt.stdout)
+			}
+			lines := strings.Split(strings.TrimSpace(stderr.String()), "\n")
+			if len(lines) != len(tt.stderr) {
+				t.Fatalf("The report had %v lines, not %v. Output:\n%v", len(lines), len(tt.stderr), stderr.String())
+			}
+			for i, expected := range tt.stderr {
+				if !strings.HasPrefix(lines[i], expected) {
+					t.Fatalf("Line %v of the report didn't start with %q. Output:\n%v", i+1, expected, stderr.String())
+				}
+			}
+		})
+	}
+}
+
+func TestRunMergeOutputFile(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "input.csv")
+	err := os.WriteFile(input, []byte("996515213405158,a651521-01ocul_qu\n996515203405158,a651520-01ocul_qu\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := filepath.Join(dir, "combined.csv")
+	var stdout, stderr strings.Builder
+	status := runMerge(&stdout, &stderr, []string{"-o", output, input})
+	if status != 0 {
+		t.Fatalf("runMerge() returned %v, not 0. Output:\n%v", status, stderr.String())
+	}
+	content, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "996515203405158,a651520\n996515213405158,a651521\n"
+	if string(content) != expected {
+		t.Fatalf("The merged file was\n%v\nnot\n%v", string(content), expected)
+	}
+	// The merged file can be loaded.
+	m := map[uint32]uint64{}
+	err = mapping.LoadFile(m, output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m) != 2 {
+		t.Fatalf("%v mappings were loaded from the merged file, not 2.", len(m))
+	}
+}
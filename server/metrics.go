@@ -0,0 +1,448 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// metricsPath is the path of the Prometheus metrics endpoint.
+	metricsPath string = "/metrics"
+
+	// metricsPrefix is the prefix of the names of all metrics.
+	metricsPrefix string = "permanentdetour_"
+)
+
+// defaultLatencyBuckets are the upper bounds, in seconds, of the handler latency histogram buckets.
+var defaultLatencyBuckets = []float64{0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1}
+
+// defaultLookupBuckets are the upper bounds, in seconds, of the mapping lookup time histogram buckets.
+// Lookups take nanoseconds, so the buckets are much finer than those of the handler latency.
+var defaultLookupBuckets = []float64{0.00000001, 0.000000025, 0.00000005, 0.0000001, 0.00000025, 0.0000005, 0.000001, 0.0000025, 0.000005, 0.00001, 0.0001}
+
+// Metrics counts the requests served by the Detourer. A nil *Metrics discards everything.
+type Metrics struct {
+	requests    atomic.Uint64
+	redirects   counterVec // Redirects by rule.
+	unmapped    atomic.Uint64
+	parseErrors atomic.Uint64
+	rateLimited atomic.Uint64
+	panics      atomic.Uint64 // Requests whose handlers panicked.
+	canary      atomic.Uint64 // Redirects to the canary Primo view.
+	latency     *histogram
+	lookups     *histogram    // Time taken to look up bibIDs in the mapping.
+	lookupErrs  atomic.Uint64 // Lookups which couldn't finish, like those past the request's deadline.
+	mappings    atomic.Int64
+	primoUp     atomic.Int64  // 1 if the last Primo check passed, 0 if it failed, or -1 if Primo isn't checked.
+	primoCheck  atomic.Int64  // Nanoseconds taken by the last Primo check.
+	statsd      *statsdClient // The StatsD client which also receives the metrics, or nil.
+
+	tenantsMu sync.RWMutex
+	tenants   map[string]*tenantMetrics // Counts of the requests served for each tenant, by name.
+}
+
+// tenantMetrics counts the requests served for a tenant, so each can be reported separately.
+type tenantMetrics struct {
+	redirects   counterVec // Redirects by rule.
+	unmapped    atomic.Uint64
+	parseErrors atomic.Uint64
+}
+
+// NewMetrics returns an empty Metrics.
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		redirects: counterVec{values: map[string]*atomic.Uint64{}},
+		latency:   newHistogram(defaultLatencyBuckets),
+		lookups:   newHistogram(defaultLookupBuckets),
+		tenants:   map[string]*tenantMetrics{},
+	}
+	m.primoUp.Store(-1)
+	return m
+}
+
+// tenant returns the counters of the named tenant, or nil for requests which aren't a tenant's.
+func (m *Metrics) tenant(name string) *tenantMetrics {
+	if name == "" {
+		return nil
+	}
+	m.tenantsMu.RLock()
+	t, present := m.tenants[name]
+	m.tenantsMu.RUnlock()
+	if present {
+		return t
+	}
+	m.tenantsMu.Lock()
+	defer m.tenantsMu.Unlock()
+	t, present = m.tenants[name]
+	if !present {
+		t = &tenantMetrics{redirects: counterVec{values: map[string]*atomic.Uint64{}}}
+		m.tenants[name] = t
+	}
+	return t
+}
+
+// tenantTags returns the StatsD tags of a tenant's requests.
+func tenantTags(tenant string, tags ...string) []string {
+	if tenant == "" {
+		return tags
+	}
+	return append(tags, "tenant:"+tenant)
+}
+
+// observeRequest records a request, whether it was redirected, refused, or served by the APIs or the admin endpoints.
+func (m *Metrics) observeRequest() {
+	if m == nil {
+		return
+	}
+	m.requests.Add(1)
+	m.statsd.count("requests", 1)
+}
+
+// observeRedirect records a request for the tenant which was redirected by rule, and how long it took.
+// The tenant is empty for requests which aren't a tenant's.
+func (m *Metrics) observeRedirect(tenant, rule string, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	m.redirects.inc(rule)
+	m.latency.observe(duration.Seconds())
+	if t := m.tenant(tenant); t != nil {
+		t.redirects.inc(rule)
+	}
+	m.statsd.count("redirects", 1, tenantTags(tenant, "rule:"+rule)...)
+	m.statsd.timing("request_duration", duration, tenantTags(tenant)...)
+}
+
+// countRequests returns middleware which counts every request in m, which may be nil.
+func countRequests(m *Metrics) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			m.observeRequest()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// observeLookup records how long a lookup in the mapping took.
+func (m *Metrics) observeLookup(duration time.Duration) {
+	if m == nil {
+		return
+	}
+	m.lookups.observe(duration.Seconds())
+}
+
+// observeLookupError records a lookup in the mapping which couldn't finish.
+func (m *Metrics) observeLookupError() {
+	if m == nil {
+		return
+	}
+	m.lookupErrs.Add(1)
+	m.statsd.count("lookup_errors", 1)
+}
+
+// observeCanary records a redirect to the canary Primo view.
+func (m *Metrics) observeCanary() {
+	if m == nil {
+		return
+	}
+	m.canary.Add(1)
+	m.statsd.count("canary_redirects", 1)
+}
+
+// observeUnmapped records a lookup for the tenant of a bibID which isn't in the mapping.
+func (m *Metrics) observeUnmapped(tenant string) {
+	if m == nil {
+		return
+	}
+	m.unmapped.Add(1)
+	if t := m.tenant(tenant); t != nil {
+		t.unmapped.Add(1)
+	}
+	m.statsd.count("unmapped", 1, tenantTags(tenant)...)
+}
+
+// observeParseError records a request for the tenant with a bibID which couldn't be parsed.
+func (m *Metrics) observeParseError(tenant string) {
+	if m == nil {
+		return
+	}
+	m.parseErrors.Add(1)
+	if t := m.tenant(tenant); t != nil {
+		t.parseErrors.Add(1)
+	}
+	m.statsd.count("parse_errors", 1, tenantTags(tenant)...)
+}
+
+// observeRateLimited records a request which was refused because the client made too many requests.
+func (m *Metrics) observeRateLimited() {
+	if m == nil {
+		return
+	}
+	m.rateLimited.Add(1)
+	m.statsd.count("rate_limited", 1)
+}
+
+// observePanic records a request whose handler panicked.
+func (m *Metrics) observePanic() {
+	if m == nil {
+		return
+	}
+	m.panics.Add(1)
+	m.statsd.count("panics", 1)
+}
+
+// setMappings records the number of loaded mappings.
+func (m *Metrics) setMappings(n int) {
+	if m == nil {
+		return
+	}
+	m.mappings.Store(int64(n))
+	m.statsd.gauge("mappings", int64(n))
+}
+
+// observePrimoCheck records whether a Primo reachability check passed, and how long it took.
+func (m *Metrics) observePrimoCheck(up bool, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	var value int64
+	if up {
+		value = 1
+	}
+	m.primoUp.Store(value)
+	m.primoCheck.Store(int64(duration))
+	m.statsd.gauge("primo_up", value)
+	m.statsd.timing("primo_check_duration", duration)
+}
+
+// ServeHTTP writes the metrics in the Prometheus text exposition format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
+
+// WriteTo writes the metrics in the Prometheus text exposition format.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	ew := &errWriter{w: w}
+	writeMetricHeader(ew, "requests_total", "counter", "Requests received, including those refused, and those for the APIs and admin endpoints.")
+	fmt.Fprintf(ew, "%vrequests_total %v\n", metricsPrefix, m.requests.Load())
+	writeMetricHeader(ew, "redirects_total", "counter", "Redirects by the rule which built them.")
+	m.redirects.each(func(rule string, value uint64) {
+		fmt.Fprintf(ew, "%vredirects_total{rule=%q} %v\n", metricsPrefix, rule, value)
+	})
+	writeMetricHeader(ew, "unmapped_total", "counter", "Record requests for bibIDs which aren't in the mapping.")
+	fmt.Fprintf(ew, "%vunmapped_total %v\n", metricsPrefix, m.unmapped.Load())
+	writeMetricHeader(ew, "parse_errors_total", "counter", "Record requests with bibIDs which couldn't be parsed.")
+	fmt.Fprintf(ew, "%vparse_errors_total %v\n", metricsPrefix, m.parseErrors.Load())
+	writeMetricHeader(ew, "lookup_errors_total", "counter", "Mapping lookups which couldn't finish, like those past the request's deadline.")
+	fmt.Fprintf(ew, "%vlookup_errors_total %v\n", metricsPrefix, m.lookupErrs.Load())
+	writeMetricHeader(ew, "rate_limited_total", "counter", "Requests refused because the client made too many requests.")
+	fmt.Fprintf(ew, "%vrate_limited_total %v\n", metricsPrefix, m.rateLimited.Load())
+	writeMetricHeader(ew, "panics_total", "counter", "Requests whose handlers panicked, which were answered with a 500 status.")
+	fmt.Fprintf(ew, "%vpanics_total %v\n", metricsPrefix, m.panics.Load())
+	writeMetricHeader(ew, "canary_redirects_total", "counter", "Redirects to the canary Primo view.")
+	fmt.Fprintf(ew, "%vcanary_redirects_total %v\n", metricsPrefix, m.canary.Load())
+	writeMetricHeader(ew, "mappings", "gauge", "BibID to Ex Libris ID mappings loaded.")
+	fmt.Fprintf(ew, "%vmappings %v\n", metricsPrefix, m.mappings.Load())
+	if up := m.primoUp.Load(); up >= 0 {
+		writeMetricHeader(ew, "primo_up", "gauge", "Whether the last Primo reachability check passed.")
+		fmt.Fprintf(ew, "%vprimo_up %v\n", metricsPrefix, up)
+		writeMetricHeader(ew, "primo_check_duration_seconds", "gauge", "Time taken by the last Primo reachability check.")
+		fmt.Fprintf(ew, "%vprimo_check_duration_seconds %v\n", metricsPrefix, time.Duration(m.primoCheck.Load()).Seconds())
+	}
+	m.writeTenants(ew)
+	writeMetricHeader(ew, "request_duration_seconds", "histogram", "Time taken to handle redirect requests.")
+	m.latency.write(ew, "request_duration_seconds")
+	writeMetricHeader(ew, "lookup_duration_seconds", "histogram", "Time taken to look up bibIDs in the mapping.")
+	m.lookups.write(ew, "lookup_duration_seconds")
+	return ew.n, ew.err
+}
+
+// writeTenants writes the counters of each tenant, labelled with its name. Nothing is written without tenants.
+func (m *Metrics) writeTenants(w io.Writer) {
+	m.tenantsMu.RLock()
+	names := make([]string, 0, len(m.tenants))
+	for name := range m.tenants {
+		names = append(names, name)
+	}
+	m.tenantsMu.RUnlock()
+	if len(names) == 0 {
+		return
+	}
+	sort.Strings(names)
+	tenants := make([]*tenantMetrics, len(names))
+	for i, name := range names {
+		tenants[i] = m.tenant(name)
+	}
+	writeMetricHeader(w, "tenant_redirects_total", "counter", "Redirects for each tenant by the rule which built them.")
+	for i, t := range tenants {
+		t.redirects.each(func(rule string, value uint64) {
+			fmt.Fprintf(w, "%vtenant_redirects_total{tenant=%q,rule=%q} %v\n", metricsPrefix, names[i], rule, value)
+		})
+	}
+	writeMetricHeader(w, "tenant_unmapped_total", "counter", "Record requests for each tenant for bibIDs which aren't in the mapping.")
+	for i, t := range tenants {
+		fmt.Fprintf(w, "%vtenant_unmapped_total{tenant=%q} %v\n", metricsPrefix, names[i], t.unmapped.Load())
+	}
+	writeMetricHeader(w, "tenant_parse_errors_total", "counter", "Record requests for each tenant with bibIDs which couldn't be parsed.")
+	for i, t := range tenants {
+		fmt.Fprintf(w, "%vtenant_parse_errors_total{tenant=%q} %v\n", metricsPrefix, names[i], t.parseErrors.Load())
+	}
+}
+
+// writeMetricHeader writes the HELP and TYPE lines for a metric.
+func writeMetricHeader(w io.Writer, name, metricType, help string) {
+	fmt.Fprintf(w, "# HELP %v%v %v\n", metricsPrefix, name, help)
+	fmt.Fprintf(w, "# TYPE %v%v %v\n", metricsPrefix, name, metricType)
+}
+
+// counterVec is a set of counters distinguished by a label value.
+type counterVec struct {
+	mu     sync.RWMutex
+	values map[string]*atomic.Uint64
+}
+
+// inc increments the counter for the label value.
+func (c *counterVec) inc(label string) {
+	c.mu.RLock()
+	value, present := c.values[label]
+	c.mu.RUnlock()
+	if !present {
+		c.mu.Lock()
+		value, present = c.values[label]
+		if !present {
+			value = new(atomic.Uint64)
+			c.values[label] = value
+		}
+		c.mu.Unlock()
+	}
+	value.Add(1)
+}
+
+// each calls f for each label value and count, in label order.
+func (c *counterVec) each(f func(label string, value uint64)) {
+	c.mu.RLock()
+	labels := make([]string, 0, len(c.values))
+	for label := range c.values {
+		labels = append(labels, label)
+	}
+	c.mu.RUnlock()
+	sort.Strings(labels)
+	for _, label := range labels {
+		c.mu.RLock()
+		value := c.values[label].Load()
+		c.mu.RUnlock()
+		f(label, value)
+	}
+}
+
+// histogram counts observations in cumulative buckets.
+type histogram struct {
+	mu      sync.Mutex
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+// newHistogram returns an empty histogram with the bucket upper bounds.
+func newHistogram(buckets []float64) *histogram {
+	return &histogram{
+		buckets: buckets,
+		counts:  make([]uint64, len(buckets)),
+	}
+}
+
+// observe adds an observation to the histogram.
+func (h *histogram) observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, bound := range h.buckets {
+		if v <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// latencySummary summarizes a latency histogram, in seconds. The quantiles are estimated from the buckets.
+type latencySummary struct {
+	Count uint64  `json:"count"`
+	Mean  float64 `json:"meanSeconds"`
+	P50   float64 `json:"p50Seconds"`
+	P90   float64 `json:"p90Seconds"`
+	P99   float64 `json:"p99Seconds"`
+}
+
+// summary returns the count, mean, and estimated quantiles of the observations.
+func (h *histogram) summary() latencySummary {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := latencySummary{Count: h.count}
+	if h.count == 0 {
+		return s
+	}
+	s.Mean = h.sum / float64(h.count)
+	s.P50 = h.quantile(0.5)
+	s.P90 = h.quantile(0.9)
+	s.P99 = h.quantile(0.99)
+	return s
+}
+
+// quantile estimates the q quantile by interpolating linearly within the bucket it falls in, like Prometheus.
+// Observations above the largest bucket are estimated as the largest bound. The caller must hold the lock.
+func (h *histogram) quantile(q float64) float64 {
+	rank := q * float64(h.count)
+	lower, below := 0.0, uint64(0)
+	for i, bound := range h.buckets {
+		if float64(h.counts[i]) >= rank {
+			inBucket := h.counts[i] - below
+			if inBucket == 0 {
+				return bound
+			}
+			return lower + (bound-lower)*(rank-float64(below))/float64(inBucket)
+		}
+		lower, below = bound, h.counts[i]
+	}
+	return lower
+}
+
+// write writes the histogram's buckets, sum, and count.
+func (h *histogram) write(w io.Writer, name string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, bound := range h.buckets {
+		fmt.Fprintf(w, "%v%v_bucket{le=%q} %v\n", metricsPrefix, name, strconv.FormatFloat(bound, 'g', -1, 64), h.counts[i])
+	}
+	fmt.Fprintf(w, "%v%v_bucket{le=\"+Inf\"} %v\n", metricsPrefix, name, h.count)
+	fmt.Fprintf(w, "%v%v_sum %v\n", metricsPrefix, name, strconv.FormatFloat(h.sum, 'g', -1, 64))
+	fmt.Fprintf(w, "%v%v_count %v\n", metricsPrefix, name, h.count)
+}
+
+// errWriter is a helper which tracks the bytes written and the first error, so many writes can be checked at once.
+type errWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (ew *errWriter) Write(p []byte) (int, error) {
+	if ew.err != nil {
+		return 0, ew.err
+	}
+	n, err := ew.w.Write(p)
+	ew.n += int64(n)
+	ew.err = err
+	return n, err
+}
@@ -0,0 +1,79 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"math"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cu-library/permanentdetour/mapping"
+)
+
+func TestMetrics(t *testing.T) {
+	d := Detourer{
+		store:   mapping.NewMap(map[uint32]uint64{651520: 996515203405158}),
+		primo:   "ocul-qu.primo.exlibrisgroup.com",
+		vid:     "01OCUL_QU:QU_DEFAULT",
+		metrics: NewMetrics(),
+	}
+	for _, request := range []string{
+		"/vwebv/holdingsInfo?bibId=651520",
+		"/vwebv/holdingsInfo?bibId=1",
+		"/vwebv/holdingsInfo?bibId=invalid",
+		"/vwebv/search?searchArg=spiders&searchCode=NAME",
+		"/vwebv/my",
+		"/",
+	} {
+		observed(d).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", request, nil))
+	}
+	// Every request is counted, including those which aren't redirected.
+	h := Chain(observed(d), countRequests(d.metrics))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/", nil))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/favicon.ico", nil))
+
+	w := httptest.NewRecorder()
+	d.metrics.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body := w.Body.String()
+	for _, expected := range []string{
+		"permanentdetour_requests_total 3\n",
+		"permanentdetour_redirects_total{rule=\"default\"} 2\n",
+		"permanentdetour_redirects_total{rule=\"patron\"} 1\n",
+		"permanentdetour_redirects_total{rule=\"record\"} 3\n",
+		"permanentdetour_redirects_total{rule=\"search\"} 1\n",
+		"permanentdetour_unmapped_total 1\n",
+		"permanentdetour_parse_errors_total 1\n",
+		"permanentdetour_request_duration_seconds_bucket{le=\"+Inf\"} 7\n",
+		"permanentdetour_request_duration_seconds_count 7\n",
+		"permanentdetour_lookup_duration_seconds_count 2\n",
+	} {
+		if !strings.Contains(body, expected) {
+			t.Fatalf("The metrics did not contain %q:\n%v", expected, body)
+		}
+	}
+}
+
+func TestHistogramSummary(t *testing.T) {
+	h := newHistogram([]float64{1, 2, 4})
+	if h.summary() != (latencySummary{}) {
+		t.Fatalf("An empty histogram's summary was %+v.", h.summary())
+	}
+	for _, v := range []float64{0.5, 1.5, 1.5, 3} {
+		h.observe(v)
+	}
+	expected := latencySummary{Count: 4, Mean: 1.625, P50: 1.5, P90: 3.2, P99: 3.92}
+	s := h.summary()
+	if s.Count != expected.Count || s.Mean != expected.Mean ||
+		!approximately(s.P50, expected.P50) || !approximately(s.P90, expected.P90) || !approximately(s.P99, expected.P99) {
+		t.Fatalf("summary() returned %+v, not %+v.", s, expected)
+	}
+}
+
+// approximately reports whether a and b are equal, within floating point error.
+func approximately(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
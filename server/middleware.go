@@ -0,0 +1,110 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"runtime/debug"
+)
+
+// Middleware wraps a handler with a concern which applies to every request, like logging or rate limiting.
+type Middleware func(http.Handler) http.Handler
+
+// Chain returns h wrapped in the middleware, the first outermost, so it sees each request first and its response last.
+// Nil middleware are skipped, so middleware which are turned off can still be listed in place.
+//
+// The server chains its middleware in this order, which is recommended for servers which embed a Detourer:
+//
+//  1. TrustedProxies, so the rest see the client's address and scheme, not the load balancer's.
+//  2. AccessLog, so every response is logged, including refusals.
+//  3. IPFilter, so refused clients don't use up rate limits.
+//  4. RateLimit, so clients making too many requests are shed before any more work is done.
+//  5. RequestID, so the logs of the requests which are served can be correlated.
+//  6. Recovery, inside RequestID so a panic is logged with the request's ID, and inside AccessLog so the 500 is logged.
+//
+// Outside them all, the server counts every request in its Metrics, including those the middleware refuse.
+// Inside AccessLog, it records every request in the event log, if there is one, including those IPFilter and
+// RateLimit refuse.
+//
+// The Detourer's own redirects are traced, logged, and counted by the middleware returned by redirectObservers,
+// which the server chains around the Detourer alone, so they aren't applied to the API and admin endpoints.
+// They read the rule and branch which built each redirect from the outcome the Detourer leaves in the request's context.
+func Chain(h http.Handler, middleware ...Middleware) http.Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		if middleware[i] != nil {
+			h = middleware[i](h)
+		}
+	}
+	return h
+}
+
+// TrustedProxies returns middleware which takes the client's address and scheme from the X-Forwarded-For and
+// X-Forwarded-Proto headers of requests from the trusted prefixes.
+func TrustedProxies(trusted []netip.Prefix) Middleware {
+	return func(next http.Handler) http.Handler {
+		return withTrustedProxies(next, trusted)
+	}
+}
+
+// AccessLog returns middleware which writes a line for each request to w, in the Apache combined log format.
+func AccessLog(w io.Writer) Middleware {
+	return accessLog(w, nil)
+}
+
+// accessLog returns middleware which writes a line for each request to w, in the Apache combined log format,
+// with client addresses anonymized by anonymizer, if it isn't nil.
+func accessLog(w io.Writer, anonymizer *ipAnonymizer) Middleware {
+	return func(next http.Handler) http.Handler {
+		return newAccessLogger(next, w, anonymizer)
+	}
+}
+
+// IPFilter returns middleware which responds with a 403 status to clients outside the allowed prefixes,
+// if there are any, or inside the denied prefixes.
+func IPFilter(allow, deny []netip.Prefix) Middleware {
+	return func(next http.Handler) http.Handler {
+		return withIPFilter(next, allow, deny)
+	}
+}
+
+// RateLimit returns middleware which responds with a 429 status to clients, outside the exempt prefixes,
+// making more than rate requests a second, after a burst of burst requests. Refusals are counted in metrics,
+// which may be nil.
+func RateLimit(rate float64, burst int, exempt []netip.Prefix, metrics *Metrics) Middleware {
+	return newRateLimiter(rate, burst, exempt, metrics).limit
+}
+
+// RequestID returns middleware which assigns each request an ID, or honours a valid incoming X-Request-ID,
+// and returns it in the X-Request-ID response header.
+func RequestID() Middleware {
+	return withRequestID
+}
+
+// Recovery returns middleware which recovers from panics in the handlers it wraps, logs them with the stack,
+// and responds with a 500 status, so one bad request doesn't drop the connection without a response.
+// Panics are counted in metrics, which may be nil.
+func Recovery(metrics *Metrics) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				recovered := recover()
+				if recovered == nil {
+					return
+				}
+				// The server aborts the response quietly on this panic, as it's used on purpose.
+				if recovered == http.ErrAbortHandler {
+					panic(recovered)
+				}
+				metrics.observePanic()
+				slog.ErrorContext(r.Context(), "Recovered from a panic.", "method", r.Method, "path", r.URL.Path, "panic", recovered, "stack", string(debug.Stack()))
+				http.Error(w, "Internal server error.", http.StatusInternalServerError)
+			}()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
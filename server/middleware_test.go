@@ -0,0 +1,61 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestChain(t *testing.T) {
+	var order []string
+	named := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	h := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		order = append(order, "handler")
+	}), named("first"), nil, named("second"))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if strings.Join(order, ",") != "first,second,handler" {
+		t.Fatalf("The chain served the request in the order %v, not first, second, handler.", order)
+	}
+}
+
+func TestRecovery(t *testing.T) {
+	metrics := NewMetrics()
+	h := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("broken")
+	}), RequestID(), Recovery(metrics))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/vwebv/holdingsInfo?bibId=1", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("A panicking handler responded with %v, not %v.", w.Code, http.StatusInternalServerError)
+	}
+	if w.Header().Get(requestIDHeader) == "" {
+		t.Fatal("A panicking handler's response has no request ID.")
+	}
+	if metrics.panics.Load() != 1 {
+		t.Fatalf("%v panics were counted, not 1.", metrics.panics.Load())
+	}
+}
+
+func TestRecoveryAbort(t *testing.T) {
+	h := Recovery(nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+	defer func() {
+		if recover() != http.ErrAbortHandler {
+			t.Fatal("Recovery didn't pass on http.ErrAbortHandler.")
+		}
+	}()
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+}
@@ -0,0 +1,92 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	// missesCommand is the subcommand which downloads the unmapped bibIDs requested from a running instance.
+	missesCommand string = "misses"
+
+	// defaultMissesTimeout is the time allowed to download the unmapped bibIDs.
+	defaultMissesTimeout time.Duration = time.Minute
+)
+
+// runMisses downloads the unmapped bibIDs requested from the running instance at -target, and writes them as CSV
+// to the -o file or stdout, most requested first, for cataloguers to work through. A summary is reported to stderr.
+// It returns the exit status, 1 if the download failed, or 2 if the arguments are invalid.
+func runMisses(stdout, stderr io.Writer, args []string) int {
+	flags := flag.NewFlagSet(missesCommand, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	target := flags.String("target", "", "The URL of the running instance's -admin-address, like http://127.0.0.1:9090. Required.")
+	output := flags.String("o", "", "The file to write the unmapped bibIDs to. Written to standard output when empty or -.")
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: permanentdetour %v -target http://host:9090 [-o misses.csv]\n", missesCommand)
+		flags.PrintDefaults()
+	}
+	err := flags.Parse(args)
+	if err != nil {
+		return 2
+	}
+	base, err := url.Parse(*target)
+	if err != nil || (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" || flags.NArg() > 0 {
+		flags.Usage()
+		return 2
+	}
+
+	report, err := fetchUnmapped(context.Background(), base.JoinPath(unmappedPath))
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	if *output == "" || *output == "-" {
+		err = writeUnmappedCSV(stdout, report.Unmapped)
+	} else {
+		err = writeMappingFile(*output, func(w io.Writer) error {
+			return writeUnmappedCSV(w, report.Unmapped)
+		})
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	fmt.Fprintf(stderr, "Downloaded %v unmapped bibIDs. %v requests for bibIDs over the instance's -unmapped-limit weren't tracked.\n", len(report.Unmapped), report.Dropped)
+	return 0
+}
+
+// fetchUnmapped returns the report of the unmapped bibIDs served at u.
+func fetchUnmapped(ctx context.Context, u *url.URL) (unmappedReport, error) {
+	var report unmappedReport
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return report, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", "permanentdetour/"+version)
+	client := &http.Client{Timeout: defaultMissesTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return report, fmt.Errorf("Could not download the unmapped bibIDs, %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		// The endpoint isn't served when unmapped bibIDs aren't tracked.
+		return report, fmt.Errorf("Could not download the unmapped bibIDs, %v responded with %v", u, resp.Status)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&report)
+	if err != nil {
+		return report, fmt.Errorf("Could not read the unmapped bibIDs from %v, %w", u, err)
+	}
+	return report, nil
+}
@@ -0,0 +1,75 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunMisses(t *testing.T) {
+	u := newUnmappedTracker(2)
+	seen := time.Date(2019, 10, 10, 13, 55, 36, 0, time.UTC)
+	u.record(651520, "", seen)
+	u.record(42, "", seen)
+	u.record(42, "", seen.Add(time.Hour))
+	// The limit has been reached, so this bibID isn't tracked.
+	u.record(7, "", seen)
+	mux := http.NewServeMux()
+	mux.HandleFunc(unmappedPath, u.serveUnmapped)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	expected := "bibId,count,firstSeen,lastSeen\n" +
+		"42,2,2019-10-10T13:55:36Z,2019-10-10T14:55:36Z\n" +
+		"651520,1,2019-10-10T13:55:36Z,2019-10-10T13:55:36Z\n"
+
+	var stdout, stderr strings.Builder
+	status := runMisses(&stdout, &stderr, []string{"-target", server.URL})
+	if status != 0 {
+		t.Fatalf("runMisses() returned %v, not 0. Output:\n%v", status, stderr.String())
+	}
+	if stdout.String() != expected {
+		t.Fatalf("The CSV was\n%v\nnot\n%v", stdout.String(), expected)
+	}
+	if !strings.HasPrefix(stderr.String(), "Downloaded 2 unmapped bibIDs. 1 requests") {
+		t.Fatalf("The summary was %q.", stderr.String())
+	}
+
+	output := filepath.Join(t.TempDir(), "misses.csv")
+	status = runMisses(&stdout, &stderr, []string{"-target", server.URL, "-o", output})
+	if status != 0 {
+		t.Fatalf("runMisses() to a file returned %v, not 0. Output:\n%v", status, stderr.String())
+	}
+	content, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != expected {
+		t.Fatalf("The file was\n%v\nnot\n%v", string(content), expected)
+	}
+
+	var tests = []struct {
+		args     []string
+		expected int
+	}{
+		{[]string{}, 2},
+		{[]string{"-target", "localhost:8877"}, 2},
+		{[]string{"-target", server.URL, "extra"}, 2},
+		// The instance doesn't track unmapped bibIDs.
+		{[]string{"-target", server.URL + "/missing"}, 1},
+	}
+	for _, tt := range tests {
+		status := runMisses(&stdout, &stderr, tt.args)
+		if status != tt.expected {
+			t.Errorf("runMisses(%q) returned %v, not %v.", tt.args, status, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,21 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"net/http"
+
+	"github.com/cu-library/permanentdetour/detour"
+)
+
+// normalizeMobileRequest returns a copy of the request with its mobile WebVoyage URL normalized to the desktop URL,
+// so the same rules can be used to translate them. If the request isn't for the mobile interface, it is returned unchanged.
+func normalizeMobileRequest(r *http.Request) *http.Request {
+	u, mobile := detour.NormalizeMobileURL(r.URL)
+	if !mobile {
+		return r
+	}
+	return requestWithURL(r, u)
+}
@@ -0,0 +1,29 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNormalizeMobileRequest(t *testing.T) {
+	var tests = []struct {
+		request  string
+		expected string
+	}{
+		{"/vwebv/holdingsInfo?bibId=1", "/vwebv/holdingsInfo?bibId=1"},
+		{"/vwebv/m/holdingsInfo?bibId=1&sk=mobile", "/vwebv/holdingsInfo?bibId=1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.request, func(t *testing.T) {
+			normalized := normalizeMobileRequest(httptest.NewRequest("GET", tt.request, nil))
+			if normalized.URL.String() != tt.expected {
+				t.Fatalf("normalizeMobileRequest(\"%v\") returned \"%v\", not \"%v\"", tt.request, normalized.URL, tt.expected)
+			}
+		})
+	}
+}
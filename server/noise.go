@@ -0,0 +1,33 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"strings"
+)
+
+// defaultNoisePaths are paths which browsers and crawlers request on their own, which aren't catalogue links.
+// Paths ending in * match any path with that prefix.
+var defaultNoisePaths = []string{
+	"/favicon.ico",
+	"/apple-touch-icon*",
+	"/browserconfig.xml",
+	"/site.webmanifest",
+	"/manifest.json",
+	"/sitemap.xml",
+	"/ads.txt",
+	"/.well-known/*",
+}
+
+// isNoisePath reports whether the path matches one of the noise paths.
+func isNoisePath(path string, noisePaths []string) bool {
+	for _, noise := range noisePaths {
+		prefix, isPrefix := strings.CutSuffix(noise, "*")
+		if (isPrefix && strings.HasPrefix(path, prefix)) || path == noise {
+			return true
+		}
+	}
+	return false
+}
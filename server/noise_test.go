@@ -0,0 +1,35 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestIsNoisePath(t *testing.T) {
+	var tests = []struct {
+		path  string
+		noise bool
+	}{
+		{"/favicon.ico", true},
+		{"/apple-touch-icon.png", true},
+		{"/apple-touch-icon-120x120-precomposed.png", true},
+		{"/.well-known/security.txt", true},
+		{"/wp-login.php", true},
+		{"/favicon.ico.bak", false},
+		{"/vwebv/holdingsInfo", false},
+		{"/", false},
+	}
+
+	noisePaths := slices.Concat(defaultNoisePaths, []string{"/wp-login.php"})
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if isNoisePath(tt.path, noisePaths) != tt.noise {
+				t.Fatalf("isNoisePath(\"%v\") returned %v, not %v", tt.path, !tt.noise, tt.noise)
+			}
+		})
+	}
+}
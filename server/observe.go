@@ -0,0 +1,222 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// redirectOutcomeKey is the context key under which the outcome of a request served by a Detourer is stored.
+type redirectOutcomeKey struct{}
+
+// redirectOutcome is what a Detourer did with a request. The Detourer fills it in, and the middleware chained
+// around it by redirectObservers read it once the response is written, to trace, log, and count the request.
+type redirectOutcome struct {
+	start      time.Time
+	translated bool              // Whether the request was translated, rather than refused.
+	d          Detourer          // The Detourer which translated the request, with its trackers nil in debug mode.
+	result     TranslationResult // The translation of the request.
+	debug      bool              // Whether the translation was described instead of redirected to.
+	held       bool              // Whether the request was held at the maintenance page instead of redirected.
+	status     int               // The status of the response, unless the translation was described.
+}
+
+// withRedirectOutcome returns the request with ctx, which is derived from the request's context, and an empty
+// redirectOutcome in it, and the outcome. If ctx already has one, from middleware further out, that outcome is
+// returned. The request is only copied once, however its context is changed.
+func withRedirectOutcome(r *http.Request, ctx context.Context) (*http.Request, *redirectOutcome) {
+	o, ok := ctx.Value(redirectOutcomeKey{}).(*redirectOutcome)
+	if !ok {
+		o = &redirectOutcome{start: time.Now()}
+		ctx = context.WithValue(ctx, redirectOutcomeKey{}, o)
+	}
+	if ctx != r.Context() {
+		r = r.WithContext(ctx)
+	}
+	return r, o
+}
+
+// reportOutcome records what the Detourer did with the translated request, for the middleware observing it,
+// if there are any.
+func reportOutcome(r *http.Request, outcome redirectOutcome) {
+	o, ok := r.Context().Value(redirectOutcomeKey{}).(*redirectOutcome)
+	if !ok {
+		return
+	}
+	outcome.start, outcome.translated = o.start, true
+	*o = outcome
+}
+
+// redirected reports whether the request was redirected or held for maintenance, rather than described.
+func (o *redirectOutcome) redirected() bool {
+	return o.translated && !o.debug
+}
+
+// redirectObservers returns the middleware which trace, log, and count the requests served by a Detourer, in the
+// order they are chained around it. They read the rule and branch which translated each request from the outcome the
+// Detourer leaves in the request's context, so ServeHTTP itself only translates and redirects.
+func redirectObservers() []Middleware {
+	return []Middleware{traceRedirects, logRedirects, measureRedirects, countRules, trackUnmapped}
+}
+
+// traceRedirects is middleware which serves each request in a server span, continuing any trace the request is
+// part of, with the translation's rule, target, and bibID as its attributes.
+func traceRedirects(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := startRequestSpan(r.Context(), propagation.HeaderCarrier(r.Header), "redirect")
+		defer span.End()
+		r, o := withRedirectOutcome(r, ctx)
+		next.ServeHTTP(w, r)
+		if !o.translated {
+			return
+		}
+		result := o.result
+		if result.record {
+			switch result.Branch {
+			case "invalid", "lookup-error":
+				span.RecordError(result.Err)
+			default:
+				span.SetAttributes(attrBibID.Int64(int64(result.BibID)), attrMappingHit.Bool(result.Found))
+			}
+		}
+		span.SetAttributes(attrRule.String(result.Rule), attrTargetHost.String(result.Target.Host))
+	})
+}
+
+// logRedirects is middleware which logs invalid and unmapped bibIDs and failed lookups, even in debug mode, and each
+// redirect and request held for maintenance, in the categories which aren't suppressed.
+func logRedirects(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r, o := withRedirectOutcome(r, r.Context())
+		next.ServeHTTP(w, r)
+		if !o.translated {
+			return
+		}
+		d, result := o.d, o.result
+		logger := d.logger()
+		if result.Canary {
+			logger = logger.With("canary", true)
+		}
+		switch {
+		case !result.record:
+		case result.Branch == "invalid":
+			if ok, skipped := d.logs.allow(logInvalid, result.URL.Query().Get("bibId"), o.start); ok {
+				logger.WarnContext(r.Context(), "Invalid bibID.", "url", result.URL.String(), "err", result.Err, "skipped", skipped)
+			}
+		case result.Branch == "lookup-error":
+			if ok, skipped := d.logs.allow(logLookupError, strconv.FormatUint(uint64(result.BibID), 10), o.start); ok {
+				logger.WarnContext(r.Context(), "Could not look up bibID.", "bibID", result.BibID, "err", result.Err, "skipped", skipped)
+			}
+		case !result.Found:
+			if ok, skipped := d.logs.allow(logNotFound, strconv.FormatUint(uint64(result.BibID), 10), o.start); ok {
+				logger.InfoContext(r.Context(), "BibID not found.", "bibID", result.BibID, "skipped", skipped)
+			}
+		}
+		if !o.redirected() {
+			return
+		}
+		message, category := "Redirected.", logRedirected
+		if o.held {
+			message, category = "Held for maintenance.", logMaintenance
+		}
+		if !d.logs.enabled(category) {
+			return
+		}
+		logger.InfoContext(r.Context(), message,
+			"method", r.Method,
+			"client", d.anonymizer.anonymize(clientIP(r)),
+			"path", result.URL.Path,
+			"rule", result.Rule,
+			"target", result.Target.String(),
+			"status", o.status,
+			"duration", time.Since(o.start),
+		)
+	})
+}
+
+// measureRedirects is middleware which counts invalid and unmapped bibIDs, and redirects and requests held for
+// maintenance with their durations, in the Detourer's metrics.
+func measureRedirects(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r, o := withRedirectOutcome(r, r.Context())
+		next.ServeHTTP(w, r)
+		if !o.translated {
+			return
+		}
+		d, result := o.d, o.result
+		if result.record {
+			switch {
+			case result.Branch == "invalid":
+				d.metrics.observeParseError(d.tenant)
+			case result.Branch == "lookup-error":
+			case !result.Found:
+				d.metrics.observeUnmapped(d.tenant)
+			}
+		}
+		if !o.redirected() {
+			return
+		}
+		if o.held {
+			d.metrics.observeRedirect(d.tenant, "maintenance", time.Since(o.start))
+			return
+		}
+		d.metrics.observeRedirect(d.tenant, result.Rule, time.Since(o.start))
+		if result.Canary {
+			d.metrics.observeCanary()
+		}
+	})
+}
+
+// countRules is middleware which counts redirects by the rule and branch which built them, and by path,
+// for the rules endpoint and the dashboard.
+func countRules(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r, o := withRedirectOutcome(r, r.Context())
+		next.ServeHTTP(w, r)
+		if !o.redirected() || o.held {
+			return
+		}
+		o.d.rules.record(o.result.Rule, o.result.Branch, o.start)
+		o.d.paths.record(o.result.URL.Path)
+	})
+}
+
+// recordEvents returns middleware which records every request in the event log, with the status of its response,
+// and the rule and branch which translated it, if a Detourer did. It's nil if there's no event log. The server chains
+// it around all of its handlers, so requests which are refused, described, or served by the APIs are also recorded.
+func recordEvents(events *eventLog) Middleware {
+	if events == nil {
+		return nil
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r, o := withRedirectOutcome(r, r.Context())
+			rec := &statusRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r)
+			status := rec.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			events.record(r, o.result, status, o.start)
+		})
+	}
+}
+
+// trackUnmapped is middleware which tracks requests for bibIDs which aren't mapped, with their referrers.
+func trackUnmapped(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r, o := withRedirectOutcome(r, r.Context())
+		next.ServeHTTP(w, r)
+		if !o.translated || !o.result.hasBibID() || o.result.Found || o.result.Branch == "lookup-error" {
+			return
+		}
+		o.d.unmapped.record(o.result.BibID, r.Referer(), o.start)
+	})
+}
@@ -0,0 +1,66 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cu-library/permanentdetour/mapping"
+)
+
+func TestRedirectObservers(t *testing.T) {
+	m, err := newMaintenance("", 5*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := Detourer{
+		store:       mapping.NewMap(map[uint32]uint64{651520: 996515203405158}),
+		primo:       "ocul-qu.primo.exlibrisgroup.com",
+		vid:         "01OCUL_QU:QU_DEFAULT",
+		metrics:     NewMetrics(),
+		rules:       newRuleHits(),
+		unmapped:    newUnmappedTracker(defaultUnmappedLimit),
+		maintenance: m,
+	}
+	counts := func() map[string]uint64 {
+		counts := map[string]uint64{}
+		d.metrics.redirects.each(func(rule string, value uint64) {
+			counts[rule] = value
+		})
+		return counts
+	}
+
+	// Without the observers, ServeHTTP only redirects.
+	d.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/vwebv/holdingsInfo?bibId=1", nil))
+	if len(counts()) != 0 || len(d.rules.report()) != 0 || len(d.unmapped.report().Unmapped) != 0 {
+		t.Fatal("ServeHTTP counted a redirect without the middleware which count them.")
+	}
+
+	h := observed(d)
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/vwebv/holdingsInfo?bibId=1", nil))
+	// Refused and described requests aren't counted.
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/vwebv/holdingsInfo?bibId=1", nil))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/vwebv/holdingsInfo?bibId=651520&_detour=debug", nil))
+	// Requests held for maintenance are counted under maintenance, but not by rule.
+	m.set(true)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/vwebv/holdingsInfo?bibId=651520", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("During maintenance, the response status was %v, not 503.", w.Code)
+	}
+
+	if c := counts(); len(c) != 2 || c["record"] != 1 || c["maintenance"] != 1 {
+		t.Fatalf("The redirects counted were %v, not 1 record and 1 maintenance.", c)
+	}
+	if report := d.rules.report(); len(report) != 1 || report[0].Branch != "unmapped" || report[0].Hits != 1 {
+		t.Fatalf("The rules counted were %+v, not 1 unmapped record.", report)
+	}
+	if unmapped := d.unmapped.report().Unmapped; len(unmapped) != 1 || unmapped[0].BibID != 1 {
+		t.Fatalf("The unmapped bibIDs tracked were %+v, not 1.", unmapped)
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/cu-library/permanentdetour/mapping"
+)
+
+// Option sets a setting of a Detourer made with NewDetourer.
+type Option func(*Detourer) error
+
+// NewDetourer returns a Detourer which redirects record links to the MMS IDs of their bibIDs in store,
+// with the options applied in order. Redirects need the Primo instance, set with WithPrimo or WithPrimoHost,
+// and the view, set with WithVID. Settings without an option keep their defaults.
+func NewDetourer(store mapping.Store, opts ...Option) (Detourer, error) {
+	d := Detourer{store: store, lookupTimeout: defaultLookupTimeout}
+	for _, opt := range opts {
+		err := opt(&d)
+		if err != nil {
+			return Detourer{}, err
+		}
+	}
+	return d, nil
+}
+
+// WithPrimo redirects to the Primo instance with the subdomain, like ocul-qu for ocul-qu.primo.exlibrisgroup.com.
+func WithPrimo(subdomain string) Option {
+	return func(d *Detourer) error {
+		d.setPrimoSubdomain(subdomain)
+		return nil
+	}
+}
+
+// WithPrimoHost redirects to the Primo instance at a custom host, like search.library.example.edu,
+// or a scheme and host, like http://search.library.example.edu. The sandbox is reached through the Ex Libris host
+// set with WithPrimo, so WithPrimo has to come first.
+func WithPrimoHost(host string) Option {
+	return func(d *Detourer) error {
+		err := d.setPrimoHost(host)
+		if err != nil {
+			return fmt.Errorf("Could not set the Primo host, %w", err)
+		}
+		return nil
+	}
+}
+
+// WithVID sets the vid parameter of redirects to Primo, the view, like 01OCUL_QU:QU_DEFAULT.
+func WithVID(vid string) Option {
+	return func(d *Detourer) error {
+		d.vid = vid
+		return nil
+	}
+}
+
+// WithFallback redirects requests which match no rule to the absolute URL target, instead of the Primo search form.
+func WithFallback(target string) Option {
+	return func(d *Detourer) error {
+		fallback, err := parseRedirectTarget(target)
+		if err != nil {
+			return fmt.Errorf("Invalid fallback, %w", err)
+		}
+		d.fallback = fallback
+		return nil
+	}
+}
+
+// WithRedirectStatus sends redirects with the status, one of redirectStatuses, instead of defaultRedirectStatus.
+func WithRedirectStatus(status int) Option {
+	return func(d *Detourer) error {
+		err := checkRedirectStatus(status)
+		if err != nil {
+			return fmt.Errorf("Invalid redirect status, %w", err)
+		}
+		d.status = status
+		return nil
+	}
+}
+
+// WithSandbox redirects to the Primo sandbox instead of production, unless a request asks otherwise.
+func WithSandbox(sandbox bool) Option {
+	return func(d *Detourer) error {
+		d.sandbox = sandbox
+		return nil
+	}
+}
+
+// WithProxyHosts unwraps the starting point URLs of the EZproxy hosts before translating them.
+func WithProxyHosts(hosts ...string) Option {
+	return func(d *Detourer) error {
+		d.proxyHosts = hosts
+		return nil
+	}
+}
+
+// WithMethods translates requests with the methods, instead of defaultMethods.
+func WithMethods(methods ...string) Option {
+	return func(d *Detourer) error {
+		d.methods = make([]string, 0, len(methods))
+		for _, method := range methods {
+			d.methods = append(d.methods, strings.ToUpper(method))
+		}
+		return nil
+	}
+}
+
+// WithNoisePaths answers requests for the paths with 404 Not Found, as well as defaultNoisePaths, instead of translating them.
+func WithNoisePaths(paths ...string) Option {
+	return func(d *Detourer) error {
+		d.noisePaths = slices.Concat(defaultNoisePaths, paths)
+		return nil
+	}
+}
+
+// WithRobotsTag sets the X-Robots-Tag header of redirects, like noindex.
+func WithRobotsTag(tag string) Option {
+	return func(d *Detourer) error {
+		d.robotsTag = tag
+		return nil
+	}
+}
+
+// WithBatchLimit sets the maximum number of bibIDs in a batch lookup API request, instead of defaultBatchLimit.
+func WithBatchLimit(limit int) Option {
+	return func(d *Detourer) error {
+		d.batchLimit = limit
+		return nil
+	}
+}
+
+// WithLookupTimeout sets the longest a request waits for its mapping lookups, instead of defaultLookupTimeout.
+// A record link whose lookup doesn't finish in time is redirected to the search form. There's no limit when it's 0.
+func WithLookupTimeout(timeout time.Duration) Option {
+	return func(d *Detourer) error {
+		d.lookupTimeout = timeout
+		return nil
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cu-library/permanentdetour/mapping"
+)
+
+func TestNewDetourer(t *testing.T) {
+	d, err := NewDetourer(mapping.NewMap(map[uint32]uint64{651520: 996515203405158}),
+		WithPrimo("ocul-qu"),
+		WithPrimoHost("search.library.queensu.ca"),
+		WithVID("01OCUL_QU:QU_DEFAULT"),
+		WithFallback("https://library.queensu.ca/search"),
+		WithRedirectStatus(http.StatusFound),
+		WithMethods("get"),
+		WithNoisePaths("/old-opac/*"),
+		WithRobotsTag("noindex"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		method   string
+		target   string
+		status   int
+		location string
+	}{
+		{"GET", "/vwebv/holdingsInfo?bibId=651520", http.StatusFound, "https://search.library.queensu.ca/discovery/fulldisplay?docid=alma996515203405158&vid=01OCUL_QU%3AQU_DEFAULT"},
+		{"GET", "/unknown", http.StatusFound, "https://library.queensu.ca/search"},
+		{"GET", "/old-opac/index.html", http.StatusNotFound, ""},
+		{"GET", "/favicon.ico", http.StatusNotFound, ""},
+		{"HEAD", "/vwebv/holdingsInfo?bibId=651520", http.StatusMethodNotAllowed, ""},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		d.ServeHTTP(w, httptest.NewRequest(tt.method, tt.target, nil))
+		if w.Code != tt.status || w.Header().Get("Location") != tt.location {
+			t.Fatalf("%v %v responded with %v %q, not %v %q.", tt.method, tt.target, w.Code, w.Header().Get("Location"), tt.status, tt.location)
+		}
+		if tt.location != "" && w.Header().Get("X-Robots-Tag") != "noindex" {
+			t.Fatalf("%v %v responded with X-Robots-Tag %q, not noindex.", tt.method, tt.target, w.Header().Get("X-Robots-Tag"))
+		}
+	}
+}
+
+func TestNewDetourerInvalid(t *testing.T) {
+	var tests = []struct {
+		name string
+		opt  Option
+	}{
+		{"primo host", WithPrimoHost("ftp://search.library.queensu.ca")},
+		{"fallback", WithFallback("/search")},
+		{"redirect status", WithRedirectStatus(http.StatusOK)},
+	}
+	for _, tt := range tests {
+		_, err := NewDetourer(nil, WithPrimo("ocul-qu"), tt.opt)
+		if err == nil {
+			t.Fatalf("NewDetourer with an invalid %v returned no error.", tt.name)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// writePIDFile writes the process ID to the file at path, replacing it atomically so readers never see a partial file.
+func writePIDFile(path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("Could not create PID file %v, %w", path, err)
+	}
+	defer os.Remove(tmp.Name())
+	_, err = fmt.Fprintf(tmp, "%v\n", os.Getpid())
+	if err != nil {
+		tmp.Close()
+		return fmt.Errorf("Could not write PID file %v, %w", path, err)
+	}
+	err = tmp.Chmod(0644)
+	if err != nil {
+		tmp.Close()
+		return fmt.Errorf("Could not write PID file %v, %w", path, err)
+	}
+	err = tmp.Close()
+	if err != nil {
+		return fmt.Errorf("Could not write PID file %v, %w", path, err)
+	}
+	err = os.Rename(tmp.Name(), path)
+	if err != nil {
+		return fmt.Errorf("Could not write PID file %v, %w", path, err)
+	}
+	return nil
+}
+
+// removePIDFile removes the PID file at path, unless it has been replaced by another process,
+// like the new process after an upgrade.
+func removePIDFile(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("Could not read PID file %v, %w", path, err)
+	}
+	if string(bytes.TrimSpace(content)) != strconv.Itoa(os.Getpid()) {
+		return nil
+	}
+	err = os.Remove(path)
+	if err != nil {
+		return fmt.Errorf("Could not remove PID file %v, %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestPIDFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "permanentdetour.pid")
+	err := writePIDFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != strconv.Itoa(os.Getpid())+"\n" {
+		t.Fatalf("The PID file contained %q, not the process ID %v.", content, os.Getpid())
+	}
+	err = removePIDFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = os.Stat(path)
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("The PID file wasn't removed, %v.", err)
+	}
+}
+
+func TestRemovePIDFileReplaced(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "permanentdetour.pid")
+	// Another process, like the new process after an upgrade, has written its PID.
+	other := strconv.Itoa(os.Getpid()+1) + "\n"
+	err := os.WriteFile(path, []byte(other), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = removePIDFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("The replaced PID file was removed, %v.", err)
+	}
+	if string(content) != other {
+		t.Fatalf("The PID file contained %q, not %q.", content, other)
+	}
+}
@@ -0,0 +1,39 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPprofHandler(t *testing.T) {
+	var tests = []struct {
+		name          string
+		token         string
+		authorization string
+		status        int
+	}{
+		{"no token", "", "", http.StatusOK},
+		{"missing token", "secret", "", http.StatusUnauthorized},
+		{"wrong token", "secret", "Bearer guess", http.StatusUnauthorized},
+		{"correct token", "secret", "Bearer secret", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", pprofPath+"cmdline", nil)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			pprofHandler(tt.token).ServeHTTP(w, r)
+			if w.Code != tt.status {
+				t.Fatalf("The profiling endpoint returned %v, not %v.", w.Code, tt.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/cu-library/permanentdetour/detour"
+)
+
+// parsePrimoHost parses a Primo host, like search.library.queensu.ca, or a URL with only a scheme and host,
+// like http://search.library.queensu.ca, into the scheme and host. The scheme is https when not given.
+func parsePrimoHost(s string) (scheme, host string, _ error) {
+	if !strings.Contains(s, "://") {
+		s = "https://" + s
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return "", "", fmt.Errorf("Invalid Primo host %q, %w", s, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || strings.Trim(u.Path, "/") != "" || u.RawQuery != "" || u.User != nil {
+		return "", "", fmt.Errorf("Invalid Primo host %q, expected a host like search.library.example.edu, or a scheme and host", s)
+	}
+	return u.Scheme, u.Host, nil
+}
+
+// setPrimoSubdomain redirects to the Ex Libris hosted Primo instance with the subdomain, like ocul-qu.
+func (d *Detourer) setPrimoSubdomain(subdomain string) {
+	d.primo = fmt.Sprintf("%v.%v", subdomain, detour.PrimoDomain)
+	d.primoScheme = ""
+	d.exLibrisHost = ""
+}
+
+// setPrimoHost redirects to a custom Primo host, like a CNAME in front of Primo VE.
+// The Ex Libris host which was in use is kept for the sandbox, which isn't behind the custom host.
+func (d *Detourer) setPrimoHost(s string) error {
+	scheme, host, err := parsePrimoHost(s)
+	if err != nil {
+		return err
+	}
+	d.exLibrisHost = cmp.Or(d.exLibrisHost, d.primo)
+	d.primo, d.primoScheme = host, scheme
+	return nil
+}
+
+// primoURL returns the URL of the path on the Primo host.
+func (d Detourer) primoURL(path string) *url.URL {
+	return &url.URL{
+		Scheme: cmp.Or(d.primoScheme, "https"),
+		Host:   d.primo,
+		Path:   path,
+	}
+}
+
+// useSandboxHost redirects to the Primo sandbox of the Ex Libris host.
+func (d *Detourer) useSandboxHost() {
+	d.primo = sandboxHost(cmp.Or(d.exLibrisHost, d.primo))
+	d.primoScheme = ""
+}
+
+// checkPrimo returns an error if the Primo instance or vid isn't configured.
+func (d Detourer) checkPrimo() error {
+	if d.primo == "" {
+		return errors.New("Set -primo to the subdomain of the Primo instance, like ocul-qu, or -primo-host, or primo or primoHost in the configuration file")
+	}
+	if d.vid == "" {
+		return errors.New("Set -vid to the Primo view, like 01OCUL_QU:QU_DEFAULT, or vid in the configuration file")
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cu-library/permanentdetour/mapping"
+)
+
+func TestParsePrimoHost(t *testing.T) {
+	var tests = []struct {
+		input  string
+		scheme string
+		host   string
+		valid  bool
+	}{
+		{"search.library.queensu.ca", "https", "search.library.queensu.ca", true},
+		{"http://search.library.queensu.ca/", "http", "search.library.queensu.ca", true},
+		{"https://localhost:8443", "https", "localhost:8443", true},
+		{"ftp://search.library.queensu.ca", "", "", false},
+		{"https://search.library.queensu.ca/discovery", "", "", false},
+		{"", "", "", false},
+	}
+	for _, tt := range tests {
+		scheme, host, err := parsePrimoHost(tt.input)
+		if (err == nil) != tt.valid || scheme != tt.scheme || host != tt.host {
+			t.Fatalf("parsePrimoHost(%q) returned %q, %q, %v.", tt.input, scheme, host, err)
+		}
+	}
+}
+
+func TestCustomPrimoHost(t *testing.T) {
+	d := Detourer{
+		store: mapping.NewMap(map[uint32]uint64{651520: 996515203405158}),
+		vid:   "01OCUL_QU:QU_DEFAULT",
+	}
+	d.setPrimoSubdomain("ocul-qu")
+	err := d.setPrimoHost("http://search.library.queensu.ca")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		header   string
+		location string
+	}{
+		{"", "http://search.library.queensu.ca/discovery/fulldisplay?docid=alma996515203405158&vid=01OCUL_QU%3AQU_DEFAULT"},
+		{primoSandbox, "https://ocul-qu-psb.primo.exlibrisgroup.com/discovery/fulldisplay?docid=alma996515203405158&vid=01OCUL_QU%3AQU_DEFAULT"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/vwebv/holdingsInfo?bibId=651520", nil)
+		r.Header.Set(primoEnvironmentHeader, tt.header)
+		w := httptest.NewRecorder()
+		d.ServeHTTP(w, r)
+		if w.Header().Get("Location") != tt.location {
+			t.Fatalf("With header %q, the redirect was to %v, not %v.", tt.header, w.Header().Get("Location"), tt.location)
+		}
+	}
+	result, err := d.lookup(context.Background(), 651520)
+	if err != nil || result.URL != tests[0].location {
+		t.Fatalf("The lookup API returned %v, %v, not %v.", result.URL, err, tests[0].location)
+	}
+}
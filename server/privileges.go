@@ -0,0 +1,73 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+//go:build unix
+
+package server
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+// lookupIDs finds the user and group IDs to switch to. The user and group can be names or numeric IDs.
+// When the group is empty, the user's primary group is used.
+func lookupIDs(userName, groupName string) (uid, gid int, _ error) {
+	u, err := user.Lookup(userName)
+	if err != nil {
+		u, err = user.LookupId(userName)
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("Unknown user %v", userName)
+	}
+	uid, err = strconv.Atoi(u.Uid)
+	if err != nil {
+		return 0, 0, fmt.Errorf("User %v has a non-numeric ID %v", userName, u.Uid)
+	}
+	gidString := u.Gid
+	if groupName != "" {
+		g, err := user.LookupGroup(groupName)
+		if err != nil {
+			g, err = user.LookupGroupId(groupName)
+		}
+		if err != nil {
+			return 0, 0, fmt.Errorf("Unknown group %v", groupName)
+		}
+		gidString = g.Gid
+	}
+	gid, err = strconv.Atoi(gidString)
+	if err != nil {
+		return 0, 0, fmt.Errorf("Group %v has a non-numeric ID %v", groupName, gidString)
+	}
+	return uid, gid, nil
+}
+
+// dropPrivileges switches the process to the user and group, after the listeners on privileged ports are bound.
+// Supplementary groups are cleared and the group is set before the user, as an unprivileged user can't change groups.
+// It does nothing when the process is already running as the user and group, like after an upgrade.
+func dropPrivileges(uid, gid int) error {
+	if os.Getuid() == uid && os.Geteuid() == uid && os.Getgid() == gid && os.Getegid() == gid {
+		return nil
+	}
+	err := syscall.Setgroups([]int{})
+	if err != nil {
+		return fmt.Errorf("Could not clear supplementary groups, %w", err)
+	}
+	err = syscall.Setgid(gid)
+	if err != nil {
+		return fmt.Errorf("Could not set group ID to %v, %w", gid, err)
+	}
+	err = syscall.Setuid(uid)
+	if err != nil {
+		return fmt.Errorf("Could not set user ID to %v, %w", uid, err)
+	}
+	// Make sure root can't be regained.
+	if uid != 0 && syscall.Setuid(0) == nil {
+		return fmt.Errorf("Could regain root after setting user ID to %v", uid)
+	}
+	return nil
+}
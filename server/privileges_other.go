@@ -0,0 +1,22 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+//go:build !unix
+
+package server
+
+import "errors"
+
+// errNoSetuid is returned when switching users on a system without setuid.
+var errNoSetuid = errors.New("Switching users is only supported on Unix systems")
+
+// lookupIDs is only supported on Unix systems.
+func lookupIDs(userName, groupName string) (uid, gid int, _ error) {
+	return 0, 0, errNoSetuid
+}
+
+// dropPrivileges is only supported on Unix systems.
+func dropPrivileges(uid, gid int) error {
+	return errNoSetuid
+}
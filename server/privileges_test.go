@@ -0,0 +1,153 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+//go:build unix
+
+package server
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// privilegesHelperVariable is set when the test binary is run as a server process by TestPIDFileUpgradeUnprivileged.
+const privilegesHelperVariable string = "PERMANENTDETOUR_TEST_PRIVILEGES_HELPER"
+
+func TestLookupIDs(t *testing.T) {
+	current, err := user.Current()
+	if err != nil {
+		t.Skip("The current user can't be looked up.")
+	}
+	wantUID, _ := strconv.Atoi(current.Uid)
+	wantGID, _ := strconv.Atoi(current.Gid)
+
+	var tests = []struct {
+		name  string
+		user  string
+		group string
+	}{
+		{"by name", current.Username, ""},
+		{"by ID", current.Uid, ""},
+		{"with group ID", current.Uid, current.Gid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uid, gid, err := lookupIDs(tt.user, tt.group)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if uid != wantUID || gid != wantGID {
+				t.Fatalf("lookupIDs(%q, %q) returned %v:%v, not %v:%v.", tt.user, tt.group, uid, gid, wantUID, wantGID)
+			}
+		})
+	}
+
+	_, _, err = lookupIDs("permanentdetour-no-such-user", "")
+	if err == nil {
+		t.Fatal("lookupIDs should have returned an error for an unknown user, but it did not.")
+	}
+}
+
+func TestDropPrivilegesAlreadyDropped(t *testing.T) {
+	// Switching to the current user and group does nothing, even when unprivileged.
+	err := dropPrivileges(os.Getuid(), os.Getgid())
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPIDFileUpgradeUnprivileged(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("Dropping privileges requires root.")
+	}
+	nobody, err := user.Lookup("nobody")
+	if err != nil {
+		t.Skip("There's no nobody user to switch to.")
+	}
+	uid, _ := strconv.Atoi(nobody.Uid)
+	gid, _ := strconv.Atoi(nobody.Gid)
+	// The directory is writable by the user, like a systemd RuntimeDirectory.
+	dir := t.TempDir()
+	err = os.Chmod(filepath.Dir(dir), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chown(dir, uid, gid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "permanentdetour.pid")
+	// The test binary is copied where the user can run it.
+	binary, err := os.ReadFile(os.Args[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	executable := filepath.Join(t.TempDir(), "server.test")
+	err = os.WriteFile(executable, binary, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chmod(filepath.Dir(executable), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	run := func(credential *syscall.Credential, remove bool) int {
+		cmd := exec.Command(executable, "-test.run=^TestPrivilegesHelper$")
+		cmd.Env = append(os.Environ(), fmt.Sprintf("%v=%v,%v", privilegesHelperVariable, path, remove))
+		cmd.SysProcAttr = &syscall.SysProcAttr{Credential: credential}
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("The server process failed, %v: %s", err, out)
+		}
+		return cmd.ProcessState.Pid()
+	}
+
+	// The first process starts as root, and writes the PID file after switching to the user.
+	first := run(nil, false)
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if owner := info.Sys().(*syscall.Stat_t); int(owner.Uid) != uid || int(owner.Gid) != gid {
+		t.Fatalf("The PID file was owned by %v:%v, not %v:%v.", owner.Uid, owner.Gid, uid, gid)
+	}
+	content, _ := os.ReadFile(path)
+	if strings.TrimSpace(string(content)) != strconv.Itoa(first) {
+		t.Fatalf("The PID file contained %q, not the first process's ID %v.", content, first)
+	}
+
+	// The new process after an upgrade starts as the user, replaces the PID file, and removes it on shutdown.
+	run(&syscall.Credential{Uid: uint32(uid), Gid: uint32(gid)}, true)
+	_, err = os.Stat(path)
+	if err == nil {
+		t.Fatal("The new process didn't remove the PID file.")
+	}
+}
+
+// TestPrivilegesHelper is run as a server process by TestPIDFileUpgradeUnprivileged.
+func TestPrivilegesHelper(t *testing.T) {
+	settings, ok := os.LookupEnv(privilegesHelperVariable)
+	if !ok {
+		t.Skip("Only run by TestPIDFileUpgradeUnprivileged.")
+	}
+	path, remove, _ := strings.Cut(settings, ",")
+	err := dropPrivilegesAndWritePIDFile("nobody", "", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if remove == "true" {
+		err = removePIDFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// proxyHeaderTimeout is how long a connection has to send its PROXY protocol header.
+	proxyHeaderTimeout time.Duration = 5 * time.Second
+
+	// maxProxyV1HeaderLength is the maximum length of a PROXY protocol v1 header, including the CRLF.
+	maxProxyV1HeaderLength int = 107
+)
+
+// proxyV2Signature begins every PROXY protocol v2 header.
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// errNoProxyHeader is returned when a connection doesn't begin with a PROXY protocol header.
+var errNoProxyHeader = errors.New("connection did not begin with a PROXY protocol header")
+
+// proxyListener is a listener whose connections begin with a PROXY protocol v1 or v2 header,
+// which conveys the address of the client connected to the proxy.
+type proxyListener struct {
+	net.Listener
+}
+
+// Accept returns the next connection. The header is read on the connection's first use, not here,
+// so a slow client can't hold up the listener.
+func (l proxyListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &proxyConn{Conn: conn, r: bufio.NewReader(conn)}, nil
+}
+
+// proxyConn is a connection which begins with a PROXY protocol header.
+type proxyConn struct {
+	net.Conn
+	r *bufio.Reader
+
+	once       sync.Once
+	remoteAddr net.Addr
+	err        error
+}
+
+// readHeader reads the PROXY protocol header from the connection, once.
+func (c *proxyConn) readHeader() {
+	c.once.Do(func() {
+		c.Conn.SetReadDeadline(time.Now().Add(proxyHeaderTimeout))
+		defer c.Conn.SetReadDeadline(time.Time{})
+		c.remoteAddr, c.err = readProxyHeader(c.r)
+		if c.err != nil {
+			// A connection without a valid header can't be trusted, so isn't served.
+			c.Conn.Close()
+		}
+	})
+}
+
+func (c *proxyConn) Read(b []byte) (int, error) {
+	c.readHeader()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.r.Read(b)
+}
+
+// RemoteAddr returns the address of the client, as reported by the proxy.
+// If the proxy didn't report an address, as for its own health checks, the address of the proxy is returned.
+func (c *proxyConn) RemoteAddr() net.Addr {
+	c.readHeader()
+	if c.remoteAddr != nil {
+		return c.remoteAddr
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// readProxyHeader reads a PROXY protocol v1 or v2 header, returning the source address it conveys.
+// The address is nil for v1 UNKNOWN and v2 LOCAL headers.
+func readProxyHeader(r *bufio.Reader) (net.Addr, error) {
+	start, err := r.Peek(len(proxyV2Signature))
+	if err != nil && len(start) < len("PROXY ") {
+		return nil, errNoProxyHeader
+	}
+	switch {
+	case bytes.Equal(start, proxyV2Signature):
+		return readProxyV2Header(r)
+	case bytes.HasPrefix(start, []byte("PROXY ")):
+		return readProxyV1Header(r)
+	}
+	return nil, errNoProxyHeader
+}
+
+// readProxyV1Header reads a human readable PROXY protocol v1 header, like
+// PROXY TCP4 203.0.113.7 192.0.2.1 56324 443\r\n.
+func readProxyV1Header(r *bufio.Reader) (net.Addr, error) {
+	var line []byte
+	for len(line) < maxProxyV1HeaderLength {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("Could not read PROXY protocol header, %w", err)
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, errors.New("PROXY protocol v1 header is too long or not terminated by CRLF")
+	}
+	fields := strings.Split(string(line[:len(line)-2]), " ")
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, fmt.Errorf("Invalid PROXY protocol v1 header %q", line)
+	}
+	ip := net.ParseIP(fields[2])
+	if ip == nil || (fields[1] == "TCP4") != (ip.To4() != nil) {
+		return nil, fmt.Errorf("Invalid source address in PROXY protocol v1 header %q", line)
+	}
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid source port in PROXY protocol v1 header %q", line)
+	}
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+// readProxyV2Header reads a binary PROXY protocol v2 header.
+func readProxyV2Header(r *bufio.Reader) (net.Addr, error) {
+	header := make([]byte, len(proxyV2Signature)+4)
+	_, err := io.ReadFull(r, header)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read PROXY protocol header, %w", err)
+	}
+	versionCommand, family := header[12], header[13]
+	length := binary.BigEndian.Uint16(header[14:16])
+	if versionCommand>>4 != 2 {
+		return nil, fmt.Errorf("Unsupported PROXY protocol version %v", versionCommand>>4)
+	}
+	payload := make([]byte, length)
+	_, err = io.ReadFull(r, payload)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read PROXY protocol header, %w", err)
+	}
+	switch versionCommand & 0x0F {
+	case 0x0:
+		// LOCAL, sent by the proxy itself, like for health checks.
+		return nil, nil
+	case 0x1:
+		// PROXY
+	default:
+		return nil, fmt.Errorf("Unsupported PROXY protocol command %v", versionCommand&0x0F)
+	}
+	switch family {
+	case 0x11: // TCP over IPv4
+		if len(payload) < 12 {
+			return nil, errors.New("PROXY protocol v2 header is too short for IPv4 addresses")
+		}
+		return &net.TCPAddr{IP: net.IP(payload[0:4]), Port: int(binary.BigEndian.Uint16(payload[8:10]))}, nil
+	case 0x21: // TCP over IPv6
+		if len(payload) < 36 {
+			return nil, errors.New("PROXY protocol v2 header is too short for IPv6 addresses")
+		}
+		return &net.TCPAddr{IP: net.IP(payload[0:16]), Port: int(binary.BigEndian.Uint16(payload[32:34]))}, nil
+	}
+	// Other families, like UNIX sockets, have no useful client address.
+	return nil, nil
+}
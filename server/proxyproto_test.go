@@ -0,0 +1,97 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestReadProxyHeader(t *testing.T) {
+	v2 := func(command, family byte, payload string) string {
+		return string(proxyV2Signature) + string([]byte{0x20 | command, family, 0, byte(len(payload))}) + payload
+	}
+	ipv4 := "\xcb\x00\x71\x07" + "\xc0\x00\x02\x01" + "\xdc\x04" + "\x01\xbb"
+	ipv6 := "\x20\x01\x0d\xb8" + strings.Repeat("\x00", 11) + "\x01" + strings.Repeat("\x00", 16) + "\xdc\x04" + "\x01\xbb"
+
+	var tests = []struct {
+		name    string
+		header  string
+		addr    string
+		invalid bool
+	}{
+		{"v1 TCP4", "PROXY TCP4 203.0.113.7 192.0.2.1 56324 443\r\n", "203.0.113.7:56324", false},
+		{"v1 TCP6", "PROXY TCP6 2001:db8::1 2001:db8::2 56324 443\r\n", "[2001:db8::1]:56324", false},
+		{"v1 UNKNOWN", "PROXY UNKNOWN\r\n", "", false},
+		{"v1 mismatched family", "PROXY TCP4 2001:db8::1 2001:db8::2 56324 443\r\n", "", true},
+		{"v1 missing CRLF", "PROXY TCP4 203.0.113.7 192.0.2.1 56324 443\n", "", true},
+		{"v1 too long", "PROXY " + strings.Repeat("A", 120) + "\r\n", "", true},
+		{"v2 TCP4", v2(0x1, 0x11, ipv4), "203.0.113.7:56324", false},
+		{"v2 TCP6", v2(0x1, 0x21, ipv6), "[2001:db8::1]:56324", false},
+		{"v2 LOCAL", v2(0x0, 0x00, ""), "", false},
+		{"v2 short", v2(0x1, 0x11, ipv4[:6]), "", true},
+		{"no header", "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := bufio.NewReader(strings.NewReader(tt.header + "GET / HTTP/1.1\r\n"))
+			addr, err := readProxyHeader(r)
+			if tt.invalid {
+				if err == nil {
+					t.Fatalf("readProxyHeader(%q) should have returned an error, but it did not.", tt.header)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readProxyHeader(%q) returned an error, %v", tt.header, err)
+			}
+			if (addr == nil && tt.addr != "") || (addr != nil && addr.String() != tt.addr) {
+				t.Fatalf("readProxyHeader(%q) returned %v, not %q", tt.header, addr, tt.addr)
+			}
+			rest, _ := io.ReadAll(r)
+			if string(rest) != "GET / HTTP/1.1\r\n" {
+				t.Fatalf("readProxyHeader(%q) consumed more than the header, leaving %q", tt.header, rest)
+			}
+		})
+	}
+}
+
+func TestProxyListener(t *testing.T) {
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := proxyListener{inner}
+	defer l.Close()
+
+	go func() {
+		client, err := net.Dial("tcp", inner.Addr().String())
+		if err != nil {
+			return
+		}
+		defer client.Close()
+		io.WriteString(client, "PROXY TCP4 203.0.113.7 192.0.2.1 56324 443\r\nhello")
+	}()
+
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if conn.RemoteAddr().String() != "203.0.113.7:56324" {
+		t.Fatalf("The connection's remote address was %v, not 203.0.113.7:56324.", conn.RemoteAddr())
+	}
+	body, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "hello" {
+		t.Fatalf("Read %q from the connection, not %q.", body, "hello")
+	}
+}
@@ -0,0 +1,10 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+//go:build race
+
+package server
+
+// raceEnabled reports whether the tests are run with the race detector, which makes allocations of its own.
+const raceEnabled = true
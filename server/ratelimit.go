@@ -0,0 +1,105 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"math"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultRateLimitBurst is the default number of requests a client can make at once.
+	defaultRateLimitBurst int = 20
+
+	// rateLimitSweepInterval is how often idle clients are forgotten.
+	rateLimitSweepInterval time.Duration = time.Minute
+)
+
+// rateLimiter limits the rate of requests from each client with a token bucket.
+type rateLimiter struct {
+	rate    float64 // Tokens added to each bucket per second.
+	burst   float64 // The size of each bucket.
+	exempt  []netip.Prefix
+	metrics *Metrics
+	now     func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+// tokenBucket is the number of requests a client can make, as of a time.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter returns a rateLimiter which allows each client rate requests per second,
+// with bursts of up to burst requests. Clients in the exempt prefixes aren't limited.
+func newRateLimiter(rate float64, burst int, exempt []netip.Prefix, metrics *Metrics) *rateLimiter {
+	return &rateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		exempt:  exempt,
+		metrics: metrics,
+		now:     time.Now,
+		buckets: map[string]*tokenBucket{},
+	}
+}
+
+// allow takes a token from the client's bucket, if there is one. If not, it returns how long until there is.
+func (l *rateLimiter) allow(client string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	if now.Sub(l.lastSweep) >= rateLimitSweepInterval {
+		l.sweep(now)
+	}
+	b, present := l.buckets[client]
+	if !present {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[client] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// sweep forgets the buckets of clients which have been idle long enough for their bucket to refill.
+func (l *rateLimiter) sweep(now time.Time) {
+	for client, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, client)
+		}
+	}
+	l.lastSweep = now
+}
+
+// limit is middleware which responds with a 429 status to clients which have made too many requests.
+func (l *rateLimiter) limit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client := clientIP(r)
+		if inPrefixes(client, l.exempt) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		allowed, wait := l.allow(client)
+		if !allowed {
+			l.metrics.observeRateLimited()
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(w, "Too many requests.", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,72 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	exempt, err := parsePrefixes([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics := NewMetrics()
+	l := newRateLimiter(1, 2, exempt, metrics)
+	now := time.Date(2019, time.October, 10, 13, 55, 36, 0, time.UTC)
+	l.now = func() time.Time { return now }
+	handler := l.limit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	request := func(remoteAddr string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/vwebv/holdingsInfo?bibId=1", nil)
+		r.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	// The burst is allowed, then the client is limited.
+	for i := 0; i < 2; i++ {
+		if w := request("192.0.2.1:1234"); w.Code != http.StatusOK {
+			t.Fatalf("Request %v in the burst was refused with status %v.", i, w.Code)
+		}
+	}
+	w := request("192.0.2.1:1234")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("The request after the burst had status %v, not %v.", w.Code, http.StatusTooManyRequests)
+	}
+	if w.Header().Get("Retry-After") != "1" {
+		t.Fatalf("The Retry-After header was %q, not \"1\".", w.Header().Get("Retry-After"))
+	}
+	if metrics.rateLimited.Load() != 1 {
+		t.Fatalf("%v rate limited requests were counted, not 1.", metrics.rateLimited.Load())
+	}
+
+	// Other clients have their own buckets, and exempt clients are never limited.
+	if w := request("192.0.2.2:1234"); w.Code != http.StatusOK {
+		t.Fatalf("A request from another client was refused with status %v.", w.Code)
+	}
+	for i := 0; i < 5; i++ {
+		if w := request("10.0.0.5:1234"); w.Code != http.StatusOK {
+			t.Fatalf("A request from an exempt client was refused with status %v.", w.Code)
+		}
+	}
+
+	// A token is added each second.
+	now = now.Add(time.Second)
+	if w := request("192.0.2.1:1234"); w.Code != http.StatusOK {
+		t.Fatalf("The request after a token was added was refused with status %v.", w.Code)
+	}
+
+	// Idle clients are forgotten.
+	now = now.Add(rateLimitSweepInterval)
+	request("192.0.2.3:1234")
+	if len(l.buckets) != 1 {
+		t.Fatalf("%v clients are remembered after the sweep, not 1.", len(l.buckets))
+	}
+}
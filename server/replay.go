@@ -0,0 +1,140 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"bufio"
+	"cmp"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+)
+
+// replayCommand is the subcommand which translates the requests in an access log, to predict how they'd be redirected.
+const replayCommand string = "replay"
+
+// accessLogRequest matches the method and request URI of a line of an access log in the common or combined format,
+// like those written by Apache in front of the Voyager Web OPAC, or by -access-log.
+var accessLogRequest = regexp.MustCompile(`^\S+ \S+ \S+ \[[^\]]*\] "(\S+) (\S+)[^"]*"`)
+
+// replaySummary is the summary of the translations of the requests in an access log.
+type replaySummary struct {
+	lines         int
+	malformed     int            // The lines which aren't in the common or combined format.
+	skipped       int            // The requests which weren't GET or HEAD requests, which aren't redirected.
+	replayed      int            // The requests which were translated.
+	notRedirected int            // The requests which would be answered without a redirect, like robots.txt.
+	rules         map[string]int // The number of requests by the rule and branch which matched them.
+	targets       map[string]int // The number of requests by the URL they'd be redirected to.
+	unmapped      map[uint32]int // The number of requests for bibIDs which aren't mapped.
+}
+
+// runReplay translates the requests in the access log at path, or standard input if the path is -, with the requests'
+// host set to host, and writes a summary of the rules they match, the bibIDs which aren't mapped, and where they'd be
+// redirected to w. It returns the exit status, 1 if the log couldn't be read, or 2 if no log was given.
+func runReplay(w io.Writer, s translateSettings, host, path string) int {
+	if path == "" {
+		fmt.Fprintf(w, "Usage: permanentdetour %v [-replay-host host] [flag...] access.log [file...]\n", replayCommand)
+		return 2
+	}
+	rt, err := newTranslationRouter(s)
+	if err != nil {
+		fmt.Fprintln(w, err)
+		return 1
+	}
+	var input io.Reader = os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintf(w, "Could not open access log %v, %v\n", path, err)
+			return 1
+		}
+		defer file.Close()
+		input = file
+	}
+	summary, err := replay(rt, host, input)
+	if err != nil {
+		fmt.Fprintf(w, "Could not read access log %v, %v\n", path, err)
+		return 1
+	}
+	summary.write(w)
+	return 0
+}
+
+// replay translates the GET and HEAD requests in the access log read from r, and returns the summary.
+func replay(rt *router, host string, r io.Reader) (replaySummary, error) {
+	s := replaySummary{rules: map[string]int{}, targets: map[string]int{}, unmapped: map[uint32]int{}}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		s.lines++
+		match := accessLogRequest.FindStringSubmatch(scanner.Text())
+		if match == nil {
+			s.malformed++
+			continue
+		}
+		method, uri := match[1], match[2]
+		if method != http.MethodGet && method != http.MethodHead {
+			s.skipped++
+			continue
+		}
+		rawURL := uri
+		if host != "" && uri[0] == '/' {
+			rawURL = "http://" + host + uri
+		}
+		s.replayed++
+		tr, err := translateURL(rt, rawURL)
+		if err != nil {
+			s.notRedirected++
+			continue
+		}
+		rule := tr.Rule
+		if tr.Branch != "" {
+			rule += ", " + tr.Branch
+		}
+		s.rules[rule]++
+		s.targets[tr.Target.String()]++
+		if tr.hasBibID() && !tr.Found {
+			s.unmapped[tr.BibID]++
+		}
+	}
+	return s, scanner.Err()
+}
+
+// write writes the summary to w.
+func (s replaySummary) write(w io.Writer) {
+	fmt.Fprintf(w, "Lines:            %v\n", s.lines)
+	fmt.Fprintf(w, "Malformed lines:  %v\n", s.malformed)
+	fmt.Fprintf(w, "Skipped requests: %v\n", s.skipped)
+	fmt.Fprintf(w, "Replayed:         %v\n", s.replayed)
+	fmt.Fprintf(w, "Not redirected:   %v\n", s.notRedirected)
+	writeDistribution(w, "Rules:", s.rules, s.replayed-s.notRedirected)
+
+	unmapped := map[string]int{}
+	for bibID, count := range s.unmapped {
+		unmapped[strconv.FormatUint(uint64(bibID), 10)] = count
+	}
+	writeTop(w, "Most requested unmapped bibIDs:", unmapped)
+	writeTop(w, "Most common targets:", s.targets)
+}
+
+// writeTop writes up to statsListLimit of the counts, most common first.
+func writeTop(w io.Writer, title string, counts map[string]int) {
+	fmt.Fprintf(w, "%v %v\n", title, len(counts))
+	keys := slices.SortedFunc(maps.Keys(counts), func(a, b string) int {
+		return cmp.Or(cmp.Compare(counts[b], counts[a]), cmp.Compare(a, b))
+	})
+	for i, key := range keys {
+		if i == statsListLimit {
+			fmt.Fprintf(w, "  %v more were not listed\n", len(keys)-statsListLimit)
+			break
+		}
+		fmt.Fprintf(w, "  %v %v\n", counts[key], key)
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunReplay(t *testing.T) {
+	dir := t.TempDir()
+	mappings := filepath.Join(dir, "mappings.csv")
+	err := os.WriteFile(mappings, []byte("996515213405158,a651521-01ocul_qu\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accessLog := filepath.Join(dir, "access.log")
+	err = os.WriteFile(accessLog, []byte(`10.0.0.1 - - [10/Oct/2019:13:55:36 -0400] "GET /vwebv/holdingsInfo?bibId=651521 HTTP/1.1" 200 2326 "-" "Mozilla/5.0"
+10.0.0.1 - - [10/Oct/2019:13:55:37 -0400] "GET /vwebv/holdingsInfo?bibId=9 HTTP/1.1" 200 2326 "-" "Mozilla/5.0"
+10.0.0.2 - - [10/Oct/2019:13:55:37 -0400] "HEAD /vwebv/holdingsInfo?bibId=9 HTTP/1.0" 200 0
+10.0.0.1 - - [10/Oct/2019:13:55:38 -0400] "POST /vwebv/search HTTP/1.1" 200 2326 "-" "Mozilla/5.0"
+10.0.0.1 - - [10/Oct/2019:13:55:38 -0400] "GET /favicon.ico HTTP/1.1" 200 2326 "-" "Mozilla/5.0"
+Not a log line
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings := translateSettings{primo: "ocul-qu", vid: "01OCUL_QU:QU_DEFAULT", mappingFiles: []string{mappings}}
+
+	var out strings.Builder
+	status := runReplay(&out, settings, "catalogue.library.queensu.ca", accessLog)
+	if status != 0 {
+		t.Fatalf("runReplay() returned %v, not 0. Output:\n%v", status, out.String())
+	}
+	var tests = []string{
+		"Lines:            6",
+		"Malformed lines:  1",
+		"Skipped requests: 1",
+		"Replayed:         4",
+		"Not redirected:   1",
+		"  record, unmapped 2 (66.7%)",
+		"  record, mapped 1 (33.3%)",
+		"Most requested unmapped bibIDs: 1",
+		"  2 9",
+		"  1 https://ocul-qu.primo.exlibrisgroup.com/discovery/fulldisplay?docid=alma996515213405158&vid=01OCUL_QU%3AQU_DEFAULT",
+	}
+	lines := strings.Split(out.String(), "\n")
+	for _, expected := range tests {
+		found := false
+		for _, line := range lines {
+			if line == expected {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("The summary didn't have the line %q. Output:\n%v", expected, out.String())
+		}
+	}
+
+	status = runReplay(&out, settings, "", "")
+	if status != 2 {
+		t.Fatalf("runReplay() without an access log returned %v, not 2.", status)
+	}
+	status = runReplay(&out, settings, "", filepath.Join(dir, "missing.log"))
+	if status != 1 {
+		t.Fatalf("runReplay() of a missing access log returned %v, not 1.", status)
+	}
+}
@@ -0,0 +1,210 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+)
+
+// reportCommand is the subcommand which summarizes a day of the event log.
+const reportCommand string = "report"
+
+// reportDateLayout is the layout of -report-date.
+const reportDateLayout string = "2006-01-02"
+
+// The conditions on events which were redirected, and held for maintenance. Requests which weren't translated,
+// like those which were refused or served by the APIs, have no rule, and debug requests aren't redirected.
+const (
+	eventRedirected string = "rule != '' AND status BETWEEN 300 AND 399"
+	eventHeld       string = "rule != '' AND status = 503"
+)
+
+// reportSettings are the settings of the report subcommand.
+type reportSettings struct {
+	eventsDB string
+	date     string // The day to summarize, in reportDateLayout, or empty for yesterday.
+	output   string // The file to write the summary to, or empty for standard output.
+	smtp     smtpSettings
+}
+
+// smtpSettings are where the summary is emailed, if address is set.
+type smtpSettings struct {
+	address  string   // The host and port of the SMTP server.
+	from     string   // The sender's address.
+	to       []string // The recipients' addresses.
+	username string   // The username to authenticate with, or empty to send without authenticating.
+	password string
+}
+
+// dailySummary is the summary of a day of the event log.
+type dailySummary struct {
+	day       time.Time
+	requests  int            // The requests which were recorded, including those which weren't redirected.
+	redirects int            // The requests which were redirected.
+	held      int            // The requests which were held for maintenance.
+	rules     map[string]int // The number of requests by the rule and branch which translated them.
+	unmapped  map[string]int // The number of requests for bibIDs which aren't mapped.
+	referrers map[string]int // The number of requests by their referrer, if they had one.
+}
+
+// runReport summarizes the requests recorded in the event log on the day, in the local time zone, and writes the
+// summary to the output file or w, and emails it if an SMTP server is set. It returns the exit status, 1 if the event
+// log couldn't be read or the summary couldn't be written or sent, or 2 if the settings are invalid.
+func runReport(w io.Writer, s reportSettings, now time.Time) int {
+	usage := fmt.Sprintf("Usage: permanentdetour %v -events-db events.db [-report-date yyyy-mm-dd] [-output summary.txt] [flag...]", reportCommand)
+	if s.eventsDB == "" {
+		fmt.Fprintln(w, usage)
+		return 2
+	}
+	// The day before today is summarized by default, so the report can be run each morning.
+	y, m, d := now.AddDate(0, 0, -1).Date()
+	day := time.Date(y, m, d, 0, 0, 0, 0, now.Location())
+	if s.date != "" {
+		var err error
+		day, err = time.ParseInLocation(reportDateLayout, s.date, now.Location())
+		if err != nil {
+			fmt.Fprintf(w, "Invalid -report-date %q, expected a date like 2019-10-11\n%v\n", s.date, usage)
+			return 2
+		}
+	}
+	if s.smtp.address != "" && (s.smtp.from == "" || len(s.smtp.to) == 0) {
+		fmt.Fprintf(w, "Emailing the summary requires -smtp-from and -smtp-to\n%v\n", usage)
+		return 2
+	}
+
+	db, err := sql.Open("sqlite", eventLogDSN(s.eventsDB, true))
+	if err != nil {
+		fmt.Fprintf(w, "Could not open event log %v, %v\n", s.eventsDB, err)
+		return 1
+	}
+	defer db.Close()
+	summary, err := summarizeDay(db, day)
+	if err != nil {
+		fmt.Fprintf(w, "Could not summarize event log %v, %v\n", s.eventsDB, err)
+		return 1
+	}
+	var body bytes.Buffer
+	summary.write(&body)
+
+	if s.output == "" {
+		w.Write(body.Bytes())
+	} else {
+		err = os.WriteFile(s.output, body.Bytes(), 0644)
+		if err != nil {
+			fmt.Fprintf(w, "Could not write summary, %v\n", err)
+			return 1
+		}
+	}
+	if s.smtp.address != "" {
+		err = s.smtp.send(summary.subject(), body.Bytes(), now)
+		if err != nil {
+			fmt.Fprintf(w, "Could not email summary to %v, %v\n", strings.Join(s.smtp.to, ", "), err)
+			return 1
+		}
+	}
+	return 0
+}
+
+// summarizeDay returns the summary of the events recorded on the day which starts at day, in its time zone.
+func summarizeDay(db *sql.DB, day time.Time) (dailySummary, error) {
+	s := dailySummary{day: day, rules: map[string]int{}, unmapped: map[string]int{}, referrers: map[string]int{}}
+	start := day.UTC().Format(eventTimeLayout)
+	end := day.AddDate(0, 0, 1).UTC().Format(eventTimeLayout)
+
+	err := db.QueryRow(`SELECT count(*), count(*) FILTER (WHERE `+eventRedirected+`), count(*) FILTER (WHERE `+eventHeld+`)
+		FROM events WHERE time >= ? AND time < ?`, start, end).Scan(&s.requests, &s.redirects, &s.held)
+	if err != nil {
+		return s, err
+	}
+	counts := []struct {
+		query  string
+		counts map[string]int
+	}{
+		{`SELECT rule || iif(branch = '', '', ', ' || branch), count(*) FROM events
+			WHERE time >= ? AND time < ? AND ` + eventRedirected + ` GROUP BY 1`, s.rules},
+		{`SELECT bib_id, count(*) FROM events
+			WHERE time >= ? AND time < ? AND ` + eventRedirected + ` AND mapped = 0 GROUP BY 1`, s.unmapped},
+		{`SELECT referrer, count(*) FROM events
+			WHERE time >= ? AND time < ? AND ` + eventRedirected + ` AND referrer != '' GROUP BY 1`, s.referrers},
+	}
+	for _, c := range counts {
+		rows, err := db.Query(c.query, start, end)
+		if err != nil {
+			return s, err
+		}
+		for rows.Next() {
+			var key string
+			var count int
+			err = rows.Scan(&key, &count)
+			if err != nil {
+				rows.Close()
+				return s, err
+			}
+			c.counts[key] = count
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return s, err
+		}
+	}
+	return s, nil
+}
+
+// subject returns the subject of the summary's email.
+func (s dailySummary) subject() string {
+	return "Permanent Detour summary for " + s.day.Format(reportDateLayout)
+}
+
+// write writes the summary to w.
+func (s dailySummary) write(w io.Writer) {
+	fmt.Fprintln(w, s.subject())
+	fmt.Fprintf(w, "Requests:             %v\n", s.requests)
+	fmt.Fprintf(w, "Redirects:            %v\n", s.redirects)
+	fmt.Fprintf(w, "Held for maintenance: %v\n", s.held)
+	writeDistribution(w, "Rules:", s.rules, s.redirects)
+	writeTop(w, "Most requested unmapped bibIDs:", s.unmapped)
+	writeTop(w, "Most common referrers:", s.referrers)
+}
+
+// send emails the body to the recipients, authenticating with the username and password if there's a username.
+// Go's SMTP client only sends the password over TLS, or to a server on localhost.
+func (s smtpSettings) send(subject string, body []byte, now time.Time) error {
+	var auth smtp.Auth
+	if s.username != "" {
+		host, _, err := net.SplitHostPort(s.address)
+		if err != nil {
+			return fmt.Errorf("Invalid -smtp-address %q, %w", s.address, err)
+		}
+		auth = smtp.PlainAuth("", s.username, s.password, host)
+	}
+	return smtp.SendMail(s.address, auth, s.from, s.to, s.message(subject, body, now))
+}
+
+// message returns the email of the body, with its headers, and its lines ended with CRLF.
+func (s smtpSettings) message(subject string, body []byte, now time.Time) []byte {
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %v\r\n", s.from)
+	fmt.Fprintf(&msg, "To: %v\r\n", strings.Join(s.to, ", "))
+	fmt.Fprintf(&msg, "Subject: %v\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %v\r\n", now.Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	msg.WriteString("\r\n")
+	for line := range strings.Lines(string(body)) {
+		msg.WriteString(strings.TrimRight(line, "\r\n"))
+		msg.WriteString("\r\n")
+	}
+	return msg.Bytes()
+}
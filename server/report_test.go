@@ -0,0 +1,111 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunReport(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.db")
+	events, err := openEventLog(path, defaultEventsBatchSize, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	est := time.FixedZone("EST", -5*60*60)
+	day := time.Date(2019, 10, 11, 0, 0, 0, 0, est)
+	unmapped := func(at time.Time, bibID int64, referrer string) redirectEvent {
+		return redirectEvent{time: at, rule: "record", branch: "unmapped", bibID: sql.NullInt64{Int64: bibID, Valid: true}, mapped: sql.NullBool{Valid: true}, status: 307, referrer: referrer}
+	}
+	err = events.write([]redirectEvent{
+		{time: day.Add(9 * time.Hour), rule: "record", branch: "mapped", bibID: sql.NullInt64{Int64: 651520, Valid: true}, mapped: sql.NullBool{Bool: true, Valid: true}, status: 307, referrer: "https://guides.library.queensu.ca/hamlet"},
+		unmapped(day.Add(10*time.Hour), 651521, "https://guides.library.queensu.ca/hamlet"),
+		unmapped(day.Add(11*time.Hour), 651521, ""),
+		unmapped(day.Add(23*time.Hour), 1, "https://www.google.com/"),
+		{time: day.Add(12 * time.Hour), rule: "search", branch: "TALL", status: 307},
+		{time: day.Add(13 * time.Hour), rule: "default", status: 503},
+		// Requests which weren't redirected are only counted as requests.
+		{time: day.Add(14 * time.Hour), rule: "record", branch: "unmapped", bibID: sql.NullInt64{Int64: 651522, Valid: true}, mapped: sql.NullBool{Valid: true}, status: 200, referrer: "https://www.google.com/"},
+		{time: day.Add(15 * time.Hour), status: 405, referrer: "https://www.google.com/"},
+		// Requests on the days before and after, in the local time zone, aren't summarized.
+		{time: day.Add(-time.Minute), rule: "default", status: 307},
+		{time: day.Add(24 * time.Hour), rule: "default", status: 307},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = events.close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out strings.Builder
+	// The day before now is summarized by default.
+	status := runReport(&out, reportSettings{eventsDB: path}, day.Add(36*time.Hour))
+	if status != 0 {
+		t.Fatalf("runReport() returned %v, and wrote %q.", status, out.String())
+	}
+	expected := `Permanent Detour summary for 2019-10-11
+Requests:             8
+Redirects:            5
+Held for maintenance: 1
+Rules:
+  record, unmapped 3 (60.0%)
+  record, mapped 1 (20.0%)
+  search, TALL 1 (20.0%)
+Most requested unmapped bibIDs: 2
+  2 651521
+  1 1
+Most common referrers: 2
+  2 https://guides.library.queensu.ca/hamlet
+  1 https://www.google.com/
+`
+	if out.String() != expected {
+		t.Fatalf("runReport() wrote\n%v\nnot\n%v", out.String(), expected)
+	}
+
+	out.Reset()
+	status = runReport(&out, reportSettings{eventsDB: path, date: "2019-10-13"}, day)
+	if status != 0 || !strings.Contains(out.String(), "Redirects:            0\n") {
+		t.Fatalf("runReport() of a day without events returned %v, and wrote %q.", status, out.String())
+	}
+
+	var tests = []struct {
+		name string
+		s    reportSettings
+	}{
+		{"no event log", reportSettings{}},
+		{"invalid date", reportSettings{eventsDB: path, date: "11/10/2019"}},
+		{"no recipients", reportSettings{eventsDB: path, smtp: smtpSettings{address: "localhost:25", from: "detour@example.com"}}},
+	}
+	for _, tt := range tests {
+		out.Reset()
+		status := runReport(&out, tt.s, day)
+		if status != 2 {
+			t.Errorf("With %v, runReport() returned %v, not 2.", tt.name, status)
+		}
+	}
+}
+
+func TestSMTPMessage(t *testing.T) {
+	s := smtpSettings{from: "detour@example.com", to: []string{"a@example.com", "b@example.com"}}
+	msg := string(s.message("Permanent Detour summary for 2019-10-11", []byte("Redirects: 5\nHeld for maintenance: 1\n"), time.Date(2019, 10, 12, 7, 0, 0, 0, time.UTC)))
+	expected := "From: detour@example.com\r\n" +
+		"To: a@example.com, b@example.com\r\n" +
+		"Subject: Permanent Detour summary for 2019-10-11\r\n" +
+		"Date: Sat, 12 Oct 2019 07:00:00 +0000\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"\r\n" +
+		"Redirects: 5\r\n" +
+		"Held for maintenance: 1\r\n"
+	if msg != expected {
+		t.Fatalf("message() returned %q, not %q.", msg, expected)
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWithRequestID(t *testing.T) {
+	var tests = []struct {
+		name     string
+		incoming string
+		honoured bool
+	}{
+		{"generated", "", false},
+		{"honoured", "abc-123", true},
+		{"too long", strings.Repeat("a", maxRequestIDLength+1), false},
+		{"control characters", "abc\x00123", false},
+		{"spaces", "abc 123", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var seen string
+			handler := withRequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				seen = requestIDFromContext(r.Context())
+			}))
+			r := httptest.NewRequest("GET", "/", nil)
+			if tt.incoming != "" {
+				r.Header.Set(requestIDHeader, tt.incoming)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			returned := w.Header().Get(requestIDHeader)
+			if returned == "" || returned != seen {
+				t.Fatalf("The returned request ID %q does not match the request ID %q in the context.", returned, seen)
+			}
+			if tt.honoured && returned != tt.incoming {
+				t.Fatalf("The request ID %q was not honoured, %q was returned.", tt.incoming, returned)
+			}
+			if !tt.honoured && returned == tt.incoming {
+				t.Fatalf("The invalid request ID %q was honoured.", tt.incoming)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/cu-library/permanentdetour/mapping"
+)
+
+// reverseLookupPath is the path of the JSON reverse lookup API.
+const reverseLookupPath string = "/api/v1/reverse"
+
+// reverseLookupResult is the result of looking up an MMS ID, as returned by the reverse lookup API.
+// More than one bibID can map to the same MMS ID when records were merged during migration.
+type reverseLookupResult struct {
+	MMSID  string   `json:"mmsId"`
+	Found  bool     `json:"found"`
+	BibIDs []uint32 `json:"bibIds"`
+}
+
+// buildReverseMap builds a map of ExL IDs to the BibIDs which map to them.
+func buildReverseMap(store mapping.Lister) map[uint64][]uint32 {
+	reverseMap := make(map[uint64][]uint32, store.Len())
+	for bibID, exlID := range store.All() {
+		reverseMap[exlID] = append(reverseMap[exlID], bibID)
+	}
+	// Sort the BibIDs so responses are stable.
+	for _, bibIDs := range reverseMap {
+		if len(bibIDs) > 1 {
+			sort.Slice(bibIDs, func(i, j int) bool { return bibIDs[i] < bibIDs[j] })
+		}
+	}
+	return reverseMap
+}
+
+// serveReverseLookup responds to reverse lookup API requests, like /api/v1/reverse?mmsId=996515203405158.
+func (d Detourer) serveReverseLookup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeJSON(w, http.StatusMethodNotAllowed, apiError{"Reverse lookups must use GET."})
+		return
+	}
+	if d.reverseMap == nil || !d.featureEnabled(featureLookupAPI) {
+		writeJSON(w, http.StatusNotFound, apiError{"Reverse lookups are not enabled on this server."})
+		return
+	}
+	exlID, err := strconv.ParseUint(r.URL.Query().Get("mmsId"), 10, 64)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, apiError{fmt.Sprintf("The mmsId parameter must be an MMS ID number, %v.", err)})
+		return
+	}
+	result := reverseLookupResult{
+		MMSID:  strconv.FormatUint(exlID, 10),
+		BibIDs: []uint32{},
+	}
+	bibIDs, present := d.reverseMap[exlID]
+	status := http.StatusNotFound
+	if present {
+		result.Found = true
+		result.BibIDs = bibIDs
+		status = http.StatusOK
+	}
+	writeJSON(w, status, result)
+}
@@ -0,0 +1,57 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/cu-library/permanentdetour/mapping"
+)
+
+func TestServeReverseLookup(t *testing.T) {
+	store := mapping.NewMap(map[uint32]uint64{651520: 996515203405158, 651521: 996515213405158, 2: 996515213405158})
+	d := Detourer{store: store, reverseMap: buildReverseMap(store)}
+	var tests = []struct {
+		request string
+		status  int
+		bibIDs  []uint32
+	}{
+		{"/api/v1/reverse?mmsId=996515203405158", http.StatusOK, []uint32{651520}},
+		{"/api/v1/reverse?mmsId=996515213405158", http.StatusOK, []uint32{2, 651521}},
+		{"/api/v1/reverse?mmsId=1", http.StatusNotFound, []uint32{}},
+		{"/api/v1/reverse?mmsId=invalid", http.StatusBadRequest, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.request, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			d.serveReverseLookup(w, httptest.NewRequest("GET", tt.request, nil))
+			if w.Code != tt.status {
+				t.Fatalf("serveReverseLookup(\"%v\") returned status %v, not %v", tt.request, w.Code, tt.status)
+			}
+			if tt.bibIDs == nil {
+				return
+			}
+			var result reverseLookupResult
+			err := json.NewDecoder(w.Body).Decode(&result)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(result.BibIDs, tt.bibIDs) {
+				t.Fatalf("serveReverseLookup(\"%v\") returned bibIDs %v, not %v", tt.request, result.BibIDs, tt.bibIDs)
+			}
+		})
+	}
+
+	w := httptest.NewRecorder()
+	Detourer{store: store}.serveReverseLookup(w, httptest.NewRequest("GET", "/api/v1/reverse?mmsId=996515203405158", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("serveReverseLookup returned status %v when disabled, not %v", w.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,39 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+)
+
+const (
+	// robotsPath is the path of the robots exclusion file.
+	robotsPath string = "/robots.txt"
+
+	// defaultRobotsTxt allows crawlers to follow the redirects, so they learn the new URLs.
+	defaultRobotsTxt string = "User-agent: *\nAllow: /\n"
+)
+
+// loadRobotsTxt returns the contents of the robots.txt file at path, or defaultRobotsTxt if path is empty.
+func loadRobotsTxt(path string) ([]byte, error) {
+	if path == "" {
+		return []byte(defaultRobotsTxt), nil
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read robots.txt file %v, %w", path, err)
+	}
+	return content, nil
+}
+
+// robotsHandler returns a handler which responds with the robots.txt content.
+func robotsHandler(content []byte) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write(content)
+	})
+}
@@ -0,0 +1,42 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRobotsHandler(t *testing.T) {
+	content, err := loadRobotsTxt("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	robotsHandler(content).ServeHTTP(w, httptest.NewRequest("GET", robotsPath, nil))
+	if w.Body.String() != defaultRobotsTxt {
+		t.Fatalf("robots.txt was %q, not %q.", w.Body.String(), defaultRobotsTxt)
+	}
+
+	path := filepath.Join(t.TempDir(), "robots.txt")
+	err = os.WriteFile(path, []byte("User-agent: *\nDisallow: /\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err = loadRobotsTxt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "User-agent: *\nDisallow: /\n" {
+		t.Fatalf("loadRobotsTxt(%q) returned %q.", path, content)
+	}
+
+	_, err = loadRobotsTxt(filepath.Join(t.TempDir(), "missing.txt"))
+	if err == nil {
+		t.Fatal("loadRobotsTxt should have returned an error for a missing file, but it did not.")
+	}
+}
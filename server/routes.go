@@ -0,0 +1,90 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/cu-library/permanentdetour/detour"
+)
+
+// pathRouteConfig is a route in the configuration file, which translates requests under a path prefix,
+// like /law for a campus catalogue at /law/vwebv, with their own vid, search scope, and tab.
+type pathRouteConfig struct {
+	Prefix string `json:"prefix"`
+	VID    string `json:"vid,omitempty"`   // The vid parameter for the route's redirects.
+	Scope  string `json:"scope,omitempty"` // The search scope of the route's search redirects, instead of detour.DefaultSearchScope.
+	Tab    string `json:"tab,omitempty"`   // The tab of the route's search redirects, instead of detour.DefaultSearchTab.
+}
+
+// pathRoute is a parsed pathRouteConfig.
+type pathRoute struct {
+	prefix string
+	vid    string
+	scope  string
+	tab    string
+}
+
+// parsePathRoutes checks the routes have unique prefixes, which start with / and don't end with it.
+// The error lists every invalid route.
+func parsePathRoutes(configs []pathRouteConfig) ([]pathRoute, error) {
+	routes := make([]pathRoute, 0, len(configs))
+	var prefixes []string
+	var errs []error
+	for _, rc := range configs {
+		if !strings.HasPrefix(rc.Prefix, "/") || strings.HasSuffix(rc.Prefix, "/") {
+			errs = append(errs, fmt.Errorf("the route prefix %q must start with /, and not end with it", rc.Prefix))
+			continue
+		}
+		if slices.Contains(prefixes, rc.Prefix) {
+			errs = append(errs, fmt.Errorf("the route prefix %v is used more than once", rc.Prefix))
+			continue
+		}
+		prefixes = append(prefixes, rc.Prefix)
+		routes = append(routes, pathRoute{prefix: rc.Prefix, vid: rc.VID, scope: rc.Scope, tab: rc.Tab})
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	// Longer prefixes are checked first, so /law/reserves can be routed apart from /law.
+	slices.SortStableFunc(routes, func(a, b pathRoute) int {
+		return len(b.prefix) - len(a.prefix)
+	})
+	return routes, nil
+}
+
+// routeRequest returns the route whose prefix matches the request's path, and a copy of the request with
+// the prefix removed, so the route's requests are translated with the same rules. If no route matches,
+// the request is returned unchanged with a nil route.
+func routeRequest(r *http.Request, routes []pathRoute) (*http.Request, *pathRoute) {
+	for i, route := range routes {
+		rest, found := strings.CutPrefix(r.URL.Path, route.prefix)
+		if !found || (rest != "" && !strings.HasPrefix(rest, "/")) {
+			continue
+		}
+		if rest == "" {
+			rest = "/"
+		}
+		return requestWithURL(r, &url.URL{Path: rest, RawQuery: r.URL.RawQuery}), &routes[i]
+	}
+	return r, nil
+}
+
+// setSearchDefaults replaces the default search scope and tab of redirectTo with the route's, if it has them.
+// Redirects to other tabs, like the journal search, are left alone.
+func (route *pathRoute) setSearchDefaults(redirectTo *url.URL) {
+	q := redirectTo.Query()
+	if route.scope != "" && q.Get("search_scope") == detour.DefaultSearchScope {
+		detour.SetParam(redirectTo, "search_scope", route.scope)
+	}
+	if route.tab != "" && q.Get("tab") == detour.DefaultSearchTab {
+		detour.SetParam(redirectTo, "tab", route.tab)
+	}
+}
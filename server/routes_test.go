@@ -0,0 +1,71 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cu-library/permanentdetour/mapping"
+)
+
+func TestPathRoutes(t *testing.T) {
+	routes, err := parsePathRoutes([]pathRouteConfig{
+		{Prefix: "/law", VID: "01OCUL_QU:LAW", Scope: "LawLibrary", Tab: "LawTab"},
+		{Prefix: "/law/reserves", VID: "01OCUL_QU:RESERVES"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := Detourer{
+		store:      mapping.NewMap(map[uint32]uint64{651520: 996515203405158}),
+		primo:      "ocul-qu.primo.exlibrisgroup.com",
+		vid:        "01OCUL_QU:QU_DEFAULT",
+		pathRoutes: routes,
+	}
+
+	var tests = []struct {
+		url      string
+		location string
+	}{
+		{"/vwebv/holdingsInfo?bibId=651520",
+			"https://ocul-qu.primo.exlibrisgroup.com/discovery/fulldisplay?docid=alma996515203405158&vid=01OCUL_QU%3AQU_DEFAULT"},
+		{"/law/vwebv/holdingsInfo?bibId=651520",
+			"https://ocul-qu.primo.exlibrisgroup.com/discovery/fulldisplay?docid=alma996515203405158&vid=01OCUL_QU%3ALAW"},
+		{"/law/reserves/vwebv/holdingsInfo?bibId=651520",
+			"https://ocul-qu.primo.exlibrisgroup.com/discovery/fulldisplay?docid=alma996515203405158&vid=01OCUL_QU%3ARESERVES"},
+		{"/law/vwebv/search?searchArg=torts&searchCode=GKEY^",
+			"https://ocul-qu.primo.exlibrisgroup.com/discovery/search?query=any%2Ccontains%2Ctorts&search_scope=LawLibrary&tab=LawTab&vid=01OCUL_QU%3ALAW"},
+		{"/law/vwebv/search?searchArg=nature&searchCode=JALL",
+			"https://ocul-qu.primo.exlibrisgroup.com/discovery/jsearch?query=any%2Ccontains%2Cnature&search_scope=LawLibrary&tab=jsearch_slot&vid=01OCUL_QU%3ALAW"},
+		{"/lawyers/vwebv/holdingsInfo?bibId=651520",
+			"https://ocul-qu.primo.exlibrisgroup.com/discovery/search?vid=01OCUL_QU%3AQU_DEFAULT"},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		d.ServeHTTP(w, httptest.NewRequest("GET", tt.url, nil))
+		if w.Header().Get("Location") != tt.location {
+			t.Fatalf("%v redirected to %v, not %v.", tt.url, w.Header().Get("Location"), tt.location)
+		}
+	}
+}
+
+func TestParsePathRoutes(t *testing.T) {
+	var tests = []struct {
+		name   string
+		routes []pathRouteConfig
+	}{
+		{"relative", []pathRouteConfig{{Prefix: "law"}}},
+		{"trailing slash", []pathRouteConfig{{Prefix: "/law/"}}},
+		{"duplicate", []pathRouteConfig{{Prefix: "/law"}, {Prefix: "/law"}}},
+	}
+	for _, tt := range tests {
+		_, err := parsePathRoutes(tt.routes)
+		if err == nil {
+			t.Fatalf("parsePathRoutes() didn't return an error for a %v prefix.", tt.name)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"cmp"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// rulesPath is the path of the admin endpoint which lists redirects by rule and branch.
+const rulesPath string = "/admin/rules"
+
+// ruleHit counts the redirects built by a branch of a rule, like the NAME searchCode of the search rule.
+type ruleHit struct {
+	Rule    string    `json:"rule"`
+	Branch  string    `json:"branch,omitempty"`
+	Hits    uint64    `json:"hits"`
+	LastHit time.Time `json:"lastHit"`
+}
+
+// ruleBranch identifies a branch of a rule.
+type ruleBranch struct {
+	rule   string
+	branch string
+}
+
+// ruleHits counts redirects by rule and branch, with when each was last used, so rules which no longer
+// get traffic can be retired. A nil *ruleHits discards everything.
+type ruleHits struct {
+	mu   sync.Mutex
+	hits map[ruleBranch]*ruleHit
+}
+
+// newRuleHits returns an empty ruleHits.
+func newRuleHits() *ruleHits {
+	return &ruleHits{hits: map[ruleBranch]*ruleHit{}}
+}
+
+// record counts a redirect built by the branch of the rule at time t. The branch can be empty.
+func (h *ruleHits) record(rule, branch string, t time.Time) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	key := ruleBranch{rule, branch}
+	hit, present := h.hits[key]
+	if !present {
+		hit = &ruleHit{Rule: rule, Branch: branch}
+		h.hits[key] = hit
+	}
+	hit.Hits++
+	hit.LastHit = t
+}
+
+// report returns the counters in rule and branch order.
+func (h *ruleHits) report() []ruleHit {
+	h.mu.Lock()
+	report := make([]ruleHit, 0, len(h.hits))
+	for _, hit := range h.hits {
+		report = append(report, *hit)
+	}
+	h.mu.Unlock()
+	slices.SortFunc(report, func(a, b ruleHit) int {
+		return cmp.Or(cmp.Compare(a.Rule, b.Rule), cmp.Compare(a.Branch, b.Branch))
+	})
+	return report
+}
+
+// serveRules responds with the counters as JSON.
+func (h *ruleHits) serveRules(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, h.report())
+}
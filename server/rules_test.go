@@ -0,0 +1,89 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cu-library/permanentdetour/mapping"
+)
+
+func TestRuleHits(t *testing.T) {
+	h := newRuleHits()
+	first := time.Date(2019, 10, 10, 13, 55, 36, 0, time.UTC)
+	last := first.Add(time.Hour)
+	h.record("search", "NAME", first)
+	h.record("default", "", first)
+	h.record("search", "NAME", last)
+	h.record("search", "CALL", first)
+
+	expected := []ruleHit{
+		{Rule: "default", Hits: 1, LastHit: first},
+		{Rule: "search", Branch: "CALL", Hits: 1, LastHit: first},
+		{Rule: "search", Branch: "NAME", Hits: 2, LastHit: last},
+	}
+	w := httptest.NewRecorder()
+	h.serveRules(w, httptest.NewRequest("GET", rulesPath, nil))
+	var report []ruleHit
+	err := json.Unmarshal(w.Body.Bytes(), &report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(report, expected) {
+		t.Fatalf("serveRules returned %+v, not %+v.", report, expected)
+	}
+
+	var nilHits *ruleHits
+	nilHits.record("default", "", first)
+}
+
+func TestRuleHitsBranches(t *testing.T) {
+	d := Detourer{
+		primo: "ocul-qu.primo.exlibrisgroup.com",
+		vid:   "01OCUL_QU:QU_DEFAULT",
+		store: mapping.NewMap(map[uint32]uint64{651520: 996515203405158}),
+		rules: newRuleHits(),
+	}
+	var tests = []struct {
+		url    string
+		rule   string
+		branch string
+	}{
+		{"/vwebv/holdingsInfo?bibId=651520", "record", "mapped"},
+		{"/vwebv/holdingsInfo?bibId=1", "record", "unmapped"},
+		{"/vwebv/holdingsInfo?bibId=abc", "record", "invalid"},
+		{"/vwebv/search?searchArg=smith&searchCode=NAME", "search", "NAME"},
+		{"/vwebv/search?searchArg=smith&searchCode=GKEY%5E*", "search", "other"},
+		{"/vwebv/search?SEARCH=smith", "search", "SEARCH"},
+		{"/cgi-bin/Pwebrecon.cgi?BBID=651520", "classic", "mapped"},
+		{"/cgi-bin/Pwebrecon.cgi?DB=local&Search_Arg=smith&Search_Code=NAME_", "classic", "NAME"},
+		{"/cgi-bin/Pwebrecon.cgi?DB=local&PAGE=First", "classic", "empty"},
+		{"/vwebv/login", "patron", "login"},
+		{"/vwebv/my", "patron", "my"},
+		{"/", "default", ""},
+	}
+	for _, tt := range tests {
+		observed(d).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", tt.url, nil))
+	}
+	report := d.rules.report()
+	if len(report) != len(tests) {
+		t.Fatalf("%v rule branches were counted, not %v: %+v", len(report), len(tests), report)
+	}
+	for _, tt := range tests {
+		found := false
+		for _, hit := range report {
+			if hit.Rule == tt.rule && hit.Branch == tt.branch && hit.Hits == 1 {
+				found = true
+			}
+		}
+		if !found {
+			t.Fatalf("%v wasn't counted as rule %q branch %q: %+v", tt.url, tt.rule, tt.branch, report)
+		}
+	}
+}
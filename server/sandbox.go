@@ -0,0 +1,50 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"net/http"
+	"strings"
+)
+
+const (
+	// primoEnvironmentHeader is the request header which chooses the Primo environment a request is redirected to,
+	// primoSandbox or primoProduction, so QA can exercise the translation rules against the sandbox.
+	primoEnvironmentHeader string = "X-Detour-Primo"
+
+	// primoSandbox is the value of primoEnvironmentHeader which redirects to the Primo sandbox.
+	primoSandbox string = "sandbox"
+
+	// primoProduction is the value of primoEnvironmentHeader which redirects to production Primo.
+	primoProduction string = "production"
+
+	// sandboxSuffix is added to the subdomain of a Primo host to get the host of its sandbox, like ocul-qu-psb.
+	sandboxSuffix string = "-psb"
+)
+
+// sandboxHost returns the host of the Primo sandbox for a production Primo host.
+// ocul-qu.primo.exlibrisgroup.com becomes ocul-qu-psb.primo.exlibrisgroup.com.
+func sandboxHost(host string) string {
+	subdomain, rest, found := strings.Cut(host, ".")
+	if strings.HasSuffix(subdomain, sandboxSuffix) {
+		return host
+	}
+	if !found {
+		return subdomain + sandboxSuffix
+	}
+	return subdomain + sandboxSuffix + "." + rest
+}
+
+// useSandbox reports whether the request should be redirected to the Primo sandbox, which is the default
+// when sandbox is set, and whether the request chose the environment with the primoEnvironmentHeader.
+func useSandbox(r *http.Request, sandbox bool) (bool, bool) {
+	switch strings.ToLower(r.Header.Get(primoEnvironmentHeader)) {
+	case primoSandbox:
+		return true, true
+	case primoProduction:
+		return false, true
+	}
+	return sandbox, false
+}
@@ -0,0 +1,64 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cu-library/permanentdetour/mapping"
+)
+
+func TestSandboxHost(t *testing.T) {
+	var tests = []struct {
+		host     string
+		expected string
+	}{
+		{"ocul-qu.primo.exlibrisgroup.com", "ocul-qu-psb.primo.exlibrisgroup.com"},
+		{"ocul-qu-psb.primo.exlibrisgroup.com", "ocul-qu-psb.primo.exlibrisgroup.com"},
+		{"localhost", "localhost-psb"},
+	}
+	for _, tt := range tests {
+		if got := sandboxHost(tt.host); got != tt.expected {
+			t.Fatalf("sandboxHost(%v) was %v, not %v.", tt.host, got, tt.expected)
+		}
+	}
+}
+
+func TestSandboxRedirects(t *testing.T) {
+	var tests = []struct {
+		sandbox      bool
+		header       string
+		location     string
+		cacheControl string
+	}{
+		{false, "", "https://ocul-qu.primo.exlibrisgroup.com/discovery/fulldisplay?docid=alma996515203405158&vid=01OCUL_QU%3AQU_DEFAULT", "max-age=60"},
+		{false, "sandbox", "https://ocul-qu-psb.primo.exlibrisgroup.com/discovery/fulldisplay?docid=alma996515203405158&vid=01OCUL_QU%3AQU_DEFAULT", "no-store"},
+		{true, "", "https://ocul-qu-psb.primo.exlibrisgroup.com/discovery/fulldisplay?docid=alma996515203405158&vid=01OCUL_QU%3AQU_DEFAULT", "max-age=60"},
+		{true, "Production", "https://ocul-qu.primo.exlibrisgroup.com/discovery/fulldisplay?docid=alma996515203405158&vid=01OCUL_QU%3AQU_DEFAULT", "no-store"},
+	}
+
+	for _, tt := range tests {
+		d := Detourer{
+			store:        mapping.NewMap(map[uint32]uint64{651520: 996515203405158}),
+			primo:        "ocul-qu.primo.exlibrisgroup.com",
+			vid:          "01OCUL_QU:QU_DEFAULT",
+			cacheControl: map[string]string{"": "max-age=60"},
+			sandbox:      tt.sandbox,
+		}
+		r := httptest.NewRequest("GET", "/vwebv/holdingsInfo?bibId=651520", nil)
+		if tt.header != "" {
+			r.Header.Set(primoEnvironmentHeader, tt.header)
+		}
+		w := httptest.NewRecorder()
+		d.ServeHTTP(w, r)
+		if w.Header().Get("Location") != tt.location {
+			t.Fatalf("With sandbox %v and header %q, the redirect was to %v, not %v.", tt.sandbox, tt.header, w.Header().Get("Location"), tt.location)
+		}
+		if w.Header().Get("Cache-Control") != tt.cacheControl {
+			t.Fatalf("With sandbox %v and header %q, Cache-Control was %v, not %v.", tt.sandbox, tt.header, w.Header().Get("Cache-Control"), tt.cacheControl)
+		}
+	}
+}
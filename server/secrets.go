@@ -0,0 +1,75 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// secretFileSuffix is the suffix of the environment variables which name a file holding a secret flag's value.
+const secretFileSuffix string = "_FILE"
+
+// secretFlags are the flags which hold secrets. They can be read from files, like mounted secrets,
+// instead of the command line or environment, which other processes can see in /proc.
+var secretFlags = []string{"pprof-token", "smtp-password"}
+
+// readSecretFiles sets each secret flag in flags which wasn't set on the command line or by its environment
+// variable from a file. The file is named by the environment variable with secretFileSuffix, like
+// PERMANENTDETOUR_PPROF_TOKEN_FILE, or is the file named like the flag in secretsDir, like pprof-token.
+// It returns the names of the flags which were set. Files named by environment variables must exist.
+func readSecretFiles(flags *flag.FlagSet, secretsDir string) ([]string, error) {
+	set := []string{}
+	flags.Visit(func(f *flag.Flag) { set = append(set, f.Name) })
+	read := []string{}
+	for _, name := range secretFlags {
+		f := flags.Lookup(name)
+		if f == nil || slices.Contains(set, name) || os.Getenv(environmentVariableName(f)) != "" {
+			continue
+		}
+		path := os.Getenv(environmentVariableName(f) + secretFileSuffix)
+		required := path != ""
+		if !required && secretsDir != "" {
+			path = filepath.Join(secretsDir, name)
+		}
+		if path == "" {
+			continue
+		}
+		value, err := readSecretFile(path)
+		if errors.Is(err, fs.ErrNotExist) && !required {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Could not read the secret for -%v, %w", name, err)
+		}
+		// The value is set without flags.Set, so it isn't put on the command line of the Windows service.
+		err = f.Value.Set(value)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to set configuration option %v from the secret file %v, %w", name, path, err)
+		}
+		read = append(read, name)
+	}
+	return read, nil
+}
+
+// readSecretFile returns the content of the file at path, without a trailing newline. An empty secret is an error,
+// so a secret which failed to mount doesn't silently disable what it protects.
+func readSecretFile(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	value := strings.TrimRight(string(content), "\r\n")
+	if value == "" {
+		return "", fmt.Errorf("The secret file %v is empty", path)
+	}
+	return value, nil
+}
@@ -0,0 +1,77 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestReadSecretFiles(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "pprof-token"), []byte("from-dir\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(dir, "token"), []byte("from-file\r\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(dir, "empty"), []byte("\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		name       string
+		args       []string
+		env        string
+		fileEnv    string
+		secretsDir string
+		expected   string
+		err        bool
+	}{
+		{"unset", nil, "", "", "", "", false},
+		{"secrets dir", nil, "", "", dir, "from-dir", false},
+		{"file variable", nil, "", filepath.Join(dir, "token"), dir, "from-file", false},
+		{"missing in secrets dir", nil, "", "", t.TempDir(), "", false},
+		{"missing file variable", nil, "", filepath.Join(dir, "missing"), "", "", true},
+		{"empty file", nil, "", filepath.Join(dir, "empty"), "", "", true},
+		{"flag set", []string{"-pprof-token=from-flag"}, "", filepath.Join(dir, "token"), dir, "from-flag", false},
+		{"environment set", nil, "from-env", filepath.Join(dir, "token"), dir, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("PERMANENTDETOUR_PPROF_TOKEN", tt.env)
+			t.Setenv("PERMANENTDETOUR_PPROF_TOKEN_FILE", tt.fileEnv)
+			flags := flag.NewFlagSet("permanentdetour", flag.ContinueOnError)
+			token := flags.String("pprof-token", "", "")
+			err := flags.Parse(tt.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			read, err := readSecretFiles(flags, tt.secretsDir)
+			if tt.err {
+				if err == nil {
+					t.Fatal("readSecretFiles() didn't return an error.")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The environment variable is applied by overrideUnsetFlagsFromEnvironmentVariables, not here.
+			if *token != tt.expected {
+				t.Fatalf("-pprof-token was %q, not %q.", *token, tt.expected)
+			}
+			if slices.Contains(read, "pprof-token") != (tt.expected != "" && len(tt.args) == 0) {
+				t.Fatalf("readSecretFiles() returned %v.", read)
+			}
+		})
+	}
+}
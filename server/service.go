@@ -0,0 +1,44 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+)
+
+const (
+	// serviceName is the name of the Windows service.
+	serviceName string = "permanentdetour"
+
+	// serviceDisplayName is the name of the Windows service shown in the Services console.
+	serviceDisplayName string = "Permanent Detour"
+)
+
+// serviceArgs returns the arguments the service is started with: the flags which were set, other than -service,
+// and the mapping files, including those set with -mappings. The service's working directory is the system directory,
+// so the mapping file paths are made absolute.
+func serviceArgs(fs *flag.FlagSet) ([]string, error) {
+	args := []string{}
+	paths := []string{}
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "service":
+		case "mappings":
+			paths = append(paths, splitMappingList(f.Value.String())...)
+		default:
+			args = append(args, fmt.Sprintf("-%v=%v", f.Name, f.Value))
+		}
+	})
+	for _, path := range append(paths, fs.Args()...) {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return nil, fmt.Errorf("Could not get absolute path of %v, %w", path, err)
+		}
+		args = append(args, abs)
+	}
+	return args, nil
+}
@@ -0,0 +1,35 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+//go:build !windows
+
+package server
+
+import (
+	"errors"
+	"os"
+)
+
+// errNotWindows is returned when installing or uninstalling a Windows service on another system.
+var errNotWindows = errors.New("Windows services are only supported on Windows")
+
+// isWindowsService reports whether the process was started by the service control manager, which it never is here.
+func isWindowsService() bool {
+	return false
+}
+
+// runService is only supported on Windows.
+func runService(sigs chan<- os.Signal) func() {
+	return func() {}
+}
+
+// installService is only supported on Windows.
+func installService(args []string) error {
+	return errNotWindows
+}
+
+// uninstallService is only supported on Windows.
+func uninstallService() error {
+	return errNotWindows
+}
@@ -0,0 +1,41 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"flag"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestServiceArgs(t *testing.T) {
+	fs := flag.NewFlagSet("permanentdetour", flag.ContinueOnError)
+	fs.String("service", "", "")
+	fs.String("address", defaultAddress, "")
+	fs.String("vid", "", "")
+	fs.Bool("reverse", false, "")
+	fs.String("mappings", "", "")
+	err := fs.Parse([]string{"-service", "install", "-address", ":80", "-mappings", "law.csv", "-reverse", "mappings.csv"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	args, err := serviceArgs(fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	abs, err := filepath.Abs("mappings.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lawAbs, err := filepath.Abs("law.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"-address=:80", "-reverse=true", lawAbs, abs}
+	if !slices.Equal(args, expected) {
+		t.Fatalf("serviceArgs() returned %v, not %v.", args, expected)
+	}
+}
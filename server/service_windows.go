@@ -0,0 +1,124 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// isWindowsService reports whether the process was started by the service control manager.
+func isWindowsService() bool {
+	is, err := svc.IsWindowsService()
+	return err == nil && is
+}
+
+// windowsService handles requests from the service control manager.
+// Stop and shutdown requests are sent to the server as a SIGTERM signal, so it shuts down gracefully.
+type windowsService struct {
+	sigs    chan<- os.Signal
+	stopped <-chan struct{}
+}
+
+// Execute reports the service as running, and handles control requests until the server stops.
+func (s windowsService) Execute(args []string, r <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+	for {
+		select {
+		case c := <-r:
+			switch c.Cmd {
+			case svc.Interrogate:
+				status <- c.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending}
+				s.sigs <- syscall.SIGTERM
+				<-s.stopped
+				return false, 0
+			}
+		case <-s.stopped:
+			return false, 0
+		}
+	}
+}
+
+// runService runs the process as a Windows service, delivering stop requests to sigs.
+// The returned function must be called once the server has stopped, and returns once the service has stopped.
+func runService(sigs chan<- os.Signal) func() {
+	stopped := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		err := svc.Run(serviceName, windowsService{sigs: sigs, stopped: stopped})
+		if err != nil {
+			fatal("Could not run as a Windows service.", "err", err)
+		}
+		close(finished)
+	}()
+	return func() {
+		close(stopped)
+		<-finished
+	}
+}
+
+// installService installs the executable as an automatically started Windows service, started with args.
+func installService(args []string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("Could not find the executable, %w", err)
+	}
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("Could not connect to the service control manager, %w", err)
+	}
+	defer m.Disconnect()
+	s, err := m.OpenService(serviceName)
+	if err == nil {
+		s.Close()
+		return fmt.Errorf("The %v service is already installed", serviceName)
+	}
+	s, err = m.CreateService(serviceName, exe, mgr.Config{
+		DisplayName: serviceDisplayName,
+		Description: "Redirects Voyager Web OPAC requests to Primo URLs.",
+		StartType:   mgr.StartAutomatic,
+	}, args...)
+	if err != nil {
+		return fmt.Errorf("Could not create the %v service, %w", serviceName, err)
+	}
+	defer s.Close()
+	// Restart the service if it fails, like when the mappings can't be loaded after an update.
+	err = s.SetRecoveryActions([]mgr.RecoveryAction{
+		{Type: mgr.ServiceRestart, Delay: 5 * time.Second},
+	}, uint32((24 * time.Hour).Seconds()))
+	if err != nil {
+		return fmt.Errorf("Could not set the %v service's recovery actions, %w", serviceName, err)
+	}
+	slog.Info("Installed service.", "name", serviceName, "executable", exe, "args", args)
+	return nil
+}
+
+// uninstallService removes the Windows service.
+func uninstallService() error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("Could not connect to the service control manager, %w", err)
+	}
+	defer m.Disconnect()
+	s, err := m.OpenService(serviceName)
+	if err != nil {
+		return fmt.Errorf("The %v service is not installed, %w", serviceName, err)
+	}
+	defer s.Close()
+	err = s.Delete()
+	if err != nil {
+		return fmt.Errorf("Could not delete the %v service, %w", serviceName, err)
+	}
+	slog.Info("Uninstalled service.", "name", serviceName)
+	return nil
+}
@@ -0,0 +1,65 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// defaultShutdownTimeout is the default time allowed for open connections to finish when shutting down.
+const defaultShutdownTimeout time.Duration = 30 * time.Second
+
+// connCounter counts a server's open connections, using its ConnState hook.
+type connCounter struct {
+	open atomic.Int64
+}
+
+// track is the http.Server ConnState hook.
+func (c *connCounter) track(conn net.Conn, state http.ConnState) {
+	switch state {
+	case http.StateNew:
+		c.open.Add(1)
+	case http.StateHijacked, http.StateClosed:
+		c.open.Add(-1)
+	}
+}
+
+// shutdownServer gracefully shuts the server down, waiting until the context is done for open connections to
+// finish before closing them. It logs how many connections were drained and how many were forcibly closed.
+func shutdownServer(ctx context.Context, server *http.Server, conns *connCounter) error {
+	open := conns.open.Load()
+	err := server.Shutdown(ctx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		forced := conns.open.Load()
+		slog.Warn("Shutdown timed out, closing connections.", "drained", open-forced, "forced", forced)
+		return server.Close()
+	}
+	slog.Info("Connections drained.", "drained", open, "forced", 0)
+	return err
+}
+
+// stopGRPCServer gracefully stops the gRPC server, waiting until the context is done for open RPCs
+// to finish before stopping it forcibly.
+func stopGRPCServer(ctx context.Context, s *grpc.Server) {
+	stopped := make(chan struct{})
+	go func() {
+		s.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		slog.Warn("gRPC shutdown timed out, stopping.")
+		s.Stop()
+	}
+}
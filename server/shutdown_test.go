@@ -0,0 +1,54 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestShutdownServer(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	conns := &connCounter{}
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			<-release
+		}),
+		ConnState: conns.track,
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(listener)
+
+	// Start a request which doesn't finish until released.
+	go http.Get("http://" + listener.Addr().String())
+	<-started
+	if conns.open.Load() != 1 {
+		t.Fatalf("%v connections are open, not 1.", conns.open.Load())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = shutdownServer(ctx, server, conns)
+	close(release)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Wait for the forcibly closed connection to be counted.
+	deadline := time.Now().Add(time.Second)
+	for conns.open.Load() != 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if conns.open.Load() != 0 {
+		t.Fatalf("%v connections are open after shutting down, not 0.", conns.open.Load())
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+const (
+	// sitemapCommand is the subcommand which writes sitemaps of the Primo permalinks of the mapped records.
+	sitemapCommand string = "sitemap"
+
+	// sitemapURLLimit is the maximum number of URLs in a sitemap, set by the sitemap protocol.
+	sitemapURLLimit int = 50000
+
+	// sitemapIndexFile is the name of the sitemap index, which lists the sitemaps.
+	sitemapIndexFile string = "sitemap.xml"
+
+	// sitemapNamespace is the XML namespace of sitemaps and sitemap indexes.
+	sitemapNamespace string = "http://www.sitemaps.org/schemas/sitemap/0.9"
+)
+
+// sitemapURLSet is a sitemap.
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"urlset"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	URLs    []sitemapLoc `xml:"url"`
+}
+
+// sitemapIndex is a sitemap index.
+type sitemapIndex struct {
+	XMLName  xml.Name     `xml:"sitemapindex"`
+	XMLNS    string       `xml:"xmlns,attr"`
+	Sitemaps []sitemapLoc `xml:"sitemap"`
+}
+
+// sitemapLoc is a URL in a sitemap, or a sitemap in a sitemap index.
+type sitemapLoc struct {
+	Loc string `xml:"loc"`
+}
+
+// runSitemap writes sitemaps of the Primo permalinks of the mapped bibIDs to the directory dir, and a sitemap
+// index listing them, with the sitemaps published at baseURL. The files written are reported to stderr.
+// It returns the exit status, 1 if the sitemaps couldn't be written, or 2 if the arguments are invalid.
+func runSitemap(stderr io.Writer, s translateSettings, dir, baseURL string) int {
+	base, err := url.Parse(baseURL)
+	if dir == "" || err != nil || !base.IsAbs() {
+		fmt.Fprintf(stderr, "Usage: permanentdetour %v -output dir -sitemap-url https://example.com/sitemaps/ [flag...] [file...]\n", sitemapCommand)
+		return 2
+	}
+	rt, err := newTranslationRouter(s)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		fmt.Fprintf(stderr, "Could not create sitemap directory %v, %v\n", dir, err)
+		return 1
+	}
+	files, err := writeSitemaps(rt.def, dir, base, sitemapURLLimit)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	fmt.Fprintf(stderr, "Wrote %v permalinks to %v sitemaps, listed in %v\n", rt.def.store.Len(), len(files), filepath.Join(dir, sitemapIndexFile))
+	return 0
+}
+
+// writeSitemaps writes the Primo permalinks of the bibIDs mapped by d, in order of bibID, to sitemaps in dir with
+// at most limit URLs in each, named like sitemap-1.xml, then the sitemap index. It returns the names of the sitemaps.
+func writeSitemaps(d Detourer, dir string, base *url.URL, limit int) ([]string, error) {
+	index := sitemapIndex{XMLNS: sitemapNamespace}
+	var files []string
+	bibIDs, err := d.sortedBibIDs()
+	if err != nil {
+		return nil, err
+	}
+	for chunk := range slices.Chunk(bibIDs, limit) {
+		sitemap := sitemapURLSet{XMLNS: sitemapNamespace, URLs: make([]sitemapLoc, 0, len(chunk))}
+		for _, bibID := range chunk {
+			exlID, _ := d.store.Lookup(bibID)
+			sitemap.URLs = append(sitemap.URLs, sitemapLoc{Loc: d.recordURL(exlID).String()})
+		}
+		name := fmt.Sprintf("sitemap-%v.xml", len(files)+1)
+		err := writeXMLFile(filepath.Join(dir, name), sitemap)
+		if err != nil {
+			return files, err
+		}
+		files = append(files, name)
+		index.Sitemaps = append(index.Sitemaps, sitemapLoc{Loc: base.JoinPath(name).String()})
+	}
+	return files, writeXMLFile(filepath.Join(dir, sitemapIndexFile), index)
+}
+
+// writeXMLFile replaces the file at path with v as an XML document, once it has been written completely.
+func writeXMLFile(path string, v any) error {
+	return writeMappingFile(path, func(w io.Writer) error {
+		_, err := io.WriteString(w, xml.Header)
+		if err != nil {
+			return err
+		}
+		encoder := xml.NewEncoder(w)
+		encoder.Indent("", "  ")
+		err = encoder.Encode(v)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(w, "\n")
+		return err
+	})
+}
@@ -0,0 +1,114 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"encoding/xml"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestWriteSitemaps(t *testing.T) {
+	dir := t.TempDir()
+	mappings := filepath.Join(dir, "mappings.csv")
+	err := os.WriteFile(mappings, []byte("996515213405158,a651521-01ocul_qu\n996515203405158,a651520-01ocul_qu\n996515223405158,a651522-01ocul_qu\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rt, err := newTranslationRouter(translateSettings{primo: "ocul-qu", vid: "01OCUL_QU:QU_DEFAULT", mappingFiles: []string{mappings}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	base, _ := url.Parse("https://library.example.com/sitemaps/")
+	files, err := writeSitemaps(rt.def, dir, base, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(files, []string{"sitemap-1.xml", "sitemap-2.xml"}) {
+		t.Fatalf("The sitemaps were %v, not sitemap-1.xml and sitemap-2.xml.", files)
+	}
+
+	var index sitemapIndex
+	readXML(t, filepath.Join(dir, sitemapIndexFile), &index)
+	var locs []string
+	for _, sitemap := range index.Sitemaps {
+		locs = append(locs, sitemap.Loc)
+	}
+	expected := []string{"https://library.example.com/sitemaps/sitemap-1.xml", "https://library.example.com/sitemaps/sitemap-2.xml"}
+	if !slices.Equal(locs, expected) {
+		t.Fatalf("The sitemap index listed %v, not %v.", locs, expected)
+	}
+
+	var tests = []struct {
+		file     string
+		expected []string
+	}{
+		{
+			"sitemap-1.xml",
+			[]string{
+				"https://ocul-qu.primo.exlibrisgroup.com/discovery/fulldisplay?docid=alma996515203405158&vid=01OCUL_QU%3AQU_DEFAULT",
+				"https://ocul-qu.primo.exlibrisgroup.com/discovery/fulldisplay?docid=alma996515213405158&vid=01OCUL_QU%3AQU_DEFAULT",
+			},
+		},
+		{
+			"sitemap-2.xml",
+			[]string{
+				"https://ocul-qu.primo.exlibrisgroup.com/discovery/fulldisplay?docid=alma996515223405158&vid=01OCUL_QU%3AQU_DEFAULT",
+			},
+		},
+	}
+	for _, tt := range tests {
+		var sitemap sitemapURLSet
+		readXML(t, filepath.Join(dir, tt.file), &sitemap)
+		var urls []string
+		for _, u := range sitemap.URLs {
+			urls = append(urls, u.Loc)
+		}
+		if !slices.Equal(urls, tt.expected) {
+			t.Errorf("%v listed %v, not %v.", tt.file, urls, tt.expected)
+		}
+		if sitemap.XMLNS != sitemapNamespace {
+			t.Errorf("%v had the namespace %q, not %q.", tt.file, sitemap.XMLNS, sitemapNamespace)
+		}
+	}
+
+	// The & in permalinks is escaped.
+	content, err := os.ReadFile(filepath.Join(dir, "sitemap-2.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), "alma996515223405158&amp;vid=") {
+		t.Fatalf("sitemap-2.xml was\n%v", string(content))
+	}
+}
+
+func TestRunSitemap(t *testing.T) {
+	var stderr strings.Builder
+	status := runSitemap(&stderr, translateSettings{}, t.TempDir(), "/sitemaps/")
+	if status != 2 {
+		t.Fatalf("runSitemap() with a relative URL returned %v, not 2.", status)
+	}
+	status = runSitemap(&stderr, translateSettings{}, "", "https://library.example.com/sitemaps/")
+	if status != 2 {
+		t.Fatalf("runSitemap() without a directory returned %v, not 2.", status)
+	}
+}
+
+// readXML decodes the XML file at path into v.
+func readXML(t *testing.T, path string, v any) {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = xml.Unmarshal(content, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/cu-library/permanentdetour/detour"
+)
+
+const (
+	// smokeCommand is the subcommand which checks the redirects of a running instance, after it is deployed.
+	smokeCommand string = "smoke"
+
+	// defaultSmokeTimeout is the time allowed for each request to the running instance.
+	defaultSmokeTimeout time.Duration = 10 * time.Second
+)
+
+// smokeCase is a legacy URL sent to the running instance.
+type smokeCase struct {
+	name string
+	path string // The path and query of the legacy URL.
+}
+
+// smokeCases are the legacy URLs sent to the running instance, representative of the links patrons follow.
+var smokeCases = []smokeCase{
+	{"record, unmapped", detour.RecordPrefix + "?bibId=4294967295"},
+	{"record, invalid", detour.RecordPrefix + "?bibId=invalid"},
+	{"search, TKEY^", detour.SearchPrefix + "?searchArg=origin+of+species&searchCode=TKEY%5E&searchType=1"},
+	{"search, TALL", detour.SearchPrefix + "?searchArg=origin+of+species&searchCode=TALL&searchType=1"},
+	{"search, NAME", detour.SearchPrefix + "?searchArg=darwin%2C+charles&searchCode=NAME&searchType=1"},
+	{"search, CALL", detour.SearchPrefix + "?searchArg=QH365+.O2&searchCode=CALL&searchType=1"},
+	{"search, JALL", detour.SearchPrefix + "?searchArg=nature&searchCode=JALL&searchType=1"},
+	{"search, other", detour.SearchPrefix + "?searchArg=darwin&searchCode=GKEY%5E*&searchType=0"},
+	{"search, SEARCH", detour.SearchPrefix + "?SEARCH=darwin"},
+	{"search, empty", detour.SearchPrefix},
+	{"classic, unmapped", detour.ClassicPath + "?BBID=4294967295"},
+	{"classic, TALL", detour.ClassicPath + "?DB=local&Search_Arg=origin+of+species&Search_Code=TALL&CNT=50"},
+	{"classic, NAME", detour.ClassicPath + "?DB=local&Search_Arg=darwin%2C+charles&Search_Code=NAME_&CNT=50"},
+	{"classic, empty", detour.ClassicPath + "?DB=local&PAGE=First"},
+	{"patron, my", detour.PatronInfoPrefix + "Account"},
+	{"patron, login", detour.PatronInfoPrefix2},
+	{"openurl", "/openurl?url_ver=Z39.88-2004&rft.isbn=9780140432053"},
+	{"default", "/"},
+}
+
+// runSmoke sends the smokeCases, and record links for a mapped bibID, to the running instance at target,
+// and checks each is redirected to the same Location, with the same status, as it is translated with the settings.
+// Each result and a summary are written to w. It returns the exit status, 1 if any check failed,
+// or 2 if the target is invalid.
+func runSmoke(w io.Writer, s translateSettings, target string) int {
+	base, err := url.Parse(target)
+	if err != nil || (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" {
+		fmt.Fprintf(w, "Usage: permanentdetour %v -target http://host:8877 [flag...] [file...]\n", smokeCommand)
+		return 2
+	}
+	rt, err := newTranslationRouter(s)
+	if err != nil {
+		fmt.Fprintln(w, err)
+		return 1
+	}
+	cases := slices.Clone(smokeCases)
+	// The lowest mapped bibID is checked, so the instance is known to have loaded mappings.
+	d := rt.forHost(base.Host)
+	bibIDs, err := d.sortedBibIDs()
+	if err != nil {
+		fmt.Fprintln(w, err)
+		return 1
+	}
+	if len(bibIDs) > 0 {
+		bibID := strconv.FormatUint(uint64(bibIDs[0]), 10)
+		cases = slices.Insert(cases, 0,
+			smokeCase{"record, mapped", detour.RecordPrefix + "?bibId=" + bibID},
+			smokeCase{"classic, mapped", detour.ClassicPath + "?BBID=" + bibID},
+		)
+	}
+
+	// Redirects are checked, not followed.
+	client := &http.Client{
+		Timeout: defaultSmokeTimeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	failed := 0
+	for _, c := range cases {
+		legacy := base.Scheme + "://" + base.Host + c.path
+		problem := checkSmokeCase(context.Background(), client, rt, legacy)
+		if problem != "" {
+			failed++
+			fmt.Fprintf(w, "FAIL %v: %v, %v\n", c.name, legacy, problem)
+			continue
+		}
+		fmt.Fprintf(w, "ok   %v: %v\n", c.name, legacy)
+	}
+	fmt.Fprintf(w, "%v of %v checks passed.\n", len(cases)-failed, len(cases))
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// checkSmokeCase requests the legacy URL from the running instance, and returns how its response differs from
+// the translation with rt, or empty if it doesn't.
+func checkSmokeCase(ctx context.Context, client *http.Client, rt *router, legacy string) string {
+	expected, err := translateURL(rt, legacy)
+	if err != nil {
+		return err.Error()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, legacy, nil)
+	if err != nil {
+		return err.Error()
+	}
+	req.Header.Set("User-Agent", "permanentdetour/"+version)
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Sprintf("Could not send the request, %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != expected.Status {
+		return fmt.Sprintf("The status was %v, not %v", resp.StatusCode, expected.Status)
+	}
+	location := resp.Header.Get("Location")
+	if location != expected.Target.String() {
+		return fmt.Sprintf("The Location was %q, not %q", location, expected.Target)
+	}
+	return ""
+}
@@ -0,0 +1,65 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunSmoke(t *testing.T) {
+	dir := t.TempDir()
+	mappings := filepath.Join(dir, "mappings.csv")
+	err := os.WriteFile(mappings, []byte("996515213405158,a651521-01ocul_qu\n996515203405158,a651520-01ocul_qu\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings := translateSettings{primo: "ocul-qu", vid: "01OCUL_QU:QU_DEFAULT", mappingFiles: []string{mappings}}
+
+	// The running instance is deployed with the same settings.
+	rt, err := newTranslationRouter(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(rt.def)
+	defer server.Close()
+
+	var out strings.Builder
+	status := runSmoke(&out, settings, server.URL)
+	if status != 0 {
+		t.Fatalf("runSmoke() returned %v, not 0. Output:\n%v", status, out.String())
+	}
+	expected := []string{
+		"ok   record, mapped: " + server.URL + "/vwebv/holdingsInfo?bibId=651520",
+		"ok   classic, mapped: " + server.URL + "/cgi-bin/Pwebrecon.cgi?BBID=651520",
+		"ok   search, JALL: " + server.URL + "/vwebv/search?searchArg=nature&searchCode=JALL&searchType=1",
+		"20 of 20 checks passed.",
+	}
+	for _, line := range expected {
+		if !strings.Contains(out.String(), line+"\n") {
+			t.Errorf("The output didn't have %q. Output:\n%v", line, out.String())
+		}
+	}
+
+	// The running instance was deployed with the wrong view.
+	settings.vid = "01OCUL_QU:QU_NEW"
+	out.Reset()
+	status = runSmoke(&out, settings, server.URL)
+	if status != 1 {
+		t.Fatalf("runSmoke() against the wrong view returned %v, not 1. Output:\n%v", status, out.String())
+	}
+	failure := `FAIL record, mapped: ` + server.URL + `/vwebv/holdingsInfo?bibId=651520, The Location was "https://ocul-qu.primo.exlibrisgroup.com/discovery/fulldisplay?docid=alma996515203405158&vid=01OCUL_QU%3AQU_DEFAULT", not "https://ocul-qu.primo.exlibrisgroup.com/discovery/fulldisplay?docid=alma996515203405158&vid=01OCUL_QU%3AQU_NEW"`
+	if !strings.Contains(out.String(), failure+"\n") || !strings.HasSuffix(out.String(), "0 of 20 checks passed.\n") {
+		t.Fatalf("The output was\n%v", out.String())
+	}
+
+	status = runSmoke(&out, settings, "localhost:8877")
+	if status != 2 {
+		t.Fatalf("runSmoke() with a target without a scheme returned %v, not 2.", status)
+	}
+}
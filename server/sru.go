@@ -0,0 +1,235 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/cu-library/permanentdetour/mapping"
+)
+
+const (
+	// almaDomain is the domain at which Alma instances are hosted.
+	almaDomain string = "alma.exlibrisgroup.com"
+
+	// almaSRUVersion is the SRU version supported by Alma.
+	almaSRUVersion string = "1.2"
+)
+
+// sruIndexes maps the CQL indexes supported by the Voyager SRU server to Alma SRU indexes.
+var sruIndexes = map[string]string{
+	"bath.author":      "alma.creator",
+	"bath.isbn":        "alma.isbn",
+	"bath.issn":        "alma.issn",
+	"bath.name":        "alma.creator",
+	"bath.subject":     "alma.subjects",
+	"bath.title":       "alma.title",
+	"cql.anywhere":     "alma.all_for_ui",
+	"cql.serverchoice": "alma.all_for_ui",
+	"dc.anywhere":      "alma.all_for_ui",
+	"dc.author":        "alma.creator",
+	"dc.creator":       "alma.creator",
+	"dc.date":          "alma.main_pub_date",
+	"dc.identifier":    "alma.standard_number",
+	"dc.isbn":          "alma.isbn",
+	"dc.issn":          "alma.issn",
+	"dc.publisher":     "alma.publisher",
+	"dc.subject":       "alma.subjects",
+	"dc.title":         "alma.title",
+}
+
+// sruRecordIDIndex is the CQL index of Voyager record IDs, which is rewritten to a search for the mapped MMS ID.
+const sruRecordIDIndex string = "rec.id"
+
+// cqlTokenKind is the kind of a token of a CQL query.
+type cqlTokenKind int
+
+const (
+	cqlSpace  cqlTokenKind = iota // A run of whitespace.
+	cqlWord                       // An index, relation, boolean, or unquoted term.
+	cqlQuoted                     // A quoted term, with its quotes.
+	cqlSymbol                     // A parenthesis, modifier slash, or symbolic relation.
+)
+
+// cqlToken is a token of a CQL query, with its text as it was in the query.
+type cqlToken struct {
+	kind cqlTokenKind
+	text string
+}
+
+// sruShim proxies SRU searchRetrieve requests made to the retired catalogue to Alma's SRU endpoint.
+type sruShim struct {
+	target *url.URL      // The Alma SRU endpoint.
+	store  mapping.Store // The mappings of BibIDs to ExL IDs, used to rewrite record ID searches.
+	proxy  *httputil.ReverseProxy
+}
+
+// newSRUShim returns an sruShim which proxies requests to the Alma SRU endpoint at target.
+func newSRUShim(target *url.URL, store mapping.Store) *sruShim {
+	s := &sruShim{
+		target: target,
+		store:  store,
+	}
+	s.proxy = &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			q := pr.In.URL.Query()
+			q.Set("version", almaSRUVersion)
+			q.Set("query", rewriteCQLQuery(q.Get("query"), s.store))
+			pr.Out.URL = &url.URL{
+				Scheme:   s.target.Scheme,
+				Host:     s.target.Host,
+				Path:     s.target.Path,
+				RawQuery: q.Encode(),
+			}
+			pr.Out.Host = ""
+			pr.SetXForwarded()
+		},
+	}
+	return s
+}
+
+// almaSRUURL returns the Alma SRU endpoint for the Primo subdomain and vid.
+func almaSRUURL(subdomain, vid string) *url.URL {
+	return &url.URL{
+		Scheme: "https",
+		Host:   fmt.Sprintf("%v.%v", subdomain, almaDomain),
+		Path:   fmt.Sprintf("/view/sru/%v", strings.SplitN(vid, ":", 2)[0]),
+	}
+}
+
+// The sruShim serves searchRetrieve requests by proxying them to Alma.
+func (s *sruShim) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "SRU requests must use GET.", http.StatusMethodNotAllowed)
+		return
+	}
+	if r.URL.Query().Get("operation") != "searchRetrieve" {
+		http.Error(w, "Only the searchRetrieve operation is supported.", http.StatusBadRequest)
+		return
+	}
+	s.proxy.ServeHTTP(w, r)
+}
+
+// rewriteCQLQuery rewrites the Voyager indexes in a CQL query to their Alma equivalents.
+// Searches for Voyager record IDs are rewritten to searches for the mapped MMS ID.
+// Quoted terms are left as they are, even if they contain the name of an index.
+func rewriteCQLQuery(query string, store mapping.Store) string {
+	tokens := tokenizeCQL(query)
+	var b strings.Builder
+	b.Grow(len(query))
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		if t.kind != cqlWord {
+			b.WriteString(t.text)
+			continue
+		}
+		if strings.EqualFold(t.text, sruRecordIDIndex) {
+			exlID, end, ok := lookupCQLRecordID(tokens[i+1:], store)
+			if ok {
+				fmt.Fprintf(&b, "alma.mms_id=%v", exlID)
+				i += end
+				continue
+			}
+		}
+		almaIndex, present := sruIndexes[strings.ToLower(t.text)]
+		if !present {
+			almaIndex = t.text
+		}
+		b.WriteString(almaIndex)
+	}
+	return b.String()
+}
+
+// lookupCQLRecordID parses the relation and term which follow a rec.id index, like == "651520", and returns the
+// mapped ExL ID and the number of tokens they took. It returns false if the relation isn't an equality, or the
+// term isn't a mapped bibID.
+func lookupCQLRecordID(tokens []cqlToken, store mapping.Store) (uint64, int, bool) {
+	i := 0
+	skipSpace := func() {
+		for i < len(tokens) && tokens[i].kind == cqlSpace {
+			i++
+		}
+	}
+	skipSpace()
+	if i == len(tokens) {
+		return 0, 0, false
+	}
+	relation := tokens[i]
+	switch {
+	case relation.kind == cqlSymbol && (relation.text == "=" || relation.text == "=="):
+	case relation.kind == cqlWord && strings.EqualFold(relation.text, "exact"):
+	default:
+		return 0, 0, false
+	}
+	i++
+	skipSpace()
+	if i == len(tokens) {
+		return 0, 0, false
+	}
+	term := tokens[i]
+	value := term.text
+	switch term.kind {
+	case cqlQuoted:
+		value = strings.TrimSuffix(strings.TrimPrefix(value, `"`), `"`)
+	case cqlWord:
+	default:
+		return 0, 0, false
+	}
+	bibID64, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		return 0, 0, false
+	}
+	exlID, present := store.Lookup(uint32(bibID64))
+	if !present {
+		return 0, 0, false
+	}
+	return exlID, i + 1, true
+}
+
+// tokenizeCQL splits a CQL query into tokens, keeping all of its text, so the query can be rebuilt from them.
+// An unterminated quoted term runs to the end of the query.
+func tokenizeCQL(query string) []cqlToken {
+	var tokens []cqlToken
+	for len(query) > 0 {
+		var t cqlToken
+		switch c := query[0]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			end := len(query) - len(strings.TrimLeft(query, " \t\n\r"))
+			t = cqlToken{cqlSpace, query[:end]}
+		case c == '"':
+			end := 1
+			for end < len(query) && query[end] != '"' {
+				// A backslash escapes the next character, like a quote.
+				if query[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			t = cqlToken{cqlQuoted, query[:min(end+1, len(query))]}
+		case c == '(' || c == ')' || c == '/':
+			t = cqlToken{cqlSymbol, query[:1]}
+		case c == '=' || c == '<' || c == '>':
+			end := 1
+			if len(query) > 1 && (query[:2] == "==" || query[:2] == "<=" || query[:2] == ">=" || query[:2] == "<>") {
+				end = 2
+			}
+			t = cqlToken{cqlSymbol, query[:end]}
+		default:
+			end := strings.IndexAny(query, " \t\n\r\"()/=<>")
+			if end == -1 {
+				end = len(query)
+			}
+			t = cqlToken{cqlWord, query[:end]}
+		}
+		tokens = append(tokens, t)
+		query = query[len(t.text):]
+	}
+	return tokens
+}
@@ -0,0 +1,85 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/cu-library/permanentdetour/mapping"
+)
+
+func TestRewriteCQLQuery(t *testing.T) {
+	store := mapping.NewMap(map[uint32]uint64{651520: 996515203405158})
+	var tests = []struct {
+		query    string
+		expected string
+	}{
+		{"", ""},
+		{"spiders", "spiders"},
+		{"dc.title=spiders", "alma.title=spiders"},
+		{"DC.Title = \"charlotte's web\" and dc.creator=white", "alma.title = \"charlotte's web\" and alma.creator=white"},
+		{"bath.isbn=0061124958", "alma.isbn=0061124958"},
+		{"cql.serverChoice all \"spiders webs\"", "alma.all_for_ui all \"spiders webs\""},
+		{"rec.id=651520", "alma.mms_id=996515203405158"},
+		{"rec.id == \"651520\" or dc.title=spiders", "alma.mms_id=996515203405158 or alma.title=spiders"},
+		{"rec.id=1", "rec.id=1"},
+		{"local.unknown=spiders", "local.unknown=spiders"},
+		{"rec.id exact 651520", "alma.mms_id=996515203405158"},
+		{"(rec.id=651520)", "(alma.mms_id=996515203405158)"},
+		{"dc.title=spiders sortBy dc.date/sort.descending", "alma.title=spiders sortBy alma.main_pub_date/sort.descending"},
+		// Quoted terms aren't rewritten, even if they contain an index.
+		{"cql.serverChoice all \"dc.title rec.id=651520\"", "alma.all_for_ui all \"dc.title rec.id=651520\""},
+		{"dc.title=\"the \\\"dc.title\\\" index\" or dc.subject=cql", "alma.title=\"the \\\"dc.title\\\" index\" or alma.subjects=cql"},
+		{"dc.title=\"unterminated dc.title", "alma.title=\"unterminated dc.title"},
+		{"mydc.title=spiders", "mydc.title=spiders"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			rewritten := rewriteCQLQuery(tt.query, store)
+			if rewritten != tt.expected {
+				t.Fatalf("rewriteCQLQuery(\"%v\") returned \"%v\", not \"%v\"", tt.query, rewritten, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSRUShim(t *testing.T) {
+	alma := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Received-Forwarded-For", r.Header.Get("X-Forwarded-For"))
+		w.Write([]byte(r.URL.Path + "?" + r.URL.RawQuery))
+	}))
+	defer alma.Close()
+	target, err := url.Parse(alma.URL + "/view/sru/01OCUL_QU")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newSRUShim(target, mapping.NewMap(nil))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/voyager?version=1.1&operation=searchRetrieve&query=dc.title%3Dspiders", nil)
+	r.RemoteAddr = "192.0.2.1:1234"
+	r.Header.Set("X-Forwarded-For", "198.51.100.1")
+	s.ServeHTTP(w, r)
+	body, _ := ioutil.ReadAll(w.Result().Body)
+	expected := "/view/sru/01OCUL_QU?operation=searchRetrieve&query=alma.title%3Dspiders&version=1.2"
+	if string(body) != expected {
+		t.Fatalf("sruShim proxied the request to \"%v\", not \"%v\"", string(body), expected)
+	}
+	// The client's own X-Forwarded-For header isn't passed on.
+	if forwardedFor := w.Result().Header.Get("X-Received-Forwarded-For"); forwardedFor != "192.0.2.1" {
+		t.Fatalf("sruShim sent X-Forwarded-For \"%v\", not \"192.0.2.1\"", forwardedFor)
+	}
+
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "/voyager?operation=scan", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("sruShim returned status %v for a scan request, not %v", w.Code, http.StatusBadRequest)
+	}
+}
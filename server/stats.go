@@ -0,0 +1,179 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"bufio"
+	"cmp"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/cu-library/permanentdetour/mapping"
+)
+
+const (
+	// statsCommand is the subcommand which prints statistics of mapping files.
+	statsCommand string = "stats"
+
+	// statsListLimit is the maximum number of MMS IDs mapped from more than one bibID which are listed.
+	statsListLimit int = 20
+
+	// noSuffix is how bibIDs without an institution suffix are listed.
+	noSuffix string = "(none)"
+)
+
+// mappingFileStats are the statistics of mapping files, which help spot partial or mis-scoped extracts.
+type mappingFileStats struct {
+	files        int
+	records      int               // The lines or snapshot entries read.
+	invalid      int               // The lines which couldn't be processed.
+	duplicates   int               // The records for bibIDs which were already mapped.
+	mappings     map[uint32]uint64 // The first mapping of each bibID.
+	suffixes     map[string]int    // The number of records by the institution suffix of their bibID, like 01ocul_qu.
+	institutions map[string]int    // The number of records by the institution code at the end of their MMS ID.
+}
+
+// runStats writes statistics of the mapping files at paths to w. It returns the exit status,
+// 1 if a file couldn't be read, or 2 if no files were given.
+func runStats(w io.Writer, paths []string) int {
+	if len(paths) == 0 {
+		fmt.Fprintf(w, "Usage: permanentdetour %v file...\n", statsCommand)
+		return 2
+	}
+	s := mappingFileStats{
+		files:        len(paths),
+		mappings:     map[uint32]uint64{},
+		suffixes:     map[string]int{},
+		institutions: map[string]int{},
+	}
+	for _, path := range paths {
+		err := s.addFile(path)
+		if err != nil {
+			fmt.Fprintf(w, "Could not read %v, %v\n", path, err)
+			return 1
+		}
+	}
+	s.write(w)
+	return 0
+}
+
+// addFile adds the records in the mapping file or snapshot at path.
+func (s *mappingFileStats) addFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	reader := bufio.NewReader(file)
+	if mapping.IsSnapshot(reader) {
+		// Snapshots don't keep the bibIDs' suffixes.
+		m := map[uint32]uint64{}
+		err := mapping.ReadSnapshot(reader, m)
+		if err != nil {
+			return err
+		}
+		for _, bibID := range slices.Sorted(maps.Keys(m)) {
+			s.add(bibID, m[bibID], noSuffix)
+		}
+		return nil
+	}
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		bibID, exlID, err := mapping.ParseLine(scanner.Text())
+		if err != nil {
+			s.records++
+			s.invalid++
+			continue
+		}
+		s.add(bibID, exlID, bibIDSuffix(scanner.Text()))
+	}
+	return scanner.Err()
+}
+
+// add counts a record of a mapping.
+func (s *mappingFileStats) add(bibID uint32, exlID uint64, suffix string) {
+	s.records++
+	s.suffixes[suffix]++
+	id := strconv.FormatUint(exlID, 10)
+	if len(id) > mmsidInstitutionLength {
+		s.institutions[id[len(id)-mmsidInstitutionLength:]]++
+	}
+	_, present := s.mappings[bibID]
+	if present {
+		s.duplicates++
+		return
+	}
+	s.mappings[bibID] = exlID
+}
+
+// bibIDSuffix returns the institution suffix of the bibID in a mapping file line, like 01ocul_qu in a651520-01ocul_qu,
+// or noSuffix if it has none.
+func bibIDSuffix(line string) string {
+	fields := strings.Split(line, ",")
+	if len(fields) < 2 {
+		return noSuffix
+	}
+	_, suffix, found := strings.Cut(fields[1], "-")
+	suffix = strings.TrimSpace(suffix)
+	if !found || suffix == "" {
+		return noSuffix
+	}
+	return suffix
+}
+
+// write writes the statistics to w.
+func (s *mappingFileStats) write(w io.Writer) {
+	fmt.Fprintf(w, "Files:            %v\n", s.files)
+	fmt.Fprintf(w, "Records:          %v\n", s.records)
+	fmt.Fprintf(w, "Invalid lines:    %v\n", s.invalid)
+	fmt.Fprintf(w, "Duplicate bibIDs: %v\n", s.duplicates)
+	fmt.Fprintf(w, "Mapped bibIDs:    %v\n", len(s.mappings))
+	if len(s.mappings) > 0 {
+		bibIDs := slices.Sorted(maps.Keys(s.mappings))
+		first, last := bibIDs[0], bibIDs[len(bibIDs)-1]
+		// A low share of the range being mapped can mean an extract is partial.
+		fmt.Fprintf(w, "BibID range:      %v to %v, %.1f%% mapped\n", first, last, 100*float64(len(bibIDs))/(float64(last-first)+1))
+	}
+	writeDistribution(w, "BibID suffixes:", s.suffixes, s.records-s.invalid)
+	writeDistribution(w, "MMS ID institution codes:", s.institutions, s.records-s.invalid)
+
+	// MMS IDs mapped from more than one bibID are usually from records merged in Alma, or an extract which is mis-scoped.
+	reverse := buildReverseMap(mapping.NewMap(s.mappings))
+	var shared []uint64
+	for exlID, bibIDs := range reverse {
+		if len(bibIDs) > 1 {
+			shared = append(shared, exlID)
+		}
+	}
+	slices.Sort(shared)
+	fmt.Fprintf(w, "MMS IDs mapped from more than one bibID: %v\n", len(shared))
+	for i, exlID := range shared {
+		if i == statsListLimit {
+			fmt.Fprintf(w, "  %v more were not listed\n", len(shared)-statsListLimit)
+			break
+		}
+		bibIDs := make([]string, 0, len(reverse[exlID]))
+		for _, bibID := range reverse[exlID] {
+			bibIDs = append(bibIDs, strconv.FormatUint(uint64(bibID), 10))
+		}
+		fmt.Fprintf(w, "  %v: %v\n", exlID, strings.Join(bibIDs, ", "))
+	}
+}
+
+// writeDistribution writes the counts, most common first, with their share of the total.
+func writeDistribution(w io.Writer, title string, counts map[string]int, total int) {
+	fmt.Fprintln(w, title)
+	keys := slices.SortedFunc(maps.Keys(counts), func(a, b string) int {
+		return cmp.Or(cmp.Compare(counts[b], counts[a]), cmp.Compare(a, b))
+	})
+	for _, key := range keys {
+		fmt.Fprintf(w, "  %-12v %v (%.1f%%)\n", key, counts[key], 100*float64(counts[key])/float64(total))
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cu-library/permanentdetour/mapping"
+)
+
+func TestRunStats(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "mappings.csv")
+	err := os.WriteFile(path, []byte("996515203405158,a651520-01ocul_qu\n996515203405158,a651530-01ocul_qu\n991234503405170,651540\nnot a mapping\n996515213405158,a651520-01ocul_qu\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var snapshot bytes.Buffer
+	err = mapping.WriteSnapshot(&snapshot, map[uint32]uint64{651521: 996515213405158})
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshotPath := filepath.Join(dir, "mappings.snap")
+	err = os.WriteFile(snapshotPath, snapshot.Bytes(), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out strings.Builder
+	status := runStats(&out, []string{path, snapshotPath})
+	if status != 0 {
+		t.Fatalf("runStats() returned %v, not 0. Output:\n%v", status, out.String())
+	}
+	expected := strings.Join([]string{
+		"Files:            2",
+		"Records:          6",
+		"Invalid lines:    1",
+		"Duplicate bibIDs: 1",
+		"Mapped bibIDs:    4",
+		"BibID range:      651520 to 651540, 19.0% mapped",
+		"BibID suffixes:",
+		"  01ocul_qu    3 (60.0%)",
+		"  (none)       2 (40.0%)",
+		"MMS ID institution codes:",
+		"  5158         4 (80.0%)",
+		"  5170         1 (20.0%)",
+		"MMS IDs mapped from more than one bibID: 1",
+		"  996515203405158: 651520, 651530",
+	}, "\n") + "\n"
+	if out.String() != expected {
+		t.Fatalf("The statistics were\n%v\nnot\n%v", out.String(), expected)
+	}
+
+	out.Reset()
+	status = runStats(&out, []string{filepath.Join(dir, "missing.csv")})
+	if status != 1 {
+		t.Fatalf("runStats() of a missing file returned %v, not 1.", status)
+	}
+}
+
+func TestStatsListLimit(t *testing.T) {
+	var lines strings.Builder
+	for i := 0; i < statsListLimit+3; i++ {
+		fmt.Fprintf(&lines, "99%v3405158,a%v\n99%v3405158,a%v\n", i+10, 2*i+1, i+10, 2*i+2)
+	}
+	path := filepath.Join(t.TempDir(), "mappings.csv")
+	err := os.WriteFile(path, []byte(lines.String()), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out strings.Builder
+	runStats(&out, []string{path})
+	if !strings.Contains(out.String(), fmt.Sprintf("MMS IDs mapped from more than one bibID: %v\n", statsListLimit+3)) {
+		t.Fatalf("Not every shared MMS ID was counted. Output:\n%v", out.String())
+	}
+	if !strings.HasSuffix(out.String(), "  3 more were not listed\n") {
+		t.Fatalf("The shared MMS IDs which weren't listed weren't counted. Output:\n%v", out.String())
+	}
+}
+
+func TestBibIDSuffix(t *testing.T) {
+	var tests = []struct {
+		line     string
+		expected string
+	}{
+		{"996515203405158,a651520-01ocul_qu", "01ocul_qu"},
+		{"996515203405158,a651520-01ocul_qu,extra", "01ocul_qu"},
+		{"996515203405158,a651520", noSuffix},
+		{"996515203405158,a651520-", noSuffix},
+		{"not a mapping", noSuffix},
+	}
+	for _, tt := range tests {
+		suffix := bibIDSuffix(tt.line)
+		if suffix != tt.expected {
+			t.Errorf("The suffix of %q was %q, not %q.", tt.line, suffix, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultStatsDPrefix is the default prefix of the names of metrics sent to StatsD.
+const defaultStatsDPrefix string = "permanentdetour."
+
+// statsdClient sends metrics to a StatsD or DogStatsD server over UDP.
+// Sends are fire-and-forget, so an unavailable server never slows down requests.
+type statsdClient struct {
+	conn      net.Conn
+	prefix    string
+	dogstatsd bool // Whether to send labels as DogStatsD tags, instead of in the metric name.
+}
+
+// newStatsDClient returns a statsdClient which sends metrics to the server at address.
+func newStatsDClient(address, prefix string, dogstatsd bool) (*statsdClient, error) {
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, fmt.Errorf("Could not connect to StatsD server %v, %v.", address, err)
+	}
+	return &statsdClient{conn: conn, prefix: prefix, dogstatsd: dogstatsd}, nil
+}
+
+// count sends a counter increment.
+func (c *statsdClient) count(name string, value int64, tags ...string) {
+	c.send(name, strconv.FormatInt(value, 10), "c", tags)
+}
+
+// gauge sends a gauge value.
+func (c *statsdClient) gauge(name string, value int64, tags ...string) {
+	c.send(name, strconv.FormatInt(value, 10), "g", tags)
+}
+
+// timing sends a timer value in milliseconds.
+func (c *statsdClient) timing(name string, duration time.Duration, tags ...string) {
+	c.send(name, strconv.FormatFloat(duration.Seconds()*1000, 'f', -1, 64), "ms", tags)
+}
+
+// send formats and sends a metric. Tags are key:value pairs. Without DogStatsD, the tag values are
+// appended to the metric name, like permanentdetour.redirects.record.
+func (c *statsdClient) send(name, value, metricType string, tags []string) {
+	if c == nil {
+		return
+	}
+	var b strings.Builder
+	b.WriteString(c.prefix)
+	b.WriteString(name)
+	if !c.dogstatsd {
+		for _, tag := range tags {
+			b.WriteString(".")
+			b.WriteString(tag[strings.Index(tag, ":")+1:])
+		}
+	}
+	b.WriteString(":")
+	b.WriteString(value)
+	b.WriteString("|")
+	b.WriteString(metricType)
+	if c.dogstatsd && len(tags) > 0 {
+		b.WriteString("|#")
+		b.WriteString(strings.Join(tags, ","))
+	}
+	// Errors are ignored, as with any UDP StatsD client.
+	c.conn.Write([]byte(b.String()))
+}
@@ -0,0 +1,50 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestStatsDClient(t *testing.T) {
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	var tests = []struct {
+		dogstatsd bool
+		send      func(c *statsdClient)
+		expected  string
+	}{
+		{false, func(c *statsdClient) { c.count("requests", 1) }, "permanentdetour.requests:1|c"},
+		{false, func(c *statsdClient) { c.count("redirects", 1, "rule:record") }, "permanentdetour.redirects.record:1|c"},
+		{true, func(c *statsdClient) { c.count("redirects", 1, "rule:record") }, "permanentdetour.redirects:1|c|#rule:record"},
+		{false, func(c *statsdClient) { c.gauge("mappings", 42) }, "permanentdetour.mappings:42|g"},
+		{true, func(c *statsdClient) { c.timing("request_duration", 1500*time.Microsecond) }, "permanentdetour.request_duration:1.5|ms"},
+	}
+
+	buf := make([]byte, 512)
+	for _, tt := range tests {
+		t.Run(tt.expected, func(t *testing.T) {
+			c, err := newStatsDClient(server.LocalAddr().String(), defaultStatsDPrefix, tt.dogstatsd)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.send(c)
+			server.SetReadDeadline(time.Now().Add(time.Second))
+			n, _, err := server.ReadFrom(buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(buf[:n]) != tt.expected {
+				t.Fatalf("The StatsD client sent %q, not %q", buf[:n], tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"net/http"
+	"time"
+)
+
+// statusPath is the path of the admin endpoint which summarizes the service's state as JSON.
+const statusPath string = "/admin/status"
+
+// serviceStatus is the body of the status endpoint.
+type serviceStatus struct {
+	Version         string         `json:"version"`
+	UptimeSeconds   int64          `json:"uptimeSeconds"`
+	Mappings        int64          `json:"mappings"`
+	Requests        uint64         `json:"requests"`
+	RequestDuration latencySummary `json:"requestDuration"`
+	LookupDuration  latencySummary `json:"lookupDuration"`
+	Memory          memoryUsage    `json:"memory"`
+}
+
+// statusHandler serves the status endpoint.
+type statusHandler struct {
+	started time.Time
+	metrics *Metrics
+	memory  memoryUsage // The memory used by the mapping store, measured when it was loaded.
+}
+
+// status returns the current status.
+func (h statusHandler) status(now time.Time) serviceStatus {
+	return serviceStatus{
+		Version:         version,
+		UptimeSeconds:   int64(now.Sub(h.started).Seconds()),
+		Mappings:        h.metrics.mappings.Load(),
+		Requests:        h.metrics.requests.Load(),
+		RequestDuration: h.metrics.latency.summary(),
+		LookupDuration:  h.metrics.lookups.summary(),
+		Memory:          h.memory.current(),
+	}
+}
+
+// ServeHTTP responds with the status as JSON.
+func (h statusHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, h.status(time.Now()))
+}
@@ -0,0 +1,40 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cu-library/permanentdetour/mapping"
+)
+
+func TestStatus(t *testing.T) {
+	d := Detourer{
+		store:   mapping.NewMap(map[uint32]uint64{651520: 996515203405158}),
+		primo:   "ocul-qu.primo.exlibrisgroup.com",
+		vid:     "01OCUL_QU:QU_DEFAULT",
+		metrics: NewMetrics(),
+	}
+	d.metrics.setMappings(d.store.Len())
+	Chain(observed(d), countRequests(d.metrics)).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/vwebv/holdingsInfo?bibId=651520", nil))
+
+	h := statusHandler{started: time.Now().Add(-time.Minute), metrics: d.metrics}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", statusPath, nil))
+	var status serviceStatus
+	err := json.Unmarshal(w.Body.Bytes(), &status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.UptimeSeconds != 60 || status.Mappings != 1 || status.Requests != 1 {
+		t.Fatalf("The status was %+v.", status)
+	}
+	if status.RequestDuration.Count != 1 || status.LookupDuration.Count != 1 {
+		t.Fatalf("The request and lookup durations weren't both observed once: %+v", status)
+	}
+}
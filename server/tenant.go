@@ -0,0 +1,219 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/cu-library/permanentdetour/mapping"
+)
+
+// tenantConfig is a tenant in the configuration file: a retired catalogue hostname whose requests are
+// redirected to its own Primo instance and vid, with its own mappings.
+type tenantConfig struct {
+	Name      string   `json:"name"`
+	Hosts     []string `json:"hosts"`               // The hostnames whose requests are served by the tenant, like catalogue.library.queensu.ca.
+	Primo     string   `json:"primo,omitempty"`     // The subdomain of the tenant's Primo instance.
+	PrimoHost string   `json:"primoHost,omitempty"` // The host of the tenant's Primo instance, when it is behind a custom hostname.
+	VID       string   `json:"vid,omitempty"`       // The tenant's vid parameter for Primo.
+	Fallback  string   `json:"fallback,omitempty"`  // The URL the tenant's requests which match no rule are redirected to.
+	Mappings  []string `json:"mappings,omitempty"`  // The tenant's mapping files. The mappings given as arguments are used when empty.
+	AccessLog string   `json:"accessLog,omitempty"` // A file to write the tenant's own access log to, in addition to -access-log.
+}
+
+// router chooses the Detourer for a request by its Host header.
+type router struct {
+	def   Detourer             // Serves requests for hosts which aren't a tenant's.
+	hosts map[string]*Detourer // The tenants' Detourers, by lower case hostname.
+}
+
+// forHost returns the Detourer for the host, which may include a port.
+func (rt *router) forHost(host string) Detourer {
+	if len(rt.hosts) == 0 {
+		return rt.def
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	t, present := rt.hosts[strings.ToLower(host)]
+	if !present {
+		return rt.def
+	}
+	return *t
+}
+
+// forRequest returns the Detourer for the request's host.
+func (rt *router) forRequest(r *http.Request) Detourer {
+	return rt.forHost(r.Host)
+}
+
+// validateTenants checks the tenants have unique names and hosts. The error lists every invalid tenant setting.
+func validateTenants(tenants []tenantConfig) error {
+	var names, hosts []string
+	var errs []error
+	for i, tc := range tenants {
+		if tc.Name == "" || slices.Contains(names, tc.Name) {
+			errs = append(errs, fmt.Errorf("tenant %v has no name, or the name of another tenant", i+1))
+		}
+		names = append(names, tc.Name)
+		if len(tc.Hosts) == 0 {
+			errs = append(errs, fmt.Errorf("tenant %v has no hosts", tc.Name))
+		}
+		for _, host := range tc.Hosts {
+			host = strings.ToLower(host)
+			if host == "" || slices.Contains(hosts, host) {
+				errs = append(errs, fmt.Errorf("tenant %v has an empty host, or the host of another tenant", tc.Name))
+				continue
+			}
+			hosts = append(hosts, host)
+		}
+		if tc.PrimoHost != "" {
+			_, _, err := parsePrimoHost(tc.PrimoHost)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("invalid Primo host of tenant %v, %w", tc.Name, err))
+			}
+		}
+		if tc.Fallback != "" {
+			_, err := parseRedirectTarget(tc.Fallback)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("invalid fallback of tenant %v, %w", tc.Name, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// tenantMappings are the mappings loaded from a tenant's mapping files.
+type tenantMappings struct {
+	store      *mapping.SwappableStore // Swappable, so the mappings can be reloaded.
+	reverseMap map[uint64][]uint32
+}
+
+// buildTenants returns the tenants' Detourers by lower case hostname, each a copy of d with the tenant's settings,
+// and the tenants' mappings by their mapping files. Mappings in previous are reused instead of loading the files again.
+// Relative mapping file paths are relative to dir.
+func buildTenants(d Detourer, tenants []tenantConfig, dir string, previous map[string]tenantMappings) (map[string]*Detourer, map[string]tenantMappings, error) {
+	hosts := map[string]*Detourer{}
+	loaded := map[string]tenantMappings{}
+	for _, tc := range tenants {
+		t := d
+		t.tenant = tc.Name
+		// The canary is a pilot of the default hosts' view, not the tenant's.
+		t.canary = nil
+		if tc.Primo != "" {
+			t.setPrimoSubdomain(tc.Primo)
+		}
+		if tc.PrimoHost != "" {
+			err := t.setPrimoHost(tc.PrimoHost)
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid Primo host of tenant %v, %w", tc.Name, err)
+			}
+		}
+		if tc.VID != "" {
+			t.vid = tc.VID
+		}
+		if tc.Fallback != "" {
+			fallback, err := parseRedirectTarget(tc.Fallback)
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid fallback of tenant %v, %w", tc.Name, err)
+			}
+			t.fallback = fallback
+		}
+		if len(tc.Mappings) > 0 {
+			paths := make([]string, 0, len(tc.Mappings))
+			for _, path := range tc.Mappings {
+				if !filepath.IsAbs(path) {
+					path = filepath.Join(dir, path)
+				}
+				paths = append(paths, path)
+			}
+			key := strings.Join(paths, "\n")
+			m, present := loaded[key]
+			if !present {
+				m, present = previous[key]
+			}
+			if !present {
+				loadedMap, err := mapping.LoadMap(paths...)
+				if err != nil {
+					return nil, nil, fmt.Errorf("Could not load the mappings of tenant %v, %w", tc.Name, err)
+				}
+				store := mapping.NewSwappableStore(loadedMap)
+				m = tenantMappings{store: store}
+				if d.reverseMap != nil {
+					m.reverseMap = buildReverseMap(store)
+				}
+				loaded[key] = m
+			}
+			t.store, t.reverseMap = m.store, m.reverseMap
+		}
+		for _, host := range tc.Hosts {
+			hosts[strings.ToLower(host)] = &t
+		}
+	}
+	return hosts, loaded, nil
+}
+
+// openTenantAccessLogs sets the access log of each tenant's Detourer in hosts, and returns the logs by path.
+// Logs in previous are reused, instead of opening the files again. Relative paths are relative to dir.
+func openTenantAccessLogs(tenants []tenantConfig, hosts map[string]*Detourer, dir string, previous map[string]*rotatingFile, rotation logRotation) (map[string]*rotatingFile, error) {
+	opened := map[string]*rotatingFile{}
+	for _, tc := range tenants {
+		if tc.AccessLog == "" {
+			continue
+		}
+		path := tc.AccessLog
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		f, present := opened[path]
+		if !present {
+			f, present = previous[path]
+		}
+		if !present {
+			var err error
+			f, err = newRotatingFile(path, rotation.maxSize, rotation.maxAge)
+			if err != nil {
+				closeUnusedLogs(opened, previous)
+				return nil, fmt.Errorf("Could not open the access log of tenant %v, %w", tc.Name, err)
+			}
+		}
+		opened[path] = f
+		// The tenant's hosts share one Detourer.
+		hosts[strings.ToLower(tc.Hosts[0])].accessLog = f
+	}
+	return opened, nil
+}
+
+// closeUnusedLogs closes the logs in previous which aren't in current.
+func closeUnusedLogs(previous, current map[string]*rotatingFile) {
+	for path, f := range previous {
+		if current[path] != f {
+			f.Close()
+		}
+	}
+}
+
+// logAccess serves the request with serve, then writes it to the tenant's access log, if it has one.
+func (d Detourer) logAccess(w http.ResponseWriter, r *http.Request, serve http.HandlerFunc) {
+	if d.accessLog == nil {
+		serve(w, r)
+		return
+	}
+	received := time.Now()
+	rec := &statusRecorder{ResponseWriter: w}
+	serve(rec, r)
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	io.WriteString(d.accessLog, combinedLogLine(r, d.anonymizer, rec.status, rec.bytes, received))
+}
@@ -0,0 +1,145 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cu-library/permanentdetour/mapping"
+)
+
+func TestTenants(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "law.csv"), []byte("996515203405159,a651520-01ocul_qu\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "config.json")
+	err = os.WriteFile(path, []byte(`{"tenants":[
+		{"name":"law","hosts":["lawcat.queensu.ca"],"primo":"ocul-ql","vid":"01OCUL_QL:QL_DEFAULT","mappings":["law.csv"]},
+		{"name":"health","hosts":["healthcat.queensu.ca"],"vid":"01OCUL_QU:HEALTH"}
+	]}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := Detourer{
+		store: mapping.NewMap(map[uint32]uint64{651520: 996515203405158}),
+		primo: "ocul-qu.primo.exlibrisgroup.com",
+		vid:   "01OCUL_QU:QU_DEFAULT",
+	}
+	l, err := newLiveDetourer(base, path, logRotation{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		host     string
+		location string
+	}{
+		{"catalogue.library.queensu.ca", "https://ocul-qu.primo.exlibrisgroup.com/discovery/fulldisplay?docid=alma996515203405158&vid=01OCUL_QU%3AQU_DEFAULT"},
+		{"LawCat.queensu.ca:8877", "https://ocul-ql.primo.exlibrisgroup.com/discovery/fulldisplay?docid=alma996515203405159&vid=01OCUL_QL%3AQL_DEFAULT"},
+		{"healthcat.queensu.ca", "https://ocul-qu.primo.exlibrisgroup.com/discovery/fulldisplay?docid=alma996515203405158&vid=01OCUL_QU%3AHEALTH"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/vwebv/holdingsInfo?bibId=651520", nil)
+		r.Host = tt.host
+		w := httptest.NewRecorder()
+		l.ServeHTTP(w, r)
+		if w.Header().Get("Location") != tt.location {
+			t.Fatalf("For %v, the redirect was to %v, not %v.", tt.host, w.Header().Get("Location"), tt.location)
+		}
+	}
+
+	// Unchanged mapping files aren't loaded again on reload.
+	lawStore := l.current.Load().hosts["lawcat.queensu.ca"].store
+	os.Remove(filepath.Join(dir, "law.csv"))
+	err = l.reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.current.Load().hosts["lawcat.queensu.ca"].store != lawStore {
+		t.Fatal("The tenant's mappings were loaded again on reload.")
+	}
+}
+
+func TestTenantLogsAndMetrics(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	err := os.WriteFile(path, []byte(`{"tenants":[
+		{"name":"law","hosts":["lawcat.queensu.ca"],"vid":"01OCUL_QL:QL_DEFAULT","accessLog":"law.log"},
+		{"name":"health","hosts":["healthcat.queensu.ca"],"vid":"01OCUL_QU:HEALTH"}
+	]}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var logs bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+
+	base := Detourer{
+		store:   mapping.NewMap(map[uint32]uint64{651520: 996515203405158}),
+		primo:   "ocul-qu.primo.exlibrisgroup.com",
+		vid:     "01OCUL_QU:QU_DEFAULT",
+		metrics: NewMetrics(),
+	}
+	l, err := newLiveDetourer(base, path, logRotation{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.close()
+	for _, host := range []string{"lawcat.queensu.ca", "healthcat.queensu.ca", "catalogue.library.queensu.ca"} {
+		r := httptest.NewRequest("GET", "/vwebv/holdingsInfo?bibId=651520", nil)
+		r.Host = host
+		observed(l).ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	accessLog, err := os.ReadFile(filepath.Join(dir, "law.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(string(accessLog), "\n") != 1 || !strings.Contains(string(accessLog), `"GET /vwebv/holdingsInfo?bibId=651520 HTTP/1.1" 307`) {
+		t.Fatalf("The tenant's access log was %q, not one line for its request.", accessLog)
+	}
+	if !strings.Contains(logs.String(), "tenant=law") || !strings.Contains(logs.String(), "tenant=health") {
+		t.Fatalf("The log messages weren't tagged with the tenants:\n%v", logs.String())
+	}
+
+	var metrics strings.Builder
+	base.metrics.WriteTo(&metrics)
+	for _, expected := range []string{
+		`permanentdetour_redirects_total{rule="record"} 3`,
+		`permanentdetour_tenant_redirects_total{tenant="health",rule="record"} 1`,
+		`permanentdetour_tenant_redirects_total{tenant="law",rule="record"} 1`,
+	} {
+		if !strings.Contains(metrics.String(), expected) {
+			t.Fatalf("The metrics didn't include %v:\n%v", expected, metrics.String())
+		}
+	}
+}
+
+func TestValidateTenants(t *testing.T) {
+	var tests = []struct {
+		name    string
+		tenants []tenantConfig
+		err     string
+	}{
+		{"no name", []tenantConfig{{Hosts: []string{"a"}}}, "no name"},
+		{"no hosts", []tenantConfig{{Name: "a"}}, "no hosts"},
+		{"shared host", []tenantConfig{{Name: "a", Hosts: []string{"a"}}, {Name: "b", Hosts: []string{"A"}}}, "another tenant"},
+		{"relative fallback", []tenantConfig{{Name: "a", Hosts: []string{"a"}, Fallback: "/"}}, "invalid fallback"},
+	}
+	for _, tt := range tests {
+		err := validateTenants(tt.tenants)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Fatalf("For %v, validateTenants() returned %v, not an error containing %q.", tt.name, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	_ "embed"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/cu-library/permanentdetour/detour"
+)
+
+const (
+	// testPagePath is the path of the admin page on which staff can translate a legacy URL or bibID.
+	testPagePath string = "/admin/test"
+
+	// testPageCSP is the Content-Security-Policy of the test page, which has inline styles and a form, but no scripts.
+	testPageCSP string = "default-src 'none'; style-src 'unsafe-inline'; frame-ancestors 'none'; base-uri 'none'; form-action 'self'"
+)
+
+//go:embed web/test.html
+var testPageHTML string
+
+// testPageTemplate renders the test page.
+var testPageTemplate = template.Must(template.New("test").Parse(testPageHTML))
+
+// testPageData is the data rendered by the test page template.
+type testPageData struct {
+	Version     string
+	Input       string            // The legacy URL or bibID which was entered.
+	Translation *translationDebug // The translation, or nil if nothing was entered or it couldn't be translated.
+	Error       string
+}
+
+// testPageURL returns the legacy URL to translate for the input, a legacy URL, or a bibID, which is translated
+// like a record link.
+func testPageURL(input string) string {
+	_, err := strconv.ParseUint(input, 10, 64)
+	if err == nil {
+		return detour.RecordPrefix + "?bibId=" + input
+	}
+	return input
+}
+
+// serveTestPage renders a form on which a legacy URL or bibID can be entered, and how it is translated by the
+// current configuration, like with the translate subcommand. The translation isn't counted.
+func (l *liveDetourer) serveTestPage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method not allowed.", http.StatusMethodNotAllowed)
+		return
+	}
+	data := testPageData{Version: version, Input: strings.TrimSpace(r.URL.Query().Get("url"))}
+	if data.Input != "" {
+		tr, err := translateURL(l.current.Load(), testPageURL(data.Input))
+		if err != nil {
+			data.Error = err.Error()
+		} else {
+			td := newTranslationDebug(http.MethodGet, tr)
+			data.Translation = &td
+		}
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", testPageCSP)
+	w.Header().Set("Cache-Control", "no-store")
+	err := testPageTemplate.Execute(w, data)
+	if err != nil {
+		slog.Error("Error rendering test page.", "err", err)
+	}
+}
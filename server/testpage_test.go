@@ -0,0 +1,73 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/cu-library/permanentdetour/mapping"
+)
+
+func TestTestPage(t *testing.T) {
+	base := Detourer{
+		store:   mapping.NewMap(map[uint32]uint64{651520: 996515203405158}),
+		primo:   "ocul-qu.primo.exlibrisgroup.com",
+		vid:     "01OCUL_QU:QU_DEFAULT",
+		metrics: NewMetrics(),
+	}
+	l, err := newLiveDetourer(base, "", logRotation{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		input    string
+		expected []string
+	}{
+		{"", []string{`<form method="get" action="test">`}},
+		{"651520", []string{
+			"<td>record, mapped</td>",
+			"<td>651520</td>",
+			"Yes, to MMS ID 996515203405158",
+			`<a href="https://ocul-qu.primo.exlibrisgroup.com/discovery/fulldisplay?docid=alma996515203405158&amp;vid=01OCUL_QU%3AQU_DEFAULT">`,
+		}},
+		{"https://catalogue.library.queensu.ca/vwebv/holdingsInfo?bibId=42", []string{
+			"<td>record, unmapped</td>",
+			"<td>No</td>",
+		}},
+		{"/favicon.ico", []string{`<p class="error">/favicon.ico is not translated, it is answered with status 404</p>`}},
+		{`"><script>`, []string{`value="&#34;&gt;&lt;script&gt;"`}},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		l.serveTestPage(w, httptest.NewRequest("GET", testPagePath+"?url="+url.QueryEscape(tt.input), nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("The test page for %q returned %v, not 200.", tt.input, w.Code)
+		}
+		if w.Header().Get("Content-Security-Policy") != testPageCSP {
+			t.Fatalf("The test page's Content-Security-Policy was %q.", w.Header().Get("Content-Security-Policy"))
+		}
+		for _, expected := range tt.expected {
+			if !strings.Contains(w.Body.String(), expected) {
+				t.Errorf("The test page for %q didn't contain %q. Body:\n%v", tt.input, expected, w.Body.String())
+			}
+		}
+	}
+
+	// Tests aren't counted.
+	if base.metrics.requests.Load() != 0 {
+		t.Fatalf("%v requests were counted, not 0.", base.metrics.requests.Load())
+	}
+
+	w := httptest.NewRecorder()
+	l.serveTestPage(w, httptest.NewRequest("POST", testPagePath, nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("A POST to the test page returned %v, not 405.", w.Code)
+	}
+}
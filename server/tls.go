@@ -0,0 +1,69 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// certReloader holds a TLS certificate which can be reloaded from disk, so renewed certificates
+// can be used without a restart.
+type certReloader struct {
+	certFile string
+	keyFile  string
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+}
+
+// newCertReloader loads the certificate and key, and returns a certReloader for them.
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	c := &certReloader{certFile: certFile, keyFile: keyFile}
+	err := c.reload()
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// reload loads the certificate and key from disk. If they can't be loaded, the previous certificate is kept.
+func (c *certReloader) reload() error {
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return fmt.Errorf("Could not load TLS certificate %v and key %v, %v.", c.certFile, c.keyFile, err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cert = &cert
+	return nil
+}
+
+// reloadOnSIGHUP reloads the certificate and key whenever the process receives a SIGHUP signal.
+func (c *certReloader) reloadOnSIGHUP() {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGHUP)
+	go func() {
+		for range sigs {
+			err := c.reload()
+			if err != nil {
+				slog.Error("Could not reload TLS certificate.", "err", err)
+				continue
+			}
+			slog.Info("Reloaded TLS certificate.", "cert", c.certFile)
+		}
+	}()
+}
+
+// getCertificate returns the current certificate. It is used as the GetCertificate function of a tls.Config.
+func (c *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cert, nil
+}
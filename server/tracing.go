@@ -0,0 +1,58 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the name of the tracer used to create spans.
+const tracerName string = "github.com/cu-library/permanentdetour"
+
+// Span attribute keys.
+const (
+	attrRule       = attribute.Key("detour.rule")
+	attrBibID      = attribute.Key("detour.bib_id")
+	attrMappingHit = attribute.Key("detour.mapping.hit")
+	attrTargetHost = attribute.Key("detour.target.host")
+)
+
+// tracer creates spans for requests. Until tracing is set up, spans are discarded. Tests replace it with their own.
+var tracer = otel.Tracer(tracerName)
+
+// setupTracing exports traces over OTLP/HTTP to the endpoint, and accepts W3C trace context
+// from incoming requests. The returned function flushes and stops the exporter.
+func setupTracing(ctx context.Context, endpoint string) (func(context.Context) error, error) {
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(endpoint))
+	if err != nil {
+		return nil, fmt.Errorf("Could not create OTLP trace exporter for %v, %v.", endpoint, err)
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(
+			semconv.ServiceName("permanentdetour"),
+			semconv.ServiceVersion(version),
+		)),
+	)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return tp.Shutdown, nil
+}
+
+// startRequestSpan starts a server span for the request, continuing any trace the request is part of.
+func startRequestSpan(ctx context.Context, header propagation.HeaderCarrier, name string) (context.Context, trace.Span) {
+	ctx = otel.GetTextMapPropagator().Extract(ctx, header)
+	return tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindServer))
+}
@@ -0,0 +1,50 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cu-library/permanentdetour/mapping"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestRequestSpans(t *testing.T) {
+	// The spans are recorded by a tracer of the test's own, as the global tracer provider can only be set once.
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous := tracer
+	tracer = provider.Tracer(tracerName)
+	t.Cleanup(func() {
+		tracer = previous
+		provider.Shutdown(context.Background())
+	})
+
+	d := Detourer{
+		store: mapping.NewMap(map[uint32]uint64{651520: 996515203405158}),
+		primo: "ocul-qu.primo.exlibrisgroup.com",
+		vid:   "01OCUL_QU:QU_DEFAULT",
+	}
+	observed(d).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/vwebv/holdingsInfo?bibId=651520", nil))
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("%v spans were recorded, not 1", len(spans))
+	}
+	attributes := map[attribute.Key]attribute.Value{}
+	for _, kv := range spans[0].Attributes() {
+		attributes[kv.Key] = kv.Value
+	}
+	if attributes[attrRule].AsString() != "record" ||
+		attributes[attrBibID].AsInt64() != 651520 ||
+		!attributes[attrMappingHit].AsBool() ||
+		attributes[attrTargetHost].AsString() != "ocul-qu.primo.exlibrisgroup.com" {
+		t.Fatalf("The span had unexpected attributes %v", spans[0].Attributes())
+	}
+}
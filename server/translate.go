@@ -0,0 +1,231 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cu-library/permanentdetour/mapping"
+)
+
+// translateCommand is the subcommand which prints where legacy URLs are redirected to, instead of serving.
+const translateCommand string = "translate"
+
+// batchHeader is the header row of the CSV written by translate -batch.
+var batchHeader = []string{"source", "rule", "target", "mapping", "error"}
+
+// translateSettings are the settings legacy URLs are translated with by the translate and export subcommands.
+type translateSettings struct {
+	primo          string
+	primoHost      string
+	vid            string
+	sandbox        bool
+	proxyHosts     []string
+	noisePaths     []string
+	redirectStatus int
+	configPath     string
+	mappingFiles   []string
+}
+
+// newTranslationRouter returns the router which serves requests with the settings, the mappings,
+// and the configuration file and the cutovers which are due applied, like the server at startup.
+// The canary and maintenance mode aren't used, as the translation is the same with and without them.
+func newTranslationRouter(s translateSettings) (*router, error) {
+	store, err := mapping.LoadMap(s.mappingFiles...)
+	if err != nil {
+		return nil, err
+	}
+	opts := []Option{
+		WithVID(s.vid),
+		WithSandbox(s.sandbox),
+		WithProxyHosts(s.proxyHosts...),
+		WithNoisePaths(s.noisePaths...),
+	}
+	if s.primo != "" {
+		opts = append(opts, WithPrimo(s.primo))
+	}
+	if s.primoHost != "" {
+		opts = append(opts, WithPrimoHost(s.primoHost))
+	}
+	if s.redirectStatus != 0 {
+		opts = append(opts, WithRedirectStatus(s.redirectStatus))
+	}
+	d, err := NewDetourer(store, opts...)
+	if err != nil {
+		return nil, err
+	}
+	// The translation is printed, so per-request log messages would only repeat it.
+	d.logs, _ = newLogSampler(logCategories, 0)
+	rt := &router{def: d}
+	if s.configPath != "" {
+		c, err := loadConfigFile(s.configPath)
+		if err != nil {
+			return nil, err
+		}
+		d, err = c.apply(d)
+		if err != nil {
+			return nil, err
+		}
+		due, _ := dueCutovers(c.Cutovers, time.Now())
+		d, err = applyCutovers(d, due)
+		if err != nil {
+			return nil, err
+		}
+		hosts, _, err := buildTenants(d, c.Tenants, filepath.Dir(s.configPath), nil)
+		if err != nil {
+			return nil, err
+		}
+		rt = &router{def: d, hosts: hosts}
+	}
+	err = rt.def.checkPrimo()
+	if err != nil {
+		return nil, err
+	}
+	return rt, nil
+}
+
+// translateURL returns how a GET request for the legacy URL is translated. The URL's host chooses the tenant.
+func translateURL(rt *router, rawURL string) (TranslationResult, error) {
+	r, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return TranslationResult{}, fmt.Errorf("Could not parse URL %v, %w", rawURL, err)
+	}
+	d := rt.forRequest(r)
+	if status := d.refusal(r); status != 0 {
+		return TranslationResult{}, fmt.Errorf("%v is not translated, it is answered with status %v", rawURL, status)
+	}
+	return d.Translate(r), nil
+}
+
+// runTranslate prints where the legacy URL is redirected to, and the rule which matched it, to w.
+// It returns the exit status, 1 if the URL couldn't be translated, or 2 if no URL was given.
+func runTranslate(w io.Writer, s translateSettings, rawURL string) int {
+	if rawURL == "" {
+		fmt.Fprintf(w, "Usage: permanentdetour %v [flag...] url [file...]\n", translateCommand)
+		return 2
+	}
+	rt, err := newTranslationRouter(s)
+	if err != nil {
+		fmt.Fprintln(w, err)
+		return 1
+	}
+	tr, err := translateURL(rt, rawURL)
+	if err != nil {
+		fmt.Fprintln(w, err)
+		return 1
+	}
+	writeTranslation(w, tr)
+	return 0
+}
+
+// writeTranslation writes the description of a translation to w.
+func writeTranslation(w io.Writer, tr TranslationResult) {
+	fmt.Fprintf(w, "URL:    %v\n", tr.URL)
+	if tr.Tenant != "" {
+		fmt.Fprintf(w, "Tenant: %v\n", tr.Tenant)
+	}
+	if tr.Branch != "" {
+		fmt.Fprintf(w, "Rule:   %v, %v\n", tr.Rule, tr.Branch)
+	} else {
+		fmt.Fprintf(w, "Rule:   %v\n", tr.Rule)
+	}
+	if tr.hasBibID() {
+		fmt.Fprintf(w, "BibID:  %v\n", tr.BibID)
+	}
+	if tr.Found {
+		fmt.Fprintf(w, "MMS ID: %v\n", tr.MMSID)
+	}
+	if tr.Err != nil {
+		fmt.Fprintf(w, "Error:  %v\n", tr.Err)
+	}
+	fmt.Fprintf(w, "Target: %v\n", tr.Target)
+	fmt.Fprintf(w, "Status: %v\n", tr.Status)
+}
+
+// runTranslateBatch translates the legacy URLs in the file at path, one on each line, or standard input if the
+// path is -, and writes the source URL, matched rule, target URL, and whether the bibID was mapped to w as CSV.
+// Blank lines and lines starting with # are skipped. URLs which can't be translated are written with the error.
+// It returns the exit status, 1 if the settings are invalid or any URL couldn't be translated.
+func runTranslateBatch(w io.Writer, s translateSettings, path string) int {
+	rt, err := newTranslationRouter(s)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	var input io.Reader = os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Could not open batch file %v, %v\n", path, err)
+			return 1
+		}
+		defer file.Close()
+		input = file
+	}
+	status, err := translateBatch(w, rt, input)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not translate batch file %v, %v\n", path, err)
+		return 1
+	}
+	return status
+}
+
+// translateBatch translates the legacy URLs read from r, writing the CSV to w. It returns the exit status.
+func translateBatch(w io.Writer, rt *router, r io.Reader) (int, error) {
+	out := csv.NewWriter(w)
+	err := out.Write(batchHeader)
+	if err != nil {
+		return 1, err
+	}
+	status := 0
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		rawURL := strings.TrimSpace(scanner.Text())
+		if rawURL == "" || strings.HasPrefix(rawURL, "#") {
+			continue
+		}
+		tr, err := translateURL(rt, rawURL)
+		if err != nil {
+			status = 1
+			err = out.Write([]string{rawURL, "", "", "", err.Error()})
+		} else {
+			err = out.Write([]string{rawURL, tr.Rule, tr.Target.String(), batchMapping(tr), batchError(tr)})
+		}
+		if err != nil {
+			return 1, err
+		}
+	}
+	err = scanner.Err()
+	if err != nil {
+		return 1, err
+	}
+	out.Flush()
+	return status, out.Error()
+}
+
+// batchMapping returns whether the bibID of a record link's translation was mapped, unmapped, or invalid,
+// or empty for the other rules.
+func batchMapping(tr TranslationResult) string {
+	if !tr.record {
+		return ""
+	}
+	return tr.Branch
+}
+
+// batchError returns why the bibID of a record link's translation was invalid, or couldn't be looked up, or empty.
+func batchError(tr TranslationResult) string {
+	if tr.Err == nil {
+		return ""
+	}
+	return tr.Err.Error()
+}
@@ -0,0 +1,156 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunTranslate(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		err := os.WriteFile(path, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	mappings := write("mappings.csv", "996515203405158,a651520-01ocul_qu\n")
+	write("law.csv", "991234503405158,a12345-01ocul_qu\n")
+	config := write("config.json", `{"redirectStatus":301,"tenants":[{"name":"law","hosts":["lawcat.queensu.ca"],"vid":"01OCUL_QU:LAW","mappings":["law.csv"]}]}`)
+	settings := translateSettings{primo: "ocul-qu", vid: "01OCUL_QU:QU_DEFAULT", configPath: config, mappingFiles: []string{mappings}}
+
+	var tests = []struct {
+		name     string
+		settings translateSettings
+		url      string
+		status   int
+		output   []string
+	}{
+		{
+			"mapped",
+			settings,
+			"https://catalogue.library.queensu.ca/vwebv/holdingsInfo?bibId=651520",
+			0,
+			[]string{
+				"URL:    https://catalogue.library.queensu.ca/vwebv/holdingsInfo?bibId=651520",
+				"Rule:   record, mapped",
+				"BibID:  651520",
+				"MMS ID: 996515203405158",
+				"Target: https://ocul-qu.primo.exlibrisgroup.com/discovery/fulldisplay?docid=alma996515203405158&vid=01OCUL_QU%3AQU_DEFAULT",
+				"Status: 301",
+			},
+		},
+		{
+			"tenant",
+			settings,
+			"http://lawcat.queensu.ca/vwebv/holdingsInfo?bibId=12345",
+			0,
+			[]string{
+				"URL:    http://lawcat.queensu.ca/vwebv/holdingsInfo?bibId=12345",
+				"Tenant: law",
+				"Rule:   record, mapped",
+				"BibID:  12345",
+				"MMS ID: 991234503405158",
+				"Target: https://ocul-qu.primo.exlibrisgroup.com/discovery/fulldisplay?docid=alma991234503405158&vid=01OCUL_QU%3ALAW",
+				"Status: 301",
+			},
+		},
+		{
+			"invalid bibID",
+			translateSettings{primo: "ocul-qu", vid: "01OCUL_QU:QU_DEFAULT"},
+			"/vwebv/holdingsInfo?bibId=abc",
+			0,
+			[]string{
+				"URL:    /vwebv/holdingsInfo?bibId=abc",
+				"Rule:   record, invalid",
+				"Error:  ",
+				"Target: https://ocul-qu.primo.exlibrisgroup.com/discovery/search?vid=01OCUL_QU%3AQU_DEFAULT",
+				"Status: 307",
+			},
+		},
+		{
+			"noise",
+			translateSettings{primo: "ocul-qu", vid: "01OCUL_QU:QU_DEFAULT"},
+			"/favicon.ico",
+			1,
+			[]string{"/favicon.ico is not translated, it is answered with status 404"},
+		},
+		{
+			"not configured",
+			translateSettings{},
+			"/vwebv/search",
+			1,
+			[]string{"Set -primo"},
+		},
+		{
+			"no URL",
+			settings,
+			"",
+			2,
+			[]string{"Usage: permanentdetour translate"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			status := runTranslate(&out, tt.settings, tt.url)
+			if status != tt.status {
+				t.Fatalf("runTranslate() returned %v, not %v. Output:\n%v", status, tt.status, out.String())
+			}
+			lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+			if len(lines) != len(tt.output) {
+				t.Fatalf("The output had %v lines, not %v. Output:\n%v", len(lines), len(tt.output), out.String())
+			}
+			for i, expected := range tt.output {
+				if !strings.HasPrefix(lines[i], expected) {
+					t.Fatalf("Line %v of the output didn't start with %q. Output:\n%v", i+1, expected, out.String())
+				}
+			}
+		})
+	}
+}
+
+func TestTranslateBatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mappings.csv")
+	err := os.WriteFile(path, []byte("996515203405158,a651520-01ocul_qu\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rt, err := newTranslationRouter(translateSettings{primo: "ocul-qu", vid: "01OCUL_QU:QU_DEFAULT", mappingFiles: []string{path}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := strings.Join([]string{
+		"# Links from the library website",
+		"https://catalogue.library.queensu.ca/vwebv/holdingsInfo?bibId=651520",
+		"",
+		"https://catalogue.library.queensu.ca/vwebv/holdingsInfo?bibId=651521",
+		"/vwebv/my",
+		"/favicon.ico",
+	}, "\n")
+	var out strings.Builder
+	status, err := translateBatch(&out, rt, strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != 1 {
+		t.Fatalf("translateBatch() returned %v, not 1.", status)
+	}
+	expected := strings.Join([]string{
+		"source,rule,target,mapping,error",
+		"https://catalogue.library.queensu.ca/vwebv/holdingsInfo?bibId=651520,record,https://ocul-qu.primo.exlibrisgroup.com/discovery/fulldisplay?docid=alma996515203405158&vid=01OCUL_QU%3AQU_DEFAULT,mapped,",
+		"https://catalogue.library.queensu.ca/vwebv/holdingsInfo?bibId=651521,record,https://ocul-qu.primo.exlibrisgroup.com/discovery/search?vid=01OCUL_QU%3AQU_DEFAULT,unmapped,",
+		"/vwebv/my,patron,https://ocul-qu.primo.exlibrisgroup.com/discovery/login?vid=01OCUL_QU%3AQU_DEFAULT,,",
+		"/favicon.ico,,,,\"/favicon.ico is not translated, it is answered with status 404\"",
+	}, "\n") + "\n"
+	if out.String() != expected {
+		t.Fatalf("The CSV was\n%v\nnot\n%v", out.String(), expected)
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"slices"
+
+	"github.com/cu-library/permanentdetour/detour"
+)
+
+// TranslationResult is how a request was translated. The redirect, the debug description, the translate
+// subcommand, and the metrics and logs of the request are all made from it.
+type TranslationResult struct {
+	Tenant string   // The name of the tenant which translated the request, or empty.
+	URL    *url.URL // The request URL which was translated, after unwrapping proxies, routing, and normalizing mobile requests.
+	Rule   string   // The name of the rule which built the redirect, like record, or the name of a configured rule.
+	Branch string   // The branch of the rule, like the search type, or whether a bibID was mapped, unmapped, or invalid.
+	BibID  uint32   // The bibID requested by a record link, if it was valid.
+	Found  bool     // Whether the bibID was mapped.
+	MMSID  uint64   // The MMS ID the bibID is mapped to, if it was found.
+	Err    error    // Why the bibID was invalid, or couldn't be looked up.
+	Target *url.URL // The URL the request is redirected to.
+	Status int      // The status the redirect is sent with.
+	Canary bool     // Whether the client was chosen for the canary's Primo view.
+
+	chosen bool // Whether the request chose the Primo environment with a header.
+	record bool // Whether the rule looked up a bibID, like the record rule, or the classic rule for a record link.
+}
+
+// hasBibID reports whether the redirect was built from a valid bibID.
+func (tr TranslationResult) hasBibID() bool {
+	return tr.record && tr.Branch != "invalid"
+}
+
+// Translate returns how the request is translated, without redirecting, logging, or counting it.
+// Requests which ServeHTTP doesn't Translate, because of their method or path, are translated all the same.
+func (d Detourer) Translate(r *http.Request) TranslationResult {
+	result := TranslationResult{Tenant: d.tenant, Status: d.redirectStatus()}
+
+	// A share of clients are redirected to the canary's Primo view, so it can be compared before a full cutover.
+	result.Canary = d.canary.chooses(r)
+	if result.Canary {
+		d.canary.apply(&d)
+	}
+
+	// QA can choose the Primo sandbox or production with a header, overriding the default.
+	sandbox, chosen := useSandbox(r, d.sandbox)
+	if sandbox {
+		d.useSandboxHost()
+	}
+	result.chosen = chosen
+
+	// Translate the catalogue URL, not the proxy's.
+	r = unwrapProxiedRequest(r, d.proxyHosts)
+	// Requests under a route's prefix are translated without it, with the route's vid.
+	r, route := routeRequest(r, d.pathRoutes)
+	if route != nil && route.vid != "" {
+		d.vid = route.vid
+	}
+	// Mobile interface requests are translated like desktop requests.
+	r = normalizeMobileRequest(r)
+	result.URL = r.URL
+
+	// In the default case, redirect to the Primo search form. The first translator which matches the request
+	// claims it, and builds its redirect.
+	result.Target = d.primoURL("/discovery/search")
+	t, _ := translators.claim(d, r)
+	result.Rule = t.name
+	result = t.translate(d, r, result)
+
+	// Set the vid parameter on all redirects to Primo.
+	if result.Target.Host == d.primo {
+		detour.SetParam(result.Target, "vid", d.vid)
+		if route != nil {
+			route.setSearchDefaults(result.Target)
+		}
+	}
+	return result
+}
+
+// allowedMethods returns the request methods which are translated.
+func (d Detourer) allowedMethods() []string {
+	if len(d.methods) == 0 {
+		return defaultMethods
+	}
+	return d.methods
+}
+
+// refusal returns the status the request is answered with instead of being translated, 405 if its method isn't
+// allowed, or 404 if its path is noise, or 0 if it's translated.
+func (d Detourer) refusal(r *http.Request) int {
+	// Only translate requests which follow links, like GET and HEAD.
+	if !slices.Contains(d.allowedMethods(), r.Method) {
+		return http.StatusMethodNotAllowed
+	}
+	// Requests for icons and the like aren't catalogue links, so aren't translated or counted.
+	noisePaths := d.noisePaths
+	if len(noisePaths) == 0 {
+		noisePaths = defaultNoisePaths
+	}
+	if isNoisePath(r.URL.Path, noisePaths) {
+		return http.StatusNotFound
+	}
+	return 0
+}
@@ -0,0 +1,79 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cu-library/permanentdetour/mapping"
+)
+
+func TestTranslate(t *testing.T) {
+	metrics := NewMetrics()
+	d, err := NewDetourer(mapping.NewMap(map[uint32]uint64{651520: 996515203405158}),
+		WithPrimo("ocul-qu"),
+		WithVID("01OCUL_QU:QU_DEFAULT"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.metrics = metrics
+
+	var tests = []struct {
+		target string
+		rule   string
+		branch string
+		bibID  uint32
+		found  bool
+		mmsID  uint64
+		err    bool
+		url    string
+	}{
+		{"/vwebv/holdingsInfo?bibId=651520", "record", "mapped", 651520, true, 996515203405158, false, "https://ocul-qu.primo.exlibrisgroup.com/discovery/fulldisplay?docid=alma996515203405158&vid=01OCUL_QU%3AQU_DEFAULT"},
+		{"/vwebv/holdingsInfo?bibId=1", "record", "unmapped", 1, false, 0, false, "https://ocul-qu.primo.exlibrisgroup.com/discovery/search?vid=01OCUL_QU%3AQU_DEFAULT"},
+		{"/vwebv/holdingsInfo?bibId=x", "record", "invalid", 0, false, 0, true, "https://ocul-qu.primo.exlibrisgroup.com/discovery/search?vid=01OCUL_QU%3AQU_DEFAULT"},
+		{"/vwebv/search?searchArg=Hamlet&searchCode=TALL", "search", "TALL", 0, false, 0, false, "https://ocul-qu.primo.exlibrisgroup.com/discovery/search?query=title%2Ccontains%2CHamlet&search_scope=MyInst_and_CI&tab=Everything&vid=01OCUL_QU%3AQU_DEFAULT"},
+		{"/unknown", "default", "", 0, false, 0, false, "https://ocul-qu.primo.exlibrisgroup.com/discovery/search?vid=01OCUL_QU%3AQU_DEFAULT"},
+	}
+	for _, tt := range tests {
+		tr := d.Translate(httptest.NewRequest("GET", tt.target, nil))
+		if tr.Rule != tt.rule || tr.Branch != tt.branch {
+			t.Errorf("%v was translated by rule %v, %v, not %v, %v.", tt.target, tr.Rule, tr.Branch, tt.rule, tt.branch)
+		}
+		if tr.BibID != tt.bibID || tr.Found != tt.found || tr.MMSID != tt.mmsID || (tr.Err != nil) != tt.err {
+			t.Errorf("%v was translated with bibID %v, found %v, MMS ID %v, and error %v.", tt.target, tr.BibID, tr.Found, tr.MMSID, tr.Err)
+		}
+		if tr.Target.String() != tt.url || tr.Status != defaultRedirectStatus {
+			t.Errorf("%v was translated to %v %v, not %v %v.", tt.target, tr.Status, tr.Target, defaultRedirectStatus, tt.url)
+		}
+	}
+
+	// Translations aren't counted, only the requests which are served.
+	if metrics.unmapped.Load() != 0 || metrics.parseErrors.Load() != 0 {
+		t.Fatalf("Translate counted %v unmapped and %v invalid bibIDs, not 0.", metrics.unmapped.Load(), metrics.parseErrors.Load())
+	}
+}
+
+func TestTranslateLookupError(t *testing.T) {
+	d, err := NewDetourer(blockingStore{mapping.NewMap(map[uint32]uint64{651520: 996515203405158})},
+		WithPrimo("ocul-qu"),
+		WithVID("01OCUL_QU:QU_DEFAULT"),
+		WithLookupTimeout(10*time.Millisecond),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := d.Translate(httptest.NewRequest("GET", "/vwebv/holdingsInfo?bibId=651520", nil))
+	if tr.Branch != "lookup-error" || tr.Err == nil || tr.BibID != 651520 || tr.Found {
+		t.Fatalf("A lookup which timed out was translated to branch %v, bibID %v, found %v, and error %v.", tr.Branch, tr.BibID, tr.Found, tr.Err)
+	}
+	td := newTranslationDebug(http.MethodGet, tr)
+	if td.BibID == nil || *td.BibID != 651520 || td.Error == "" {
+		t.Fatalf("A lookup which timed out was described with bibID %v and error %q.", td.BibID, td.Error)
+	}
+}
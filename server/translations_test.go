@@ -0,0 +1,154 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/cu-library/permanentdetour/mapping"
+)
+
+// translationCase is a request for a legacy URL, and the URL it's expected to be redirected to.
+type translationCase struct {
+	line   int
+	source string
+	target string // Empty if the request isn't expected to be redirected.
+}
+
+// readTranslationCases reads the cases in a CSV file with a source,target header.
+// Lines starting with # are comments.
+func readTranslationCases(path string) ([]translationCase, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	r.Comment = '#'
+	r.FieldsPerRecord = 2
+	header, err := r.Read()
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Equal(header, []string{"source", "target"}) {
+		return nil, fmt.Errorf("The header is %v, not source,target", strings.Join(header, ","))
+	}
+	var cases []translationCase
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			return cases, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := r.FieldPos(0)
+		cases = append(cases, translationCase{line: line, source: record[0], target: record[1]})
+	}
+}
+
+// TestTranslationCases translates the legacy URLs in testdata/translations, with the mappings in
+// testdata/mappings.csv, and checks each is redirected to exactly the expected URL, query encoding and all.
+// New cases can be added to the files, or in new files, without writing Go.
+func TestTranslationCases(t *testing.T) {
+	store, err := mapping.LoadMap(filepath.Join("testdata", "mappings.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := NewDetourer(store, WithPrimo("ocul-qu"), WithVID("01OCUL_QU:QU_DEFAULT"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.logs, _ = newLogSampler(logCategories, 0)
+
+	paths, err := filepath.Glob(filepath.Join("testdata", "translations", "*.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatal("There are no translation cases in testdata/translations.")
+	}
+	for _, path := range paths {
+		cases, err := readTranslationCases(path)
+		if err != nil {
+			t.Fatalf("Could not read %v, %v.", path, err)
+		}
+		for _, tc := range cases {
+			w := httptest.NewRecorder()
+			d.ServeHTTP(w, httptest.NewRequest("GET", tc.source, nil))
+			if got := w.Header().Get("Location"); got != tc.target {
+				t.Errorf("%v:%v: %v was redirected to %q, not %q.", path, tc.line, tc.source, got, tc.target)
+			}
+		}
+	}
+}
+
+// FuzzTranslate checks ServeHTTP doesn't panic on any request target, that it only redirects to absolute URLs,
+// and that the redirect doesn't grow much more than the target, which could be escaped at most three times over.
+// It's seeded with the sources of the translation cases.
+func FuzzTranslate(f *testing.F) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "translations", "*.csv"))
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, path := range paths {
+		cases, err := readTranslationCases(path)
+		if err != nil {
+			f.Fatalf("Could not read %v, %v.", path, err)
+		}
+		for _, tc := range cases {
+			f.Add(tc.source)
+		}
+	}
+	store, err := mapping.LoadMap(filepath.Join("testdata", "mappings.csv"))
+	if err != nil {
+		f.Fatal(err)
+	}
+	d, err := NewDetourer(store, WithPrimo("ocul-qu"), WithVID("01OCUL_QU:QU_DEFAULT"))
+	if err != nil {
+		f.Fatal(err)
+	}
+	d.logs, _ = newLogSampler(logCategories, 0)
+
+	f.Fuzz(func(t *testing.T, target string) {
+		u, err := url.ParseRequestURI(target)
+		if err != nil {
+			return
+		}
+		r := httptest.NewRequest("GET", "/", nil)
+		r.URL, r.RequestURI = u, target
+		w := httptest.NewRecorder()
+		d.ServeHTTP(w, r)
+		location := w.Header().Get("Location")
+		if location == "" {
+			// Noise isn't translated, and debug requests are described instead of redirected.
+			if w.Code != http.StatusNotFound && w.Code != http.StatusOK {
+				t.Fatalf("%q responded with %v, without a redirect.", target, w.Code)
+			}
+			return
+		}
+		redirect, err := url.Parse(location)
+		if err != nil || !redirect.IsAbs() {
+			t.Fatalf("%q was redirected to %q, which isn't an absolute URL, %v.", target, location, err)
+		}
+		if len(location) > 3*len(target)+fuzzTranslateOverhead {
+			t.Fatalf("%q was redirected to %q, which is %v bytes.", target, location, len(location))
+		}
+	})
+}
+
+// fuzzTranslateOverhead is the most a redirect is expected to add to the escaped request target, for the Primo host,
+// path, and the parameters which are always set.
+const fuzzTranslateOverhead int = 256
@@ -0,0 +1,236 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"cmp"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/cu-library/permanentdetour/detour"
+)
+
+// translator translates the requests it matches. Each translator claims the requests for a kind of legacy URL,
+// like Voyager records or OpenURL context objects, and builds their redirects.
+type translator struct {
+	name     string // The name of the translator, which is the rule of the requests it claims, unless it sets another.
+	priority int    // Translators with lower priorities are checked first. Ties are checked in order of name.
+	// matches reports whether the translator claims the request.
+	matches func(d Detourer, r *http.Request) bool
+	// translate returns the result with its rule, branch, and target set for the request. The target is the
+	// Primo search form when it's called, and can be changed in place or replaced.
+	translate func(d Detourer, r *http.Request, result TranslationResult) TranslationResult
+}
+
+// translatorRegistry is a set of translators, checked in order of priority, then name, so the translator which
+// claims a request doesn't depend on the order they were registered in.
+type translatorRegistry struct {
+	translators []translator
+}
+
+// newTranslatorRegistry returns a registry of the translators. It panics if two translators have the same name,
+// as the rules of their requests couldn't be told apart.
+func newTranslatorRegistry(translators ...translator) *translatorRegistry {
+	reg := &translatorRegistry{}
+	for _, t := range translators {
+		reg.register(t)
+	}
+	return reg
+}
+
+// register adds the translator to the registry, in order. It panics if a translator with the same name was
+// registered.
+func (reg *translatorRegistry) register(t translator) {
+	if slices.ContainsFunc(reg.translators, func(r translator) bool { return r.name == t.name }) {
+		panic(fmt.Sprintf("permanentdetour: translator %q registered twice", t.name))
+	}
+	i, _ := slices.BinarySearchFunc(reg.translators, t, compareTranslators)
+	reg.translators = slices.Insert(reg.translators, i, t)
+}
+
+// compareTranslators orders translators by priority, then name.
+func compareTranslators(a, b translator) int {
+	return cmp.Or(cmp.Compare(a.priority, b.priority), strings.Compare(a.name, b.name))
+}
+
+// claim returns the first translator which matches the request, and reports whether one did.
+func (reg *translatorRegistry) claim(d Detourer, r *http.Request) (translator, bool) {
+	for _, t := range reg.translators {
+		if t.matches(d, r) {
+			return t, true
+		}
+	}
+	return translator{}, false
+}
+
+// names returns the names of the translators, in the order they're checked.
+func (reg *translatorRegistry) names() []string {
+	names := make([]string, 0, len(reg.translators))
+	for _, t := range reg.translators {
+		names = append(names, t.name)
+	}
+	return names
+}
+
+// The priorities of the built-in translators. They're spaced out so a translator can be added between two others.
+const (
+	priorityConfigured = 0 // Configured rules are checked first, so they can take over paths from the built-in rules.
+	prioritySFX        = 100
+	priorityOpenURL    = 200 // OpenURL context objects are passed along to the link resolver, whatever the path.
+	priorityRecord     = 300
+	priorityClassic    = 350
+	priorityPatron     = 400
+	prioritySearch     = 500
+	prioritySummon     = 600
+	priorityDefault    = 1000 // The default translator matches every request, so it's checked last.
+)
+
+// translators are the built-in translators.
+var translators = newTranslatorRegistry(
+	translator{
+		name:     "configured",
+		priority: priorityConfigured,
+		matches: func(d Detourer, r *http.Request) bool {
+			return matchPrefixRule(d.prefixRules, r.URL.Path) != nil
+		},
+		translate: func(d Detourer, r *http.Request, result TranslationResult) TranslationResult {
+			matched := matchPrefixRule(d.prefixRules, r.URL.Path)
+			result.Rule = matched.name
+			target := *matched.target
+			result.Target = &target
+			return result
+		},
+	},
+	translator{
+		name:     "sfx",
+		priority: prioritySFX,
+		matches: func(d Detourer, r *http.Request) bool {
+			return d.featureEnabled(featureSFX) && detour.IsSFX(r.Host, r.URL.Path)
+		},
+		translate: func(d Detourer, r *http.Request, result TranslationResult) TranslationResult {
+			detour.SFXRedirect(result.Target, r.URL.Query(), d.vid)
+			return result
+		},
+	},
+	translator{
+		name:     "openurl",
+		priority: priorityOpenURL,
+		matches: func(d Detourer, r *http.Request) bool {
+			return d.featureEnabled(featureOpenURL) && detour.IsOpenURL(r.URL.Query())
+		},
+		translate: func(d Detourer, r *http.Request, result TranslationResult) TranslationResult {
+			detour.OpenURLRedirect(result.Target, r.URL.Query(), d.vid)
+			return result
+		},
+	},
+	translator{
+		name:     "record",
+		priority: priorityRecord,
+		matches: func(d Detourer, r *http.Request) bool {
+			return strings.HasPrefix(r.URL.Path, detour.RecordPrefix)
+		},
+		translate: func(d Detourer, r *http.Request, result TranslationResult) TranslationResult {
+			return translateRecord(d, r, r.URL.Query(), result)
+		},
+	},
+	translator{
+		name:     "classic",
+		priority: priorityClassic,
+		matches: func(d Detourer, r *http.Request) bool {
+			return d.featureEnabled(featureClassic) && r.URL.Path == detour.ClassicPath
+		},
+		translate: func(d Detourer, r *http.Request, result TranslationResult) TranslationResult {
+			// Links to the classic CGI are translated like the catalogue links they're equivalent to.
+			q, record := detour.ClassicQuery(r.URL.Query())
+			if record {
+				return translateRecord(d, r, q, result)
+			}
+			result.Branch = detour.SearchRedirect(result.Target, q)
+			return result
+		},
+	},
+	translator{
+		name:     "patron",
+		priority: priorityPatron,
+		matches: func(d Detourer, r *http.Request) bool {
+			return d.featureEnabled(featurePatron) &&
+				(strings.HasPrefix(r.URL.Path, detour.PatronInfoPrefix) || strings.HasPrefix(r.URL.Path, detour.PatronInfoPrefix2))
+		},
+		translate: func(d Detourer, r *http.Request, result TranslationResult) TranslationResult {
+			result.Branch = "my"
+			if !strings.HasPrefix(r.URL.Path, detour.PatronInfoPrefix) {
+				result.Branch = "login"
+			}
+			result.Target.Path = detour.LoginPath
+			return result
+		},
+	},
+	translator{
+		name:     "search",
+		priority: prioritySearch,
+		matches: func(d Detourer, r *http.Request) bool {
+			return d.featureEnabled(featureSearch) && strings.HasPrefix(r.URL.Path, detour.SearchPrefix)
+		},
+		translate: func(d Detourer, r *http.Request, result TranslationResult) TranslationResult {
+			result.Branch = detour.SearchRedirect(result.Target, r.URL.Query())
+			return result
+		},
+	},
+	translator{
+		name:     "summon",
+		priority: prioritySummon,
+		matches: func(d Detourer, r *http.Request) bool {
+			return d.featureEnabled(featureSummon) && detour.IsSummonSearch(r.URL.Path)
+		},
+		translate: func(d Detourer, r *http.Request, result TranslationResult) TranslationResult {
+			detour.SummonRedirect(result.Target, r.URL.Query())
+			return result
+		},
+	},
+	translator{
+		name:     "default",
+		priority: priorityDefault,
+		matches: func(d Detourer, r *http.Request) bool {
+			return true
+		},
+		translate: func(d Detourer, r *http.Request, result TranslationResult) TranslationResult {
+			// Redirect to the fallback, if there is one, or leave the redirect to the search form.
+			if d.fallback != nil {
+				target := *d.fallback
+				result.Target = &target
+			}
+			return result
+		},
+	},
+)
+
+// translateRecord looks up the bibID in the query of a record request, and redirects to the record it's mapped to.
+func translateRecord(d Detourer, r *http.Request, q url.Values, result TranslationResult) TranslationResult {
+	result.record = true
+	// A lookup which doesn't finish within the budget leaves the redirect to the search form.
+	var lookupErr error
+	lookupCtx, cancel := d.lookupContext(r.Context())
+	result.BibID, result.Found, result.Err = detour.RecordRedirect(result.Target, q, func(bibID uint32) (uint64, bool) {
+		exlID, found, err := d.lookupID(lookupCtx, bibID)
+		result.MMSID, lookupErr = exlID, err
+		return exlID, found
+	})
+	cancel()
+	switch {
+	case result.Err != nil:
+		result.Branch = "invalid"
+	case lookupErr != nil:
+		result.Err = lookupErr
+		result.Branch = "lookup-error"
+	case result.Found:
+		result.Branch = "mapped"
+	default:
+		result.Branch = "unmapped"
+	}
+	return result
+}
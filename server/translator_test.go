@@ -0,0 +1,88 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"testing"
+
+	"github.com/cu-library/permanentdetour/mapping"
+)
+
+func TestTranslatorsClaim(t *testing.T) {
+	d, err := NewDetourer(mapping.NewMap(map[uint32]uint64{651520: 996515203405158}),
+		WithPrimo("ocul-qu"),
+		WithVID("01OCUL_QU:QU_DEFAULT"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	target, _ := url.Parse("https://library.queensu.ca/reserves")
+	d.prefixRules = []prefixRule{{name: "reserves", prefix: "/vwebv/enterCourseReserve.do", target: target}}
+	noSummon := d
+	err = noSummon.setFeatures(map[string]bool{featureSummon: false})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		d          Detourer
+		target     string
+		translator string
+	}{
+		{d, "/vwebv/enterCourseReserve.do?courseId=1", "configured"},
+		{d, "/sfx_local?sid=x&genre=article&atitle=Hamlet", "sfx"},
+		{d, "/vwebv/holdingsInfo?url_ver=Z39.88-2004&rft.atitle=Hamlet", "openurl"},
+		{d, "/vwebv/holdingsInfo?bibId=651520", "record"},
+		{d, "/cgi-bin/Pwebrecon.cgi?BBID=651520", "classic"},
+		{d, "/cgi-bin/Pwebrecon.cgi?DB=local&Search_Arg=Hamlet&Search_Code=TALL", "classic"},
+		{d, "/vwebv/myAccount", "patron"},
+		{d, "/vwebv/login", "patron"},
+		{d, "/vwebv/search?searchArg=Hamlet&searchCode=TALL", "search"},
+		{d, "/search?s.q=Hamlet", "summon"},
+		{d, "/search/results?s.q=Hamlet", "summon"},
+		{d, "/searchable?s.q=Hamlet", "default"},
+		{d, "/", "default"},
+		// A translator whose feature is off doesn't claim requests, so they're left to the next.
+		{noSummon, "/search?s.q=Hamlet", "default"},
+	}
+	for _, tt := range tests {
+		claimed, ok := translators.claim(tt.d, httptest.NewRequest("GET", tt.target, nil))
+		if !ok || claimed.name != tt.translator {
+			t.Errorf("%v was claimed by translator %q, not %q.", tt.target, claimed.name, tt.translator)
+		}
+	}
+}
+
+func TestTranslatorRegistryOrder(t *testing.T) {
+	matchAll := func(d Detourer, r *http.Request) bool { return true }
+	ts := []translator{
+		{name: "b", priority: 10, matches: matchAll},
+		{name: "c", priority: 5, matches: matchAll},
+		{name: "a", priority: 10, matches: matchAll},
+	}
+	// The order translators are checked in doesn't depend on the order they were registered in.
+	for range 3 {
+		reg := newTranslatorRegistry(ts...)
+		if !slices.Equal(reg.names(), []string{"c", "a", "b"}) {
+			t.Fatalf("Translators registered as %v were checked in the order %v, not c, a, b.", ts, reg.names())
+		}
+		claimed, _ := reg.claim(Detourer{}, httptest.NewRequest("GET", "/", nil))
+		if claimed.name != "c" {
+			t.Fatalf("The request was claimed by translator %q, not c.", claimed.name)
+		}
+		ts = append(ts[1:], ts[0])
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("Registering two translators with the same name didn't panic.")
+		}
+	}()
+	newTranslatorRegistry(ts[0], ts[0])
+}
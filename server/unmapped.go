@@ -0,0 +1,337 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"cmp"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// unmappedPath is the path of the admin endpoint which lists requested bibIDs which aren't mapped.
+	unmappedPath string = "/admin/unmapped"
+
+	// defaultUnmappedLimit is the default maximum number of unmapped bibIDs which are tracked.
+	defaultUnmappedLimit int = 100000
+
+	// defaultUnmappedSaveInterval is the default time between saves of the unmapped bibIDs.
+	defaultUnmappedSaveInterval time.Duration = 5 * time.Minute
+
+	// unmappedReportPath is the path of the admin endpoint which lists the most requested unmapped bibIDs, with the
+	// pages which linked to them.
+	unmappedReportPath string = "/admin/unmapped/report"
+
+	// defaultUnmappedReportLimit is the default number of bibIDs listed by the report endpoint.
+	defaultUnmappedReportLimit int = 50
+
+	// unmappedReferrerLimit is the number of referrers tracked for each unmapped bibID.
+	unmappedReferrerLimit int = 5
+
+	// unmappedReferrerLength is the longest referrer tracked. Longer referrers are cut off.
+	unmappedReferrerLength int = 512
+
+	// unmappedReferrerBytes is the most bytes of referrers tracked across all bibIDs. New referrers aren't tracked
+	// once it's reached.
+	unmappedReferrerBytes int = 4 << 20
+)
+
+// unmappedCSVHeader is the first line of the CSV export and saved file.
+var unmappedCSVHeader = []string{"bibId", "count", "firstSeen", "lastSeen"}
+
+// unmappedEntry records the requests for a bibID which isn't mapped.
+type unmappedEntry struct {
+	BibID     uint32    `json:"bibId"`
+	Count     uint64    `json:"count"`
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+	// The pages which linked to the bibID, most requests first. Only the first referrers of each bibID are tracked,
+	// and they aren't saved to the -unmapped-file.
+	Referrers []unmappedReferrer `json:"referrers,omitempty"`
+}
+
+// unmappedReferrer is a page which linked to an unmapped bibID, and the number of requests which followed the link.
+type unmappedReferrer struct {
+	Referrer string `json:"referrer"`
+	Count    uint64 `json:"count"`
+}
+
+// unmappedReport is the body of the JSON export of the unmapped bibIDs.
+type unmappedReport struct {
+	Dropped  uint64          `json:"dropped"`
+	Unmapped []unmappedEntry `json:"unmapped"`
+}
+
+// unmappedTopReport is the body of the report of the most requested unmapped bibIDs.
+type unmappedTopReport struct {
+	Dropped  uint64          `json:"dropped"`
+	Tracked  int             `json:"tracked"` // The number of unmapped bibIDs tracked, listed or not.
+	Unmapped []unmappedEntry `json:"unmapped"`
+}
+
+// unmappedTracker counts requests for bibIDs which aren't mapped, so missing mappings can be found.
+// A nil *unmappedTracker discards everything.
+type unmappedTracker struct {
+	limit int // The maximum number of bibIDs tracked, so a crawler can't exhaust memory.
+
+	mu            sync.Mutex
+	entries       map[uint32]*unmappedEntry
+	referrers     map[uint32]map[string]uint64 // The requests for each bibID by referrer, for those with referrers.
+	referrerBytes int                          // The total length of the tracked referrers.
+	dropped       uint64                       // Requests for bibIDs which weren't tracked because the limit was reached.
+}
+
+// newUnmappedTracker returns an empty unmappedTracker which tracks up to limit bibIDs.
+func newUnmappedTracker(limit int) *unmappedTracker {
+	return &unmappedTracker{limit: limit, entries: map[uint32]*unmappedEntry{}, referrers: map[uint32]map[string]uint64{}}
+}
+
+// record counts a request for an unmapped bibID at time t, from the referrer, which can be empty.
+func (u *unmappedTracker) record(bibID uint32, referrer string, t time.Time) {
+	if u == nil {
+		return
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	e, present := u.entries[bibID]
+	if !present {
+		if len(u.entries) >= u.limit {
+			u.dropped++
+			return
+		}
+		e = &unmappedEntry{BibID: bibID, FirstSeen: t}
+		u.entries[bibID] = e
+	}
+	e.Count++
+	e.LastSeen = t
+	if referrer != "" {
+		u.recordReferrer(bibID, referrer)
+	}
+}
+
+// recordReferrer counts a request for the bibID from the referrer. New referrers of a bibID which already has
+// unmappedReferrerLimit, or once unmappedReferrerBytes of referrers are tracked, aren't counted, so bibIDs linked
+// from many pages can't exhaust memory. The caller must hold u.mu.
+func (u *unmappedTracker) recordReferrer(bibID uint32, referrer string) {
+	referrer = trimReferrer(referrer)
+	if referrer == "" {
+		return
+	}
+	counts := u.referrers[bibID]
+	if _, present := counts[referrer]; present {
+		counts[referrer]++
+		return
+	}
+	if len(counts) >= unmappedReferrerLimit || u.referrerBytes+len(referrer) > unmappedReferrerBytes {
+		return
+	}
+	if counts == nil {
+		counts = map[string]uint64{}
+		u.referrers[bibID] = counts
+	}
+	counts[referrer] = 1
+	u.referrerBytes += len(referrer)
+}
+
+// trimReferrer returns the referrer without its query or fragment, which can hold another site's search terms or
+// session IDs, cut off at unmappedReferrerLength bytes without splitting a character.
+func trimReferrer(referrer string) string {
+	if i := strings.IndexAny(referrer, "?#"); i != -1 {
+		referrer = referrer[:i]
+	}
+	if len(referrer) <= unmappedReferrerLength {
+		return referrer
+	}
+	end := unmappedReferrerLength
+	for end > 0 && !utf8.RuneStart(referrer[end]) {
+		end--
+	}
+	return referrer[:end]
+}
+
+// report returns the tracked bibIDs, most requested first.
+func (u *unmappedTracker) report() unmappedReport {
+	u.mu.Lock()
+	report := unmappedReport{Dropped: u.dropped, Unmapped: make([]unmappedEntry, 0, len(u.entries))}
+	for bibID, e := range u.entries {
+		entry := *e
+		for referrer, count := range u.referrers[bibID] {
+			entry.Referrers = append(entry.Referrers, unmappedReferrer{Referrer: referrer, Count: count})
+		}
+		slices.SortFunc(entry.Referrers, func(a, b unmappedReferrer) int {
+			return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(a.Referrer, b.Referrer))
+		})
+		report.Unmapped = append(report.Unmapped, entry)
+	}
+	u.mu.Unlock()
+	slices.SortFunc(report.Unmapped, func(a, b unmappedEntry) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(a.BibID, b.BibID))
+	})
+	return report
+}
+
+// serveUnmapped responds with the tracked bibIDs as JSON, or as CSV when the format parameter is csv.
+func (u *unmappedTracker) serveUnmapped(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	report := u.report()
+	if r.URL.Query().Get("format") != "csv" {
+		writeJSON(w, http.StatusOK, report)
+		return
+	}
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="unmapped.csv"`)
+	err := writeUnmappedCSV(w, report.Unmapped)
+	if err != nil {
+		slog.Error("Error writing CSV response.", "err", err)
+	}
+}
+
+// serveUnmappedReport responds with the most requested unmapped bibIDs as JSON, with the pages which linked to them,
+// so a linking page, like a research guide, can be fixed instead of only the mappings. The limit parameter sets the
+// number of bibIDs listed, defaultUnmappedReportLimit by default.
+func (u *unmappedTracker) serveUnmappedReport(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	limit := defaultUnmappedReportLimit
+	if param := r.URL.Query().Get("limit"); param != "" {
+		var err error
+		limit, err = strconv.Atoi(param)
+		if err != nil || limit < 1 {
+			writeJSON(w, http.StatusBadRequest, apiError{Error: "The limit must be a positive number."})
+			return
+		}
+	}
+	report := u.report()
+	writeJSON(w, http.StatusOK, unmappedTopReport{
+		Dropped:  report.Dropped,
+		Tracked:  len(report.Unmapped),
+		Unmapped: report.Unmapped[:min(limit, len(report.Unmapped))],
+	})
+}
+
+// writeUnmappedCSV writes the entries as CSV, with a header line.
+func writeUnmappedCSV(w io.Writer, entries []unmappedEntry) error {
+	cw := csv.NewWriter(w)
+	cw.Write(unmappedCSVHeader)
+	for _, e := range entries {
+		cw.Write([]string{
+			strconv.FormatUint(uint64(e.BibID), 10),
+			strconv.FormatUint(e.Count, 10),
+			e.FirstSeen.UTC().Format(time.RFC3339),
+			e.LastSeen.UTC().Format(time.RFC3339),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// save writes the tracked bibIDs to the file at path as CSV, replacing it atomically.
+func (u *unmappedTracker) save(path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("Could not create unmapped bibIDs file %v, %w", path, err)
+	}
+	defer os.Remove(tmp.Name())
+	err = writeUnmappedCSV(tmp, u.report().Unmapped)
+	if err != nil {
+		tmp.Close()
+		return fmt.Errorf("Could not write unmapped bibIDs file %v, %w", path, err)
+	}
+	err = tmp.Close()
+	if err != nil {
+		return fmt.Errorf("Could not write unmapped bibIDs file %v, %w", path, err)
+	}
+	err = os.Rename(tmp.Name(), path)
+	if err != nil {
+		return fmt.Errorf("Could not write unmapped bibIDs file %v, %w", path, err)
+	}
+	return nil
+}
+
+// load adds the bibIDs saved in the file at path to the tracker. A missing file is not an error.
+func (u *unmappedTracker) load(path string) error {
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Could not open unmapped bibIDs file %v, %w", path, err)
+	}
+	defer file.Close()
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		return fmt.Errorf("Could not read unmapped bibIDs file %v, %w", path, err)
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for i, record := range records {
+		if i == 0 && slices.Equal(record, unmappedCSVHeader) {
+			continue
+		}
+		e, err := parseUnmappedRecord(record)
+		if err != nil {
+			return fmt.Errorf("Invalid line %v in unmapped bibIDs file %v, %w", i+1, path, err)
+		}
+		if len(u.entries) < u.limit {
+			u.entries[e.BibID] = &e
+		}
+	}
+	return nil
+}
+
+// parseUnmappedRecord parses a line of the saved unmapped bibIDs file.
+func parseUnmappedRecord(record []string) (unmappedEntry, error) {
+	var e unmappedEntry
+	if len(record) != len(unmappedCSVHeader) {
+		return e, fmt.Errorf("%v fields expected, %v found", len(unmappedCSVHeader), len(record))
+	}
+	bibID, err := strconv.ParseUint(record[0], 10, 32)
+	if err != nil {
+		return e, err
+	}
+	e.BibID = uint32(bibID)
+	e.Count, err = strconv.ParseUint(record[1], 10, 64)
+	if err != nil {
+		return e, err
+	}
+	e.FirstSeen, err = time.Parse(time.RFC3339, record[2])
+	if err != nil {
+		return e, err
+	}
+	e.LastSeen, err = time.Parse(time.RFC3339, record[3])
+	if err != nil {
+		return e, err
+	}
+	return e, nil
+}
+
+// saveEvery saves the tracked bibIDs to the file at path each interval, until stop is closed.
+func (u *unmappedTracker) saveEvery(path string, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			err := u.save(path)
+			if err != nil {
+				slog.Error("Could not save unmapped bibIDs.", "err", err)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,204 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestUnmappedTracker(t *testing.T) {
+	u := newUnmappedTracker(2)
+	first := time.Date(2019, 10, 10, 13, 55, 36, 0, time.UTC)
+	last := first.Add(time.Hour)
+	u.record(651520, "", first)
+	u.record(123, "", first)
+	u.record(123, "", last)
+	// The limit has been reached, so this bibID isn't tracked.
+	u.record(999, "", last)
+
+	expected := unmappedReport{
+		Dropped: 1,
+		Unmapped: []unmappedEntry{
+			{BibID: 123, Count: 2, FirstSeen: first, LastSeen: last},
+			{BibID: 651520, Count: 1, FirstSeen: first, LastSeen: first},
+		},
+	}
+	report := u.report()
+	if !reflect.DeepEqual(report, expected) {
+		t.Fatalf("report() returned %+v, not %+v.", report, expected)
+	}
+
+	var nilTracker *unmappedTracker
+	nilTracker.record(651520, "", first)
+}
+
+func TestUnmappedTrackerReferrers(t *testing.T) {
+	u := newUnmappedTracker(defaultUnmappedLimit)
+	seen := time.Date(2019, 10, 10, 13, 55, 36, 0, time.UTC)
+	guide := "https://guides.library.queensu.ca/hamlet"
+	u.record(651520, guide, seen)
+	u.record(651520, guide, seen)
+	u.record(651520, "", seen)
+	for i := range unmappedReferrerLimit {
+		u.record(651520, fmt.Sprintf("https://example.com/%v", i), seen)
+	}
+	// The bibID already has the most referrers tracked, so a new referrer isn't, though its request is counted.
+	u.record(651520, "https://example.com/new", seen)
+	u.record(651520, guide, seen)
+	u.record(651521, strings.Repeat("x", unmappedReferrerLength+1), seen)
+
+	report := u.report()
+	referrers := report.Unmapped[0].Referrers
+	if report.Unmapped[0].Count != 10 || len(referrers) != unmappedReferrerLimit {
+		t.Fatalf("report() returned %+v.", report.Unmapped[0])
+	}
+	if referrers[0] != (unmappedReferrer{Referrer: guide, Count: 3}) || referrers[1] != (unmappedReferrer{Referrer: "https://example.com/0", Count: 1}) {
+		t.Fatalf("report() returned the referrers %+v, not the guide's first.", referrers)
+	}
+	if len(report.Unmapped[1].Referrers[0].Referrer) != unmappedReferrerLength {
+		t.Fatalf("A long referrer was tracked with %v characters, not %v.", len(report.Unmapped[1].Referrers[0].Referrer), unmappedReferrerLength)
+	}
+}
+
+func TestTrimReferrer(t *testing.T) {
+	long := "https://guides.library.queensu.ca/x" + strings.Repeat("é", unmappedReferrerLength)
+	var tests = []struct {
+		referrer string
+		expected string
+	}{
+		{"https://guides.library.queensu.ca/hamlet", "https://guides.library.queensu.ca/hamlet"},
+		{"https://www.google.com/search?q=hamlet&sessionid=1234", "https://www.google.com/search"},
+		{"https://guides.library.queensu.ca/hamlet#holdings", "https://guides.library.queensu.ca/hamlet"},
+		{"?q=hamlet", ""},
+		// Long referrers are cut off before a character which would be split.
+		{long, long[:unmappedReferrerLength-1]},
+		{long + "?q=hamlet", long[:unmappedReferrerLength-1]},
+	}
+	for _, tt := range tests {
+		trimmed := trimReferrer(tt.referrer)
+		if trimmed != tt.expected {
+			t.Errorf("trimReferrer(%q) returned %q, not %q.", tt.referrer, trimmed, tt.expected)
+		}
+		if !utf8.ValidString(trimmed) {
+			t.Errorf("trimReferrer(%q) returned invalid UTF-8 %q.", tt.referrer, trimmed)
+		}
+	}
+}
+
+func TestUnmappedTrackerReferrerBytes(t *testing.T) {
+	u := newUnmappedTracker(defaultUnmappedLimit)
+	seen := time.Date(2019, 10, 10, 13, 55, 36, 0, time.UTC)
+	referrer := func(i int) string {
+		return fmt.Sprintf("https://guides.library.queensu.ca/%0*d", unmappedReferrerLength-len("https://guides.library.queensu.ca/"), i)
+	}
+	fit := unmappedReferrerBytes / unmappedReferrerLength
+	for i := range fit {
+		u.record(uint32(i), referrer(i), seen)
+	}
+	// Once the referrers take up the most bytes tracked, new referrers aren't tracked, but known ones are counted.
+	u.record(uint32(fit), referrer(fit), seen)
+	u.record(0, referrer(0), seen)
+
+	report := u.report()
+	if len(report.Unmapped) != fit+1 {
+		t.Fatalf("report() returned %v bibIDs, not %v.", len(report.Unmapped), fit+1)
+	}
+	for _, e := range report.Unmapped {
+		switch {
+		case e.BibID == 0 && (len(e.Referrers) != 1 || e.Referrers[0].Count != 2):
+			t.Fatalf("The known referrer of bibID 0 wasn't counted, %+v.", e.Referrers)
+		case e.BibID == uint32(fit) && len(e.Referrers) != 0:
+			t.Fatalf("A referrer past the most bytes tracked was tracked, %+v.", e.Referrers)
+		}
+	}
+}
+
+func TestServeUnmappedReport(t *testing.T) {
+	u := newUnmappedTracker(defaultUnmappedLimit)
+	seen := time.Date(2019, 10, 10, 13, 55, 36, 0, time.UTC)
+	u.record(651520, "https://guides.library.queensu.ca/hamlet", seen)
+	u.record(651520, "https://guides.library.queensu.ca/hamlet", seen)
+	u.record(123, "", seen)
+
+	var tests = []struct {
+		target   string
+		status   int
+		expected string
+	}{
+		{unmappedReportPath, http.StatusOK, `{"dropped":0,"tracked":2,"unmapped":[{"bibId":651520,"count":2,"firstSeen":"2019-10-10T13:55:36Z","lastSeen":"2019-10-10T13:55:36Z","referrers":[{"referrer":"https://guides.library.queensu.ca/hamlet","count":2}]},{"bibId":123,"count":1,"firstSeen":"2019-10-10T13:55:36Z","lastSeen":"2019-10-10T13:55:36Z"}]}`},
+		{unmappedReportPath + "?limit=1", http.StatusOK, `{"dropped":0,"tracked":2,"unmapped":[{"bibId":651520,"count":2,"firstSeen":"2019-10-10T13:55:36Z","lastSeen":"2019-10-10T13:55:36Z","referrers":[{"referrer":"https://guides.library.queensu.ca/hamlet","count":2}]}]}`},
+		{unmappedReportPath + "?limit=0", http.StatusBadRequest, `{"error":"The limit must be a positive number."}`},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		u.serveUnmappedReport(w, httptest.NewRequest("GET", tt.target, nil))
+		if w.Code != tt.status || strings.TrimSpace(w.Body.String()) != tt.expected {
+			t.Errorf("%v responded with %v %v, not %v %v.", tt.target, w.Code, w.Body.String(), tt.status, tt.expected)
+		}
+	}
+}
+
+func TestServeUnmapped(t *testing.T) {
+	u := newUnmappedTracker(defaultUnmappedLimit)
+	seen := time.Date(2019, 10, 10, 13, 55, 36, 0, time.UTC)
+	u.record(651520, "", seen)
+
+	w := httptest.NewRecorder()
+	u.serveUnmapped(w, httptest.NewRequest("GET", unmappedPath, nil))
+	var report unmappedReport
+	err := json.Unmarshal(w.Body.Bytes(), &report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Unmapped) != 1 || report.Unmapped[0].BibID != 651520 {
+		t.Fatalf("The JSON export was %v.", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	u.serveUnmapped(w, httptest.NewRequest("GET", unmappedPath+"?format=csv", nil))
+	expected := "bibId,count,firstSeen,lastSeen\n651520,1,2019-10-10T13:55:36Z,2019-10-10T13:55:36Z\n"
+	if w.Body.String() != expected {
+		t.Fatalf("The CSV export was %q, not %q.", w.Body.String(), expected)
+	}
+	if w.Header().Get("Content-Type") != "text/csv; charset=utf-8" {
+		t.Fatalf("The CSV export had a Content-Type of %q.", w.Header().Get("Content-Type"))
+	}
+}
+
+func TestUnmappedSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "unmapped.csv")
+	seen := time.Date(2019, 10, 10, 13, 55, 36, 0, time.UTC)
+
+	// A missing file is not an error, as nothing has been saved yet.
+	u := newUnmappedTracker(defaultUnmappedLimit)
+	err := u.load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.record(651520, "", seen)
+	u.record(651520, "", seen)
+	err = u.save(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := newUnmappedTracker(defaultUnmappedLimit)
+	err = loaded.load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded.report(), u.report()) {
+		t.Fatalf("Loaded %+v, not the saved %+v.", loaded.report(), u.report())
+	}
+}
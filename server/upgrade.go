@@ -0,0 +1,174 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// upgradeListenersVariable is the environment variable which names the listeners passed to an upgraded process.
+// The listeners are passed as file descriptors starting at 3, in order, followed by the readiness pipe.
+const upgradeListenersVariable string = "PERMANENTDETOUR_UPGRADE_LISTENERS"
+
+// namedListener is a listener and the name of what it serves, like http or admin.
+type namedListener struct {
+	name string
+	net.Listener
+}
+
+// upgrader hands the process's listeners to a new process on upgrade, so a new binary can start
+// serving without refusing connections. Listeners should be bound with listen, so they can be passed on.
+type upgrader struct {
+	mu        sync.Mutex
+	inherited []namedListener // Listeners passed from the previous process, which haven't been used yet.
+	listeners []namedListener // Listeners to pass to the next process.
+	parent    *os.File        // The pipe used to tell the previous process this one is ready, or nil.
+}
+
+// newUpgrader returns an upgrader with the listeners passed from the previous process, if this process was started by an upgrade.
+func newUpgrader() (*upgrader, error) {
+	u := &upgrader{}
+	names := os.Getenv(upgradeListenersVariable)
+	if names == "" {
+		return u, nil
+	}
+	// The next upgrade sets its own list of listeners.
+	os.Unsetenv(upgradeListenersVariable)
+
+	fd := listenFDsStart
+	for _, name := range strings.Split(names, ",") {
+		f := os.NewFile(uintptr(fd), name)
+		l, err := net.FileListener(f)
+		// FileListener duplicates the file descriptor.
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("Could not use file descriptor %v from the previous process as a listener, %w", fd, err)
+		}
+		u.inherited = append(u.inherited, namedListener{name, l})
+		fd++
+	}
+	u.parent = os.NewFile(uintptr(fd), "upgrade")
+	return u, nil
+}
+
+// take returns the listeners with the name which were passed from the previous process, and records them to pass on.
+func (u *upgrader) take(name string) []net.Listener {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	var taken []net.Listener
+	remaining := u.inherited[:0]
+	for _, nl := range u.inherited {
+		if nl.name == name {
+			taken = append(taken, nl.Listener)
+			u.listeners = append(u.listeners, nl)
+		} else {
+			remaining = append(remaining, nl)
+		}
+	}
+	u.inherited = remaining
+	return taken
+}
+
+// add records listeners bound elsewhere, like those from systemd, to pass on.
+func (u *upgrader) add(name string, listeners ...net.Listener) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for _, l := range listeners {
+		u.listeners = append(u.listeners, namedListener{name, l})
+	}
+}
+
+// listen returns the listener with the name passed from the previous process, or binds a new one on the address.
+func (u *upgrader) listen(name, addr string) (net.Listener, error) {
+	taken := u.take(name)
+	if len(taken) > 0 {
+		return taken[0], nil
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	u.add(name, l)
+	return l, nil
+}
+
+// ready tells the previous process that this one is serving, so it can shut down.
+// Any passed listeners which weren't used are closed.
+func (u *upgrader) ready() error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for _, nl := range u.inherited {
+		nl.Close()
+	}
+	u.inherited = nil
+	if u.parent == nil {
+		return nil
+	}
+	_, err := u.parent.Write([]byte{1})
+	u.parent.Close()
+	u.parent = nil
+	return err
+}
+
+// upgrade starts a new process from the executable, with the same arguments and environment, and passes it the listeners.
+// It returns once the new process is ready, or returns an error if it exits before it is ready.
+func (u *upgrader) upgrade() error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("Could not find the executable, %w", err)
+	}
+
+	u.mu.Lock()
+	names := make([]string, 0, len(u.listeners))
+	files := make([]*os.File, 0, len(u.listeners)+1)
+	for _, nl := range u.listeners {
+		filer, ok := nl.Listener.(interface{ File() (*os.File, error) })
+		if !ok {
+			u.mu.Unlock()
+			return fmt.Errorf("The %v listener on %v can't be passed to another process", nl.name, nl.Addr())
+		}
+		f, err := filer.File()
+		if err != nil {
+			u.mu.Unlock()
+			return fmt.Errorf("Could not get the file of the %v listener on %v, %w", nl.name, nl.Addr(), err)
+		}
+		defer f.Close()
+		names = append(names, nl.name)
+		files = append(files, f)
+	}
+	u.mu.Unlock()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("Could not create the readiness pipe, %w", err)
+	}
+	defer r.Close()
+
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), fmt.Sprintf("%v=%v", upgradeListenersVariable, strings.Join(names, ",")))
+	cmd.ExtraFiles = append(files, w)
+	err = cmd.Start()
+	// The new process has its own copy of the write end, so a failed process closes the pipe.
+	w.Close()
+	if err != nil {
+		return fmt.Errorf("Could not start %v, %w", exe, err)
+	}
+	go cmd.Wait()
+
+	_, err = r.Read(make([]byte, 1))
+	if err != nil {
+		return errors.New("The new process exited before it was ready")
+	}
+	return nil
+}
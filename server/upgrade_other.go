@@ -0,0 +1,12 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+//go:build !unix
+
+package server
+
+import "os"
+
+// upgradeSignals are the signals which start an upgrade. Upgrades need SIGUSR2, so aren't supported here.
+var upgradeSignals []os.Signal
@@ -0,0 +1,79 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"net"
+	"os"
+	"testing"
+)
+
+func TestUpgraderListen(t *testing.T) {
+	inherited, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := &upgrader{inherited: []namedListener{{"admin", inherited}}}
+
+	l, err := u.listen("admin", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l != inherited {
+		t.Fatal("listen() didn't return the inherited admin listener.")
+	}
+	l, err = u.listen("grpc", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if l == inherited {
+		t.Fatal("listen() returned the inherited admin listener for grpc.")
+	}
+	if len(u.inherited) != 0 {
+		t.Fatalf("%v inherited listeners weren't used, not 0.", len(u.inherited))
+	}
+	if len(u.listeners) != 2 {
+		t.Fatalf("%v listeners would be passed on upgrade, not 2.", len(u.listeners))
+	}
+}
+
+func TestUpgraderReady(t *testing.T) {
+	unused, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	u := &upgrader{inherited: []namedListener{{"acme-http", unused}}, parent: w}
+
+	err = u.ready()
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := r.Read(make([]byte, 1))
+	if n != 1 || err != nil {
+		t.Fatalf("The previous process wasn't told this one is ready, %v.", err)
+	}
+	// The unused listener should have been closed.
+	_, err = unused.Accept()
+	if err == nil {
+		t.Fatal("The unused inherited listener wasn't closed.")
+	}
+}
+
+func TestNewUpgraderNotUpgraded(t *testing.T) {
+	t.Setenv(upgradeListenersVariable, "")
+	u, err := newUpgrader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(u.inherited) != 0 || u.parent != nil {
+		t.Fatal("newUpgrader() returned inherited listeners when not upgraded.")
+	}
+}
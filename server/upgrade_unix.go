@@ -0,0 +1,15 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+//go:build unix
+
+package server
+
+import (
+	"os"
+	"syscall"
+)
+
+// upgradeSignals are the signals which start an upgrade.
+var upgradeSignals = []os.Signal{syscall.SIGUSR2}
@@ -0,0 +1,111 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultPrimoCheckTimeout is the default time allowed for a Primo reachability check.
+	defaultPrimoCheckTimeout time.Duration = 10 * time.Second
+
+	// primoCheckFailures is the number of consecutive failed checks before Primo is reported unreachable
+	// to readiness probes, so a single slow response doesn't take every instance out of a load balancer.
+	primoCheckFailures int = 3
+)
+
+// upstreamCheck periodically checks that Primo is reachable at the configured subdomain and vid,
+// so a typo in either is noticed before patrons report broken redirects.
+type upstreamCheck struct {
+	url     string
+	client  *http.Client
+	metrics *Metrics
+
+	mu       sync.Mutex
+	err      error // The error from the last check, or nil if it passed.
+	failures int   // Consecutive failed checks.
+	checked  time.Time
+}
+
+// newUpstreamCheck returns an upstreamCheck of the Primo search page for the vid.
+func newUpstreamCheck(search *url.URL, vid string, timeout time.Duration, metrics *Metrics) *upstreamCheck {
+	u := *search
+	u.RawQuery = url.Values{"vid": {vid}}.Encode()
+	return &upstreamCheck{url: u.String(), client: &http.Client{Timeout: timeout}, metrics: metrics}
+}
+
+// check sends a HEAD request to Primo and records the result.
+func (c *upstreamCheck) check(ctx context.Context) error {
+	start := time.Now()
+	err := c.head(ctx)
+	duration := time.Since(start)
+	c.metrics.observePrimoCheck(err == nil, duration)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err != nil {
+		c.failures++
+		if c.err == nil {
+			slog.Warn("Primo is unreachable.", "url", c.url, "err", err)
+		}
+	} else if c.err != nil {
+		slog.Info("Primo is reachable again.", "url", c.url, "duration", duration)
+	}
+	if err == nil {
+		c.failures = 0
+	}
+	c.err = err
+	c.checked = start
+	return err
+}
+
+// head sends the HEAD request, and returns an error if it fails or the response isn't successful.
+func (c *upstreamCheck) head(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, c.url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "permanentdetour/"+version)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("%v responded with %v", c.url, resp.Status)
+	}
+	return nil
+}
+
+// ready is a readiness check which fails once Primo has been unreachable for primoCheckFailures checks in a row.
+func (c *upstreamCheck) ready() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.failures >= primoCheckFailures {
+		return fmt.Errorf("primo unreachable for %v checks, %w", c.failures, c.err)
+	}
+	return nil
+}
+
+// checkEvery checks Primo immediately, then each interval, until stop is closed.
+func (c *upstreamCheck) checkEvery(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		c.check(context.Background())
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
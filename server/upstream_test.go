@@ -0,0 +1,69 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestNewUpstreamCheck(t *testing.T) {
+	search := &url.URL{Scheme: "https", Host: "ocul-qu.primo.exlibrisgroup.com", Path: "/discovery/search"}
+	c := newUpstreamCheck(search, "01OCUL_QU:QU_DEFAULT", defaultPrimoCheckTimeout, nil)
+	expected := "https://ocul-qu.primo.exlibrisgroup.com/discovery/search?vid=01OCUL_QU%3AQU_DEFAULT"
+	if c.url != expected {
+		t.Fatalf("The check URL was %v, not %v.", c.url, expected)
+	}
+}
+
+func TestUpstreamCheck(t *testing.T) {
+	var status atomic.Int64
+	status.Store(http.StatusOK)
+	primo := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead {
+			t.Errorf("The check sent a %v request, not HEAD.", r.Method)
+		}
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer primo.Close()
+	m := NewMetrics()
+	c := &upstreamCheck{url: primo.URL + "/discovery/search?vid=01OCUL_QU%3AQU_DEFAULT", client: primo.Client(), metrics: m}
+
+	err := c.check(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.primoUp.Load() != 1 {
+		t.Fatalf("primo_up was %v, not 1.", m.primoUp.Load())
+	}
+
+	status.Store(http.StatusNotFound)
+	for i := 1; i <= primoCheckFailures; i++ {
+		if c.check(context.Background()) == nil {
+			t.Fatal("A check of a missing page passed.")
+		}
+		err = c.ready()
+		if i < primoCheckFailures && err != nil {
+			t.Fatalf("Readiness failed after %v failed checks.", i)
+		}
+	}
+	if err == nil || !strings.Contains(err.Error(), "404") {
+		t.Fatalf("Readiness after %v failed checks was %v.", primoCheckFailures, err)
+	}
+	if m.primoUp.Load() != 0 {
+		t.Fatalf("primo_up was %v, not 0.", m.primoUp.Load())
+	}
+
+	status.Store(http.StatusOK)
+	c.check(context.Background())
+	if c.ready() != nil {
+		t.Fatal("Readiness still failed once Primo was reachable again.")
+	}
+}
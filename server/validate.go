@@ -0,0 +1,201 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/cu-library/permanentdetour/mapping"
+)
+
+const (
+	// validateCommand is the subcommand which validates mapping files, like those handed off by a vendor.
+	validateCommand string = "validate"
+
+	// mmsidPrefix is the prefix of Alma MMS IDs.
+	mmsidPrefix string = "99"
+
+	// mmsidMinLength and mmsidMaxLength are the shortest and longest Alma MMS IDs, in digits.
+	mmsidMinLength int = 8
+	mmsidMaxLength int = 19
+
+	// mmsidInstitutionLength is the length of the institution code at the end of Alma MMS IDs.
+	mmsidInstitutionLength int = 4
+)
+
+// mappingStats are the summary statistics of validated mapping files.
+type mappingStats struct {
+	files        int
+	lines        int
+	mappings     int
+	malformed    int
+	duplicates   int
+	suspicious   int
+	minBibID     uint32
+	maxBibID     uint32
+	institutions map[string]*institutionCount // The MMS IDs by their institution code.
+}
+
+// institutionCount is the number of MMS IDs with an institution code, and where the first was found.
+type institutionCount struct {
+	count int
+	first string
+}
+
+// runValidate validates the mapping files at paths, reporting every problem found and summary statistics to w.
+// It returns the exit status, 1 if any problem was found, or 2 if no files were given.
+func runValidate(w io.Writer, paths []string) int {
+	if len(paths) == 0 {
+		fmt.Fprintf(w, "Usage: permanentdetour %v file...\n", validateCommand)
+		return 2
+	}
+	stats := mappingStats{files: len(paths), institutions: map[string]*institutionCount{}}
+	seen := map[uint32]mappingLocation{}
+	var problems []string
+	for i := range paths {
+		problems = append(problems, validateMappingFile(&stats, seen, paths, i)...)
+	}
+	// MMS IDs from another institution are usually from the wrong export.
+	institution := stats.institution()
+	for _, code := range slices.Sorted(maps.Keys(stats.institutions)) {
+		if code == institution {
+			continue
+		}
+		ic := stats.institutions[code]
+		stats.suspicious += ic.count
+		problems = append(problems, fmt.Sprintf("%v MMS IDs end with the institution code %v, not %v, the first at %v", ic.count, code, institution, ic.first))
+	}
+
+	for _, problem := range problems {
+		fmt.Fprintln(w, problem)
+	}
+	stats.write(w)
+	if len(problems) > 0 {
+		fmt.Fprintf(w, "%v problems found.\n", len(problems))
+		return 1
+	}
+	fmt.Fprintln(w, "No problems found.")
+	return 0
+}
+
+// validateMappingFile adds the mappings in the file paths[index] to seen and stats, and returns its problems,
+// up to checkFileProblemLimit.
+func validateMappingFile(stats *mappingStats, seen map[uint32]mappingLocation, paths []string, index int) []string {
+	path := paths[index]
+	file, err := os.Open(path)
+	if err != nil {
+		return []string{fmt.Sprintf("%v: Could not open mapping file, %v", path, err)}
+	}
+	defer file.Close()
+
+	var problems []string
+	omitted := 0
+	report := func(format string, args ...any) {
+		if len(problems) >= checkFileProblemLimit {
+			omitted++
+			return
+		}
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+	scanner := bufio.NewScanner(file)
+	lnum := 0
+	for scanner.Scan() {
+		lnum++
+		stats.lines++
+		bibID, exlID, err := mapping.ParseLine(scanner.Text())
+		if err != nil {
+			stats.malformed++
+			report("%v:%v: Unable to process line '%v', %v", path, lnum, scanner.Text(), err)
+			continue
+		}
+		previous, present := seen[bibID]
+		if present {
+			stats.duplicates++
+			report("%v:%v: Bib ID %v was previously seen at %v", path, lnum, bibID, previous.format(paths))
+			continue
+		}
+		seen[bibID] = mappingLocation{file: index, line: lnum}
+		stats.add(bibID)
+		err = checkMMSID(exlID)
+		if err != nil {
+			stats.suspicious++
+			report("%v:%v: Suspicious MMS ID %v, %v", path, lnum, exlID, err)
+			continue
+		}
+		code := strconv.FormatUint(exlID, 10)
+		code = code[len(code)-mmsidInstitutionLength:]
+		ic, present := stats.institutions[code]
+		if !present {
+			ic = &institutionCount{first: fmt.Sprintf("%v:%v", path, lnum)}
+			stats.institutions[code] = ic
+		}
+		ic.count++
+	}
+	err = scanner.Err()
+	if err != nil {
+		report("%v: Scanner error after line %v, %v", path, lnum, err)
+	}
+	if omitted > 0 {
+		problems = append(problems, fmt.Sprintf("%v: %v more problems were not listed", path, omitted))
+	}
+	return problems
+}
+
+// checkMMSID returns an error if the ID doesn't look like an Alma MMS ID.
+func checkMMSID(exlID uint64) error {
+	s := strconv.FormatUint(exlID, 10)
+	if !strings.HasPrefix(s, mmsidPrefix) {
+		return fmt.Errorf("it doesn't start with %v", mmsidPrefix)
+	}
+	if len(s) < mmsidMinLength || len(s) > mmsidMaxLength {
+		return fmt.Errorf("it has %v digits, not %v to %v", len(s), mmsidMinLength, mmsidMaxLength)
+	}
+	return nil
+}
+
+// add counts a mapping of the bibID.
+func (s *mappingStats) add(bibID uint32) {
+	if s.mappings == 0 || bibID < s.minBibID {
+		s.minBibID = bibID
+	}
+	if s.mappings == 0 || bibID > s.maxBibID {
+		s.maxBibID = bibID
+	}
+	s.mappings++
+}
+
+// institution returns the most common institution code of the MMS IDs, or empty if there are none.
+func (s *mappingStats) institution() string {
+	institution := ""
+	for _, code := range slices.Sorted(maps.Keys(s.institutions)) {
+		if institution == "" || s.institutions[code].count > s.institutions[institution].count {
+			institution = code
+		}
+	}
+	return institution
+}
+
+// write writes the statistics to w.
+func (s *mappingStats) write(w io.Writer) {
+	fmt.Fprintf(w, "Files:              %v\n", s.files)
+	fmt.Fprintf(w, "Lines:              %v\n", s.lines)
+	fmt.Fprintf(w, "Mappings:           %v\n", s.mappings)
+	fmt.Fprintf(w, "Malformed lines:    %v\n", s.malformed)
+	fmt.Fprintf(w, "Duplicate bibIDs:   %v\n", s.duplicates)
+	fmt.Fprintf(w, "Suspicious MMS IDs: %v\n", s.suspicious)
+	if s.mappings > 0 {
+		fmt.Fprintf(w, "BibIDs:             %v to %v\n", s.minBibID, s.maxBibID)
+	}
+	if institution := s.institution(); institution != "" {
+		fmt.Fprintf(w, "Institution code:   %v\n", institution)
+	}
+}
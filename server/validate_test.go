@@ -0,0 +1,112 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunValidate(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		err := os.WriteFile(path, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	valid := write("valid.csv", "996515203405158,a651520-01ocul_qu\n996515213405158,a651521-01ocul_qu\n")
+	invalid := write("invalid.csv", "996515223405158,a651522-01ocul_qu\nnot a mapping\n996515203405159,a651520-01ocul_qu\n123,a651523-01ocul_qu\n996515243405158,a651524-01ocul_qu\n996515253405170,a651525-01ocul_qu\n")
+
+	var tests = []struct {
+		name   string
+		paths  []string
+		status int
+		output []string
+	}{
+		{
+			"valid",
+			[]string{valid},
+			0,
+			[]string{
+				"Files:              1",
+				"Lines:              2",
+				"Mappings:           2",
+				"Malformed lines:    0",
+				"Duplicate bibIDs:   0",
+				"Suspicious MMS IDs: 0",
+				"BibIDs:             651520 to 651521",
+				"Institution code:   5158",
+				"No problems found.",
+			},
+		},
+		{
+			"every problem",
+			[]string{valid, invalid},
+			1,
+			[]string{
+				invalid + ":2: Unable to process line 'not a mapping'",
+				invalid + ":3: Bib ID 651520 was previously seen at " + valid + ":1",
+				invalid + ":4: Suspicious MMS ID 123, it doesn't start with 99",
+				"1 MMS IDs end with the institution code 5170, not 5158, the first at " + invalid + ":6",
+				"Files:              2",
+				"Lines:              8",
+				"Mappings:           6",
+				"Malformed lines:    1",
+				"Duplicate bibIDs:   1",
+				"Suspicious MMS IDs: 2",
+				"BibIDs:             651520 to 651525",
+				"Institution code:   5158",
+				"4 problems found.",
+			},
+		},
+		{
+			"no files",
+			nil,
+			2,
+			[]string{"Usage: permanentdetour validate file..."},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			status := runValidate(&out, tt.paths)
+			if status != tt.status {
+				t.Fatalf("runValidate() returned %v, not %v. Output:\n%v", status, tt.status, out.String())
+			}
+			lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+			if len(lines) != len(tt.output) {
+				t.Fatalf("The output had %v lines, not %v. Output:\n%v", len(lines), len(tt.output), out.String())
+			}
+			for i, expected := range tt.output {
+				if !strings.HasPrefix(lines[i], expected) {
+					t.Fatalf("Line %v of the output didn't start with %q. Output:\n%v", i+1, expected, out.String())
+				}
+			}
+		})
+	}
+}
+
+func TestCheckMMSID(t *testing.T) {
+	var tests = []struct {
+		exlID uint64
+		err   bool
+	}{
+		{996515203405158, false},
+		{99123456, false},
+		{9912345, true},
+		{886515203405158, true},
+	}
+	for _, tt := range tests {
+		err := checkMMSID(tt.exlID)
+		if (err != nil) != tt.err {
+			t.Errorf("checkMMSID(%v) returned %v.", tt.exlID, err)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// verifyCommand is the subcommand which requests the redirect targets of a sample of the mappings.
+	verifyCommand string = "verify"
+
+	// defaultVerifySample is the default number of mappings verified.
+	defaultVerifySample int = 1000
+
+	// verifyConcurrency is the number of mappings verified at once, kept low so Primo and Alma aren't overwhelmed.
+	verifyConcurrency int = 4
+)
+
+// verifier requests the redirect targets of mappings, and searches Alma for their records.
+type verifier struct {
+	client *http.Client
+	sru    *url.URL // The Alma SRU endpoint.
+}
+
+// sruResponse is the part of an SRU searchRetrieve response which is checked.
+type sruResponse struct {
+	NumberOfRecords int `xml:"numberOfRecords"`
+}
+
+// verification is the result of verifying a mapping.
+type verification struct {
+	bibID   uint32
+	exlID   uint64
+	target  string
+	problem string // Empty if the mapping was verified.
+}
+
+// runVerify verifies a random sample of the mappings, reporting each problem found and a summary to w.
+// The permalinks are requested from Primo, and the MMS IDs are searched for in Alma with SRU, at sruTarget,
+// or the default endpoint of the Primo instance if it's empty. It returns the exit status,
+// 1 if any problem was found, or 2 if the arguments are invalid.
+func runVerify(w io.Writer, s translateSettings, sample int, sruTarget string, timeout time.Duration) int {
+	if sample < 1 {
+		fmt.Fprintf(w, "Usage: permanentdetour %v [-sample n] [flag...] [file...]\n", verifyCommand)
+		return 2
+	}
+	rt, err := newTranslationRouter(s)
+	if err != nil {
+		fmt.Fprintln(w, err)
+		return 1
+	}
+	v := verifier{client: &http.Client{Timeout: timeout}}
+	switch {
+	case sruTarget == "" && s.primo == "":
+		fmt.Fprintln(w, "Set -sru-target to the Alma SRU endpoint, as the Primo subdomain isn't set with -primo")
+		return 2
+	case sruTarget == "":
+		v.sru = almaSRUURL(s.primo, rt.def.vid)
+	default:
+		v.sru, err = url.Parse(sruTarget)
+		if err != nil {
+			fmt.Fprintf(w, "Could not parse SRU target %v, %v\n", sruTarget, err)
+			return 1
+		}
+	}
+	bibIDs, err := rt.def.sortedBibIDs()
+	if err != nil {
+		fmt.Fprintln(w, err)
+		return 1
+	}
+	bibIDs = sampleBibIDs(bibIDs, sample)
+	results := v.verifyAll(context.Background(), rt.def, bibIDs)
+	problems := 0
+	for _, result := range results {
+		if result.problem == "" {
+			continue
+		}
+		problems++
+		fmt.Fprintf(w, "Bib ID %v, MMS ID %v: %v, %v\n", result.bibID, result.exlID, result.problem, result.target)
+	}
+	fmt.Fprintf(w, "Verified %v of %v mappings, %v problems found.\n", len(results), rt.def.store.Len(), problems)
+	if problems > 0 {
+		return 1
+	}
+	return 0
+}
+
+// sampleBibIDs returns up to n of the bibIDs, which are in order, chosen at random, in order.
+func sampleBibIDs(bibIDs []uint32, n int) []uint32 {
+	if n < len(bibIDs) {
+		rand.Shuffle(len(bibIDs), func(i, j int) {
+			bibIDs[i], bibIDs[j] = bibIDs[j], bibIDs[i]
+		})
+		bibIDs = bibIDs[:n]
+		slices.Sort(bibIDs)
+	}
+	return bibIDs
+}
+
+// verifyAll verifies the mappings of the bibIDs in d, verifyConcurrency at a time, and returns the results
+// in the same order.
+func (v verifier) verifyAll(ctx context.Context, d Detourer, bibIDs []uint32) []verification {
+	results := make([]verification, len(bibIDs))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for range verifyConcurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				results[i] = v.verify(ctx, d, bibIDs[i])
+			}
+		}()
+	}
+	for i := range bibIDs {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return results
+}
+
+// verify requests the permalink of the bibID's mapping, and searches Alma for the record.
+// Primo responds to permalinks of records which don't exist like any other, so only Alma can tell they're missing.
+func (v verifier) verify(ctx context.Context, d Detourer, bibID uint32) verification {
+	exlID, _ := d.store.Lookup(bibID)
+	result := verification{bibID: bibID, exlID: exlID, target: d.recordURL(exlID).String()}
+	status, _, err := v.get(ctx, result.target)
+	switch {
+	case err != nil:
+		result.problem = fmt.Sprintf("Could not request the permalink, %v", err)
+		return result
+	case status != http.StatusOK:
+		result.problem = fmt.Sprintf("The permalink responded with %v %v", status, http.StatusText(status))
+		return result
+	}
+
+	q := url.Values{}
+	q.Set("version", almaSRUVersion)
+	q.Set("operation", "searchRetrieve")
+	q.Set("query", "alma.mms_id="+strconv.FormatUint(exlID, 10))
+	q.Set("maximumRecords", "1")
+	search := *v.sru
+	search.RawQuery = q.Encode()
+	status, body, err := v.get(ctx, search.String())
+	if err == nil && status != http.StatusOK {
+		err = fmt.Errorf("responded with %v %v", status, http.StatusText(status))
+	}
+	var response sruResponse
+	if err == nil {
+		err = xml.Unmarshal(body, &response)
+	}
+	switch {
+	case err != nil:
+		result.problem = fmt.Sprintf("Could not search Alma for the record, %v", err)
+	case response.NumberOfRecords == 0:
+		result.problem = "The record was not found in Alma"
+	}
+	return result
+}
+
+// get sends a GET request for the URL, and returns the response status and body.
+func (v verifier) get(ctx context.Context, u string) (int, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("User-Agent", "permanentdetour/"+version)
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	return resp.StatusCode, body, err
+}
@@ -0,0 +1,89 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunVerify(t *testing.T) {
+	// The server is both Primo and Alma's SRU endpoint. The record 996515223405158 was deleted from Alma,
+	// and Primo is failing for 996515233405158.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/discovery/fulldisplay":
+			if r.URL.Query().Get("docid") == "alma996515233405158" {
+				http.Error(w, "Oops", http.StatusInternalServerError)
+				return
+			}
+			fmt.Fprint(w, "<html></html>")
+		case "/view/sru/01OCUL_QU":
+			records := 1
+			if r.URL.Query().Get("query") == "alma.mms_id=996515223405158" {
+				records = 0
+			}
+			fmt.Fprintf(w, `<searchRetrieveResponse xmlns="http://www.loc.gov/zing/srw/"><version>1.2</version><numberOfRecords>%v</numberOfRecords></searchRetrieveResponse>`, records)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	mappings := filepath.Join(dir, "mappings.csv")
+	err := os.WriteFile(mappings, []byte("996515203405158,a651520-01ocul_qu\n996515223405158,a651522-01ocul_qu\n996515233405158,a651523-01ocul_qu\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings := translateSettings{primoHost: server.URL, vid: "01OCUL_QU:QU_DEFAULT", mappingFiles: []string{mappings}}
+
+	var out strings.Builder
+	status := runVerify(&out, settings, 10, server.URL+"/view/sru/01OCUL_QU", time.Second)
+	if status != 1 {
+		t.Fatalf("runVerify() returned %v, not 1. Output:\n%v", status, out.String())
+	}
+	expected := []string{
+		"Bib ID 651522, MMS ID 996515223405158: The record was not found in Alma, " + server.URL + "/discovery/fulldisplay?docid=alma996515223405158&vid=01OCUL_QU%3AQU_DEFAULT",
+		"Bib ID 651523, MMS ID 996515233405158: The permalink responded with 500 Internal Server Error, " + server.URL + "/discovery/fulldisplay?docid=alma996515233405158&vid=01OCUL_QU%3AQU_DEFAULT",
+		"Verified 3 of 3 mappings, 2 problems found.",
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if !slices.Equal(lines, expected) {
+		t.Fatalf("The output was\n%v\nnot\n%v", strings.Join(lines, "\n"), strings.Join(expected, "\n"))
+	}
+
+	out.Reset()
+	status = runVerify(&out, settings, 0, server.URL+"/view/sru/01OCUL_QU", time.Second)
+	if status != 2 {
+		t.Fatalf("runVerify() with a sample of 0 returned %v, not 2.", status)
+	}
+	status = runVerify(&out, settings, 10, "", time.Second)
+	if status != 2 {
+		t.Fatalf("runVerify() without a Primo subdomain or SRU target returned %v, not 2.", status)
+	}
+}
+
+func TestSampleBibIDs(t *testing.T) {
+	var bibIDs []uint32
+	for bibID := range uint32(100) {
+		bibIDs = append(bibIDs, bibID)
+	}
+	sample := sampleBibIDs(bibIDs, 10)
+	if len(sample) != 10 || !slices.IsSorted(sample) || len(slices.Compact(slices.Clone(sample))) != 10 {
+		t.Fatalf("The sample was %v, not 10 different bibIDs in order.", sample)
+	}
+	sample = sampleBibIDs(bibIDs, 1000)
+	if len(sample) != 100 {
+		t.Fatalf("The sample larger than the mappings had %v bibIDs, not 100.", len(sample))
+	}
+}
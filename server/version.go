@@ -0,0 +1,98 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+)
+
+// versionPath is the path of the version endpoint.
+const versionPath string = "/version"
+
+// versionInfo describes the running binary, as returned by the version endpoint.
+type versionInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"buildDate"`
+	Modified  bool   `json:"modified"` // Whether the binary was built from a checkout with uncommitted changes.
+	GoVersion string `json:"goVersion"`
+	OS        string `json:"os"`
+	Arch      string `json:"arch"`
+}
+
+// buildInfo returns the version information set with ldflags, or embedded by the Go toolchain, and the Go runtime information.
+func buildInfo() versionInfo {
+	return versionInfo{
+		Version:   version,
+		Commit:    commit,
+		BuildDate: date,
+		Modified:  modified,
+		GoVersion: runtime.Version(),
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+	}
+}
+
+// resolveBuild returns the version, commit, and build date of the Build, and whether the binary was built with
+// uncommitted changes. Those which weren't set with ldflags are taken from info, the module and version control
+// information embedded by the Go toolchain, so binaries built with go install, or go build in a checkout,
+// still report their version or commit. info may be nil.
+func resolveBuild(b Build, info *debug.BuildInfo) (string, string, string, bool) {
+	v, c, d := b.Version, b.Commit, b.Date
+	if info == nil {
+		return v, c, d, false
+	}
+	// Binaries built outside of a module, or from a checkout without a tag, have the version (devel).
+	if (v == "" || v == "devel") && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		v = info.Main.Version
+	}
+	modified := false
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			if c == "" || c == "unknown" {
+				c = setting.Value
+			}
+		case "vcs.time":
+			if d == "" || d == "unknown" {
+				d = setting.Value
+			}
+		case "vcs.modified":
+			modified = setting.Value == "true"
+		}
+	}
+	return v, c, d, modified
+}
+
+// readBuildInfo returns the build information embedded by the Go toolchain, or nil if there isn't any.
+func readBuildInfo() *debug.BuildInfo {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return nil
+	}
+	return info
+}
+
+// writeVersion writes the build information to w, for -version.
+func writeVersion(w io.Writer) {
+	info := buildInfo()
+	fmt.Fprintf(w, "permanentdetour %v\n", info.Version)
+	if info.Modified {
+		fmt.Fprintf(w, "Commit:  %v, with uncommitted changes\n", info.Commit)
+	} else {
+		fmt.Fprintf(w, "Commit:  %v\n", info.Commit)
+	}
+	fmt.Fprintf(w, "Built:   %v\n", info.BuildDate)
+	fmt.Fprintf(w, "Go:      %v %v/%v\n", info.GoVersion, info.OS, info.Arch)
+}
+
+// serveVersion responds with the build information as JSON.
+func serveVersion(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, buildInfo())
+}
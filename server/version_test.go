@@ -0,0 +1,66 @@
+// Copyright 2019 Carleton University Library All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"testing"
+)
+
+func TestServeVersion(t *testing.T) {
+	w := httptest.NewRecorder()
+	serveVersion(w, httptest.NewRequest("GET", "/version", nil))
+	var info versionInfo
+	err := json.NewDecoder(w.Body).Decode(&info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Version != version || info.Commit != commit || info.BuildDate != date || info.Modified != modified || info.GoVersion != runtime.Version() {
+		t.Fatalf("serveVersion returned %+v", info)
+	}
+}
+
+func TestResolveBuild(t *testing.T) {
+	embedded := &debug.BuildInfo{
+		Main: debug.Module{Path: "github.com/cu-library/permanentdetour", Version: "v1.2.0"},
+		Settings: []debug.BuildSetting{
+			{Key: "vcs.revision", Value: "0123456789abcdef"},
+			{Key: "vcs.time", Value: "2024-05-01T12:00:00Z"},
+			{Key: "vcs.modified", Value: "true"},
+		},
+	}
+	var tests = []struct {
+		name     string
+		build    Build
+		info     *debug.BuildInfo
+		version  string
+		commit   string
+		date     string
+		modified bool
+	}{
+		{"ldflags", Build{Version: "1.3.0", Commit: "fedcba", Date: "2024-06-01"}, embedded, "1.3.0", "fedcba", "2024-06-01", true},
+		{"go install", Build{Version: "devel", Commit: "unknown", Date: "unknown"}, embedded, "v1.2.0", "0123456789abcdef", "2024-05-01T12:00:00Z", true},
+		{"checkout", Build{Version: "devel", Commit: "unknown", Date: "unknown"}, &debug.BuildInfo{Main: debug.Module{Version: "(devel)"}}, "devel", "unknown", "unknown", false},
+		{"no build info", Build{Version: "devel", Commit: "unknown", Date: "unknown"}, nil, "devel", "unknown", "unknown", false},
+	}
+	for _, tt := range tests {
+		v, c, d, m := resolveBuild(tt.build, tt.info)
+		if v != tt.version || c != tt.commit || d != tt.date || m != tt.modified {
+			t.Errorf("With %v, resolveBuild returned %v, %v, %v, %v, not %v, %v, %v, %v.", tt.name, v, c, d, m, tt.version, tt.commit, tt.date, tt.modified)
+		}
+	}
+}
+
+func TestWriteVersion(t *testing.T) {
+	var out strings.Builder
+	writeVersion(&out)
+	if !strings.HasPrefix(out.String(), "permanentdetour "+version+"\n") || !strings.Contains(out.String(), runtime.Version()) {
+		t.Fatalf("writeVersion wrote %q.", out.String())
+	}
+}